@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/joho/godotenv"
@@ -19,11 +20,14 @@ var (
 
 // Config contains application configuration variables
 type Config struct {
+	dbdriver    string
+	dbpath      string
 	dbusername  string
 	dbpassword  string
 	dbhost      string
 	dbport      string
 	dbname      string
+	dbmigrate   bool
 	imgurbearer string
 	servermode  string
 	serverport  string
@@ -31,6 +35,16 @@ type Config struct {
 	version     string
 	environment	string
 	devAuthBypass bool
+	revisionMaxCount   int64
+	revisionMaxAgeDays int64
+	mediastore    string
+	mediapath     string
+	s3endpoint    string
+	s3bucket      string
+	s3region      string
+	s3accesskey   string
+	s3secretkey   string
+	mediaquotamb  int64
 }
 
 // NewConfiguration retrieves config from OS / file
@@ -55,11 +69,14 @@ func NewConfiguration() (*Config, error) {
 	}
 
 	config := &Config{
+		dbdriver:    os.Getenv("DB_DRIVER"),
+		dbpath:      os.Getenv("DB_PATH"),
 		dbusername:  os.Getenv("DB_USERNAME"),
 		dbpassword:  os.Getenv("DB_PASSWORD"),
 		dbhost:      os.Getenv("DB_HOST"),
 		dbport:      os.Getenv("DB_PORT"),
 		dbname:      os.Getenv("DB_NAME"),
+		dbmigrate:   isTruthy(os.Getenv("DB_MIGRATE")),
 		imgurbearer: os.Getenv("IMGUR_BEARER"),
 		servermode:  os.Getenv("SERVER_MODE"),
 		serverport:  os.Getenv("SERVER_PORT"),
@@ -67,6 +84,26 @@ func NewConfiguration() (*Config, error) {
 		version:     buildnumber,
 		environment: serverrunner,
 		devAuthBypass: isTruthy(os.Getenv("DEV_AUTH_BYPASS")),
+		revisionMaxCount:   parseInt(os.Getenv("REVISION_MAX_COUNT"), 100),
+		revisionMaxAgeDays: parseInt(os.Getenv("REVISION_MAX_AGE_DAYS"), 0),
+		mediastore:    os.Getenv("MEDIA_STORE"),
+		mediapath:     os.Getenv("MEDIA_PATH"),
+		s3endpoint:    os.Getenv("S3_ENDPOINT"),
+		s3bucket:      os.Getenv("S3_BUCKET"),
+		s3region:      os.Getenv("S3_REGION"),
+		s3accesskey:   os.Getenv("S3_ACCESS_KEY_ID"),
+		s3secretkey:   os.Getenv("S3_SECRET_ACCESS_KEY"),
+		mediaquotamb:  parseInt(os.Getenv("MEDIA_QUOTA_MB"), 500),
+	}
+
+	// SQLite keeps the database in a single file next to the binary by default
+	if config.dbpath == "" {
+		config.dbpath = "projektps.db"
+	}
+
+	// Uploaded files are kept in upload/ unless MEDIA_STORE=s3
+	if config.mediapath == "" {
+		config.mediapath = "upload"
 	}
 
 	if len(serverrunner) > 0 {
@@ -85,3 +122,12 @@ func isTruthy(val string) bool {
 		return false
 	}
 }
+
+// parseInt parses an integer config value, falling back to def if unset or invalid
+func parseInt(val string, def int64) int64 {
+	i, err := strconv.ParseInt(strings.TrimSpace(val), 10, 64)
+	if err != nil {
+		return def
+	}
+	return i
+}
@@ -6,9 +6,14 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"time"
 
+	"projektps/database"
 	"projektps/router"
 	"projektps/services/imagebank"
+	storepkg "projektps/store"
+	"projektps/store/filestore"
+	"projektps/store/s3store"
 	"projektps/store/sqlstore"
 )
 
@@ -22,18 +27,44 @@ func main() {
 		log.Fatal("Error while retrieving configuration:", err)
 	}
 
-	// Create storage
-	store, err := sqlstore.NewStore(config.dbusername, config.dbpassword, config.dbhost, config.dbport, config.dbname)
+	// Create storage, MySQL unless DB_DRIVER=sqlite
+	var store *sqlstore.SQLStore
+	if config.dbdriver == "sqlite" {
+		store, err = sqlstore.NewSQLiteStore(config.dbpath)
+	} else {
+		store, err = sqlstore.NewStore(config.dbusername, config.dbpassword, config.dbhost, config.dbport, config.dbname)
+	}
 	if err != nil {
 		log.Fatal("Error while connecting to database:", err)
 	}
 
+	// Apply pending migrations if DB_MIGRATE is set, SQLite applies them
+	// when it is opened
+	if config.dbmigrate && config.dbdriver != "sqlite" {
+		migrate(store)
+	}
+
+	// Limit how many adventure revisions are kept (0 = unlimited)
+	store.SetRevisionRetention(storepkg.RevisionRetention{
+		MaxCount: config.revisionMaxCount,
+		MaxAge:   time.Duration(config.revisionMaxAgeDays) * 24 * time.Hour,
+	})
+
 	// Start Imagebank synchronization job (runs every hour)
 	if false && config.environment == "" {
 		imagebank.Initialize(store)
 	}
+	// Create the store of uploaded files
+	media, err := newMediaStore(config)
+	if err != nil {
+		log.Fatal("Error while creating media store:", err)
+	}
+
+	// The files uploaded to an adventure may take up at most this much
+	mediaQuota := config.mediaquotamb << 20
+
 	// Create router
-	router := router.NewRouter(store, config.version, config.imgurbearer, config.environment, config.devAuthBypass)
+	router := router.NewRouter(store, media, config.version, config.imgurbearer, config.environment, config.devAuthBypass, mediaQuota)
 
 	// Start server
 	if config.servermode == "socket" {
@@ -43,6 +74,41 @@ func main() {
 	}
 }
 
+// newMediaStore creates the store of uploaded files, a folder or, with
+// MEDIA_STORE=s3, a bucket
+func newMediaStore(config *Config) (storepkg.MediaStore, error) {
+	if config.mediastore != "s3" {
+		return filestore.NewFileStore(config.mediapath, "/upload/"), nil
+	}
+
+	fmt.Println("[media] Using bucket", config.s3bucket, "at", config.s3endpoint)
+	return s3store.NewS3Store(s3store.Config{
+		Endpoint: config.s3endpoint,
+		Bucket:   config.s3bucket,
+		Credentials: s3store.Credentials{
+			AccessKeyID:     config.s3accesskey,
+			SecretAccessKey: config.s3secretkey,
+			Region:          config.s3region,
+		},
+	})
+}
+
+// migrate applies the pending migrations or stops the server
+func migrate(store *sqlstore.SQLStore) {
+	migrations, err := sqlstore.LoadMigrations(database.Migrations, "migrations")
+	if err != nil {
+		log.Fatal("Error while loading migrations:", err)
+	}
+
+	applied, err := store.MigrateUp(migrations, 0)
+	for _, migration := range applied {
+		fmt.Println("[migrate] Applied", migration)
+	}
+	if err != nil {
+		log.Fatal("Error while migrating database:", err)
+	}
+}
+
 // Run starts a web server at the specified addr/port
 func Run(router *router.Router, addr string) {
 	fmt.Println("[server] Started at port:", addr)
@@ -2,11 +2,22 @@ package main
 
 import (
 	"fmt"
-	"net/http"
+	"io/ioutil"
 	"os"
+	"path"
+	"strconv"
+	"strings"
 
 	"projektps/controllers/api"
+	"projektps/database"
+	"projektps/models"
+	"projektps/services/backup"
+	"projektps/services/scorm"
+	"projektps/services/twine"
+	"projektps/services/validation"
 	"projektps/store"
+	"projektps/store/filestore"
+	"projektps/store/s3store"
 	"projektps/store/sqlstore"
 
 	"github.com/joho/godotenv"
@@ -15,8 +26,17 @@ import (
 func main() {
 	args := os.Args
 
-	if len(args) <= 1 {
-		fmt.Printf("Usage: %s import/export <file>/<slug>\n", args[0])
+	if len(args) <= 2 {
+		fmt.Printf("Usage: %s import/export/lint <file>/<slug>\n", args[0])
+		fmt.Printf("       %s import <story.twee/story.html>\n", args[0])
+		fmt.Printf("       %s export <slug> zip/twee/html/ink\n", args[0])
+		fmt.Printf("       %s export <slug> scorm12/scorm2004 [completion percent]\n", args[0])
+		fmt.Printf("       %s migrate status/up [n]/down [n]/baseline [version]\n", args[0])
+		fmt.Printf("       %s backup <backup.zip> [base backup.zip]\n", args[0])
+		fmt.Printf("       %s restore <backup.zip> [incremental backup.zip ...]\n", args[0])
+		fmt.Printf("       %s verify <backup.zip>\n", args[0])
+		fmt.Printf("       %s media gc [-n]\n", args[0])
+		fmt.Printf("       %s media reprocess\n", args[0])
 		return
 	}
 
@@ -37,7 +57,17 @@ func main() {
 	fmt.Println(dbuser, dbpass, dbhost, dbport, dbname)
 
 	// Create storage
-	dbstore, err := sqlstore.NewStore(dbuser, dbpass, dbhost, dbport, dbname)
+	var dbstore *sqlstore.SQLStore
+	var err error
+	if os.Getenv("DB_DRIVER") == "sqlite" {
+		dbpath := os.Getenv("DB_PATH")
+		if dbpath == "" {
+			dbpath = "projektps.db"
+		}
+		dbstore, err = sqlstore.NewSQLiteStore(dbpath)
+	} else {
+		dbstore, err = sqlstore.NewStore(dbuser, dbpass, dbhost, dbport, dbname)
+	}
 	if err != nil {
 		fmt.Println("Error while connecting to database: ", err)
 		return
@@ -45,9 +75,14 @@ func main() {
 
 	var store = storeConvert(dbstore)
 
-	api := api.NewAPIController(&store, "1.0", "/upload/")
+	media, err := newMediaStore()
+	if err != nil {
+		fmt.Println("Error while creating media store: ", err)
+		return
+	}
+
+	api := api.NewAPIController(&store, media, "1.0", "/upload/", false, api.DefaultMediaQuota)
 
-	var request http.Request
 	if args[1] == "import" {
 		file, err := os.Open(args[2])
 		if err != nil {
@@ -57,17 +92,483 @@ func main() {
 
 		fmt.Println("Using file: " + args[2])
 
-		request.Body = file
-		api.ImportAdventure(nil, &request)
+		if ext := strings.ToLower(path.Ext(args[2])); ext == ".twee" || ext == ".tw" || ext == ".html" {
+			file.Close()
+			if !importTwine(api, args[2]) {
+				os.Exit(1)
+			}
+			return
+		}
+
+		ok := importArchive(api, file)
+		file.Close()
+		if !ok {
+			os.Exit(1)
+		}
 	} else if args[1] == "export" {
-		path, err := api.CreateExportZip(args[2])
+		if len(args) > 3 && args[3] == "ink" {
+			if !exportInk(api, args[2]) {
+				os.Exit(1)
+			}
+			return
+		}
+		if len(args) > 3 && strings.HasPrefix(args[3], "scorm") {
+			if !exportScorm(api, args[2], args[3], args[4:]) {
+				os.Exit(1)
+			}
+			return
+		}
+		if len(args) > 3 && args[3] != "zip" {
+			if !exportTwine(api, args[2], twine.Format(args[3])) {
+				os.Exit(1)
+			}
+			return
+		}
+
+		name, err := api.CreateExportZip(args[2])
 		if err !=nil {
 			fmt.Println(err.Error())
 		}
-		fmt.Println("File saved: " + path)
+		fmt.Println("File saved to the media store: " + name)
+	} else if args[1] == "lint" {
+		if !lintAdventure(store, args[2]) {
+			os.Exit(1)
+		}
+	} else if args[1] == "backup" {
+		if !backupDatabase(dbstore, media, args[2], args[3:]) {
+			os.Exit(1)
+		}
+	} else if args[1] == "restore" {
+		if !restoreDatabase(dbstore, media, args[2:]) {
+			os.Exit(1)
+		}
+	} else if args[1] == "verify" {
+		if _, ok := openBackup(args[2], true); !ok {
+			os.Exit(1)
+		}
+	} else if args[1] == "media" && args[2] == "gc" {
+		if !collectMedia(api, len(args) > 3 && args[3] == "-n") {
+			os.Exit(1)
+		}
+	} else if args[1] == "media" && args[2] == "reprocess" {
+		if !reprocessMedia(api) {
+			os.Exit(1)
+		}
+	} else if args[1] == "migrate" {
+		if !migrate(dbstore, args[2:]) {
+			os.Exit(1)
+		}
+	}
+}
+
+// migrate runs a migrate command and returns false if it failed
+func migrate(dbstore *sqlstore.SQLStore, args []string) bool {
+	migrations, err := sqlstore.LoadMigrations(database.Migrations, "migrations")
+	if err != nil {
+		fmt.Println("Error while loading migrations:", err)
+		return false
+	}
+
+	// Optional count or version after the command
+	var number int64
+	if len(args) > 1 {
+		number, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil || number < 0 {
+			fmt.Println("Invalid number: " + args[1])
+			return false
+		}
+	}
+
+	var done []sqlstore.Migration
+	switch args[0] {
+	case "status":
+		statuses, err := dbstore.MigrationStatus(migrations)
+		if err != nil {
+			fmt.Println("Error while reading migrations:", err)
+			return false
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Missing {
+				state = "missing"
+			} else if status.Modified {
+				state = "modified"
+			} else if status.Applied {
+				state = "applied"
+			}
+			appliedAt := ""
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-9s %-40s %s\n", state, status.Migration, appliedAt)
+		}
+		return true
+	case "up":
+		done, err = dbstore.MigrateUp(migrations, int(number))
+		for _, migration := range done {
+			fmt.Println("Applied", migration)
+		}
+	case "down":
+		if number == 0 {
+			number = 1
+		}
+		done, err = dbstore.MigrateDown(migrations, int(number))
+		for _, migration := range done {
+			fmt.Println("Reverted", migration)
+		}
+	case "baseline":
+		if len(args) == 1 && len(migrations) > 0 {
+			number = migrations[len(migrations)-1].Version
+		}
+		done, err = dbstore.BaselineMigrations(migrations, number)
+		for _, migration := range done {
+			fmt.Println("Recorded", migration)
+		}
+	default:
+		fmt.Println("Unknown migrate command: " + args[0])
+		return false
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	if len(done) == 0 {
+		fmt.Println("Nothing to do")
+	}
+	return true
+}
+
+// importArchive creates an adventure from an exported zip and prints the
+// import report
+func importArchive(api *api.API, file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		fmt.Println(err.Error())
+		return false
+	}
+
+	report, err := api.ImportArchive(file, info.Size(), 0)
+	for _, imported := range report.Files {
+		fmt.Println("FILE", imported.Name, imported.ContentType, imported.Size)
+	}
+	for _, issue := range report.Skipped {
+		fmt.Println("SKIPPED", issue.Name, issue.Message)
+	}
+	for _, issue := range report.Warnings {
+		fmt.Println("WARNING", issue.Name, issue.Message)
+	}
+	for _, issue := range report.Errors {
+		fmt.Println("ERROR", issue.Code, issue.Name, issue.Message)
+	}
+	if err != nil || !report.Valid() {
+		fmt.Println("Import failed")
+		return false
+	}
+
+	fmt.Printf("Imported %s: /redigera/%s\n", report.Adventure.Title, report.Adventure.Slug)
+	return true
+}
+
+// importTwine creates an adventure from a Twine story and prints what could
+// not be imported
+func importTwine(api *api.API, file string) bool {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Println("File not found: "+file, err)
+		return false
+	}
+
+	adventure, warnings, err := api.ImportTwineStory(data, 0)
+	for _, warning := range warnings {
+		fmt.Println("WARNING", warning)
+	}
+	if err != nil {
+		fmt.Println("Import failed:", err)
+		return false
+	}
+
+	fmt.Printf("Imported %s: /redigera/%s\n", adventure.Title, adventure.Slug)
+	return true
+}
+
+// exportTwine saves an adventure as a Twine story and prints what could not
+// be exported
+func exportTwine(api *api.API, slug string, format twine.Format) bool {
+	data, warnings, err := api.CreateTwineExport(slug, format)
+	if err != nil {
+		fmt.Println(err.Error())
+		return false
 	}
+
+	for _, warning := range warnings {
+		fmt.Println("WARNING", warning)
+	}
+
+	fileName := "PSadventure_" + slug + "." + string(format)
+	if err := ioutil.WriteFile(fileName, data, 0644); err != nil {
+		fmt.Println(err.Error())
+		return false
+	}
+
+	fmt.Println("File saved: " + fileName)
+	return true
+}
+
+// exportInk saves an adventure as ink source and prints what could not be
+// exported
+func exportInk(api *api.API, slug string) bool {
+	data, warnings, err := api.CreateInkExport(slug)
+	if err != nil {
+		fmt.Println(err.Error())
+		return false
+	}
+
+	for _, warning := range warnings {
+		fmt.Println("WARNING", warning)
+	}
+
+	fileName := "PSadventure_" + slug + ".ink"
+	if err := ioutil.WriteFile(fileName, data, 0644); err != nil {
+		fmt.Println(err.Error())
+		return false
+	}
+
+	fmt.Println("File saved: " + fileName)
+	return true
+}
+
+// exportScorm saves an adventure as a SCORM package, args can hold the
+// percentage of visited nodes that completes it
+func exportScorm(api *api.API, slug string, version string, args []string) bool {
+	settings := scorm.Settings{Version: scorm.Version(version)}
+	if len(args) > 0 {
+		percent, err := strconv.Atoi(args[0])
+		if err != nil {
+			fmt.Println("Invalid completion percent: " + args[0])
+			return false
+		}
+		settings.CompletionPercent = percent
+	}
+
+	name, err := api.CreateScormExport(slug, settings)
+	if err != nil {
+		fmt.Println(err.Error())
+		return false
+	}
+
+	fmt.Println("File saved to the media store: " + name)
+	return true
+}
+
+// lintAdventure prints the validation report of an adventure and returns
+// false if it contains errors
+func lintAdventure(store store.Store, slug string) bool {
+	adventure, err := store.GetAdventure(slug, models.Ignore)
+	if err != nil {
+		fmt.Println("Adventure not found: "+slug, err)
+		return false
+	}
+
+	report := validation.ValidateAdventure(adventure)
+
+	for _, issue := range append(report.Errors, report.Warnings...) {
+		location := ""
+		if issue.NodeID != nil {
+			location += fmt.Sprintf(" node %d", *issue.NodeID)
+		}
+		if issue.LinkID != nil {
+			location += fmt.Sprintf(" link %d", *issue.LinkID)
+		}
+		fmt.Printf("%-7s %s%s: %s\n", strings.ToUpper(string(issue.Severity)), issue.Code, location, issue.Message)
+	}
+
+	fmt.Printf("%s: %d errors, %d warnings\n", adventure.Title, len(report.Errors), len(report.Warnings))
+
+	return report.Valid()
+}
+
+// collectMedia removes the uploaded files nothing refers to, or only lists
+// them if dryRun is set
+func collectMedia(a *api.API, dryRun bool) bool {
+	collection, err := a.CollectMedia(dryRun, api.MediaGracePeriod)
+	if err != nil {
+		fmt.Println("Media gc failed:", err)
+		return false
+	}
+
+	for _, name := range collection.Removed {
+		fmt.Println("  Removed: " + name)
+	}
+	if dryRun {
+		fmt.Printf("%d files (%d bytes) would be removed, %d kept\n", len(collection.Removed), collection.Size, collection.Kept)
+	} else {
+		fmt.Printf("%d files (%d bytes) removed, %d kept\n", len(collection.Removed), collection.Size, collection.Kept)
+	}
+	return true
+}
+
+// reprocessMedia removes the metadata of the images in the upload folders of
+// adventures
+func reprocessMedia(a *api.API) bool {
+	reprocessing, err := a.ReprocessMedia()
+	if err != nil {
+		fmt.Println("Media reprocess failed:", err)
+		return false
+	}
+
+	for _, name := range reprocessing.Invalid {
+		fmt.Println("  Invalid image: " + name)
+	}
+	fmt.Printf("%d images in adventure folders cleaned, %d invalid\n", reprocessing.Cleaned, len(reprocessing.Invalid))
+	return true
+}
+
+// mediaPath is the folder of the uploaded files, unless they are in a bucket
+func mediaPath() string {
+	if folder := os.Getenv("MEDIA_PATH"); folder != "" {
+		return folder
+	}
+	return "upload"
+}
+
+// newMediaStore creates the store of uploaded files like the server does, a
+// folder or, with MEDIA_STORE=s3, a bucket
+func newMediaStore() (store.MediaStore, error) {
+	if os.Getenv("MEDIA_STORE") != "s3" {
+		return filestore.NewFileStore(mediaPath(), "/upload/"), nil
+	}
+
+	return s3store.NewS3Store(s3store.Config{
+		Endpoint: os.Getenv("S3_ENDPOINT"),
+		Bucket:   os.Getenv("S3_BUCKET"),
+		Credentials: s3store.Credentials{
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			Region:          os.Getenv("S3_REGION"),
+		},
+	})
 }
 
 func storeConvert(store store.Store) store.Store {
 	return store
 }
+
+// backupDatabase writes a backup of the database and the files of the media
+// store to file, an incremental one if the backup it builds on is given
+func backupDatabase(dbstore *sqlstore.SQLStore, media store.MediaStore, file string, args []string) bool {
+	schema, err := schemaVersion()
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+
+	options := backup.Options{Schema: schema}
+	if len(args) > 0 {
+		base, ok := openBackup(args[0], false)
+		if !ok {
+			return false
+		}
+		options.Base = base.Manifest
+	}
+
+	// The backup is written next to file and renamed when it is complete
+	temp := file + ".part"
+	writer, err := os.Create(temp)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	manifest, err := backup.Create(writer, dbstore, media, options)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp, file)
+	}
+	if err != nil {
+		os.Remove(temp)
+		fmt.Println("Backup failed:", err)
+		return false
+	}
+
+	for _, table := range sqlstore.BackupTables {
+		fmt.Printf("%-24s %d rows\n", table.Name, manifest.Tables[table.Name])
+	}
+	fmt.Printf("%-24s %d files\n", "upload", manifest.Files)
+	if manifest.Incremental() {
+		fmt.Println("Incremental backup " + manifest.ID + " of " + manifest.Base + " saved: " + file)
+	} else {
+		fmt.Println("Backup " + manifest.ID + " saved: " + file)
+	}
+	return true
+}
+
+// restoreDatabase restores a full backup and the incremental backups that
+// build on it into an empty database and the media store
+func restoreDatabase(dbstore *sqlstore.SQLStore, media store.MediaStore, files []string) bool {
+	schema, err := schemaVersion()
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+
+	archives := []*backup.Archive{}
+	for _, file := range files {
+		archive, ok := openBackup(file, false)
+		if !ok {
+			return false
+		}
+		archives = append(archives, archive)
+	}
+
+	err = backup.Restore(dbstore, media, schema, archives...)
+	if err != nil {
+		fmt.Println("Restore failed:", err)
+		return false
+	}
+
+	fmt.Println("Restored", archives[len(archives)-1].Manifest.ID)
+	return true
+}
+
+// openBackup opens a backup, and checks all of its checksums if verify is set.
+// A restore verifies the backups itself.
+func openBackup(file string, verify bool) (*backup.Archive, bool) {
+	reader, err := os.Open(file)
+	if err != nil {
+		fmt.Println("File not found: "+file, err)
+		return nil, false
+	}
+	info, err := reader.Stat()
+	if err != nil {
+		fmt.Println(err)
+		return nil, false
+	}
+
+	// The archive is read when restoring, so the file stays open
+	archive, err := backup.Open(reader, info.Size())
+	if err == nil && verify {
+		err = archive.Verify()
+	}
+	if err != nil {
+		fmt.Println(file+":", err)
+		return nil, false
+	}
+
+	fmt.Printf("%s: backup %s taken at %s, %d files\n", file, archive.Manifest.ID, archive.Manifest.TakenAt, len(archive.Manifest.Entries))
+	return archive, true
+}
+
+// schemaVersion is the latest migration, backups are only restored into a
+// database of the same version
+func schemaVersion() (int64, error) {
+	migrations, err := sqlstore.LoadMigrations(database.Migrations, "migrations")
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
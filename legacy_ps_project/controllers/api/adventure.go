@@ -10,6 +10,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"projektps/models"
+	"projektps/store"
 )
 
 // CreateAdventure creates a new adventure
@@ -47,9 +48,7 @@ func (a *API) GetAdventure(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	// Ignore which slug was passed (read or read/write)
-	adv, err := a.store.GetAdventure(id, models.Ignore)
-
+	adv, err := a.loadAdventure(id)
 	if err != nil {
 		fmt.Println("Error while loading adventure", err.Error())
 		respondWithError(w, http.StatusNotFound, err.Error())
@@ -59,44 +58,95 @@ func (a *API) GetAdventure(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, adv)
 }
 
+// loadAdventure loads an adventure by either of its slugs, an old play slug
+// loads the adventure it was renamed to
+func (a *API) loadAdventure(slug string) (*models.Adventure, error) {
+	// Ignore which slug was passed (read or read/write)
+	adv, err := a.store.GetAdventure(slug, models.Ignore)
+	if err == sql.ErrNoRows {
+		if viewSlug, redirectErr := a.store.GetSlugRedirect(slug); redirectErr == nil {
+			adv, err = a.store.GetAdventure(viewSlug, models.ReadOnly)
+		}
+	}
+	return adv, err
+}
+
 // GetAdventure returns a specific adventure
 func (a *API) GetAdventureForEdit(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
-	a.store.UpdateAdventureEditVersion(id)
-
 	adv, err := a.store.GetAdventure(id, models.Ignore)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, err.Error())
 		return
 	}
 
-	if !a.devAuthBypass {
-		user, err := a.store.GetUser(r.Context().Value("userid").(int64))
-		if err != nil {
-			fmt.Println("Error while checking user", err.Error())
-			respondWithError(w, http.StatusNotFound, err.Error())
-			return;
-		}
-
-		if user.Role > 1 {
-			found := false
-			for _, user0 := range adv.Users {
-				if user0.ID == user.ID {
-					found = true
-					break;
-				}
-			}
-			if (!found) {
-				respondWithError(w, http.StatusBadRequest, "User doesent have access to adventure")
-				return;	
-			}
-		}
+	hasAccess, err := a.hasEditAccess(r, adv)
+	if err != nil {
+		fmt.Println("Error while checking user", err.Error())
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return;
+	}
+	if !hasAccess {
+		respondWithError(w, http.StatusBadRequest, "User doesent have access to adventure")
+		return;
 	}
 	
 	respondWithJSON(w, http.StatusOK, adv)
 }
 
+// hasEditAccess checks that the requesting user is an admin or a member of the adventure
+func (a *API) hasEditAccess(r *http.Request, adv *models.Adventure) (bool, error) {
+	if a.devAuthBypass {
+		return true, nil
+	}
+
+	user, err := a.store.GetUser(requestUserID(r))
+	if err != nil {
+		return false, err
+	}
+
+	if user.Role <= 1 {
+		return true, nil
+	}
+
+	for _, user0 := range adv.Users {
+		if user0.ID == user.ID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// loadAdventureForEdit fetches the adventure by its editing slug and
+// verifies that the requesting user is allowed to edit it
+func (a *API) loadAdventureForEdit(w http.ResponseWriter, r *http.Request) (*models.Adventure, bool) {
+	slug := mux.Vars(r)["id"]
+
+	adv, err := a.store.GetAdventure(slug, models.ReadWrite)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "error.adventure.adventurenotfound")
+			return nil, false
+		}
+		respondWithError(w, http.StatusInternalServerError, "error.adventure.fetcherror")
+		return nil, false
+	}
+
+	hasAccess, err := a.hasEditAccess(r, adv)
+	if err != nil {
+		fmt.Println("Error while checking user", err.Error())
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return nil, false
+	}
+	if !hasAccess {
+		respondWithError(w, http.StatusBadRequest, "User doesent have access to adventure")
+		return nil, false
+	}
+
+	return adv, true
+}
 
 // GetAdventureByID returns a specific adventure
 func (a *API) GetAdventureByID(w http.ResponseWriter, r *http.Request) {
@@ -137,34 +187,40 @@ func (a *API) CopyAdventureById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	newAdventure, err := a.store.CreateNewAdventure()
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
+	// Create the copy and its content as one unit of work
+	var newAdventure *models.Adventure
+	err = a.store.WithTransaction(func(tx store.Store) error {
+		newAdventure, err = tx.CreateNewAdventure()
+		if err != nil {
+			return err
+		}
 
-	nodes := existingAdventure.Nodes
-	for i := range nodes {
-		nodes[i].ID = 0;
-		nodes[i].ImageURL = strings.Replace(nodes[i].ImageURL, slug, newAdventure.Slug, 1);
-		nodes[i].Props = strings.Replace(nodes[i].Props, slug, newAdventure.Slug, -1)
-	}
-	for i := range existingAdventure.Links {
-		existingAdventure.Links[i].ID = 0;
-	}
+		nodes := existingAdventure.Nodes
+		for i := range nodes {
+			nodes[i].ID = 0;
+		}
+		for i := range existingAdventure.Links {
+			existingAdventure.Links[i].ID = 0;
+		}
 
-	existingAdventure.CoverUrl = strings.Replace(existingAdventure.CoverUrl, slug, newAdventure.Slug, 1);
-	existingAdventure.Title = "Copy of " + existingAdventure.Title
-	existingAdventure.Slug = newAdventure.Slug
-	existingAdventure.ViewSlug = newAdventure.ViewSlug
+		// The files are shared with the original, files that could not be
+		// found point at the folder of the copy like before
+		err = a.ShareAdventureMedia(tx, existingAdventure, slug)
+		if err != nil {
+			return err
+		}
+		err = existingAdventure.RebaseMedia(slug, newAdventure.Slug)
+		if err != nil {
+			return err
+		}
 
-	err = a.store.UpdateAdventureContent(existingAdventure)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
+		existingAdventure.Title = "Copy of " + existingAdventure.Title
+		existingAdventure.Slug = newAdventure.Slug
+		existingAdventure.ViewSlug = newAdventure.ViewSlug
+		existingAdventure.EditVersion = newAdventure.EditVersion
 
-	err = a.CopyAdventureMedia(slug, newAdventure.Slug)
+		return tx.UpdateAdventureContent(existingAdventure, requestUserID(r))
+	})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -212,11 +268,15 @@ func (a *API) UpdateAdventureByID(w http.ResponseWriter, r *http.Request) {
 	existingAdventure.Locked = payload.Locked
 	existingAdventure.CoverUrl = payload.CoverUrl
 	existingAdventure.Users = payload.Users
-	existingAdventure.ViewSlug = payload.ViewSlug
+	if payload.ViewSlug != "" {
+		existingAdventure.ViewSlug = normalizeSlug(payload.ViewSlug)
+	}
 
 	err = a.store.UpdateAdventure(existingAdventure)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "error.adventure.updateerror")
+		if !respondWithSlugError(w, err) {
+			respondWithError(w, http.StatusInternalServerError, "error.adventure.updateerror")
+		}
 		return
 	}
 
@@ -229,6 +289,63 @@ func (a *API) UpdateAdventureByID(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, updatedAdventure)
 }
 
+type slugPayload struct {
+	ViewSlug string `json:"view_slug"`
+}
+
+// UpdateAdventureSlug lets an editor claim a readable play slug, e.g.
+// /spela/skolans-vardegrund. The old play slug redirects to the new one.
+func (a *API) UpdateAdventureSlug(w http.ResponseWriter, r *http.Request) {
+	adv, ok := a.loadAdventureForEdit(w, r)
+	if !ok {
+		return
+	}
+
+	var payload slugPayload
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "error.adventure.payloaderror")
+		return
+	}
+	defer r.Body.Close()
+
+	err := a.store.UpdateViewSlug(adv.ID, normalizeSlug(payload.ViewSlug))
+	if err != nil {
+		if !respondWithSlugError(w, err) {
+			fmt.Println("Error while updating slug", err.Error())
+			respondWithError(w, http.StatusInternalServerError, "error.adventure.updateerror")
+		}
+		return
+	}
+
+	updatedAdventure, err := a.store.GetAdventure(adv.Slug, models.ReadWrite)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "error.adventure.adventurenotfound")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, updatedAdventure)
+}
+
+// normalizeSlug lowercases a play slug typed by a user
+func normalizeSlug(slug string) string {
+	return strings.ToLower(strings.TrimSpace(slug))
+}
+
+// respondWithSlugError responds if err is about a play slug that can not be
+// used and tells whether it did
+func respondWithSlugError(w http.ResponseWriter, err error) bool {
+	switch err {
+	case models.ErrSlugInvalid, models.ErrSlugReserved:
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case store.ErrSlugTaken:
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		return false
+	}
+	return true
+}
+
 // UpdateAdventureContent updates a specific adventure and its content (nodes/links)
 func (a *API) UpdateAdventureContent(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -259,8 +376,10 @@ func (a *API) UpdateAdventureContent(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	if existingAdventure.EditVersion > adv.EditVersion {
-		respondWithError(w, http.StatusLocked, "Adventure is used by other instance.")
+	// Validate props of everything that is written by this save
+	fieldErrors := models.ValidateProps(adv.Props, changedNodes(adv.Nodes), changedLinks(adv.Links))
+	if len(fieldErrors) > 0 {
+		respondWithFieldErrors(w, fieldErrors)
 		return
 	}
 
@@ -268,9 +387,14 @@ func (a *API) UpdateAdventureContent(w http.ResponseWriter, r *http.Request) {
 	adv.Slug = existingAdventure.Slug
 	adv.ID = existingAdventure.ID
 
-	// Perform update with decoded payload
-	err = a.store.UpdateAdventureContent(&adv)
+	// Perform update with decoded payload, only if nobody else saved since
+	// the client loaded edit_version
+	err = a.store.UpdateAdventureContent(&adv, requestUserID(r))
 	if err != nil {
+		if err == store.ErrVersionConflict {
+			a.respondWithVersionConflict(w, slug)
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -289,6 +413,43 @@ func (a *API) UpdateAdventureContent(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, updatedAdventure)
 }
 
+// changedNodes returns the nodes that are new or changed in a save
+func changedNodes(nodes []models.Node) []models.Node {
+	changed := []models.Node{}
+	for _, node := range nodes {
+		if node.ID == 0 || node.Changed {
+			changed = append(changed, node)
+		}
+	}
+	return changed
+}
+
+// changedLinks returns the links that are new or changed in a save
+func changedLinks(links []models.Link) []models.Link {
+	changed := []models.Link{}
+	for _, link := range links {
+		if link.ID == 0 || link.Changed {
+			changed = append(changed, link)
+		}
+	}
+	return changed
+}
+
+// respondWithVersionConflict tells the client that its edit_version is stale
+// and passes along the current version so the client can merge
+func (a *API) respondWithVersionConflict(w http.ResponseWriter, slug string) {
+	current, err := a.store.GetAdventure(slug, models.ReadWrite)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusConflict, map[string]interface{}{
+		"error":        "error.adventure.versionconflict",
+		"edit_version": current.EditVersion,
+	})
+}
+
 // DeleteAdventureByID deletes a specific adventure
 func (a *API) DeleteAdventureByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
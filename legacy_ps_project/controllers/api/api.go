@@ -4,27 +4,40 @@ import (
 	"os"
 	"path/filepath"
 
+	"projektps/services/importer"
 	"projektps/store"
 )
 
 // API contains the neccessary references for the API struct/object
 type API struct {
 	store      store.Store
+	media      store.MediaStore
 	version    string
 	uploadDir  string
 	systemPath string
 	devAuthBypass bool
+	importLimits  importer.Limits
+	mediaQuota    int64
 }
 
-// NewAPIController creates a new API controller struct
-func NewAPIController(store *store.Store, version string, uploadDir string, devAuthBypass bool) *API {
+// DefaultMediaQuota is how much storage the files of an adventure may use
+// unless the server is configured otherwise
+const DefaultMediaQuota int64 = 500 << 20
+
+// NewAPIController creates a new API controller struct. The files of an
+// adventure, the ones uploaded to it and the ones it refers to, may use up
+// to mediaQuota bytes.
+func NewAPIController(store *store.Store, media store.MediaStore, version string, uploadDir string, devAuthBypass bool, mediaQuota int64) *API {
 	app_path, _ := os.Getwd()
 	app_path = filepath.ToSlash(app_path)
 	return &API{
 		store:      *store,
+		media:      media,
 		version:    version,
 		uploadDir:  uploadDir,
 		systemPath: app_path,
 		devAuthBypass: devAuthBypass,
+		importLimits:  importer.DefaultLimits,
+		mediaQuota:    mediaQuota,
 	}
 }
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"projektps/models"
+	"projektps/services/captions"
+	"projektps/services/media"
+)
+
+// CaptionNode is a node with a video or a podcast that lacks captions
+type CaptionNode struct {
+	NodeID int64  `json:"node_id"`
+	Title  string `json:"title"`
+	// Kind is video or podcast
+	Kind         string `json:"kind"`
+	MediaURL     string `json:"media_url"`
+	SubtitlesURL string `json:"subtitles_url,omitempty"`
+	// Problem is missing when the node has no subtitles, notfound when the
+	// file is gone, unsupported for a SubRip file the player can not show
+	// and invalid when it can not be read, see Reason
+	Problem string `json:"problem"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// CaptionsReport tells which media nodes of an adventure have captions
+type CaptionsReport struct {
+	MediaNodes int           `json:"media_nodes"`
+	Captioned  int           `json:"captioned"`
+	Missing    []CaptionNode `json:"missing"`
+}
+
+// GetAdventureCaptions lists the nodes with a video or a podcast that lack
+// captions the player can show
+func (a *API) GetAdventureCaptions(w http.ResponseWriter, r *http.Request) {
+	adv, ok := a.loadAdventureForEdit(w, r)
+	if !ok {
+		return
+	}
+
+	report := CaptionsReport{Missing: []CaptionNode{}}
+	for _, node := range adv.Nodes {
+		props, err := models.ParseNodeProps(node.Props)
+		if err != nil {
+			continue
+		}
+		captionNode, ok := mediaNode(node, props)
+		if !ok {
+			continue
+		}
+		report.MediaNodes++
+
+		if props.SubtitlesURL == nil || *props.SubtitlesURL == "" {
+			captionNode.Problem = "missing"
+			report.Missing = append(report.Missing, captionNode)
+			continue
+		}
+		captionNode.SubtitlesURL = *props.SubtitlesURL
+		// SubRip files linked before they were converted on upload
+		if isSubRip(captionNode.SubtitlesURL) {
+			captionNode.Problem = "unsupported"
+			captionNode.Reason = "the player shows WebVTT, upload the file again to convert it"
+			report.Missing = append(report.Missing, captionNode)
+			continue
+		}
+		data, err := a.readMedia(a.mediaName(captionNode.SubtitlesURL))
+		if err != nil {
+			captionNode.Problem = "notfound"
+			report.Missing = append(report.Missing, captionNode)
+			continue
+		}
+		if _, err := readCaptions(captionNode.SubtitlesURL, data); err != nil {
+			captionNode.Problem = "invalid"
+			captionNode.Reason = err.Error()
+			report.Missing = append(report.Missing, captionNode)
+			continue
+		}
+		report.Captioned++
+	}
+
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// mediaNode returns the video or the podcast of a node, the player shows a
+// video as the background of a node and a podcast in the player of a
+// podplayer-node
+func mediaNode(node models.Node, props *models.NodeProps) (CaptionNode, bool) {
+	captionNode := CaptionNode{NodeID: node.NodeID, Title: node.Title}
+	if t, ok := media.TypeByName(node.ImageURL); ok && t.Kind == media.KindVideo {
+		captionNode.Kind = "video"
+		captionNode.MediaURL = node.ImageURL
+		return captionNode, true
+	}
+	isPodcast := len(props.ChapterType) > 0 && props.ChapterType[0] == "podplayer-node"
+	if isPodcast && props.AudioURL != nil && *props.AudioURL != "" {
+		captionNode.Kind = "podcast"
+		captionNode.MediaURL = *props.AudioURL
+		return captionNode, true
+	}
+	return captionNode, false
+}
+
+// isSubRip is true for a subtitles file with the extension of SubRip
+func isSubRip(name string) bool {
+	t, ok := media.TypeByName(strings.SplitN(name, "?", 2)[0])
+	return ok && t.ContentType == "application/x-subrip"
+}
+
+// readCaptions reads a subtitles file by the extension of its name, WebVTT
+// or SubRip
+func readCaptions(name string, data []byte) (*captions.Track, error) {
+	if isSubRip(name) {
+		return captions.ParseSRT(data)
+	}
+	return captions.ParseWebVTT(data)
+}
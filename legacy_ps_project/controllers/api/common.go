@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+
+	"projektps/models"
 )
 
 func respondWithError(w http.ResponseWriter, code int, message string) {
@@ -18,6 +20,21 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Write(response)
 }
 
+// respondWithFieldErrors responds with the props values that did not pass validation
+func respondWithFieldErrors(w http.ResponseWriter, fieldErrors []models.FieldError) {
+	respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
+		"error":  "error.adventure.invalidprops",
+		"fields": fieldErrors,
+	})
+}
+
+// requestUserID returns the ID of the authenticated user, or 0 if the
+// request did not pass through the JWT middleware
+func requestUserID(r *http.Request) int64 {
+	userID, _ := r.Context().Value("userid").(int64)
+	return userID
+}
+
 const (
 	empty = ""
 	tab   = "\t"
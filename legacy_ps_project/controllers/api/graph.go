@@ -0,0 +1,530 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"projektps/models"
+	"projektps/store"
+)
+
+// graphOperation is a single JSON-Patch style change to the adventure graph.
+// Paths address nodes and links by their node_id/link_id:
+//
+//	/nodes/{nodeId}          add, replace or remove a node
+//	/nodes/-                 add a node with the next free node_id
+//	/nodes/{nodeId}/{field}  replace a single field on a node
+//
+// and the same for /links.
+type graphOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type graphPatchPayload struct {
+	EditVersion int64            `json:"edit_version"`
+	Operations  []graphOperation `json:"operations"`
+}
+
+type graphOperationResult struct {
+	Op   string       `json:"op"`
+	Path string       `json:"path"`
+	Node *models.Node `json:"node,omitempty"`
+	Link *models.Link `json:"link,omitempty"`
+}
+
+// graphError is returned by an operation that can not be applied, it rolls
+// back the whole batch and is passed on to the client
+type graphError struct {
+	status  int
+	message string
+	fields  []models.FieldError
+}
+
+func (e *graphError) Error() string {
+	return e.message
+}
+
+// Fields that may be replaced one by one, ids and node type are fixed
+var (
+	nodeFields = map[string]bool{"title": true, "icon": true, "text": true, "x": true, "y": true, "image_url": true, "image_id": true, "image_layout_type": true, "props": true}
+	linkFields = map[string]bool{"source": true, "target": true, "source_title": true, "target_title": true, "type": true, "props": true}
+)
+
+// PatchAdventureContent applies a list of node/link operations as one save
+func (a *API) PatchAdventureContent(w http.ResponseWriter, r *http.Request) {
+	adv, ok := a.loadAdventureForEdit(w, r)
+	if !ok {
+		return
+	}
+
+	var payload graphPatchPayload
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "error.adventure.payloaderror")
+		return
+	}
+	defer r.Body.Close()
+
+	if len(payload.Operations) == 0 {
+		respondWithError(w, http.StatusBadRequest, "error.graph.nooperations")
+		return
+	}
+
+	results, ok := a.applyGraphOperations(w, r, adv, payload.EditVersion, payload.Operations)
+	if !ok {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"edit_version": payload.EditVersion + 1,
+		"results":      results,
+	})
+}
+
+// GetAdventureNode returns a single node by its node_id
+func (a *API) GetAdventureNode(w http.ResponseWriter, r *http.Request) {
+	adv, ok := a.loadAdventureForEdit(w, r)
+	if !ok {
+		return
+	}
+
+	nodeID, _ := strconv.ParseInt(mux.Vars(r)["nodeId"], 10, 64)
+
+	node, err := a.store.GetNode(adv.ID, nodeID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "error.node.notfound")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, node)
+}
+
+// CreateAdventureNode adds a node with the node_id given in the path
+func (a *API) CreateAdventureNode(w http.ResponseWriter, r *http.Request) {
+	a.applySingleGraphOperation(w, r, "add", "/nodes/"+mux.Vars(r)["nodeId"])
+}
+
+// UpdateAdventureNode updates the fields present in the payload on a node
+func (a *API) UpdateAdventureNode(w http.ResponseWriter, r *http.Request) {
+	a.applySingleGraphOperation(w, r, "replace", "/nodes/"+mux.Vars(r)["nodeId"])
+}
+
+// DeleteAdventureNode removes a node along with the links to and from it
+func (a *API) DeleteAdventureNode(w http.ResponseWriter, r *http.Request) {
+	a.applySingleGraphOperation(w, r, "remove", "/nodes/"+mux.Vars(r)["nodeId"])
+}
+
+// GetAdventureLink returns a single link by its link_id
+func (a *API) GetAdventureLink(w http.ResponseWriter, r *http.Request) {
+	adv, ok := a.loadAdventureForEdit(w, r)
+	if !ok {
+		return
+	}
+
+	linkID, _ := strconv.ParseInt(mux.Vars(r)["linkId"], 10, 64)
+
+	link, err := a.store.GetLink(adv.ID, linkID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "error.link.notfound")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, link)
+}
+
+// CreateAdventureLink adds a link with the link_id given in the path
+func (a *API) CreateAdventureLink(w http.ResponseWriter, r *http.Request) {
+	a.applySingleGraphOperation(w, r, "add", "/links/"+mux.Vars(r)["linkId"])
+}
+
+// UpdateAdventureLink updates the fields present in the payload on a link
+func (a *API) UpdateAdventureLink(w http.ResponseWriter, r *http.Request) {
+	a.applySingleGraphOperation(w, r, "replace", "/links/"+mux.Vars(r)["linkId"])
+}
+
+// DeleteAdventureLink removes a link
+func (a *API) DeleteAdventureLink(w http.ResponseWriter, r *http.Request) {
+	a.applySingleGraphOperation(w, r, "remove", "/links/"+mux.Vars(r)["linkId"])
+}
+
+// applySingleGraphOperation runs one operation with the request body as its
+// value. The expected edit_version is passed as a query parameter.
+func (a *API) applySingleGraphOperation(w http.ResponseWriter, r *http.Request, op string, path string) {
+	adv, ok := a.loadAdventureForEdit(w, r)
+	if !ok {
+		return
+	}
+
+	editVersion, err := strconv.ParseInt(r.URL.Query().Get("edit_version"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "error.adventure.parametererror")
+		return
+	}
+
+	operation := graphOperation{Op: op, Path: path}
+	if op != "remove" {
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&operation.Value); err != nil {
+			respondWithError(w, http.StatusBadRequest, "error.adventure.payloaderror")
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	results, ok := a.applyGraphOperations(w, r, adv, editVersion, []graphOperation{operation})
+	if !ok {
+		return
+	}
+
+	response := map[string]interface{}{"edit_version": editVersion + 1}
+	if results[0].Node != nil {
+		response["node"] = results[0].Node
+	}
+	if results[0].Link != nil {
+		response["link"] = results[0].Link
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// applyGraphOperations runs all operations in a single transaction and
+// responds with an error if any of them fails
+func (a *API) applyGraphOperations(w http.ResponseWriter, r *http.Request, adv *models.Adventure, editVersion int64, operations []graphOperation) ([]graphOperationResult, bool) {
+	if adv.Locked {
+		respondWithError(w, http.StatusNotFound, "Adventure is read-only")
+		return nil, false
+	}
+
+	results := []graphOperationResult{}
+
+	err := a.store.EditAdventureContent(adv.Slug, editVersion, requestUserID(r), func(tx store.Store) error {
+		for _, operation := range operations {
+			result, err := applyGraphOperation(tx, adv.ID, operation)
+			if err != nil {
+				return err
+			}
+			results = append(results, *result)
+		}
+		return nil
+	})
+	if err != nil {
+		if err == store.ErrVersionConflict {
+			a.respondWithVersionConflict(w, adv.Slug)
+			return nil, false
+		}
+		if graphErr, ok := err.(*graphError); ok {
+			if len(graphErr.fields) > 0 {
+				respondWithFieldErrors(w, graphErr.fields)
+				return nil, false
+			}
+			respondWithError(w, graphErr.status, graphErr.message)
+			return nil, false
+		}
+		fmt.Println("Error while applying graph operations", err.Error())
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+
+	return results, true
+}
+
+func applyGraphOperation(tx store.Store, adventureID int64, operation graphOperation) (*graphOperationResult, error) {
+	parts := strings.Split(strings.TrimPrefix(operation.Path, "/"), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, &graphError{status: http.StatusBadRequest, message: "error.graph.invalidpath"}
+	}
+
+	// -1 means that the next free id should be used
+	id := int64(-1)
+	if parts[1] != "-" {
+		var err error
+		id, err = strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || id < 0 {
+			return nil, &graphError{status: http.StatusBadRequest, message: "error.graph.invalidpath"}
+		}
+	}
+
+	field := ""
+	if len(parts) == 3 {
+		field = parts[2]
+	}
+
+	if (id == -1 && operation.Op != "add") || (field != "" && operation.Op != "replace") {
+		return nil, &graphError{status: http.StatusBadRequest, message: "error.graph.invalidpath"}
+	}
+
+	result := &graphOperationResult{Op: operation.Op, Path: operation.Path}
+
+	switch parts[0] {
+	case "nodes":
+		node, err := applyNodeOperation(tx, adventureID, operation, id, field)
+		if err != nil {
+			return nil, err
+		}
+		result.Node = node
+	case "links":
+		link, err := applyLinkOperation(tx, adventureID, operation, id, field)
+		if err != nil {
+			return nil, err
+		}
+		result.Link = link
+	default:
+		return nil, &graphError{status: http.StatusBadRequest, message: "error.graph.invalidpath"}
+	}
+
+	return result, nil
+}
+
+func applyNodeOperation(tx store.Store, adventureID int64, operation graphOperation, nodeID int64, field string) (*models.Node, error) {
+	switch operation.Op {
+	case "add":
+		node := &models.Node{}
+		if err := json.Unmarshal(operation.Value, node); err != nil {
+			return nil, &graphError{status: http.StatusBadRequest, message: "error.node.payloaderror"}
+		}
+
+		// There is only one start node, created along with the adventure
+		if node.NodeType == "root" {
+			return nil, &graphError{status: http.StatusBadRequest, message: "error.node.rootexists"}
+		}
+
+		if nodeID == -1 {
+			nodes, err := tx.GetNodesByAdventureID(adventureID)
+			if err != nil {
+				return nil, err
+			}
+			nodeID = 0
+			for _, n := range nodes {
+				if n.NodeID >= nodeID {
+					nodeID = n.NodeID + 1
+				}
+			}
+		} else {
+			_, err := tx.GetNode(adventureID, nodeID)
+			if err == nil {
+				return nil, &graphError{status: http.StatusBadRequest, message: "error.node.exists"}
+			}
+			if err != sql.ErrNoRows {
+				return nil, err
+			}
+		}
+
+		node.ID = 0
+		node.NodeID = nodeID
+		node.AdventureID = adventureID
+
+		if err := checkProps([]models.Node{*node}, nil); err != nil {
+			return nil, err
+		}
+		return tx.CreateNewNode(node)
+
+	case "replace":
+		node, err := getNodeForOperation(tx, adventureID, nodeID)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := fieldValue(operation.Value, field, nodeFields)
+		if err != nil {
+			return nil, err
+		}
+
+		id, nodeType := node.ID, node.NodeType
+
+		// Only the fields present in the value are changed
+		if err := json.Unmarshal(value, node); err != nil {
+			return nil, &graphError{status: http.StatusBadRequest, message: "error.node.payloaderror"}
+		}
+
+		node.ID = id
+		node.NodeID = nodeID
+		node.NodeType = nodeType
+		node.AdventureID = adventureID
+
+		if err := checkProps([]models.Node{*node}, nil); err != nil {
+			return nil, err
+		}
+		return node, tx.UpdateNode(node)
+
+	case "remove":
+		node, err := getNodeForOperation(tx, adventureID, nodeID)
+		if err != nil {
+			return nil, err
+		}
+
+		if node.NodeType == "root" {
+			return nil, &graphError{status: http.StatusBadRequest, message: "error.node.rootnotremovable"}
+		}
+
+		// Links can not point to a node that does not exist
+		links, err := tx.GetLinksByAdventureID(adventureID)
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range links {
+			if link.SourceNodeID == nodeID || link.TargetNodeID == nodeID {
+				link.AdventureID = adventureID
+				if err := tx.DeleteLink(&link); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		return nil, tx.DeleteNode(node)
+	}
+
+	return nil, &graphError{status: http.StatusBadRequest, message: "error.graph.invalidop"}
+}
+
+func applyLinkOperation(tx store.Store, adventureID int64, operation graphOperation, linkID int64, field string) (*models.Link, error) {
+	switch operation.Op {
+	case "add":
+		link := &models.Link{}
+		if err := json.Unmarshal(operation.Value, link); err != nil {
+			return nil, &graphError{status: http.StatusBadRequest, message: "error.link.payloaderror"}
+		}
+
+		if linkID == -1 {
+			links, err := tx.GetLinksByAdventureID(adventureID)
+			if err != nil {
+				return nil, err
+			}
+			linkID = 0
+			for _, l := range links {
+				if l.LinkID >= linkID {
+					linkID = l.LinkID + 1
+				}
+			}
+		} else {
+			_, err := tx.GetLink(adventureID, linkID)
+			if err == nil {
+				return nil, &graphError{status: http.StatusBadRequest, message: "error.link.exists"}
+			}
+			if err != sql.ErrNoRows {
+				return nil, err
+			}
+		}
+
+		if err := checkLinkNodes(tx, adventureID, link); err != nil {
+			return nil, err
+		}
+
+		link.ID = 0
+		link.LinkID = linkID
+		link.AdventureID = adventureID
+
+		if err := checkProps(nil, []models.Link{*link}); err != nil {
+			return nil, err
+		}
+		return tx.CreateNewLink(link)
+
+	case "replace":
+		link, err := getLinkForOperation(tx, adventureID, linkID)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := fieldValue(operation.Value, field, linkFields)
+		if err != nil {
+			return nil, err
+		}
+
+		id := link.ID
+
+		// Only the fields present in the value are changed
+		if err := json.Unmarshal(value, link); err != nil {
+			return nil, &graphError{status: http.StatusBadRequest, message: "error.link.payloaderror"}
+		}
+
+		link.ID = id
+		link.LinkID = linkID
+		link.AdventureID = adventureID
+
+		if err := checkLinkNodes(tx, adventureID, link); err != nil {
+			return nil, err
+		}
+
+		if err := checkProps(nil, []models.Link{*link}); err != nil {
+			return nil, err
+		}
+		return link, tx.UpdateLink(link)
+
+	case "remove":
+		link, err := getLinkForOperation(tx, adventureID, linkID)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, tx.DeleteLink(link)
+	}
+
+	return nil, &graphError{status: http.StatusBadRequest, message: "error.graph.invalidop"}
+}
+
+func getNodeForOperation(tx store.Store, adventureID int64, nodeID int64) (*models.Node, error) {
+	node, err := tx.GetNode(adventureID, nodeID)
+	if err == sql.ErrNoRows {
+		return nil, &graphError{status: http.StatusNotFound, message: "error.node.notfound"}
+	}
+	return node, err
+}
+
+func getLinkForOperation(tx store.Store, adventureID int64, linkID int64) (*models.Link, error) {
+	link, err := tx.GetLink(adventureID, linkID)
+	if err == sql.ErrNoRows {
+		return nil, &graphError{status: http.StatusNotFound, message: "error.link.notfound"}
+	}
+	return link, err
+}
+
+// checkLinkNodes makes sure both ends of a link exist in the adventure
+func checkLinkNodes(tx store.Store, adventureID int64, link *models.Link) error {
+	for _, nodeID := range []int64{link.SourceNodeID, link.TargetNodeID} {
+		_, err := tx.GetNode(adventureID, nodeID)
+		if err == sql.ErrNoRows {
+			return &graphError{status: http.StatusBadRequest, message: "error.link.invalidnode"}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkProps validates the props of nodes and links about to be written
+func checkProps(nodes []models.Node, links []models.Link) error {
+	fieldErrors := models.ValidateProps("", nodes, links)
+	if len(fieldErrors) > 0 {
+		return &graphError{status: http.StatusBadRequest, message: "error.adventure.invalidprops", fields: fieldErrors}
+	}
+	return nil
+}
+
+// fieldValue wraps the value of a single field operation in an object, so it
+// can be decoded the same way as a complete node or link
+func fieldValue(value json.RawMessage, field string, allowed map[string]bool) (json.RawMessage, error) {
+	if field == "" {
+		return value, nil
+	}
+
+	if !allowed[field] {
+		return nil, &graphError{status: http.StatusBadRequest, message: "error.graph.invalidfield"}
+	}
+
+	return json.Marshal(map[string]json.RawMessage{field: value})
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"projektps/models"
+	"projektps/services/importer"
+	"projektps/services/twine"
+	"projektps/store"
+)
+
+// zipSignature starts every zip file
+var zipSignature = []byte("PK\x03\x04")
+
+// ImportAdventure creates an adventure from an uploaded zip, Twee or Twine
+// HTML story. The zip is streamed to a temporary file and checked before
+// anything is created, the response is an import report.
+func (a *API) ImportAdventure(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("* Importing adventure")
+
+	file, err := ioutil.TempFile("", "import-*.zip")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	limits := a.importLimits
+	size, err := io.Copy(file, io.LimitReader(r.Body, limits.MaxArchiveSize+1))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if size > limits.MaxArchiveSize {
+		report := importer.NewReport()
+		report.Error = "error.import.toolarge"
+		report.Fail(importer.CodeTooLarge, "", "the archive is larger than %d MB", limits.MaxArchiveSize>>20)
+		respondWithJSON(w, http.StatusRequestEntityTooLarge, report)
+		return
+	}
+
+	// Twee and Twine HTML stories are converted, anything else is our zip
+	head := make([]byte, len(zipSignature))
+	n, _ := file.ReadAt(head, 0)
+	if !bytes.Equal(head[:n], zipSignature) && size <= limits.MaxAdventureSize {
+		data, err := ioutil.ReadFile(file.Name())
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if twine.DetectFormat(data) != "" {
+			a.importTwine(w, r, data)
+			return
+		}
+	}
+
+	report, err := a.ImportArchive(file, size, requestUserID(r))
+	switch {
+	case err != nil:
+		respondWithJSON(w, http.StatusInternalServerError, report)
+	case !report.Valid():
+		respondWithJSON(w, http.StatusBadRequest, report)
+	default:
+		respondWithJSON(w, http.StatusOK, report)
+	}
+}
+
+// ImportArchive creates an adventure from an exported zip. An archive that
+// does not pass the checks, or whose files do not fit in the media quota, is
+// only reported, err is for failures while the
+// adventure is created. Nothing is left behind in either case.
+func (a *API) ImportArchive(reader io.ReaderAt, size int64, userID int64) (*importer.Report, error) {
+	archive, report := importer.Read(reader, size, a.importLimits)
+	if archive == nil {
+		report.Error = "error.import.invalid"
+		return report, nil
+	}
+
+	// The files count against the quota of the new adventure, like uploads
+	var used int64
+	for _, files := range [][]importer.File{archive.Media, archive.Shared} {
+		for _, file := range files {
+			used += file.Size
+		}
+	}
+	if used > a.mediaQuota {
+		report.Error = "error.import.quotaexceeded"
+		report.Fail(importer.CodeQuotaExceeded, "", "the files use %d bytes, an adventure may use %d", used, a.mediaQuota)
+		return report, nil
+	}
+
+	adventure := archive.Adventure
+	err := a.createImportedAdventure(adventure, archive, userID)
+	if err != nil {
+		report.Error = "error.import.failed"
+		report.Fail("import.failed", "", "%v", err)
+		return report, err
+	}
+
+	imported, err := a.store.GetAdventure(adventure.Slug, models.ReadWrite)
+	if err != nil {
+		report.Error = "error.import.failed"
+		report.Fail("import.failed", "", "%v", err)
+		return report, err
+	}
+	report.Adventure = imported
+
+	fmt.Printf("  Imported %s as %s with %d files\n", archive.Adventure.Title, imported.Slug, len(report.Files))
+	return report, nil
+}
+
+// createImportedAdventure creates the adventure and writes the media of
+// archive, if given, to its upload folder. On failure the rows are rolled
+// back, the folder is removed and so are the shared files that no record
+// is left for.
+func (a *API) createImportedAdventure(payload *models.Adventure, archive *importer.Archive, userID int64) error {
+	oldSlug := payload.Slug
+	newSlug := ""
+	var stored []*models.Media
+
+	err := a.store.WithTransaction(func(tx store.Store) error {
+		newAdventure, err := tx.CreateNewAdventure()
+		if err != nil {
+			return err
+		}
+		newSlug = newAdventure.Slug
+
+		if archive != nil {
+			err = a.writeImportMedia(archive, newSlug)
+			if err != nil {
+				return err
+			}
+		}
+
+		var nodes = payload.Nodes
+		for i := range nodes {
+			nodes[i].ID = 0
+		}
+		for i := range payload.Links {
+			payload.Links[i].ID = 0
+		}
+
+		if archive != nil && oldSlug != "" {
+			err = payload.RebaseMedia(oldSlug, newSlug)
+			if err != nil {
+				return err
+			}
+		}
+
+		if archive != nil && len(archive.Shared) > 0 {
+			var shared map[string]string
+			shared, stored, err = a.storeImportShared(tx, archive)
+			if err != nil {
+				return err
+			}
+			err = payload.MapMedia(func(url string) string {
+				if stored, exists := shared[url]; exists {
+					return stored
+				}
+				return url
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		payload.Slug = newAdventure.Slug
+		payload.ID = newAdventure.ID
+		payload.EditVersion = newAdventure.EditVersion
+
+		return tx.UpdateAdventureContent(payload, userID)
+	})
+	if err != nil && newSlug != "" && archive != nil {
+		a.DeleteMediaFolder(newSlug)
+	}
+	if err != nil {
+		a.removeUnrecordedMedia(stored)
+	}
+	return err
+}
+
+// storeImportShared stores the shared files of archive under the media
+// folder and returns the url each was stored as by its url in the archive.
+// They are stored by the hash of their content, not of their name. The
+// files stored so far are returned on failure as well.
+func (a *API) storeImportShared(s store.Store, archive *importer.Archive) (map[string]string, []*models.Media, error) {
+	shared := make(map[string]string)
+	records := []*models.Media{}
+	for _, file := range archive.Shared {
+		var data bytes.Buffer
+		err := archive.Copy(file, &data)
+		if err != nil {
+			return nil, records, err
+		}
+
+		stored, err := a.storeMedia(s, data.Bytes(), file.Name)
+		if err != nil {
+			return nil, records, err
+		}
+		records = append(records, stored)
+		shared[a.uploadDir+file.Name] = stored.URL
+	}
+	return shared, records, nil
+}
+
+// writeImportMedia writes the media of archive to the upload folder of slug
+func (a *API) writeImportMedia(archive *importer.Archive, slug string) error {
+	for _, file := range archive.Media {
+		// The names are checked by importer.Read, the media store checks
+		// them anyway
+		name := slug + "/" + file.Name
+		if !store.ValidMediaName(name) {
+			return fmt.Errorf("%s is outside of the upload folder", file.Name)
+		}
+
+		reader, writer := io.Pipe()
+		go func(file importer.File) {
+			writer.CloseWithError(archive.Copy(file, writer))
+		}(file)
+		err := a.media.Put(name, reader, file.ContentType)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"projektps/models"
+	"projektps/services/ink"
+)
+
+// exportInk responds with the adventure as ink source. What could not be
+// exported is logged and counted in the X-Ink-Warnings header.
+func (a *API) exportInk(w http.ResponseWriter, slug string) {
+	data, warnings, err := a.CreateInkExport(slug)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "error.adventure.adventurenotfound")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for _, warning := range warnings {
+		fmt.Println("  Ink export:", warning)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"PSadventure_%s.ink\"", slug))
+	w.Header().Set("X-Ink-Warnings", fmt.Sprint(len(warnings)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// CreateInkExport converts an adventure to ink source
+func (a *API) CreateInkExport(slug string) ([]byte, []ink.Warning, error) {
+	fmt.Println("* Exporting adventure to ink:", slug)
+
+	// Ignore which slug was passed (read or read/write)
+	adventure, err := a.store.GetAdventure(slug, models.Ignore)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, warnings := ink.Export(adventure)
+	return data, warnings, nil
+}
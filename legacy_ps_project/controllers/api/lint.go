@@ -0,0 +1,19 @@
+package api
+
+import (
+	"net/http"
+
+	"projektps/services/validation"
+)
+
+// LintAdventure validates the graph of an adventure and returns all errors and warnings
+func (a *API) LintAdventure(w http.ResponseWriter, r *http.Request) {
+	adv, ok := a.loadAdventureForEdit(w, r)
+	if !ok {
+		return
+	}
+
+	report := validation.ValidateAdventure(adv)
+
+	respondWithJSON(w, http.StatusOK, report)
+}
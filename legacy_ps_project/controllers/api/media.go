@@ -1,53 +1,322 @@
 package api
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"net/http"
 	"strconv"
+	"io"
     "io/ioutil"
 	"strings"
 	"database/sql"
-	"os"
-    "path/filepath"
+	"encoding/hex"
+	"path"
+	"time"
 
 	"github.com/gorilla/mux"
 	"projektps/helpers/unsplash"
 	"projektps/models"
+	"projektps/services/captions"
+	"projektps/services/imaging"
+	"projektps/services/media"
+	"projektps/store"
 )
 
 type Image struct {
     Url       string    `json:"url"`
+    // The manifest of an image: its size, the narrower copies to use in a
+    // srcset and the thumbnail
+    Width     int                   `json:"width,omitempty"`
+    Height    int                   `json:"height,omitempty"`
+    Variants  []models.MediaVariant `json:"variants,omitempty"`
+    SrcSet    string                `json:"srcset,omitempty"`
+    Thumbnail string                `json:"thumbnail,omitempty"`
+    // The number of cues of subtitles, and the time the last one ends in
+    // seconds
+    Cues      int                   `json:"cues,omitempty"`
+    Duration  float64               `json:"duration,omitempty"`
 }
 
 
 func (a *API) DeleteMediaFolder(slug string) {
-	os.RemoveAll(a.systemPath + a.uploadDir + slug);
+	store.DeleteMediaPrefix(a.media, slug+"/")
 }
 
-func (a *API) CopyAdventureMedia(srcSlug string, destSlug string) error {
-	path := a.systemPath + a.uploadDir
+// mediaURLExpiry is how long the url a file is redirected to is valid
+const mediaURLExpiry = time.Hour
+
+// ServeMedia serves the files of the media store under the upload folder,
+// with ranges for seeking and the cache headers of setMediaHeaders. A store
+// that can not serve its files itself, like a bucket, is redirected to with
+// a signed url.
+func (a *API) ServeMedia(w http.ResponseWriter, r *http.Request) {
+	if handler, ok := a.media.(http.Handler); ok {
+		// A missing file is not cached
+		if _, err := a.media.Stat(a.mediaName(r.URL.Path)); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		setMediaHeaders(w, r.URL.Path)
+		http.StripPrefix(a.uploadDir, handler).ServeHTTP(w, r)
+		return
+	}
+
+	url, err := a.media.SignedURL(a.mediaName(r.URL.Path), mediaURLExpiry)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// mediaMaxAge is how long a browser may keep a file under the media folder
+const mediaMaxAge = 365 * 24 * time.Hour
+
+// setMediaHeaders replaces the no-cache of the API for an uploaded file. A
+// file under the media folder is named by its content and never changes, so
+// it is kept for a year without asking again, with the hash of its name as
+// the ETag. Other files may be replaced, the browser keeps them but checks
+// their ETag first. The content type of the allowed types is set, WebVTT is
+// not known everywhere.
+func setMediaHeaders(w http.ResponseWriter, url string) {
+	if etag, ok := models.MediaFileETag(url); ok {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(mediaMaxAge.Seconds())))
+		w.Header().Set("ETag", etag)
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if t, ok := media.TypeByName(url); ok {
+		w.Header().Set("Content-Type", t.ContentType)
+	}
+}
+
+// mediaName is the name in the media store of a url under the upload folder
+func (a *API) mediaName(url string) string {
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
+	}
+	return strings.TrimPrefix(url, a.uploadDir)
+}
+
+// storeMedia stores data once by its SHA-256 under the media folder and
+// records it in s. If the content is stored already, the existing file is
+// returned, whatever it was called when it was uploaded. Images are
+// processed first, see processImage, the hash is the one of the upload.
+func (a *API) storeMedia(s store.Store, data []byte, name string) (*models.Media, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	// A file under the media folder always has the content of its name, as
+	// Put never leaves a partly written file
+	if existing, err := s.GetMediaByHash(hash); err == nil {
+		if _, err := a.media.Stat(a.mediaName(existing.URL)); err == nil {
+			return existing, nil
+		}
+	}
+
+	contentType := http.DetectContentType(data)
+	if t, ok := media.TypeByName(name); ok {
+		contentType = t.ContentType
+	}
+
+	processed := &models.Media{
+		Hash:        hash,
+		URL:         models.MediaURL(hash, path.Ext(name)),
+		ContentType: contentType,
+	}
+	data, err := a.processImage(processed, data)
+	if err != nil {
+		return nil, err
+	}
+	processed.Size = int64(len(data))
+
+	record, err := s.CreateMedia(processed)
+	if err != nil {
+		return nil, err
+	}
+	err = a.media.Put(a.mediaName(record.URL), bytes.NewReader(data), record.ContentType)
+	if err != nil {
+		return nil, err
+	}
 
-	source := path + srcSlug
-	destination := path + destSlug
+	return record, nil
+}
 
-	os.Mkdir(destination, 0755)
+// removeUnrecordedMedia removes the files of records that were stored in a
+// transaction that was rolled back. Files that still have a record, as they
+// were stored before, are kept.
+func (a *API) removeUnrecordedMedia(records []*models.Media) {
+	for _, record := range records {
+		if _, err := a.store.GetMediaByHash(record.Hash); err != sql.ErrNoRows {
+			continue
+		}
 
-    var err error = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
-        var relPath string = strings.Replace(filepath.ToSlash(path), source, "", 1)
-        if relPath == "" {
-            return nil
-        }
-        if info.IsDir() {
-            return os.Mkdir(filepath.Join(destination, relPath), 0755)
-        } else {
-            var data, err1 = ioutil.ReadFile(filepath.Join(source, relPath))
-            if err1 != nil {
-                return err1
-            }
-            return ioutil.WriteFile(filepath.Join(destination, relPath), data, 0777)
-        }
-    })
-    return err
+		urls := []string{record.URL}
+		if record.Thumbnail != "" {
+			urls = append(urls, record.Thumbnail)
+		}
+		for _, variant := range record.Variants {
+			urls = append(urls, variant.URL)
+		}
+		for _, url := range urls {
+			fmt.Println("Remove unrecorded media: ", url)
+			// No big deal if we cant delete, toolps media gc removes it later
+			a.media.Delete(a.mediaName(url))
+		}
+	}
+}
+
+// processImage removes the metadata of an image, turns it upright and stores
+// its variants next to it, see imaging.Process. The variants are added to
+// record and the image to store is returned. Other files are returned as
+// they are.
+func (a *API) processImage(record *models.Media, data []byte) ([]byte, error) {
+	result, err := imaging.Process(data)
+	if err == imaging.ErrUnsupported {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	record.Width = result.Width
+	record.Height = result.Height
+	record.Variants = nil
+	record.Thumbnail = ""
+	for _, variant := range result.Variants {
+		url := models.MediaVariantURL(record.Hash, variant.Name, variant.Extension)
+		err = a.media.Put(a.mediaName(url), bytes.NewReader(variant.Data), variant.ContentType)
+		if err != nil {
+			return nil, err
+		}
+
+		if variant.Name == imaging.ThumbnailName {
+			record.Thumbnail = url
+			continue
+		}
+		record.Variants = append(record.Variants, models.MediaVariant{URL: url, Width: variant.Width, Height: variant.Height})
+	}
+	return result.Data, nil
+}
+
+// MediaReprocessing reports the images ReprocessMedia processed
+type MediaReprocessing struct {
+	// Cleaned is the number of images in the upload folders of adventures
+	// that had their metadata removed
+	Cleaned int
+	// Invalid are the images that could not be read, relative to the
+	// upload folder
+	Invalid []string
+}
+
+// ReprocessMedia removes the metadata of the images in the upload folders of
+// adventures, which were uploaded before images were processed, see
+// imaging.Clean. The images are replaced. The recorded images are named by
+// the hash of their content and are left as they are.
+func (a *API) ReprocessMedia() (*MediaReprocessing, error) {
+	reprocessing := &MediaReprocessing{Invalid: []string{}}
+
+	objects, err := a.media.List("")
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range objects {
+		// The exports are written to the upload folder itself
+		if !strings.Contains(object.Name, "/") || strings.HasPrefix(a.uploadDir+object.Name, models.MediaURLPrefix) {
+			continue
+		}
+		if t, ok := media.TypeByName(object.Name); !ok || t.Kind != media.KindImage {
+			continue
+		}
+
+		data, err := a.readMedia(object.Name)
+		if err != nil {
+			return nil, err
+		}
+		cleaned, err := imaging.Clean(data)
+		if err == imaging.ErrUnsupported {
+			continue
+		}
+		if err == imaging.ErrInvalidImage {
+			reprocessing.Invalid = append(reprocessing.Invalid, object.Name)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(cleaned.Data, data) {
+			continue
+		}
+
+		err = a.media.Put(object.Name, bytes.NewReader(cleaned.Data), cleaned.ContentType)
+		if err != nil {
+			return nil, err
+		}
+		reprocessing.Cleaned++
+	}
+
+	return reprocessing, nil
+}
+
+// readMedia reads a file of the media store
+func (a *API) readMedia(name string) ([]byte, error) {
+	file, err := a.media.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
+
+// shareMedia stores a file from the upload folder of slug under the media
+// folder and returns its new url. Other urls, and files that do not exist,
+// are returned as they are.
+func (a *API) shareMedia(s store.Store, url string, slug string) (string, error) {
+	if !strings.HasPrefix(url, a.uploadDir+slug+"/") {
+		return url, nil
+	}
+
+	file, err := a.media.Get(a.mediaName(url))
+	if err == store.ErrMediaNotFound || err == store.ErrInvalidMediaName {
+		return url, nil
+	}
+	if err != nil {
+		return url, err
+	}
+	data, err := ioutil.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return url, err
+	}
+
+	record, err := a.storeMedia(s, data, a.mediaName(url))
+	// An image that can not be read stays where it is
+	if err == imaging.ErrInvalidImage {
+		return url, nil
+	}
+	if err != nil {
+		return url, err
+	}
+	return record.URL, nil
+}
+
+// ShareAdventureMedia points the files of the upload folder of slug that
+// adventure refers to at the media folder, so that a copy of it shares them
+// with the original instead of copying them
+func (a *API) ShareAdventureMedia(s store.Store, adventure *models.Adventure, slug string) error {
+	var shareErr error
+	err := adventure.MapMedia(func(url string) string {
+		shared, err := a.shareMedia(s, url, slug)
+		if err != nil && shareErr == nil {
+			shareErr = err
+		}
+		return shared
+	})
+	if err != nil {
+		return err
+	}
+	return shareErr
 }
 
 // GetImagesByCategory retrieves all images in a category
@@ -114,11 +383,35 @@ func (a *API) DeleteMedia(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	hasAccess, err := a.hasEditAccess(r, existingAdventure)
+	if err != nil || !hasAccess {
+		respondWithError(w, http.StatusForbidden, "error.media.forbidden")
+		return
+	}
+
+	// Files stored by their content may be used by other adventures and
+	// revisions, they are removed by toolps media gc when nothing refers to
+	// them any more. The upload no longer counts against the quota of the
+	// adventure, the references of its content still do.
+	if len(hash) >= 2 {
+		if mediaHash, ok := models.ParseMediaURL(models.MediaURLPrefix + hash[:2] + "/" + hash); ok {
+			fmt.Println("Keep shared media: ", hash)
+			if stored, err := a.store.GetMediaByHash(mediaHash); err == nil {
+				err = a.store.RemoveMediaUpload(stored.ID, existingAdventure.ID)
+				if err != nil {
+					respondWithError(w, http.StatusInternalServerError, err.Error())
+					return
+				}
+			}
+			respondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+			return
+		}
+	}
 
 	// Do not delete files that have other references
 	fileCount := 0
-	for _, node := range existingAdventure.Nodes {
-		if strings.Contains(node.ImageURL, hash) || strings.Contains(node.Props, hash) {
+	for _, url := range existingAdventure.MediaURLs() {
+		if strings.HasSuffix(url, "/" + hash) {
 			fileCount += 1
 			if fileCount > 1 {
 				break;
@@ -126,61 +419,157 @@ func (a *API) DeleteMedia(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	
-	deletePath := a.systemPath + a.uploadDir + id + "/" + hash
+	deleteName := id + "/" + hash
 
-	fmt.Println("Delete media: ", deletePath)
+	fmt.Println("Delete media: ", deleteName)
 
 	// No big deal if we cant delete, probably just already deleted
 	if (fileCount == 1) {
-		os.Remove(deletePath)
+		a.media.Delete(deleteName)
 	}
 
 	respondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
 }
 
 
+// UploadMedia stores a file for the adventure adventureId, which the caller
+// has to be allowed to edit. The content has to be of a type on the
+// allow-list of media.Types, within the size limit of its kind and within
+// the storage quota of the adventure. The file is stored by its content,
+// the name it was uploaded with is only used for its type.
+//
 // https://github.com/gustavocd/file-upload-ajax/blob/master/controllers/file.go
 func (a *API) UploadMedia(w http.ResponseWriter, r *http.Request) {
+	maxSize := media.MaxUploadSize() + 1<<20
+	if r.ContentLength > maxSize {
+		respondWithJSON(w, http.StatusRequestEntityTooLarge, map[string]interface{}{"error": "error.media.toolarge", "max_size": media.MaxUploadSize()})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		respondWithError(w, http.StatusBadRequest, "error.media.invalidform")
+		return
+	}
+
 	adventureId := r.FormValue("adventureId")
+	adventure, err := a.store.GetAdventure(adventureId, models.ReadWrite)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "error.media.adventurenotfound")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "error.adventure.fetcherror")
+		return
+	}
+	hasAccess, err := a.hasEditAccess(r, adventure)
+	if err != nil || !hasAccess {
+		respondWithError(w, http.StatusForbidden, "error.media.forbidden")
+		return
+	}
+
 	file, header, err := r.FormFile("media")
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+		respondWithError(w, http.StatusBadRequest, "error.media.nofile")
 		return
 	}
 	defer file.Close()
 
-	data, err := ioutil.ReadAll(file)
+	head := make([]byte, media.SniffLength)
+	n, _ := io.ReadFull(file, head)
+	t, err := media.Detect(path.Base(header.Filename), head[:n])
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "image error: "+err.Error())
+		fmt.Println("Refused media: ", adventureId, err)
+		respondWithError(w, http.StatusUnsupportedMediaType, "error.media.typenotallowed")
+		return
+	}
+	if header.Size > t.MaxSize() {
+		respondWithJSON(w, http.StatusRequestEntityTooLarge, map[string]interface{}{"error": "error.media.toolarge", "max_size": t.MaxSize()})
 		return
 	}
 
-	filename := header.Filename;
-
-	adventureDir := a.uploadDir + adventureId + "/"
-	filepath := a.systemPath + adventureDir
-	returnUrl := adventureDir + filename
-
-	fmt.Printf("Add image: %s, %s, %s\n", adventureDir, filepath, returnUrl)
-
-	if os.MkdirAll(filepath, os.ModePerm) != nil {
-		respondWithError(w, http.StatusBadRequest, "Create path failed: "+err.Error())
+	rest, err := ioutil.ReadAll(io.LimitReader(file, t.MaxSize()))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "error.media.invalidform")
 		return
 	}
+	data := append(head[:n], rest...)
+
+	// Subtitles are checked cue by cue, SubRip is stored as WebVTT
+	extension := t.Extensions[0]
+	var track *captions.Track
+	if t.Kind == media.KindSubtitles {
+		track, err = readCaptions(extension, data)
+		if malformed, ok := err.(*captions.ErrMalformed); ok {
+			respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "error.media.invalidsubtitles", "line": malformed.Line, "reason": malformed.Reason})
+			return
+		} else if err != nil {
+			respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "error.media.invalidsubtitles", "reason": err.Error()})
+			return
+		}
+		if extension != ".vtt" {
+			data = track.WebVTT()
+			extension = ".vtt"
+		}
+	}
 
-	outfile, err := os.Create(filepath+filename)
+	used, counted, err := a.mediaUsage(adventure.ID, data)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Open file failed: "+err.Error())
+		respondWithError(w, http.StatusInternalServerError, "error.media.saveerror")
+		return
+	}
+	if !counted && used+int64(len(data)) > a.mediaQuota {
+		respondWithJSON(w, http.StatusRequestEntityTooLarge, map[string]interface{}{"error": "error.media.quotaexceeded", "quota": a.mediaQuota, "used": used})
 		return
 	}
 
-	_, err = outfile.Write(data)
+	// The name is made from the content and the allowed type
+	stored, err := a.storeMedia(a.store, data, "media"+extension)
+	if err == imaging.ErrInvalidImage {
+		respondWithError(w, http.StatusBadRequest, "error.media.invalidimage")
+		return
+	}
+	if err == nil {
+		err = a.store.AddMediaUpload(stored.ID, adventure.ID)
+	}
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Save to file failed: "+err.Error())
+		fmt.Println("Error while storing media", err)
+		respondWithError(w, http.StatusInternalServerError, "error.media.saveerror")
 		return
 	}
 
+	fmt.Printf("Add media: %s, %s, %s\n", adventureId, header.Filename, stored.URL)
+
 	var i Image
-	i.Url = returnUrl;
+	i.Url = stored.URL
+	i.Width = stored.Width
+	i.Height = stored.Height
+	i.Variants = stored.Variants
+	i.SrcSet = stored.SrcSet()
+	i.Thumbnail = stored.Thumbnail
+	if track != nil {
+		i.Cues = len(track.Cues)
+		i.Duration = track.Duration().Seconds()
+	}
 	respondWithJSON(w, http.StatusOK, i)
 }
+
+// mediaUsage returns the storage the files of an adventure use, and whether
+// data is one of them already
+func (a *API) mediaUsage(adventureID int64, data []byte) (int64, bool, error) {
+	files, err := a.store.GetAdventureMedia(adventureID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	var used int64
+	counted := false
+	for _, file := range files {
+		used += file.Size
+		if file.Hash == hash {
+			counted = true
+		}
+	}
+	return used, counted, nil
+}
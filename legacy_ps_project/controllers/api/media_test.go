@@ -0,0 +1,231 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"projektps/models"
+	"projektps/services/imaging"
+	"projektps/store"
+	"projektps/store/filestore"
+	"projektps/store/memstore"
+)
+
+// bucket is a media store that can not serve its files, like a bucket
+type bucket struct {
+	store.MediaStore
+}
+
+func (b bucket) SignedURL(name string, expires time.Duration) (string, error) {
+	if !store.ValidMediaName(name) {
+		return "", store.ErrInvalidMediaName
+	}
+	return "https://bucket.example.com/" + name + "?signed", nil
+}
+
+func TestServeMedia(t *testing.T) {
+	dir, err := ioutil.TempDir("", "media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := filestore.NewFileStore(dir, "/upload/")
+	a := &API{media: files, uploadDir: "/upload/"}
+	if err := ioutil.WriteFile(dir+"/skog.png", []byte("skog"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A folder is served by the server
+	w := httptest.NewRecorder()
+	a.ServeMedia(w, httptest.NewRequest("GET", "/upload/skog.png", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "skog" {
+		t.Errorf("expected the file, got %d %q", w.Code, w.Body.String())
+	}
+
+	// A bucket is redirected to
+	a.media = bucket{files}
+	w = httptest.NewRecorder()
+	a.ServeMedia(w, httptest.NewRequest("GET", "/upload/abc/skog.png", nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://bucket.example.com/abc/skog.png?signed" {
+		t.Errorf("expected a redirect to the bucket, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	a.ServeMedia(w, httptest.NewRequest("GET", "/upload/abc/../../skog.png", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+// photo returns a JPEG with an EXIF segment that has a GPS position
+func photo(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+	exif := "Exif\x00\x00II*\x00\x08\x00\x00\x00\x00\x00GPS 59.3293N 18.0686E"
+	segment := append([]byte{0xff, 0xe1, 0, byte(len(exif) + 2)}, exif...)
+	data := encoded.Bytes()
+	return append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+}
+
+func TestStoreImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := memstore.NewStore()
+	a := &API{store: s, media: filestore.NewFileStore(dir, "/upload/"), uploadDir: "/upload/"}
+	read := func(url string) []byte {
+		t.Helper()
+		data, err := a.readMedia(a.mediaName(url))
+		if err != nil {
+			t.Fatalf("%s: %v", url, err)
+		}
+		return data
+	}
+
+	upload := photo(t, 1200, 600)
+	stored, err := a.storeMedia(s, upload, "skog.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(read(stored.URL), []byte("GPS")) || stored.Size != int64(len(read(stored.URL))) {
+		t.Error("expected the image to be stored without its metadata")
+	}
+	if stored.Width != 1200 || stored.Height != 600 || len(stored.Variants) != 2 || stored.Variants[1].Width != 960 || stored.Thumbnail == "" {
+		t.Errorf("unexpected media %+v", stored)
+	}
+	for _, url := range []string{stored.Variants[0].URL, stored.Variants[1].URL, stored.Thumbnail} {
+		if !strings.HasPrefix(url, models.MediaVariantURL(stored.Hash, "", "")) {
+			t.Errorf("expected %s next to the image", url)
+		}
+		read(url)
+	}
+
+	// The same upload is the same file
+	again, err := a.storeMedia(s, upload, "skog2.jpg")
+	if err != nil || again.ID != stored.ID {
+		t.Errorf("expected media %d, got %+v: %v", stored.ID, again, err)
+	}
+
+	if _, err := a.storeMedia(s, []byte("\xff\xd8\xff\xe0\x00"), "trasig.jpg"); err != imaging.ErrInvalidImage {
+		t.Errorf("expected imaging.ErrInvalidImage, got %v", err)
+	}
+}
+
+func TestRemoveUnrecordedMedia(t *testing.T) {
+	dir, err := ioutil.TempDir("", "media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := memstore.NewStore()
+	a := &API{store: s, media: filestore.NewFileStore(dir, "/upload/"), uploadDir: "/upload/"}
+	exists := func(url string) bool {
+		_, err := a.media.Stat(a.mediaName(url))
+		return err == nil
+	}
+
+	kept, err := a.storeMedia(s, []byte("kept"), "kept.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []*models.Media
+	err = s.WithTransaction(func(tx store.Store) error {
+		for _, data := range [][]byte{[]byte("kept"), photo(t, 800, 400)} {
+			record, err := a.storeMedia(tx, data, "skog.jpg")
+			if err != nil {
+				return err
+			}
+			records = append(records, record)
+		}
+		return errors.New("rollback")
+	})
+	if err == nil || len(records) != 2 {
+		t.Fatalf("expected the transaction to fail, got %v", err)
+	}
+
+	a.removeUnrecordedMedia(records)
+	if !exists(kept.URL) {
+		t.Errorf("expected %s to be kept", kept.URL)
+	}
+	removed := records[1]
+	for _, url := range []string{removed.URL, removed.Thumbnail, removed.Variants[0].URL} {
+		if exists(url) {
+			t.Errorf("expected %s to be removed", url)
+		}
+	}
+}
+
+func TestReprocessMedia(t *testing.T) {
+	dir, err := ioutil.TempDir("", "media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := memstore.NewStore()
+	a := &API{store: s, media: filestore.NewFileStore(dir, "/upload/"), uploadDir: "/upload/"}
+	write := func(name string, data []byte) {
+		t.Helper()
+		fileName := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fileName, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Uploaded before images were processed
+	hash := strings.Repeat("ab", 32)
+	record, err := s.CreateMedia(&models.Media{Hash: hash, URL: models.MediaURL(hash, ".jpg"), ContentType: "image/jpeg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := photo(t, 600, 300)
+	write(a.mediaName(record.URL), original)
+	write("abc/skog.jpg", photo(t, 100, 100))
+	write("abc/trasig.jpg", []byte("\xff\xd8\xff\xe0\x00"))
+	write("abc/text.vtt", []byte("WEBVTT"))
+
+	reprocessing, err := a.ReprocessMedia()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reprocessing.Cleaned != 1 || strings.Join(reprocessing.Invalid, ",") != "abc/trasig.jpg" {
+		t.Errorf("unexpected reprocessing %+v", reprocessing)
+	}
+
+	data, err := a.readMedia("abc/skog.jpg")
+	if err != nil || bytes.Contains(data, []byte("GPS")) {
+		t.Errorf("expected the metadata to be removed: %v", err)
+	}
+	// The file of a record has to match its hash
+	data, err = a.readMedia(a.mediaName(record.URL))
+	if err != nil || !bytes.Equal(data, original) {
+		t.Errorf("expected %s to be left as it is: %v", record.URL, err)
+	}
+
+	// Processing again changes nothing
+	reprocessing, err = a.ReprocessMedia()
+	if err != nil || reprocessing.Cleaned != 0 {
+		t.Errorf("unexpected reprocessing %+v: %v", reprocessing, err)
+	}
+}
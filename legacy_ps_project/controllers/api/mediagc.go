@@ -0,0 +1,146 @@
+package api
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"projektps/models"
+)
+
+// MediaGracePeriod is how old an unused file has to be before CollectMedia
+// removes it, a file that was just uploaded is used when the adventure is
+// saved
+const MediaGracePeriod = 24 * time.Hour
+
+// MediaCollection reports the files CollectMedia removed, or would remove
+type MediaCollection struct {
+	// Removed are the removed files, relative to the upload folder
+	Removed []string
+	// Size is the size of the removed files
+	Size int64
+	// Kept is the number of files that are still used or too new to remove
+	Kept int
+}
+
+// CollectMedia removes the uploaded files that neither an adventure nor a
+// kept revision refers to: shared files without references along with their
+// variants, files under the media folder that were never recorded and files
+// in the upload folders of adventures. The references of every adventure are counted again first.
+// Files younger than grace and the exports in the upload folder are kept.
+// With dryRun nothing is removed.
+func (a *API) CollectMedia(dryRun bool, grace time.Duration) (*MediaCollection, error) {
+	used, err := a.usedMedia()
+	if err != nil {
+		return nil, err
+	}
+
+	collection := &MediaCollection{Removed: []string{}}
+	before := time.Now().Add(-grace)
+
+	records, err := a.store.GetMedia()
+	if err != nil {
+		return nil, err
+	}
+	recorded := make(map[string]bool)
+	for _, record := range records {
+		if record.RefCount > 0 || used[record.URL] || record.CreatedAt.After(before) {
+			// The variants of an image go with it
+			recorded[record.URL] = true
+			recorded[record.Thumbnail] = true
+			for _, variant := range record.Variants {
+				recorded[variant.URL] = true
+			}
+			continue
+		}
+		if !dryRun {
+			err = a.store.DeleteMedia(record.ID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	objects, err := a.media.List("")
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range objects {
+		// The exports are written to the upload folder itself
+		if !strings.Contains(object.Name, "/") {
+			continue
+		}
+
+		fileURL := a.uploadDir + object.Name
+		if recorded[fileURL] || used[fileURL] || object.ModTime.After(before) {
+			collection.Kept++
+			continue
+		}
+
+		collection.Removed = append(collection.Removed, object.Name)
+		collection.Size += object.Size
+		if dryRun {
+			continue
+		}
+		err = a.media.Delete(object.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return collection, nil
+}
+
+// usedMedia returns the urls of the uploaded files that adventures and their
+// revisions refer to, and counts the references of every adventure again
+func (a *API) usedMedia() (map[string]bool, error) {
+	used := make(map[string]bool)
+	use := func(adventure *models.Adventure) {
+		for _, mediaURL := range adventure.MediaURLs() {
+			if i := strings.IndexAny(mediaURL, "?#"); i >= 0 {
+				mediaURL = mediaURL[:i]
+			}
+			used[mediaURL] = true
+			if unescaped, err := url.PathUnescape(mediaURL); err == nil {
+				used[unescaped] = true
+			}
+		}
+	}
+
+	ids, err := a.store.GetAdventureIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		err = a.store.UpdateMediaReferences(id)
+		if err != nil {
+			return nil, err
+		}
+
+		found, err := a.store.GetAdventureByID(id)
+		if err != nil {
+			return nil, err
+		}
+		adventure, err := a.store.GetAdventure(found.Slug, models.Ignore)
+		if err != nil {
+			return nil, err
+		}
+		use(adventure)
+
+		revisions, err := a.store.GetRevisions(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, revision := range revisions {
+			snapshot, err := a.store.GetRevision(id, revision.Revision)
+			if err != nil {
+				return nil, err
+			}
+			if snapshot.Adventure != nil {
+				use(snapshot.Adventure)
+			}
+		}
+	}
+
+	return used, nil
+}
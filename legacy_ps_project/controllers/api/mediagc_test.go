@@ -0,0 +1,135 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"projektps/models"
+	"projektps/store/filestore"
+	"projektps/store/memstore"
+)
+
+func TestCollectMedia(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mediagc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := memstore.NewStore()
+	a := &API{store: s, media: filestore.NewFileStore(filepath.Join(dir, "upload"), "/upload/"), uploadDir: "/upload/", systemPath: filepath.ToSlash(dir)}
+
+	write := func(name string) {
+		t.Helper()
+		fileName := filepath.Join(dir, "upload", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fileName, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(url string) bool {
+		_, err := a.media.Stat(a.mediaName(url))
+		return err == nil
+	}
+	store := func(content string) *models.Media {
+		t.Helper()
+		media, err := a.storeMedia(s, []byte(content), content+".png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return media
+	}
+
+	adventure, err := s.CreateDefaultAdventure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := store("used")
+	revised := store("revised")
+	unused := store("unused")
+	orphan := models.MediaURL(strings.Repeat("cd", 32), ".png")
+	write(strings.TrimPrefix(orphan, "/upload/"))
+	write(adventure.Slug + "/kept.jpg")
+	write(adventure.Slug + "/removed.jpg")
+	write("gone/old.jpg")
+	write("PSadventure_gone.zip")
+
+	// The first save is kept as a revision, which still uses its cover
+	for _, cover := range []string{revised.URL, used.URL} {
+		edit, err := s.GetAdventure(adventure.Slug, models.ReadWrite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edit.CoverUrl = cover
+		edit.Nodes[0].ImageURL = "/upload/" + adventure.Slug + "/kept.jpg"
+		edit.Nodes[0].Changed = true
+		if err := s.UpdateAdventureContent(edit, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing is old enough yet
+	collection, err := a.CollectMedia(false, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collection.Removed) != 0 || collection.Kept != 7 {
+		t.Errorf("expected every file to be kept, got %+v", collection)
+	}
+
+	removed := []string{
+		"gone/old.jpg",
+		strings.TrimPrefix(orphan, "/upload/"),
+		strings.TrimPrefix(unused.URL, "/upload/"),
+		adventure.Slug + "/removed.jpg",
+	}
+	sort.Strings(removed)
+
+	collection, err = a.CollectMedia(true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(collection.Removed)
+	if strings.Join(collection.Removed, ",") != strings.Join(removed, ",") || collection.Kept != 3 {
+		t.Errorf("expected %v to be removed, got %+v", removed, collection)
+	}
+	if !exists(unused.URL) || !exists(orphan) {
+		t.Error("expected a dry run to keep the files")
+	}
+
+	collection, err = a.CollectMedia(false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collection.Removed) != len(removed) {
+		t.Errorf("expected %v to be removed, got %+v", removed, collection)
+	}
+	for _, url := range []string{unused.URL, orphan, "/upload/" + adventure.Slug + "/removed.jpg", "/upload/gone/old.jpg"} {
+		if exists(url) {
+			t.Errorf("expected %s to be removed", url)
+		}
+	}
+	for _, url := range []string{used.URL, revised.URL, "/upload/" + adventure.Slug + "/kept.jpg", "/upload/PSadventure_gone.zip"} {
+		if !exists(url) {
+			t.Errorf("expected %s to be kept", url)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "upload", "gone")); !os.IsNotExist(err) {
+		t.Errorf("expected the empty folder to be removed, got %v", err)
+	}
+
+	records, err := s.GetMedia()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].ID != used.ID || records[0].RefCount != 1 || records[1].ID != revised.ID || records[1].RefCount != 0 {
+		t.Errorf("expected the used and revised files to be recorded, got %+v", records)
+	}
+}
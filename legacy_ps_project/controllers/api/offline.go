@@ -0,0 +1,185 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"projektps/controllers/web"
+	"projektps/models"
+)
+
+// offlinePlayerFiles are the files of web/ the offline player needs
+var offlinePlayerFiles = []string{
+	"css/ps_fonts.css",
+	"css/ps.css",
+	"favicon.ico",
+	"img/ConduitLight.woff2",
+	"img/ConduitMedium.woff2",
+	"js/aventyr.model.js",
+	"js/aventyr.viewer.js",
+	"js/markdown-it.min.js",
+	"js/markdownhelper.js",
+	"js/aventyr.player.js",
+	"js/aventyr.props.js",
+	"js/aventyr.scrollytell.js",
+	"js/font_stupidity.js",
+}
+
+// offlinePath returns where the file of url is stored in the offline export,
+// relative to index.html. Only files served by us are included, so false is
+// returned for links to other sites.
+func offlinePath(url string) (string, bool) {
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
+	}
+
+	for _, prefix := range []string{"/upload/", "/static/"} {
+		if !strings.HasPrefix(url, prefix) {
+			continue
+		}
+		clean := path.Clean(url)
+		if !strings.HasPrefix(clean, prefix) {
+			return "", false
+		}
+		return strings.TrimPrefix(clean, "/"), true
+	}
+	return "", false
+}
+
+// offlineAdventure returns a copy of adventure for the offline player, with
+// every file url relative to index.html and the statistics turned off. The
+// files it refers to are returned as paths in the export.
+func offlineAdventure(adventure *models.Adventure) (*models.Adventure, []string, error) {
+	offline := *adventure
+	offline.Nodes = append([]models.Node{}, adventure.Nodes...)
+
+	files := []string{}
+	err := offline.MapMedia(func(url string) string {
+		name, ok := offlinePath(url)
+		if !ok {
+			return url
+		}
+		files = append(files, name)
+		return name
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range offline.Nodes {
+		node := &offline.Nodes[i]
+		if node.Props == "" {
+			continue
+		}
+
+		props, err := models.ParseNodeProps(node.Props)
+		if err != nil {
+			fmt.Println("Skipping node", node.NodeID, "with invalid props:", err.Error())
+			continue
+		}
+		if props.NodeStatistics == nil {
+			continue
+		}
+		props.NodeStatistics = nil
+
+		node.Props, err = props.Encode()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return &offline, files, nil
+}
+
+// writeOfflinePlayer adds index.html with the adventure inlined, the player
+// and every file the adventure refers to. The result plays from a folder or
+// any static host, without the server. scripts are loaded after the player.
+// The names of the added files are returned.
+func (a *API) writeOfflinePlayer(zipWriter *zip.Writer, adventure *models.Adventure, scripts []string) ([]string, error) {
+	offline, media, err := offlineAdventure(adventure)
+	if err != nil {
+		return nil, err
+	}
+
+	viewData := web.ViewData{}
+	viewData.IsOffline = true
+	viewData.Adventure = *offline
+	viewData.Scripts = scripts
+
+	tmpl, err := template.New("ps_player.html").ParseFiles("web/ps_player.html", "web/fonts.html")
+	if err != nil {
+		return nil, err
+	}
+
+	var templateBuffer bytes.Buffer
+	err = tmpl.Execute(&templateBuffer, viewData)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := zipWriter.Create("index.html")
+	if err != nil {
+		return nil, err
+	}
+	writer.Write(templateBuffer.Bytes())
+
+	fileMap := make(map[string]bool)
+	for _, name := range offlinePlayerFiles {
+		fileMap["static/"+name] = true
+	}
+	for _, name := range media {
+		fileMap[name] = true
+	}
+
+	names := []string{}
+	for name := range fileMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	added := []string{"index.html"}
+	for _, name := range names {
+		ok, err := a.addExportFile(zipWriter, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			added = append(added, name)
+		}
+	}
+
+	return added, nil
+}
+
+// addExportFile copies the file served as /name into the zip. A missing file
+// is logged and skipped.
+func (a *API) addExportFile(zipWriter *zip.Writer, name string) (bool, error) {
+	var file io.ReadCloser
+	var err error
+	if strings.HasPrefix(name, "static/") {
+		// /static/ is served from web/
+		file, err = os.Open(a.systemPath + "/web/" + strings.TrimPrefix(name, "static/"))
+	} else {
+		file, err = a.media.Get(a.mediaName("/" + name))
+	}
+	if err != nil {
+		fmt.Println("Missing: " + name)
+		return false, nil
+	}
+	defer file.Close()
+
+	fmt.Println("  Added: " + name)
+
+	zipEntry, err := zipWriter.Create(name)
+	if err != nil {
+		return false, err
+	}
+	_, err = io.Copy(zipEntry, file)
+	return err == nil, err
+}
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"projektps/models"
+	"projektps/services/analytics"
+	"projektps/store"
+)
+
+// maxPlayEventsBody limits the size of the events the player sends at once
+const maxPlayEventsBody = 1 << 20
+
+type playEventsPayload struct {
+	SessionID string             `json:"session_id"`
+	Events    []models.PlayEvent `json:"events"`
+}
+
+// playError is an error of AddPlayEvents with the status to respond with
+type playError struct {
+	status  int
+	message string
+	reason  string
+}
+
+func (e *playError) Error() string {
+	return e.message
+}
+
+// AddPlayEvents records the events of a play session. The player makes up the
+// id of the session and the session is created by its start event. Events
+// the session already has are skipped, so the player can send them again
+// when it does not know if they got through.
+func (a *API) AddPlayEvents(w http.ResponseWriter, r *http.Request) {
+	var payload playEventsPayload
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPlayEventsBody))
+	if err := decoder.Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	if !models.ValidPlaySessionID(payload.SessionID) {
+		respondWithError(w, http.StatusBadRequest, "error.play.invalidsession")
+		return
+	}
+
+	adv, err := a.store.GetAdventure(mux.Vars(r)["id"], models.Ignore)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "error.play.adventurenotfound")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var lastSeq int64
+	err = a.store.WithTransaction(func(tx store.Store) error {
+		// The start event creates the session before it is read, so a second
+		// request with the same start waits for the first one and then skips
+		// the events it added
+		if len(payload.Events) > 0 && payload.Events[0].Type == models.PlayStart {
+			if err := tx.CreatePlaySession(&models.PlaySession{ID: payload.SessionID, AdventureID: adv.ID}); err != nil {
+				return err
+			}
+		}
+		session, err := tx.GetPlaySession(payload.SessionID)
+		if err == sql.ErrNoRows || (err == nil && session.AdventureID != adv.ID) {
+			return &playError{status: http.StatusNotFound, message: "error.play.sessionnotfound"}
+		}
+		if err != nil {
+			return err
+		}
+
+		events := []models.PlayEvent{}
+		for _, event := range payload.Events {
+			if event.Seq > session.LastSeq() {
+				events = append(events, event)
+			}
+		}
+		if err := models.ValidatePlayEvents(session, events); err != nil {
+			return &playError{status: http.StatusBadRequest, message: "error.play.invalidevents", reason: err.Error()}
+		}
+
+		lastSeq = session.LastSeq()
+		if len(events) == 0 {
+			return nil
+		}
+		lastSeq = events[len(events)-1].Seq
+		return tx.AddPlayEvents(session.ID, events)
+	})
+	if err != nil {
+		if playErr, ok := err.(*playError); ok {
+			if playErr.reason != "" {
+				respondWithJSON(w, playErr.status, map[string]string{"error": playErr.message, "reason": playErr.reason})
+				return
+			}
+			respondWithError(w, playErr.status, playErr.message)
+			return
+		}
+		fmt.Println("Error while adding play events", err.Error())
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]int64{"last_seq": lastSeq})
+}
+
+// GetPlaySummary returns how many of the sessions of an adventure reached an
+// end, see loadPlayPeriod for the period
+func (a *API) GetPlaySummary(w http.ResponseWriter, r *http.Request) {
+	adv, from, to, ok := a.loadPlayPeriod(w, r)
+	if !ok {
+		return
+	}
+	counts, err := a.store.CountPlaySessions(adv.ID, from, to, analytics.IdleTimeout)
+	if err != nil {
+		fmt.Println("Error while counting play sessions", err.Error())
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, analytics.Summarize(counts))
+}
+
+// GetPlayNodes returns the time the players spent on each node of an
+// adventure and where they stopped playing
+func (a *API) GetPlayNodes(w http.ResponseWriter, r *http.Request) {
+	adv, from, to, ok := a.loadPlayPeriod(w, r)
+	if !ok {
+		return
+	}
+	counts, err := a.store.GetPlayNodeCounts(adv.ID, from, to, analytics.IdleTimeout)
+	if err != nil {
+		fmt.Println("Error while counting play nodes", err.Error())
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, analytics.Nodes(adv, counts))
+}
+
+// GetPlayPaths returns the most common paths through an adventure, limit
+// sets how many, 10 by default
+func (a *API) GetPlayPaths(w http.ResponseWriter, r *http.Request) {
+	limit := 10
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			respondWithError(w, http.StatusBadRequest, "error.play.invalidlimit")
+			return
+		}
+	}
+
+	adv, from, to, ok := a.loadPlayPeriod(w, r)
+	if !ok {
+		return
+	}
+	paths, err := a.store.GetPlayPaths(adv.ID, from, to)
+	if err != nil {
+		fmt.Println("Error while counting play paths", err.Error())
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, analytics.Paths(paths, limit))
+}
+
+// GetPlayFlow returns how many times each link of an adventure was followed
+// and its share of the choices made on its source, as the nodes and links of
+// a Sankey diagram
+func (a *API) GetPlayFlow(w http.ResponseWriter, r *http.Request) {
+	adv, from, to, ok := a.loadPlayPeriod(w, r)
+	if !ok {
+		return
+	}
+	counts, err := a.store.CountPlaySessions(adv.ID, from, to, analytics.IdleTimeout)
+	if err != nil {
+		fmt.Println("Error while counting play sessions", err.Error())
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	choices, err := a.store.GetPlayChoices(adv.ID, from, to)
+	if err != nil {
+		fmt.Println("Error while counting play choices", err.Error())
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, analytics.LinkFlow(adv, choices, counts.Sessions))
+}
+
+// loadPlayPeriod loads the adventure with its nodes and reads the period of
+// the query, from and to as dates like 2026-10-01, which include the whole
+// day, or times in RFC 3339. The period is the last 30 days by default.
+func (a *API) loadPlayPeriod(w http.ResponseWriter, r *http.Request) (*models.Adventure, time.Time, time.Time, bool) {
+	var from, to time.Time
+	adventureID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return nil, from, to, false
+	}
+
+	query := r.URL.Query()
+	to = time.Now()
+	if value := query.Get("to"); value != "" {
+		to, err = parsePlayTime(value, true)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "error.play.invalidperiod")
+			return nil, from, to, false
+		}
+	}
+	from = to.AddDate(0, 0, -30)
+	if value := query.Get("from"); value != "" {
+		from, err = parsePlayTime(value, false)
+		if err != nil || from.After(to) {
+			respondWithError(w, http.StatusBadRequest, "error.play.invalidperiod")
+			return nil, from, to, false
+		}
+	}
+
+	adv, err := a.store.GetAdventureByID(adventureID)
+	if err == nil {
+		adv, err = a.store.GetAdventure(adv.Slug, models.ReadWrite)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "error.play.adventurenotfound")
+			return nil, from, to, false
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return nil, from, to, false
+	}
+	return adv, from, to, true
+}
+
+// parsePlayTime reads a date or a time in RFC 3339, a date is the start of
+// the day in UTC, or the end of it for endOfDay
+func parsePlayTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return t, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	return t, nil
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"projektps/models"
+	"projektps/store"
+)
+
+// loadRevision fetches the revision with the number found in the named route variable
+func (a *API) loadRevision(w http.ResponseWriter, r *http.Request, adventureID int64, name string) (*models.Revision, bool) {
+	number, err := strconv.ParseInt(mux.Vars(r)[name], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "error.revision.parametererror")
+		return nil, false
+	}
+
+	revision, err := a.store.GetRevision(adventureID, number)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "error.revision.revisionnotfound")
+			return nil, false
+		}
+		fmt.Println("Error while loading revision", err.Error())
+		respondWithError(w, http.StatusInternalServerError, "error.revision.fetcherror")
+		return nil, false
+	}
+
+	return revision, true
+}
+
+// GetRevisions lists the saved revisions of an adventure, newest first
+func (a *API) GetRevisions(w http.ResponseWriter, r *http.Request) {
+	adv, ok := a.loadAdventureForEdit(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := a.store.GetRevisions(adv.ID)
+	if err != nil {
+		fmt.Println("Error while loading revisions", err.Error())
+		respondWithError(w, http.StatusInternalServerError, "error.revision.fetcherror")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, revisions)
+}
+
+// GetRevision returns a single revision including its adventure snapshot
+func (a *API) GetRevision(w http.ResponseWriter, r *http.Request) {
+	adv, ok := a.loadAdventureForEdit(w, r)
+	if !ok {
+		return
+	}
+
+	revision, ok := a.loadRevision(w, r, adv.ID, "revision")
+	if !ok {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, revision)
+}
+
+// DiffRevisions returns the differences between two revisions of an adventure
+func (a *API) DiffRevisions(w http.ResponseWriter, r *http.Request) {
+	adv, ok := a.loadAdventureForEdit(w, r)
+	if !ok {
+		return
+	}
+
+	from, ok := a.loadRevision(w, r, adv.ID, "from")
+	if !ok {
+		return
+	}
+
+	to, ok := a.loadRevision(w, r, adv.ID, "to")
+	if !ok {
+		return
+	}
+
+	diff := models.DiffAdventures(from.Adventure, to.Adventure)
+	diff.From = from.Revision
+	diff.To = to.Revision
+
+	respondWithJSON(w, http.StatusOK, diff)
+}
+
+// RestoreRevision saves the content of an older revision as the new head.
+// The restore is a regular save, so it is recorded as a revision of its own
+// and the revisions in between are kept.
+func (a *API) RestoreRevision(w http.ResponseWriter, r *http.Request) {
+	adv, ok := a.loadAdventureForEdit(w, r)
+	if !ok {
+		return
+	}
+
+	if adv.Locked {
+		respondWithError(w, http.StatusNotFound, "Adventure is read-only")
+		return
+	}
+
+	revision, ok := a.loadRevision(w, r, adv.ID, "revision")
+	if !ok {
+		return
+	}
+
+	restored := revision.Adventure
+	restored.ID = adv.ID
+	restored.Slug = adv.Slug
+	restored.ViewSlug = adv.ViewSlug
+	restored.Locked = adv.Locked
+	restored.EditVersion = adv.EditVersion
+
+	// Nodes and links are recreated, the graph is held together by node_id/link_id
+	for i := range restored.Nodes {
+		restored.Nodes[i].ID = 0
+	}
+	for i := range restored.Links {
+		restored.Links[i].ID = 0
+	}
+
+	err := a.store.UpdateAdventureContent(restored, requestUserID(r))
+	if err != nil {
+		if err == store.ErrVersionConflict {
+			a.respondWithVersionConflict(w, adv.Slug)
+			return
+		}
+		fmt.Println("Error while restoring revision", err.Error())
+		respondWithError(w, http.StatusInternalServerError, "error.revision.restoreerror")
+		return
+	}
+
+	updatedAdventure, err := a.store.GetAdventure(adv.Slug, models.ReadWrite)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "error.adventure.adventurenotfound")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, updatedAdventure)
+}
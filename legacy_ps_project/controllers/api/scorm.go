@@ -0,0 +1,90 @@
+package api
+
+import (
+	"archive/zip"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"projektps/models"
+	"projektps/services/scorm"
+)
+
+// scormSettingsScript is written to the package with the settings of the
+// adapter, aventyr.scorm.js is copied from web/js
+const (
+	scormSettingsScript = "static/js/scorm_settings.js"
+	scormAdapterScript  = "static/js/aventyr.scorm.js"
+)
+
+// exportScorm responds with the adventure as a SCORM package. ?completion=80
+// also completes the adventure when 80 percent of the nodes are visited.
+func (a *API) exportScorm(w http.ResponseWriter, r *http.Request, slug string, version scorm.Version) {
+	settings := scorm.Settings{Version: version}
+	if completion := r.URL.Query().Get("completion"); completion != "" {
+		percent, err := strconv.Atoi(completion)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "error.adventure.invalidcompletion")
+			return
+		}
+		settings.CompletionPercent = percent
+	}
+	if err := settings.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "error.adventure.invalidcompletion")
+		return
+	}
+
+	zipName, err := a.CreateScormExport(slug, settings)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "error.adventure.adventurenotfound")
+			return
+		}
+		fmt.Println("SCORM export error: ", err.Error())
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	a.respondWithExportZip(w, zipName)
+}
+
+// CreateScormExport writes a SCORM package of the offline player, with an
+// imsmanifest.xml and an adapter that reports completion to the LMS
+func (a *API) CreateScormExport(slug string, settings scorm.Settings) (string, error) {
+	if err := settings.Validate(); err != nil {
+		return "", err
+	}
+
+	return a.createExportZip(slug, &exportPackage{
+		suffix:  "_" + string(settings.Version),
+		scripts: []string{scormSettingsScript, scormAdapterScript},
+		write: func(zipWriter *zip.Writer, adventure *models.Adventure, files []string) error {
+			writer, err := zipWriter.Create(scormSettingsScript)
+			if err != nil {
+				return err
+			}
+			writer.Write(settings.Script())
+
+			ok, err := a.addExportFile(zipWriter, scormAdapterScript)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("the SCORM adapter %s is missing", scormAdapterScript)
+			}
+			files = append(files, scormSettingsScript, scormAdapterScript)
+
+			manifest, err := scorm.Manifest(settings.Version, adventure.ViewSlug, adventure.Title, "index.html", files)
+			if err != nil {
+				return err
+			}
+			writer, err = zipWriter.Create("imsmanifest.xml")
+			if err != nil {
+				return err
+			}
+			_, err = writer.Write(manifest)
+			return err
+		},
+	})
+}
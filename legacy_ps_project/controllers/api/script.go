@@ -0,0 +1,53 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"projektps/services/script"
+)
+
+// GetAdventureScript responds with the adventure as a numbered script to read
+// on paper, as print styled HTML or with ?format=md as Markdown
+func (a *API) GetAdventureScript(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	format := script.Format(r.URL.Query().Get("format"))
+	contentType := ""
+	switch format {
+	case "", script.FormatHTML:
+		format = script.FormatHTML
+		contentType = "text/html; charset=utf-8"
+	case script.FormatMarkdown:
+		contentType = "text/markdown; charset=utf-8"
+	default:
+		respondWithError(w, http.StatusBadRequest, "error.adventure.invalidformat")
+		return
+	}
+
+	adv, err := a.loadAdventure(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "error.adventure.adventurenotfound")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	data, err := script.Render(adv, format)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if format == script.FormatMarkdown {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"PSadventure_%s.md\"", adv.ViewSlug))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"projektps/models"
+	"projektps/services/twine"
+)
+
+type twineImportResult struct {
+	Adventure *models.Adventure `json:"adventure"`
+	Warnings  []twine.Warning   `json:"warnings"`
+}
+
+// importTwine creates an adventure from a Twee or Twine HTML story and
+// responds with it along with what could not be imported
+func (a *API) importTwine(w http.ResponseWriter, r *http.Request, data []byte) {
+	adventure, warnings, err := a.ImportTwineStory(data, requestUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, twineImportResult{Adventure: adventure, Warnings: warnings})
+}
+
+// ImportTwineStory creates an adventure from a Twee 3 or Twine 2 HTML story
+func (a *API) ImportTwineStory(data []byte, userID int64) (*models.Adventure, []twine.Warning, error) {
+	story, err := twine.Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	adventure, warnings := twine.ToAdventure(story)
+	if len(adventure.Nodes) == 0 {
+		return nil, warnings, fmt.Errorf("the story has no passages")
+	}
+
+	// New adventures start out in the first category
+	adventure.Category.ID = 1
+
+	err = a.createImportedAdventure(adventure, nil, userID)
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	imported, err := a.store.GetAdventure(adventure.Slug, models.ReadWrite)
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	return imported, warnings, nil
+}
+
+// exportTwine responds with the adventure as a Twine story. What could not be
+// exported is logged and counted in the X-Twine-Warnings header.
+func (a *API) exportTwine(w http.ResponseWriter, slug string, format twine.Format) {
+	data, warnings, err := a.CreateTwineExport(slug, format)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "error.adventure.adventurenotfound")
+			return
+		}
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, warning := range warnings {
+		fmt.Println("  Twine export:", warning)
+	}
+
+	contentType := "text/plain; charset=utf-8"
+	if format == twine.FormatHTML {
+		contentType = "text/html; charset=utf-8"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"PSadventure_%s.%s\"", slug, format))
+	w.Header().Set("X-Twine-Warnings", fmt.Sprint(len(warnings)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// CreateTwineExport converts an adventure to a Twine story in format
+func (a *API) CreateTwineExport(slug string, format twine.Format) ([]byte, []twine.Warning, error) {
+	fmt.Println("* Exporting adventure to Twine:", slug)
+
+	if format != twine.FormatTwee && format != twine.FormatHTML {
+		return nil, nil, fmt.Errorf("unknown export format %q", format)
+	}
+
+	// Ignore which slug was passed (read or read/write)
+	adventure, err := a.store.GetAdventure(slug, models.Ignore)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	story, warnings := twine.FromAdventure(adventure)
+	data, err := twine.Write(story, format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, warnings, nil
+}
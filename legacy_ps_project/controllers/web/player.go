@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/skip2/go-qrcode"
@@ -41,11 +43,14 @@ func (web *Web) PlayerHandlerCommon(w http.ResponseWriter, r *http.Request, prev
 
 	adv, err := web.store.GetAdventure(slug, models.Ignore)
 	if err != nil {
-		web.NotFoundHandler(w, r)
+		if !web.redirectRenamedSlug(w, r, slug) {
+			web.NotFoundHandler(w, r)
+		}
 		return
 	}
 
 	viewData.Adventure = *adv
+	viewData.MediaSrcSets = web.mediaSrcSets(adv)
 
 	web.Process("ps_player.html", w, viewData);
 
@@ -54,6 +59,32 @@ func (web *Web) PlayerHandlerCommon(w http.ResponseWriter, r *http.Request, prev
 	}
 }
 
+// mediaSrcSets returns the srcsets of the images of adventure that have
+// variants, so that the player can pick the one that fits the screen
+func (web *Web) mediaSrcSets(adventure *models.Adventure) map[string]string {
+	srcsets := make(map[string]string)
+	records, err := web.store.GetAdventureMedia(adventure.ID)
+	if err != nil {
+		fmt.Println("Error while fetching adventure media", err.Error())
+		return srcsets
+	}
+	byHash := make(map[string]*models.Media, len(records))
+	for i := range records {
+		byHash[records[i].Hash] = &records[i]
+	}
+
+	for _, url := range adventure.MediaURLs() {
+		hash, ok := models.ParseMediaURL(url)
+		if !ok || byHash[hash] == nil {
+			continue
+		}
+		if srcset := byHash[hash].SrcSet(); srcset != "" {
+			srcsets[url] = srcset
+		}
+	}
+	return srcsets
+}
+
 // PlayerQRHandler generates a QR code containing a link for the adventure
 func (web *Web) PlayerQRHandler(w http.ResponseWriter, r *http.Request) {
 	// Get slug
@@ -69,7 +100,9 @@ func (web *Web) PlayerQRHandler(w http.ResponseWriter, r *http.Request) {
 	_, err := web.store.GetAdventure(slug, models.ReadOnly)
 	if err == sql.ErrNoRows {
 		// respondWithError(w, http.StatusBadRequest, "Invalid adventure ID")
-		web.NotFoundHandler(w, r)
+		if !web.redirectRenamedSlug(w, r, slug) {
+			web.NotFoundHandler(w, r)
+		}
 		return
 	}
 
@@ -87,3 +120,24 @@ func (web *Web) PlayerQRHandler(w http.ResponseWriter, r *http.Request) {
 		fmt.Println("[error] Unable to write image PNG (", slug, ")")
 	}
 }
+
+// redirectRenamedSlug sends a permanent redirect if slug is the old play slug
+// of an adventure, keeping links and QR codes to the old slug working
+func (web *Web) redirectRenamedSlug(w http.ResponseWriter, r *http.Request, slug string) bool {
+	viewSlug, err := web.store.GetSlugRedirect(slug)
+	if err != nil {
+		return false
+	}
+
+	segments := strings.Split(r.URL.Path, "/")
+	for i, segment := range segments {
+		if segment == slug {
+			segments[i] = viewSlug
+			break
+		}
+	}
+
+	target := url.URL{Path: strings.Join(segments, "/"), RawQuery: r.URL.RawQuery}
+	http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+	return true
+}
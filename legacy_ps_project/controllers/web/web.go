@@ -24,9 +24,14 @@ type ViewData struct {
 	Adventure  models.Adventure
 	Lists      []models.List
 	IsEditable bool
+	IsOffline  bool
+	Scripts    []string
 	IsRoot     bool
 	Host       string
 	Version    string
+	// MediaSrcSets are the srcsets of the images of Adventure that have
+	// narrower variants, by url
+	MediaSrcSets map[string]string
 }
 
 func NewWebController(store *store.Store, version string, path string, environment string) *Web {
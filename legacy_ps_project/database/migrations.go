@@ -0,0 +1,11 @@
+// Package database embeds the migrations of the MySQL schema, so that the
+// server and toolps can apply them without the files being deployed
+package database
+
+import "embed"
+
+// Migrations contains migrations/*.sql, see sqlstore.LoadMigrations for the
+// naming of the files
+//
+//go:embed migrations/*.sql
+var Migrations embed.FS
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `adventure_revision`;
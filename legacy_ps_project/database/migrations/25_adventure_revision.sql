@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `adventure_revision` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `adventure_id` int(11) NOT NULL,
+  `revision` int(11) NOT NULL,
+  `user_id` int(11) DEFAULT NULL,
+  `snapshot` longtext NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `adventure_revision_number` (`adventure_id`, `revision`),
+  CONSTRAINT `adventure_revision_ibfk_1` FOREIGN KEY (`adventure_id`) REFERENCES `adventure` (`id`) ON DELETE CASCADE ON UPDATE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
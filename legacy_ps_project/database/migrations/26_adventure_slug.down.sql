@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS `adventure_slug_redirect`;
+
+ALTER TABLE `adventure`
+  DROP INDEX `adventure_slug`,
+  DROP INDEX `adventure_view_slug`;
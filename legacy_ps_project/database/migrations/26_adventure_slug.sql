@@ -0,0 +1,19 @@
+-- Slugs were never unique, the adventures that share one with an older
+-- adventure get their id appended, within the 30 characters of the column
+UPDATE `adventure` SET `slug` = CONCAT(SUBSTR(`slug`, 1, 30 - LENGTH(`id`)), `id`)
+WHERE `id` NOT IN (SELECT `id` FROM (SELECT MIN(`id`) AS `id` FROM `adventure` GROUP BY `slug`) AS `first_slug`);
+
+UPDATE `adventure` SET `view_slug` = CONCAT(SUBSTR(`view_slug`, 1, 29 - LENGTH(`id`)), '-', `id`)
+WHERE `id` NOT IN (SELECT `id` FROM (SELECT MIN(`id`) AS `id` FROM `adventure` GROUP BY `view_slug`) AS `first_view_slug`);
+
+ALTER TABLE `adventure`
+  ADD UNIQUE KEY `adventure_slug` (`slug`),
+  ADD UNIQUE KEY `adventure_view_slug` (`view_slug`);
+
+CREATE TABLE IF NOT EXISTS `adventure_slug_redirect` (
+  `slug` varchar(30) NOT NULL,
+  `adventure_id` int(11) NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`slug`),
+  CONSTRAINT `adventure_slug_redirect_ibfk_1` FOREIGN KEY (`adventure_id`) REFERENCES `adventure` (`id`) ON DELETE CASCADE ON UPDATE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `media_reference`;
+DROP TABLE IF EXISTS `media`;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS `media` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `hash` char(64) NOT NULL,
+  `url` varchar(255) NOT NULL,
+  `size` bigint(20) NOT NULL DEFAULT 0,
+  `content_type` varchar(100) NOT NULL DEFAULT '',
+  `created_at` timestamp NOT NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `media_hash` (`hash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `media_reference` (
+  `media_id` int(11) NOT NULL,
+  `adventure_id` int(11) NOT NULL,
+  `ref_count` int(11) NOT NULL DEFAULT 1,
+  PRIMARY KEY (`media_id`, `adventure_id`),
+  KEY `media_reference_adventure` (`adventure_id`),
+  CONSTRAINT `media_reference_ibfk_1` FOREIGN KEY (`media_id`) REFERENCES `media` (`id`) ON DELETE CASCADE ON UPDATE RESTRICT,
+  CONSTRAINT `media_reference_ibfk_2` FOREIGN KEY (`adventure_id`) REFERENCES `adventure` (`id`) ON DELETE CASCADE ON UPDATE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
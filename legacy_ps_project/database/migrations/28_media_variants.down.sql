@@ -0,0 +1,5 @@
+ALTER TABLE `media`
+  DROP COLUMN `width`,
+  DROP COLUMN `height`,
+  DROP COLUMN `thumbnail`,
+  DROP COLUMN `variants`;
@@ -0,0 +1,5 @@
+ALTER TABLE `media`
+  ADD COLUMN `width` int(11) NOT NULL DEFAULT 0,
+  ADD COLUMN `height` int(11) NOT NULL DEFAULT 0,
+  ADD COLUMN `thumbnail` varchar(255) NOT NULL DEFAULT '',
+  ADD COLUMN `variants` varchar(2048) NOT NULL DEFAULT '';
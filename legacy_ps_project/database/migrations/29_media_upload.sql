@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS `media_upload` (
+  `media_id` int(11) NOT NULL,
+  `adventure_id` int(11) NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`media_id`, `adventure_id`),
+  KEY `media_upload_adventure` (`adventure_id`),
+  CONSTRAINT `media_upload_ibfk_1` FOREIGN KEY (`media_id`) REFERENCES `media` (`id`) ON DELETE CASCADE ON UPDATE RESTRICT,
+  CONSTRAINT `media_upload_ibfk_2` FOREIGN KEY (`adventure_id`) REFERENCES `adventure` (`id`) ON DELETE CASCADE ON UPDATE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
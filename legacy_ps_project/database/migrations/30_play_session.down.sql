@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `play_event`;
+DROP TABLE IF EXISTS `play_session`;
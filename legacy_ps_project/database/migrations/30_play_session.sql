@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS `play_session` (
+  `id` varchar(64) NOT NULL,
+  `adventure_id` int(11) NOT NULL,
+  `started_at` timestamp NOT NULL DEFAULT current_timestamp(),
+  `updated_at` timestamp NOT NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`id`),
+  KEY `play_session_adventure` (`adventure_id`, `started_at`),
+  CONSTRAINT `play_session_ibfk_1` FOREIGN KEY (`adventure_id`) REFERENCES `adventure` (`id`) ON DELETE CASCADE ON UPDATE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `play_event` (
+  `session_id` varchar(64) NOT NULL,
+  `seq` int(11) NOT NULL,
+  `type` varchar(16) NOT NULL,
+  `node_id` int(11) DEFAULT NULL,
+  `link_id` int(11) DEFAULT NULL,
+  `offset_ms` bigint(20) NOT NULL DEFAULT 0,
+  `created_at` timestamp NOT NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`session_id`, `seq`),
+  KEY `play_event_node` (`node_id`),
+  CONSTRAINT `play_event_ibfk_1` FOREIGN KEY (`session_id`) REFERENCES `play_session` (`id`) ON DELETE CASCADE ON UPDATE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -35,11 +35,6 @@ type Adventure struct {
 	Users		[]User     `json:"users"`
 }
 
-type AdventureProps struct {
-	FontList []string `json:"font_list"`
-}
-
-
 // Permission denotes mutability permission
 type Permission int
 
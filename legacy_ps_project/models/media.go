@@ -0,0 +1,136 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MediaURLPrefix is where uploaded files are served by the SHA-256 of their
+// uploaded content. The files are shared by every adventure that refers to them, so
+// copies of an adventure do not copy them.
+const MediaURLPrefix = "/upload/media/"
+
+// Media is an uploaded file stored once by its content
+type Media struct {
+	ID          int64     `json:"id"`
+	Hash        string    `json:"hash"`
+	URL         string    `json:"url"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	CreatedAt   time.Time `json:"created_at"`
+	// RefCount is how many times the content of adventures refers to the
+	// file, as counted when they were last saved
+	RefCount int64 `json:"ref_count"`
+
+	// The size of an image, and its narrower copies for small screens,
+	// narrowest first, see MediaVariantURL
+	Width     int            `json:"width,omitempty"`
+	Height    int            `json:"height,omitempty"`
+	Variants  []MediaVariant `json:"variants,omitempty"`
+	Thumbnail string         `json:"thumbnail,omitempty"`
+}
+
+// MediaVariant is a narrower copy of an uploaded image
+type MediaVariant struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// SrcSet returns the variants and the image itself as the srcset of an img
+// element, or "" if there are no variants
+func (m *Media) SrcSet() string {
+	if len(m.Variants) == 0 || m.Width == 0 {
+		return ""
+	}
+	candidates := []string{}
+	for _, variant := range m.Variants {
+		candidates = append(candidates, fmt.Sprintf("%s %dw", variant.URL, variant.Width))
+	}
+	candidates = append(candidates, fmt.Sprintf("%s %dw", m.URL, m.Width))
+	return strings.Join(candidates, ", ")
+}
+
+var mediaHash = regexp.MustCompile(`^[0-9a-f]{64}$`)
+var mediaExtension = regexp.MustCompile(`^\.[a-z0-9]{1,10}$`)
+
+// MediaURL returns the url of the file with the SHA-256 hash and extension,
+// like /upload/media/ab/ab12….jpg. An extension that is not plain letters
+// and digits is left out.
+func MediaURL(hash string, extension string) string {
+	extension = strings.ToLower(extension)
+	if !mediaExtension.MatchString(extension) {
+		extension = ""
+	}
+	return MediaURLPrefix + hash[:2] + "/" + hash + extension
+}
+
+// MediaVariantURL returns the url of a variant of the file with the SHA-256
+// hash, next to it, like /upload/media/ab/ab12…-w960.jpg
+func MediaVariantURL(hash string, name string, extension string) string {
+	return MediaURL(hash, "") + "-" + name + strings.ToLower(extension)
+}
+
+// ParseMediaURL returns the hash of a url made by MediaURL
+func ParseMediaURL(url string) (string, bool) {
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
+	}
+	if !strings.HasPrefix(url, MediaURLPrefix) {
+		return "", false
+	}
+
+	parts := strings.Split(strings.TrimPrefix(url, MediaURLPrefix), "/")
+	if len(parts) != 2 {
+		return "", false
+	}
+	hash := parts[1]
+	if i := strings.Index(hash, "."); i >= 0 {
+		if !mediaExtension.MatchString(hash[i:]) {
+			return "", false
+		}
+		hash = hash[:i]
+	}
+	if !mediaHash.MatchString(hash) || parts[0] != hash[:2] {
+		return "", false
+	}
+	return hash, true
+}
+
+// mediaFileURL matches the urls of MediaURL and MediaVariantURL
+var mediaFileURL = regexp.MustCompile(`^` + regexp.QuoteMeta(MediaURLPrefix) + `([0-9a-f]{2})/([0-9a-f]{64})(-[a-z0-9]+)?(\.[a-z0-9]{1,10})?$`)
+
+// IsMediaFileURL is true for the url of a file or a variant under
+// MediaURLPrefix. Their names are made from the content, so they never
+// change.
+func IsMediaFileURL(url string) bool {
+	_, ok := MediaFileETag(url)
+	return ok
+}
+
+// MediaFileETag is a strong ETag for a file or a variant under
+// MediaURLPrefix, made from the hash in its name and the name of the variant
+func MediaFileETag(url string) (string, bool) {
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
+	}
+	match := mediaFileURL.FindStringSubmatch(url)
+	if match == nil || match[1] != match[2][:2] {
+		return "", false
+	}
+	return `"` + match[2] + match[3] + `"`, true
+}
+
+// MediaReferences counts how many times the adventure refers to each file
+// under MediaURLPrefix, by hash
+func (a *Adventure) MediaReferences() map[string]int64 {
+	references := make(map[string]int64)
+	for _, url := range a.MediaURLs() {
+		if hash, ok := ParseMediaURL(url); ok {
+			references[hash]++
+		}
+	}
+	return references
+}
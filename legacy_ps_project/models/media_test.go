@@ -0,0 +1,62 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMediaURL(t *testing.T) {
+	hash := "ab" + strings.Repeat("0", 62)
+	url := MediaURL(hash, ".JPG")
+	if url != "/upload/media/ab/"+hash+".jpg" {
+		t.Errorf("unexpected url %s", url)
+	}
+	if parsed, ok := ParseMediaURL(url + "?v=1"); !ok || parsed != hash {
+		t.Errorf("expected %s, got %s", hash, parsed)
+	}
+	if url := MediaURL(hash, ".j/../pg"); url != "/upload/media/ab/"+hash {
+		t.Errorf("expected the extension to be left out, got %s", url)
+	}
+
+	for _, url := range []string{"/upload/abc/" + hash + ".jpg", "/upload/media/cd/" + hash + ".jpg", "/upload/media/ab/ab12.jpg", "/upload/media/ab/x/" + hash} {
+		if _, ok := ParseMediaURL(url); ok {
+			t.Errorf("expected %s not to be a media url", url)
+		}
+	}
+}
+
+func TestMediaVariants(t *testing.T) {
+	hash := "ab" + strings.Repeat("0", 62)
+	media := Media{URL: MediaURL(hash, ".jpg"), Width: 2000}
+	if srcset := media.SrcSet(); srcset != "" {
+		t.Errorf("expected no srcset without variants, got %s", srcset)
+	}
+
+	variant := MediaVariantURL(hash, "w960", ".JPG")
+	if variant != "/upload/media/ab/"+hash+"-w960.jpg" {
+		t.Errorf("unexpected url %s", variant)
+	}
+	// A variant is not referred to by itself
+	if _, ok := ParseMediaURL(variant); ok {
+		t.Errorf("expected %s not to be a media url", variant)
+	}
+	// ..but it never changes, like the file
+	for _, url := range []string{variant, media.URL + "?t=1", MediaURL(hash, "")} {
+		if !IsMediaFileURL(url) {
+			t.Errorf("expected %s to be a media file", url)
+		}
+	}
+	if etag, _ := MediaFileETag(variant + "?t=1"); etag != `"`+hash+`-w960"` {
+		t.Errorf("unexpected ETag %s", etag)
+	}
+	for _, url := range []string{"/upload/abc/skog.jpg", "/upload/media/cd/" + hash + ".jpg", MediaURL(hash, "") + "-W960.jpg"} {
+		if IsMediaFileURL(url) {
+			t.Errorf("expected %s not to be a media file", url)
+		}
+	}
+
+	media.Variants = []MediaVariant{{URL: variant, Width: 960, Height: 480}}
+	if srcset := media.SrcSet(); srcset != variant+" 960w, "+media.URL+" 2000w" {
+		t.Errorf("unexpected srcset %s", srcset)
+	}
+}
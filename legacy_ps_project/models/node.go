@@ -18,9 +18,3 @@ type Node struct {
 	Changed         bool   `json:"changed,omitempty"` // Changed is used to identify which nodes should be updated
 	Props			string `json:"props,omitempty"` // Various node properties (mostly visual selectors) stored in a json field
 }
-
-type Props struct {
-	AudioUrl string `json:"audio_url,omitempty"`
-	AudioUrlAlt string `json:"audio_url_alt,omitempty"`
-	SubtitlesUrl string `json:"subtitles_url,omitempty"`
-}
\ No newline at end of file
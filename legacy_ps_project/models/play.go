@@ -0,0 +1,158 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// PlayEventType is what happened in a play session
+type PlayEventType string
+
+// The events of a play session
+const (
+	// PlayStart is the first event of every session
+	PlayStart PlayEventType = "start"
+	// PlayNode is sent when a node is shown
+	PlayNode PlayEventType = "node"
+	// PlayChoice is sent when the player follows a link
+	PlayChoice PlayEventType = "choice"
+	// PlayEnd is sent when the player reaches a node without links
+	PlayEnd PlayEventType = "end"
+)
+
+// MaxPlayEvents is the number of events a session may have
+const MaxPlayEvents = 5000
+
+// PlayEvent is an event of a play session. Seq numbers the events of a
+// session from 1, in the order they happened. Node and choice events have
+// the node_id of the node shown and the link_id of the link followed.
+type PlayEvent struct {
+	Seq    int64         `json:"seq"`
+	Type   PlayEventType `json:"type"`
+	NodeID *int64        `json:"node_id,omitempty"`
+	LinkID *int64        `json:"link_id,omitempty"`
+	// Offset is the time of the event in milliseconds from the start of the
+	// session, by the clock of the player
+	Offset int64 `json:"t"`
+}
+
+// PlaySession is an anonymous play of an adventure. Its ID is made up by the
+// player and only tells the events of one play apart from the others.
+type PlaySession struct {
+	ID          string      `json:"id"`
+	AdventureID int64       `json:"-"`
+	StartedAt   time.Time   `json:"started_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	Events      []PlayEvent `json:"events"`
+}
+
+// Ended is true for a session that reached an end
+func (s *PlaySession) Ended() bool {
+	return len(s.Events) > 0 && s.Events[len(s.Events)-1].Type == PlayEnd
+}
+
+// LastSeq is the number of the last event of the session, 0 without events
+func (s *PlaySession) LastSeq() int64 {
+	if len(s.Events) == 0 {
+		return 0
+	}
+	return s.Events[len(s.Events)-1].Seq
+}
+
+// PlayCounts counts the sessions of an adventure by how they ended. A
+// session that has not ended is abandoned when it has had no events for the
+// idle time the sessions were counted with, else it is in progress.
+type PlayCounts struct {
+	Sessions  int
+	Completed int
+	Abandoned int
+}
+
+// PlayNodeCounts is what the sessions of an adventure did on a node. Visits
+// counts every time the node was shown and Sessions the sessions that showed
+// it, Concluded those of them that were completed or abandoned and DropOffs
+// the abandoned ones that showed it last.
+type PlayNodeCounts struct {
+	NodeID    int64
+	Visits    int
+	Sessions  int
+	Concluded int
+	DropOffs  int
+	// Durations are the times in milliseconds from when the node was shown
+	// until the next choice or node, for the visits followed by one, in
+	// ascending order
+	Durations []int64
+}
+
+// PlayPathCounts counts the sessions that were shown the same nodes in
+// order. A node shown again right after itself is only listed once.
+type PlayPathCounts struct {
+	Nodes     []int64
+	Completed bool
+	Count     int
+}
+
+// PlayChoiceCounts counts the choices of a link made on the node Source
+// that led to Target, and the sessions that made them
+type PlayChoiceCounts struct {
+	Source   int64
+	Target   int64
+	LinkID   int64
+	Value    int
+	Sessions int
+}
+
+var playSessionID = regexp.MustCompile(`^[A-Za-z0-9_-]{16,64}$`)
+
+// ValidPlaySessionID is true for the ids the player makes, like a UUID
+func ValidPlaySessionID(id string) bool {
+	return playSessionID.MatchString(id)
+}
+
+// ValidatePlayEvents checks that events can follow the last event of
+// session, which is nil for a new session. The first event of a session is
+// a start, nodes need a node id, choices a link id, nothing follows an end
+// and the numbers and times of the events go up.
+func ValidatePlayEvents(session *PlaySession, events []PlayEvent) error {
+	var last *PlayEvent
+	if session != nil && len(session.Events) > 0 {
+		last = &session.Events[len(session.Events)-1]
+	}
+
+	for i := range events {
+		event := &events[i]
+		switch {
+		case last == nil && (event.Type != PlayStart || event.Seq != 1):
+			return fmt.Errorf("a session starts with a start event with seq 1")
+		case last != nil && event.Type == PlayStart:
+			return fmt.Errorf("event %d: the session has started already", event.Seq)
+		case last != nil && last.Type == PlayEnd:
+			return fmt.Errorf("event %d: the session has ended", event.Seq)
+		case last != nil && event.Seq != last.Seq+1:
+			return fmt.Errorf("event %d: expected event %d", event.Seq, last.Seq+1)
+		case last != nil && event.Offset < last.Offset:
+			return fmt.Errorf("event %d: the time goes back", event.Seq)
+		case event.Seq > MaxPlayEvents:
+			return fmt.Errorf("event %d: a session has at most %d events", event.Seq, MaxPlayEvents)
+		case event.Offset < 0:
+			return fmt.Errorf("event %d: the time is negative", event.Seq)
+		}
+
+		switch event.Type {
+		case PlayStart, PlayEnd:
+		case PlayNode:
+			if event.NodeID == nil {
+				return fmt.Errorf("event %d: a node event needs a node_id", event.Seq)
+			}
+		case PlayChoice:
+			if event.LinkID == nil {
+				return fmt.Errorf("event %d: a choice event needs a link_id", event.Seq)
+			}
+		default:
+			return fmt.Errorf("event %d: unknown type %q", event.Seq, event.Type)
+		}
+		last = event
+	}
+	return nil
+}
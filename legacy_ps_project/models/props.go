@@ -0,0 +1,466 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Number is a numeric prop value. The editor saves these both as strings
+// ("50") and as numbers (50), the original form is kept when written back.
+type Number struct {
+	value  string
+	quoted bool
+}
+
+// NewNumber creates a number that is saved as a JSON number
+func NewNumber(value float64) Number {
+	return Number{value: strconv.FormatFloat(value, 'f', -1, 64)}
+}
+
+// NewNumberString creates a number that is saved as a JSON string
+func NewNumberString(value string) Number {
+	return Number{value: value, quoted: true}
+}
+
+// String returns the value as it was written, without quotes
+func (n Number) String() string {
+	return n.value
+}
+
+// Float returns the value as a float, ok is false for empty or non numeric values
+func (n Number) Float() (float64, bool) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(n.value), 64)
+	return value, err == nil
+}
+
+// Int returns the value as an integer, ok is false unless it is a whole number
+func (n Number) Int() (int64, bool) {
+	value, ok := n.Float()
+	return int64(value), ok && value == float64(int64(value))
+}
+
+// IsEmpty is true for null and empty string values
+func (n Number) IsEmpty() bool {
+	return strings.TrimSpace(n.value) == ""
+}
+
+// MarshalJSON writes the number in the form it was read
+func (n Number) MarshalJSON() ([]byte, error) {
+	if n.quoted {
+		return json.Marshal(n.value)
+	}
+	if n.value == "" {
+		return []byte("null"), nil
+	}
+	if _, ok := n.Float(); !ok {
+		return json.Marshal(n.value)
+	}
+	return []byte(n.value), nil
+}
+
+// UnmarshalJSON accepts strings, numbers and null
+func (n *Number) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		*n = Number{}
+	case string:
+		*n = Number{value: v, quoted: true}
+	case float64:
+		*n = Number{value: string(data)}
+	default:
+		return &json.UnmarshalTypeError{Value: string(data), Type: reflect.TypeOf(n)}
+	}
+	return nil
+}
+
+// StringList is a list of strings that older editor versions saved as a
+// single string, which is kept when written back
+type StringList struct {
+	Values []string
+	single bool
+}
+
+// MarshalJSON writes the list in the form it was read
+func (l StringList) MarshalJSON() ([]byte, error) {
+	if l.single && len(l.Values) == 1 {
+		return json.Marshal(l.Values[0])
+	}
+	if l.Values == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(l.Values)
+}
+
+// UnmarshalJSON accepts a string or a list of strings
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		*l = StringList{Values: []string{value}, single: true}
+		return nil
+	}
+
+	*l = StringList{}
+	return json.Unmarshal(data, &l.Values)
+}
+
+// NodeProps contains the documented keys of node.props, see
+// EDITOR_SETTINGS_CATALOG.md. Keys that are not part of the struct are
+// kept as they are when the props are written back.
+type NodeProps struct {
+	ChapterType    []string `json:"settings_chapterType"`
+	OrderedLinkIDs []Number `json:"ordered_link_ids"`
+	NodeConditions []string `json:"node_conditions"`
+	NodeStatistics []string `json:"node_statistics"`
+	NodeTimer      *Number  `json:"node_timer"`
+
+	NavigationStyle []string `json:"background.navigation_style"`
+	VideoAudio      []string `json:"settings_videoAudio"`
+	ExtraAudio      []string `json:"settings_extraAudio"`
+
+	ColorBackground       *string `json:"color_background"`
+	ColorForeground       *string `json:"color_foreground"`
+	ColorTextBackground   *string `json:"color_textbackground"`
+	ColorText             *string `json:"color_text"`
+	ColorButtonBackground *string `json:"color_buttonbackground"`
+	ColorButtonText       *string `json:"color_buttontext"`
+	ColorNodeConditions   *string `json:"color_nodeconditions"`
+	ProgressBarColor      *string `json:"progress_bar_color"`
+	ProgressBarBgColor    *string `json:"progress_bar_bgcolor"`
+
+	AlphaForeground       *Number `json:"alpha_foreground"`
+	AlphaTextBackground   *Number `json:"alpha_textbackground"`
+	AlphaText             *Number `json:"alpha_text"`
+	AlphaButtonBackground *Number `json:"alpha_buttonbackground"`
+	AlphaButtonText       *Number `json:"alpha_buttontext"`
+	AlphaNodeConditions   *Number `json:"alpha_nodeconditions"`
+
+	// ColorBlur is the blur in px, despite its name
+	ColorBlur *Number `json:"color_blur"`
+
+	AudioURL     *string `json:"audio_url"`
+	AudioURLAlt  *string `json:"audio_url_alt"`
+	SubtitlesURL *string `json:"subtitles_url"`
+	AudioVolume  *Number `json:"audio_volume"`
+
+	raw     map[string]json.RawMessage
+	invalid []string
+}
+
+// LinkProps contains the documented keys of link.props
+type LinkProps struct {
+	PositiveNodeList []Number `json:"positiveNodeList"`
+	NegativeNodeList []Number `json:"negativeNodeList"`
+
+	raw     map[string]json.RawMessage
+	invalid []string
+}
+
+// MenuShortcut is a menu entry leading to a node, an empty NodeID is an unused slot
+type MenuShortcut struct {
+	NodeID Number `json:"nodeId"`
+	Text   string `json:"text"`
+}
+
+// AdventureProps contains the documented keys of adventure.props
+type AdventureProps struct {
+	MenuOption        *StringList    `json:"menu_option"`
+	MenuShortcuts     []MenuShortcut `json:"menu_shortcuts"`
+	MenuSoundOverride *bool          `json:"menu_sound_override"`
+	FontList          []string       `json:"font_list"`
+
+	raw     map[string]json.RawMessage
+	invalid []string
+}
+
+// ParseNodeProps reads node.props, an empty string gives empty props
+func ParseNodeProps(props string) (*NodeProps, error) {
+	p := &NodeProps{}
+	return p, parseProps(props, p)
+}
+
+// ParseLinkProps reads link.props, an empty string gives empty props
+func ParseLinkProps(props string) (*LinkProps, error) {
+	p := &LinkProps{}
+	return p, parseProps(props, p)
+}
+
+// ParseAdventureProps reads adventure.props, an empty string gives empty props
+func ParseAdventureProps(props string) (*AdventureProps, error) {
+	p := &AdventureProps{}
+	return p, parseProps(props, p)
+}
+
+func parseProps(props string, p json.Unmarshaler) error {
+	if strings.TrimSpace(props) == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(props), p)
+}
+
+// Encode returns the props as a JSON string for node.props
+func (p *NodeProps) Encode() (string, error) {
+	return encodeProps(p)
+}
+
+// Encode returns the props as a JSON string for link.props
+func (p *LinkProps) Encode() (string, error) {
+	return encodeProps(p)
+}
+
+// Encode returns the props as a JSON string for adventure.props
+func (p *AdventureProps) Encode() (string, error) {
+	return encodeProps(p)
+}
+
+func encodeProps(p json.Marshaler) (string, error) {
+	data, err := json.Marshal(p)
+	return string(data), err
+}
+
+// The alias types have the same fields but none of the methods, so the
+// default encoding can be used for the documented keys
+type nodeProps NodeProps
+type linkProps LinkProps
+type adventureProps AdventureProps
+
+// UnmarshalJSON reads the documented keys and keeps all others
+func (p *NodeProps) UnmarshalJSON(data []byte) error {
+	return unmarshalProps(data, (*nodeProps)(p), &p.raw, &p.invalid)
+}
+
+// MarshalJSON writes the documented keys on top of all keys that were read
+func (p NodeProps) MarshalJSON() ([]byte, error) {
+	return marshalProps((*nodeProps)(&p), p.raw, p.invalid)
+}
+
+// UnmarshalJSON reads the documented keys and keeps all others
+func (p *LinkProps) UnmarshalJSON(data []byte) error {
+	return unmarshalProps(data, (*linkProps)(p), &p.raw, &p.invalid)
+}
+
+// MarshalJSON writes the documented keys on top of all keys that were read
+func (p LinkProps) MarshalJSON() ([]byte, error) {
+	return marshalProps((*linkProps)(&p), p.raw, p.invalid)
+}
+
+// UnmarshalJSON reads the documented keys and keeps all others
+func (p *AdventureProps) UnmarshalJSON(data []byte) error {
+	return unmarshalProps(data, (*adventureProps)(p), &p.raw, &p.invalid)
+}
+
+// MarshalJSON writes the documented keys on top of all keys that were read
+func (p AdventureProps) MarshalJSON() ([]byte, error) {
+	return marshalProps((*adventureProps)(&p), p.raw, p.invalid)
+}
+
+// unmarshalProps keeps all keys in raw and reads the documented keys one by
+// one. A documented key with a value of the wrong type is left in raw and
+// listed in invalid, so it is written back untouched.
+func unmarshalProps(data []byte, known interface{}, raw *map[string]json.RawMessage, invalid *[]string) error {
+	if err := json.Unmarshal(data, raw); err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(known).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key := propKey(v.Type().Field(i))
+		value, exists := (*raw)[key]
+		if key == "" || !exists {
+			continue
+		}
+
+		if err := json.Unmarshal(value, v.Field(i).Addr().Interface()); err != nil {
+			*invalid = append(*invalid, key)
+		}
+	}
+
+	return nil
+}
+
+// marshalProps merges the documented keys into the raw keys. A documented key
+// that is nil is left out, unless it was read as an explicit null.
+func marshalProps(known interface{}, raw map[string]json.RawMessage, invalid []string) ([]byte, error) {
+	data, err := json.Marshal(known)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for _, key := range invalid {
+		delete(fields, key)
+	}
+
+	merged := make(map[string]json.RawMessage, len(raw)+len(fields))
+	for key, value := range raw {
+		merged[key] = value
+	}
+
+	for key, value := range fields {
+		if string(value) == "null" {
+			if original, exists := raw[key]; !exists || string(original) != "null" {
+				delete(merged, key)
+			}
+			continue
+		}
+		merged[key] = value
+	}
+
+	return json.Marshal(merged)
+}
+
+func propKey(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		return ""
+	}
+	return strings.Split(field.Tag.Get("json"), ",")[0]
+}
+
+// MediaURLs returns the uploaded files referenced from node.props
+func (p *NodeProps) MediaURLs() []string {
+	urls := []string{}
+	for _, url := range []*string{p.AudioURL, p.AudioURLAlt, p.SubtitlesURL} {
+		if url != nil && *url != "" {
+			urls = append(urls, *url)
+		}
+	}
+	return urls
+}
+
+// RebaseMedia points all uploaded files referenced from node.props to another adventure
+func (p *NodeProps) RebaseMedia(oldSlug, newSlug string) {
+	p.MapMedia(func(url string) string {
+		return RebaseMediaURL(url, oldSlug, newSlug)
+	})
+}
+
+// MapMedia replaces every file url in node.props with mapping(url)
+func (p *NodeProps) MapMedia(mapping func(url string) string) {
+	for _, url := range []*string{p.AudioURL, p.AudioURLAlt, p.SubtitlesURL} {
+		if url != nil {
+			*url = mapping(*url)
+		}
+	}
+}
+
+// RebaseMediaURL points a /upload/{slug}/ url to the upload folder of another adventure
+func RebaseMediaURL(url, oldSlug, newSlug string) string {
+	return strings.Replace(url, "/upload/"+oldSlug+"/", "/upload/"+newSlug+"/", 1)
+}
+
+// contentMediaURL matches the src and href attributes in the text of a node
+// that point at uploaded files, the url is the second group
+var contentMediaURL = regexp.MustCompile(`(?i)(\s(?:src|href)\s*=\s*["']?)(/upload/[^"'\s>]+)`)
+
+// ContentMediaURLs returns the uploaded files the text of a node refers to
+func ContentMediaURLs(content string) []string {
+	urls := []string{}
+	for _, match := range contentMediaURL.FindAllStringSubmatch(content, -1) {
+		urls = append(urls, match[2])
+	}
+	return urls
+}
+
+// MediaURLs returns every uploaded file the adventure refers to: the cover,
+// node images, files in the text of nodes, node audio and subtitles and fonts
+func (a *Adventure) MediaURLs() []string {
+	urls := []string{}
+	if a.CoverUrl != "" {
+		urls = append(urls, a.CoverUrl)
+	}
+
+	for _, node := range a.Nodes {
+		if node.ImageURL != "" {
+			urls = append(urls, node.ImageURL)
+		}
+		urls = append(urls, ContentMediaURLs(node.Content)...)
+
+		props, err := ParseNodeProps(node.Props)
+		if err != nil {
+			continue
+		}
+		urls = append(urls, props.MediaURLs()...)
+	}
+
+	props, err := ParseAdventureProps(a.Props)
+	if err == nil {
+		for _, url := range props.FontList {
+			if url != "" {
+				urls = append(urls, url)
+			}
+		}
+	}
+
+	return urls
+}
+
+// RebaseMedia points every uploaded file the adventure refers to at the
+// upload folder of newSlug, used when an adventure is copied or imported
+func (a *Adventure) RebaseMedia(oldSlug, newSlug string) error {
+	return a.MapMedia(func(url string) string {
+		return RebaseMediaURL(url, oldSlug, newSlug)
+	})
+}
+
+// MapMedia replaces every file url returned by MediaURLs with mapping(url).
+// Props that can not be read are left as they are, like MediaURLs skips them.
+func (a *Adventure) MapMedia(mapping func(url string) string) error {
+	if a.CoverUrl != "" {
+		a.CoverUrl = mapping(a.CoverUrl)
+	}
+
+	for i := range a.Nodes {
+		node := &a.Nodes[i]
+		if node.ImageURL != "" {
+			node.ImageURL = mapping(node.ImageURL)
+		}
+		node.Content = contentMediaURL.ReplaceAllStringFunc(node.Content, func(match string) string {
+			groups := contentMediaURL.FindStringSubmatch(match)
+			return groups[1] + mapping(groups[2])
+		})
+
+		if node.Props == "" {
+			continue
+		}
+
+		props, err := ParseNodeProps(node.Props)
+		if err != nil {
+			fmt.Println("Skipping the media of node", node.NodeID, "with invalid props:", err.Error())
+			continue
+		}
+		props.MapMedia(mapping)
+
+		node.Props, err = props.Encode()
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.Props == "" {
+		return nil
+	}
+
+	props, err := ParseAdventureProps(a.Props)
+	if err != nil {
+		fmt.Println("Skipping the fonts of adventure", a.ID, "with invalid props:", err.Error())
+		return nil
+	}
+	for i := range props.FontList {
+		props.FontList[i] = mapping(props.FontList[i])
+	}
+
+	a.Props, err = props.Encode()
+	return err
+}
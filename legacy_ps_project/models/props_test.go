@@ -0,0 +1,153 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func sameJSON(t *testing.T, expected, actual string) {
+	t.Helper()
+
+	var e, a interface{}
+	if err := json.Unmarshal([]byte(expected), &e); err != nil {
+		t.Fatalf("invalid expected JSON: %v", err)
+	}
+	if err := json.Unmarshal([]byte(actual), &a); err != nil {
+		t.Fatalf("invalid JSON %s: %v", actual, err)
+	}
+	if !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
+
+func TestNodePropsRoundTrip(t *testing.T) {
+	props := `{"settings_chapterType":["chapter-node"],"alpha_text":"50","alpha_foreground":80,` +
+		`"ordered_link_ids":["3",-1],"node_conditions":[],"audio_url":null,"some_future_key":{"a":[1,2]}}`
+
+	parsed, err := ParseNodeProps(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.AlphaText.String() != "50" || parsed.AlphaForeground.String() != "80" {
+		t.Errorf("unexpected alphas %s %s", parsed.AlphaText.String(), parsed.AlphaForeground.String())
+	}
+	if id, ok := parsed.OrderedLinkIDs[0].Int(); !ok || id != 3 {
+		t.Errorf("expected ordered link 3, got %s", parsed.OrderedLinkIDs[0].String())
+	}
+
+	encoded, err := parsed.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameJSON(t, props, encoded)
+}
+
+func TestNodePropsKeepsInvalidValues(t *testing.T) {
+	props := `{"color_text":123,"alpha_text":"50"}`
+
+	parsed, err := ParseNodeProps(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errors := parsed.Validate()
+	if len(errors) != 1 || errors[0].Field != "props.color_text" {
+		t.Errorf("expected one error for color_text, got %+v", errors)
+	}
+
+	encoded, err := parsed.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameJSON(t, props, encoded)
+}
+
+func TestAdventurePropsLegacyMenuOption(t *testing.T) {
+	props := `{"menu_option":"all","menu_shortcuts":[{"nodeId":"","text":""},{"nodeId":"12","text":"Home"}]}`
+
+	parsed, err := ParseAdventureProps(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errors := parsed.Validate(); len(errors) != 0 {
+		t.Errorf("expected no errors, got %+v", errors)
+	}
+
+	encoded, err := parsed.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameJSON(t, props, encoded)
+}
+
+func TestValidateProps(t *testing.T) {
+	nodes := []Node{
+		{NodeID: 1, Props: `{"color_background":"#12345g","alpha_text":"150","settings_chapterType":["unknown"]}`},
+		{NodeID: 2, Props: `{"color_background":"#123456","node_timer":"10"}`},
+	}
+	links := []Link{
+		{LinkID: 5, Props: `{"positiveNodeList":["1","x"]}`},
+	}
+
+	errors := ValidateProps(`{"menu_option":["back","fly"]}`, nodes, links)
+
+	fields := map[string]bool{}
+	for _, e := range errors {
+		switch {
+		case e.NodeID != nil:
+			fields[e.Field+"@node"] = true
+		case e.LinkID != nil:
+			fields[e.Field+"@link"] = true
+		default:
+			fields[e.Field] = true
+		}
+	}
+
+	expected := map[string]bool{
+		"props.color_background@node":     true,
+		"props.alpha_text@node":           true,
+		"props.settings_chapterType@node": true,
+		"props.positiveNodeList@link":     true,
+		"props.menu_option":               true,
+	}
+	if !reflect.DeepEqual(expected, fields) {
+		t.Errorf("expected %v, got %v", expected, fields)
+	}
+}
+
+func TestRebaseMedia(t *testing.T) {
+	adventure := Adventure{
+		CoverUrl: "/upload/abc/cover.jpg",
+		Props:    `{"font_list":["/upload/abc/font.woff"]}`,
+		Nodes: []Node{
+			{ImageURL: "/upload/abc/image.jpg", Props: `{"audio_url":"/upload/abc/sound.mp3","alpha_text":"50"}`},
+			{Content: `<p><img src="/upload/abc/inline.png"> <a href='/upload/abc/map.pdf'>Karta</a> <a href="https://example.com/upload/abc/x">x</a></p>`},
+			// Props that can not be read are skipped
+			{ImageURL: "/upload/abc/skog.jpg", Props: `{"audio_url":`},
+		},
+	}
+
+	if err := adventure.RebaseMedia("abc", "def"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"/upload/def/cover.jpg", "/upload/def/image.jpg", "/upload/def/sound.mp3", "/upload/def/font.woff", "/upload/def/inline.png", "/upload/def/map.pdf", "/upload/def/skog.jpg"}
+	actual := adventure.MediaURLs()
+	if len(actual) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	for _, url := range expected {
+		if !contains(actual, url) {
+			t.Errorf("expected %s in %v", url, actual)
+		}
+	}
+	sameJSON(t, `{"audio_url":"/upload/def/sound.mp3","alpha_text":"50"}`, adventure.Nodes[0].Props)
+	if content := adventure.Nodes[1].Content; content != `<p><img src="/upload/def/inline.png"> <a href='/upload/def/map.pdf'>Karta</a> <a href="https://example.com/upload/abc/x">x</a></p>` {
+		t.Errorf("unexpected content %s", content)
+	}
+	if props := adventure.Nodes[2].Props; props != `{"audio_url":` {
+		t.Errorf("expected the props to be left as they are, got %s", props)
+	}
+}
@@ -0,0 +1,206 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// FieldError describes a prop value that does not match the schema
+type FieldError struct {
+	NodeID  *int64 `json:"node_id,omitempty"`
+	LinkID  *int64 `json:"link_id,omitempty"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Allowed values of the documented enum keys
+var (
+	ChapterTypes     = []string{"", "start-node", "chapter-node", "chapter-node-plain", "ref-node", "ref-node-tab", "videoplayer-node", "podplayer-node", "random-node"}
+	NodeConditions   = []string{"", "hide_visited"}
+	NodeStatistics   = []string{"", "on"}
+	NavigationStyles = []string{"", "swipe", "swipeWithButton", "right", "leftright", "down", "noButtons"}
+	VideoAudioTypes  = []string{"", "off", "off_mobile"}
+	ExtraAudioTypes  = []string{"", "play_once"}
+	MenuOptions      = []string{"back", "home", "menu", "sound"}
+)
+
+type propsValidator struct {
+	errors []FieldError
+}
+
+func (v *propsValidator) add(field, format string, args ...interface{}) {
+	v.errors = append(v.errors, FieldError{Field: "props." + field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *propsValidator) invalid(keys []string) {
+	sorted := append([]string{}, keys...)
+	sort.Strings(sorted)
+	for _, key := range sorted {
+		v.add(key, "has a value of the wrong type")
+	}
+}
+
+func (v *propsValidator) enum(field string, values []string, allowed []string) {
+	for _, value := range values {
+		if !contains(allowed, value) {
+			v.add(field, "unknown value %q", value)
+		}
+	}
+}
+
+func (v *propsValidator) color(field string, value *string) {
+	if value != nil && *value != "" && !colorPattern.MatchString(*value) {
+		v.add(field, "%q is not a color on the form #RRGGBB", *value)
+	}
+}
+
+func (v *propsValidator) number(field string, value *Number, min, max float64) {
+	if value == nil || value.IsEmpty() {
+		return
+	}
+
+	n, ok := value.Float()
+	if !ok {
+		v.add(field, "%q is not a number", value.String())
+		return
+	}
+	if n < min || n > max {
+		v.add(field, "%s is outside %g..%g", value.String(), min, max)
+	}
+}
+
+func (v *propsValidator) ids(field string, values []Number) {
+	for _, value := range values {
+		if _, ok := value.Int(); !ok {
+			v.add(field, "%q is not an id", value.String())
+		}
+	}
+}
+
+// Validate checks the documented keys of node.props
+func (p *NodeProps) Validate() []FieldError {
+	v := &propsValidator{errors: []FieldError{}}
+	v.invalid(p.invalid)
+
+	v.enum("settings_chapterType", p.ChapterType, ChapterTypes)
+	v.enum("node_conditions", p.NodeConditions, NodeConditions)
+	v.enum("node_statistics", p.NodeStatistics, NodeStatistics)
+	v.enum("background.navigation_style", p.NavigationStyle, NavigationStyles)
+	v.enum("settings_videoAudio", p.VideoAudio, VideoAudioTypes)
+	v.enum("settings_extraAudio", p.ExtraAudio, ExtraAudioTypes)
+	v.ids("ordered_link_ids", p.OrderedLinkIDs)
+
+	v.color("color_background", p.ColorBackground)
+	v.color("color_foreground", p.ColorForeground)
+	v.color("color_textbackground", p.ColorTextBackground)
+	v.color("color_text", p.ColorText)
+	v.color("color_buttonbackground", p.ColorButtonBackground)
+	v.color("color_buttontext", p.ColorButtonText)
+	v.color("color_nodeconditions", p.ColorNodeConditions)
+	v.color("progress_bar_color", p.ProgressBarColor)
+	v.color("progress_bar_bgcolor", p.ProgressBarBgColor)
+
+	v.number("alpha_foreground", p.AlphaForeground, 0, 100)
+	v.number("alpha_textbackground", p.AlphaTextBackground, 0, 100)
+	v.number("alpha_text", p.AlphaText, 0, 100)
+	v.number("alpha_buttonbackground", p.AlphaButtonBackground, 0, 100)
+	v.number("alpha_buttontext", p.AlphaButtonText, 0, 100)
+	v.number("alpha_nodeconditions", p.AlphaNodeConditions, 0, 100)
+	v.number("audio_volume", p.AudioVolume, 0, 100)
+	v.number("color_blur", p.ColorBlur, 0, 1000)
+	v.number("node_timer", p.NodeTimer, 0, 86400)
+
+	return v.errors
+}
+
+// Validate checks the documented keys of link.props
+func (p *LinkProps) Validate() []FieldError {
+	v := &propsValidator{errors: []FieldError{}}
+	v.invalid(p.invalid)
+
+	v.ids("positiveNodeList", p.PositiveNodeList)
+	v.ids("negativeNodeList", p.NegativeNodeList)
+
+	return v.errors
+}
+
+// Validate checks the documented keys of adventure.props
+func (p *AdventureProps) Validate() []FieldError {
+	v := &propsValidator{errors: []FieldError{}}
+	v.invalid(p.invalid)
+
+	if p.MenuOption != nil {
+		// Older versions saved a single "all" instead of a list
+		if !(p.MenuOption.single && len(p.MenuOption.Values) == 1 && p.MenuOption.Values[0] == "all") {
+			v.enum("menu_option", p.MenuOption.Values, MenuOptions)
+		}
+	}
+
+	for i, shortcut := range p.MenuShortcuts {
+		if shortcut.NodeID.IsEmpty() {
+			continue
+		}
+		if _, ok := shortcut.NodeID.Int(); !ok {
+			v.add(fmt.Sprintf("menu_shortcuts[%d].nodeId", i), "%q is not an id", shortcut.NodeID.String())
+		}
+	}
+
+	return v.errors
+}
+
+// ValidateProps checks the props of the adventure and the given nodes and links
+func ValidateProps(adventureProps string, nodes []Node, links []Link) []FieldError {
+	errors := []FieldError{}
+
+	if props, err := ParseAdventureProps(adventureProps); err != nil {
+		errors = append(errors, FieldError{Field: "props", Message: "is not a JSON object"})
+	} else {
+		errors = append(errors, props.Validate()...)
+	}
+
+	for _, node := range nodes {
+		nodeID := node.NodeID
+
+		var nodeErrors []FieldError
+		if props, err := ParseNodeProps(node.Props); err != nil {
+			nodeErrors = []FieldError{{Field: "props", Message: "is not a JSON object"}}
+		} else {
+			nodeErrors = props.Validate()
+		}
+
+		for _, fieldError := range nodeErrors {
+			fieldError.NodeID = &nodeID
+			errors = append(errors, fieldError)
+		}
+	}
+
+	for _, link := range links {
+		linkID := link.LinkID
+
+		var linkErrors []FieldError
+		if props, err := ParseLinkProps(link.Props); err != nil {
+			linkErrors = []FieldError{{Field: "props", Message: "is not a JSON object"}}
+		} else {
+			linkErrors = props.Validate()
+		}
+
+		for _, fieldError := range linkErrors {
+			fieldError.LinkID = &linkID
+			errors = append(errors, fieldError)
+		}
+	}
+
+	return errors
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// Revision is an immutable snapshot of an adventure graph, taken on every save
+type Revision struct {
+	ID          int64      `json:"id"`
+	AdventureID int64      `json:"adventure_id"`
+	Revision    int64      `json:"revision"`
+	UserID      int64      `json:"user_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Adventure   *Adventure `json:"adventure,omitempty"`
+}
+
+// FieldChange describes a changed field and its values before and after
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// NodeChange lists the changed fields on a node that exists in both revisions
+type NodeChange struct {
+	NodeID int64         `json:"node_id"`
+	Fields []FieldChange `json:"fields"`
+}
+
+// LinkChange lists the changed fields on a link that exists in both revisions
+type LinkChange struct {
+	LinkID int64         `json:"link_id"`
+	Fields []FieldChange `json:"fields"`
+}
+
+// AdventureDiff contains the differences between two revisions of an adventure.
+// Nodes and links are matched by their node_id/link_id within the adventure.
+type AdventureDiff struct {
+	From         int64         `json:"from"`
+	To           int64         `json:"to"`
+	Fields       []FieldChange `json:"fields"`
+	NodesAdded   []Node        `json:"nodes_added"`
+	NodesRemoved []Node        `json:"nodes_removed"`
+	NodesChanged []NodeChange  `json:"nodes_changed"`
+	LinksAdded   []Link        `json:"links_added"`
+	LinksRemoved []Link        `json:"links_removed"`
+	LinksChanged []LinkChange  `json:"links_changed"`
+}
+
+// DiffAdventures compares two snapshots of the same adventure
+func DiffAdventures(from, to *Adventure) AdventureDiff {
+	diff := AdventureDiff{
+		Fields:       []FieldChange{},
+		NodesAdded:   []Node{},
+		NodesRemoved: []Node{},
+		NodesChanged: []NodeChange{},
+		LinksAdded:   []Link{},
+		LinksRemoved: []Link{},
+		LinksChanged: []LinkChange{},
+	}
+
+	diff.Fields = appendChange(diff.Fields, "title", from.Title, to.Title)
+	diff.Fields = appendChange(diff.Fields, "description", from.Description, to.Description)
+	diff.Fields = appendChange(diff.Fields, "category", from.Category.Title, to.Category.Title)
+	diff.Fields = appendChange(diff.Fields, "cover_url", from.CoverUrl, to.CoverUrl)
+	diff.Fields = appendChange(diff.Fields, "props", from.Props, to.Props)
+
+	fromNodes := make(map[int64]Node)
+	for _, node := range from.Nodes {
+		fromNodes[node.NodeID] = node
+	}
+
+	toNodes := make(map[int64]bool)
+	for _, node := range to.Nodes {
+		toNodes[node.NodeID] = true
+
+		oldNode, exists := fromNodes[node.NodeID]
+		if !exists {
+			diff.NodesAdded = append(diff.NodesAdded, node)
+			continue
+		}
+
+		fields := diffNodes(oldNode, node)
+		if len(fields) > 0 {
+			diff.NodesChanged = append(diff.NodesChanged, NodeChange{NodeID: node.NodeID, Fields: fields})
+		}
+	}
+
+	for _, node := range from.Nodes {
+		if !toNodes[node.NodeID] {
+			diff.NodesRemoved = append(diff.NodesRemoved, node)
+		}
+	}
+
+	fromLinks := make(map[int64]Link)
+	for _, link := range from.Links {
+		fromLinks[link.LinkID] = link
+	}
+
+	toLinks := make(map[int64]bool)
+	for _, link := range to.Links {
+		toLinks[link.LinkID] = true
+
+		oldLink, exists := fromLinks[link.LinkID]
+		if !exists {
+			diff.LinksAdded = append(diff.LinksAdded, link)
+			continue
+		}
+
+		fields := diffLinks(oldLink, link)
+		if len(fields) > 0 {
+			diff.LinksChanged = append(diff.LinksChanged, LinkChange{LinkID: link.LinkID, Fields: fields})
+		}
+	}
+
+	for _, link := range from.Links {
+		if !toLinks[link.LinkID] {
+			diff.LinksRemoved = append(diff.LinksRemoved, link)
+		}
+	}
+
+	return diff
+}
+
+func diffNodes(from, to Node) []FieldChange {
+	fields := []FieldChange{}
+	fields = appendChange(fields, "title", from.Title, to.Title)
+	fields = appendChange(fields, "icon", from.Icon, to.Icon)
+	fields = appendChange(fields, "text", from.Content, to.Content)
+	fields = appendChange(fields, "type", from.NodeType, to.NodeType)
+	fields = appendChange(fields, "image_url", from.ImageURL, to.ImageURL)
+	fields = appendChange(fields, "image_layout_type", from.ImageLayoutType, to.ImageLayoutType)
+	fields = appendChange(fields, "props", from.Props, to.Props)
+	fields = appendIntChange(fields, "image_id", from.ImageID, to.ImageID)
+	fields = appendIntChange(fields, "x", from.X, to.X)
+	fields = appendIntChange(fields, "y", from.Y, to.Y)
+	return fields
+}
+
+func diffLinks(from, to Link) []FieldChange {
+	fields := []FieldChange{}
+	fields = appendIntChange(fields, "source", from.SourceNodeID, to.SourceNodeID)
+	fields = appendIntChange(fields, "target", from.TargetNodeID, to.TargetNodeID)
+	fields = appendChange(fields, "source_title", from.SourceLinkTitle, to.SourceLinkTitle)
+	fields = appendChange(fields, "target_title", from.TargetLinkTitle, to.TargetLinkTitle)
+	fields = appendChange(fields, "type", from.LinkType, to.LinkType)
+	fields = appendChange(fields, "props", from.Props, to.Props)
+	return fields
+}
+
+func appendChange(fields []FieldChange, field, from, to string) []FieldChange {
+	if from == to {
+		return fields
+	}
+	return append(fields, FieldChange{Field: field, From: from, To: to})
+}
+
+func appendIntChange(fields []FieldChange, field string, from, to int64) []FieldChange {
+	if from == to {
+		return fields
+	}
+	return append(fields, FieldChange{Field: field, From: strconv.FormatInt(from, 10), To: strconv.FormatInt(to, 10)})
+}
@@ -0,0 +1,54 @@
+package models
+
+import "testing"
+
+func TestDiffAdventures(t *testing.T) {
+	from := &Adventure{
+		Title: "Skogen",
+		Nodes: []Node{
+			{NodeID: 0, Title: "Start", NodeType: "root"},
+			{NodeID: 1, Title: "Stigen"},
+			{NodeID: 2, Title: "Sjön"},
+		},
+		Links: []Link{
+			{LinkID: 1, SourceNodeID: 0, TargetNodeID: 1},
+			{LinkID: 2, SourceNodeID: 0, TargetNodeID: 2},
+		},
+	}
+	to := &Adventure{
+		Title: "Skogen 2",
+		Nodes: []Node{
+			{NodeID: 0, Title: "Start", NodeType: "root"},
+			{NodeID: 1, Title: "Stigen", X: 100},
+			{NodeID: 3, Title: "Berget"},
+		},
+		Links: []Link{
+			{LinkID: 1, SourceNodeID: 0, TargetNodeID: 1},
+			{LinkID: 3, SourceNodeID: 1, TargetNodeID: 3},
+		},
+	}
+
+	diff := DiffAdventures(from, to)
+
+	if len(diff.Fields) != 1 || diff.Fields[0].Field != "title" || diff.Fields[0].To != "Skogen 2" {
+		t.Errorf("Wrong adventure fields: %v", diff.Fields)
+	}
+	if len(diff.NodesAdded) != 1 || diff.NodesAdded[0].NodeID != 3 {
+		t.Errorf("Wrong added nodes: %v", diff.NodesAdded)
+	}
+	if len(diff.NodesRemoved) != 1 || diff.NodesRemoved[0].NodeID != 2 {
+		t.Errorf("Wrong removed nodes: %v", diff.NodesRemoved)
+	}
+	if len(diff.NodesChanged) != 1 || diff.NodesChanged[0].NodeID != 1 || diff.NodesChanged[0].Fields[0].Field != "x" {
+		t.Errorf("Wrong changed nodes: %v", diff.NodesChanged)
+	}
+	if len(diff.LinksAdded) != 1 || diff.LinksAdded[0].LinkID != 3 {
+		t.Errorf("Wrong added links: %v", diff.LinksAdded)
+	}
+	if len(diff.LinksRemoved) != 1 || diff.LinksRemoved[0].LinkID != 2 {
+		t.Errorf("Wrong removed links: %v", diff.LinksRemoved)
+	}
+	if len(diff.LinksChanged) != 0 {
+		t.Errorf("Wrong changed links: %v", diff.LinksChanged)
+	}
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+)
+
+// Limits for play slugs chosen by the editors, e.g. /spela/skolans-vardegrund.
+// The maximum is the width of the view_slug column.
+const (
+	MinViewSlugLength = 6
+	MaxViewSlugLength = 30
+)
+
+// ErrSlugInvalid is returned for a play slug that breaks the format rules
+var ErrSlugInvalid = errors.New("error.adventure.sluginvalid")
+
+// ErrSlugReserved is returned for a play slug that would shadow a route
+var ErrSlugReserved = errors.New("error.adventure.slugreserved")
+
+// ReservedSlugs can not be used as play slugs, since the catch-all player
+// route would shadow, or be shadowed by, the other routes of the site
+var ReservedSlugs = []string{
+	"admin", "api", "arkiv", "basta_valet", "dilemman", "engagera", "login",
+	"logout", "media", "redigera", "spela", "static", "testa", "upload",
+}
+
+var viewSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// ValidateViewSlug checks that slug can be used as a play slug. It has to be
+// lowercase letters a-z, digits and single hyphens between them. The
+// reserved slugs are checked first, most of them are too short or have
+// other characters and would not tell why otherwise.
+func ValidateViewSlug(slug string) error {
+	if contains(ReservedSlugs, slug) {
+		return ErrSlugReserved
+	}
+	if len(slug) < MinViewSlugLength || len(slug) > MaxViewSlugLength {
+		return ErrSlugInvalid
+	}
+	if !viewSlugPattern.MatchString(slug) {
+		return ErrSlugInvalid
+	}
+	return nil
+}
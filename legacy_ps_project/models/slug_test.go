@@ -0,0 +1,31 @@
+package models
+
+import "testing"
+
+func TestValidateViewSlug(t *testing.T) {
+	for slug, expected := range map[string]error{
+		"skolans-vardegrund":              nil,
+		"aventyr2":                        nil,
+		"admin":                           ErrSlugReserved,
+		"api":                             ErrSlugReserved,
+		"basta_valet":                     ErrSlugReserved,
+		"redigera":                        ErrSlugReserved,
+		"kort":                            ErrSlugInvalid,
+		"basta_valet2":                    ErrSlugInvalid,
+		"dubbel--bindestreck":             ErrSlugInvalid,
+		"Versaler":                        ErrSlugInvalid,
+		"en-alldeles-for-lang-lekslug-x":  nil,
+		"en-alldeles-for-lang-lekslug-xy": ErrSlugInvalid,
+	} {
+		if err := ValidateViewSlug(slug); err != expected {
+			t.Errorf("%q: expected %v, got %v", slug, expected, err)
+		}
+	}
+
+	// Every reserved slug is refused as reserved
+	for _, slug := range ReservedSlugs {
+		if err := ValidateViewSlug(slug); err != ErrSlugReserved {
+			t.Errorf("%q: expected ErrSlugReserved, got %v", slug, err)
+		}
+	}
+}
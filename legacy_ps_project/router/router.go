@@ -19,12 +19,12 @@ type Router struct {
 }
 
 // NewRouter creates and returns a router with all handlers hooked up and ready to serve
-func NewRouter(store store.Store, version string, imgurbearer string, environment string, devAuthBypass bool) *Router {
+func NewRouter(store store.Store, media store.MediaStore, version string, imgurbearer string, environment string, devAuthBypass bool, mediaQuota int64) *Router {
 
 	// Create controllers with reference to storage
 	// Controllers contain handlers for web, api & sockets
 	web := web.NewWebController(&store, version, "./web/", environment)
-	api := api.NewAPIController(&store, version, "/upload/", devAuthBypass)
+	api := api.NewAPIController(&store, media, version, "/upload/", devAuthBypass, mediaQuota)
 	// socket := socket.NewSocketServer(&store, version)
 
 	// Create the router
@@ -34,9 +34,10 @@ func NewRouter(store store.Store, version string, imgurbearer string, environmen
 	router.NotFoundHandler = http.HandlerFunc(web.NotFoundHandler)
 
 	// Hook up web routes
-	router.HandleFunc("/spela/{id:[A-Z,a-z,0-9]+}/qr", web.PlayerQRHandler).Methods("GET")
-	router.HandleFunc("/engagera/{id:[A-Z,a-z,0-9]+}", web.PlayerHandler).Methods("GET")
-	router.HandleFunc("/testa/{id:[A-Z,a-z,0-9]+}", web.PlayerHandlerPreview).Methods("GET")
+	router.HandleFunc("/spela/{id:[A-Z,a-z,0-9,-]+}/qr", web.PlayerQRHandler).Methods("GET")
+	router.HandleFunc("/spela/{id:[A-Z,a-z,0-9,-]+}", web.PlayerHandler).Methods("GET")
+	router.HandleFunc("/engagera/{id:[A-Z,a-z,0-9,-]+}", web.PlayerHandler).Methods("GET")
+	router.HandleFunc("/testa/{id:[A-Z,a-z,0-9,-]+}", web.PlayerHandlerPreview).Methods("GET")
 	router.HandleFunc("/redigera/{id:[A-Z,a-z,0-9]+}", web.EditorHandler).Methods("GET")
 
 	// Hook up websocket upgrade route
@@ -46,8 +47,10 @@ func NewRouter(store store.Store, version string, imgurbearer string, environmen
 	apirouter := router.PathPrefix("/api").Subrouter()
 	apirouter.Use(CacheControlMiddleware)
 	apirouter.HandleFunc("/adventure/{id:[A-Z,a-z,0-9,_,-]+}", api.GetAdventure).Methods("GET")
+	apirouter.HandleFunc("/adventure/{id:[A-Z,a-z,0-9,_,-]+}/script", api.GetAdventureScript).Methods("GET")
 	apirouter.HandleFunc("/auth", api.Authenticate).Methods("POST")
 	apirouter.HandleFunc("/statistics/{id:[A-Z,a-z,0-9,_,-]+}/{nodeId:[0-9]+}", api.CountNodeStatistics).Methods("GET")
+	apirouter.HandleFunc("/play/{id:[A-Z,a-z,0-9,_,-]+}/events", api.AddPlayEvents).Methods("POST")
 
 	// Create secure (jwt token) API subrouter
 	secureApiRouter := router.PathPrefix("/api").Subrouter()
@@ -60,11 +63,31 @@ func NewRouter(store store.Store, version string, imgurbearer string, environmen
 	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/edit", api.GetAdventureForEdit).Methods("GET")
 	secureApiRouter.HandleFunc("/adventure", api.CreateAdventure).Methods("POST")
 	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}", api.UpdateAdventureContent).Methods("PUT")
-	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/report", api.ReportAdventure).Methods("POST")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9,-]+}/report", api.ReportAdventure).Methods("POST")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/slug", api.UpdateAdventureSlug).Methods("PUT")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/lint", api.LintAdventure).Methods("GET")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/captions", api.GetAdventureCaptions).Methods("GET")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}", api.PatchAdventureContent).Methods("PATCH")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/nodes/{nodeId:[0-9]+}", api.GetAdventureNode).Methods("GET")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/nodes/{nodeId:[0-9]+}", api.CreateAdventureNode).Methods("POST")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/nodes/{nodeId:[0-9]+}", api.UpdateAdventureNode).Methods("PATCH")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/nodes/{nodeId:[0-9]+}", api.DeleteAdventureNode).Methods("DELETE")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/links/{linkId:[0-9]+}", api.GetAdventureLink).Methods("GET")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/links/{linkId:[0-9]+}", api.CreateAdventureLink).Methods("POST")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/links/{linkId:[0-9]+}", api.UpdateAdventureLink).Methods("PATCH")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/links/{linkId:[0-9]+}", api.DeleteAdventureLink).Methods("DELETE")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/revisions", api.GetRevisions).Methods("GET")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/revisions/{revision:[0-9]+}", api.GetRevision).Methods("GET")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/revisions/{from:[0-9]+}/diff/{to:[0-9]+}", api.DiffRevisions).Methods("GET")
+	secureApiRouter.HandleFunc("/adventure/{id:[a-z,0-9]+}/revisions/{revision:[0-9]+}/restore", api.RestoreRevision).Methods("POST")
 	secureApiRouter.HandleFunc("/adventures/{id:[a-z,0-9]+}", api.GetAdventuresByList).Methods("GET")
 	secureApiRouter.HandleFunc("/categories", api.GetCategories).Methods("GET")
 	secureApiRouter.HandleFunc("/newAdventure", api.CreateAdventure).Methods("GET")
 
+	// Projekt PS image things
+	secureApiRouter.HandleFunc("/media", api.UploadMedia).Methods("POST")
+	secureApiRouter.HandleFunc("/media/{adventure:[a-z,0-9]+}/{hash:[^/]+}", api.DeleteMedia).Methods("DELETE")
+
 	// Admin API routes, protected by requiring valid JWT token in header
 	adminapirouter := apirouter.PathPrefix("/admin").Subrouter()
 	if devAuthBypass {
@@ -94,6 +117,10 @@ func NewRouter(store store.Store, version string, imgurbearer string, environmen
 	adminapirouter.HandleFunc("/importAdventure/", api.ImportAdventure).Methods("PUT")
 	adminapirouter.HandleFunc("/exportAdventure/{id:[a-z,0-9]+}", api.ExportAdventure).Methods("GET")
 	adminapirouter.HandleFunc("/statistics/", api.GetNodeStatisticsById).Methods("PUT")
+	adminapirouter.HandleFunc("/analytics/{id:[0-9]+}", api.GetPlaySummary).Methods("GET")
+	adminapirouter.HandleFunc("/analytics/{id:[0-9]+}/nodes", api.GetPlayNodes).Methods("GET")
+	adminapirouter.HandleFunc("/analytics/{id:[0-9]+}/paths", api.GetPlayPaths).Methods("GET")
+	adminapirouter.HandleFunc("/analytics/{id:[0-9]+}/flow", api.GetPlayFlow).Methods("GET")
 
 	imageapirouter := apirouter.PathPrefix("/images").Subrouter()
 	imageapirouter.Use(CacheControlMiddleware)
@@ -101,13 +128,10 @@ func NewRouter(store store.Store, version string, imgurbearer string, environmen
 	imageapirouter.HandleFunc("/categories", api.GetImageCategories).Methods("GET")
 	imageapirouter.HandleFunc("/category/{id:[0-9]+}", api.GetImagesByCategory).Methods("GET")
 
-	// Projekt PS image things
-	apirouter.HandleFunc("/media", api.UploadMedia).Methods("POST")
-	apirouter.HandleFunc("/media/{adventure:[a-z,0-9]+}/{hash:[^/]+}", api.DeleteMedia).Methods("DELETE")
 
 	// Hook up static file server routes
 	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./web"))))
-	router.PathPrefix("/upload/").Handler(http.StripPrefix("/upload/", http.FileServer(http.Dir("./upload"))))
+	router.PathPrefix("/upload/").HandlerFunc(api.ServeMedia)
 	router.PathPrefix("/admin/").Handler(http.StripPrefix("/admin/", http.FileServer(http.Dir("./web/admin"))))
 
 	// Special. Nothing to do with projektps.
@@ -120,7 +144,7 @@ func NewRouter(store store.Store, version string, imgurbearer string, environmen
 	// ORIGIN_ALLOWED should be `scheme://dns[:port]`, or `*` (insecure)
 	headersOk := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Accept", "Authorization"})
 	originsOk := handlers.AllowedOrigins([]string{"http://localhost:3000", "http://ps-test.goteborgsregionen.se", "https://ps.goteborgsregionen.se"})
-	methodsOk := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "OPTIONS", "DELETE"})
+	methodsOk := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "PATCH", "OPTIONS", "DELETE"})
 
 	return &Router{Handler: handlers.CORS(originsOk, headersOk, methodsOk)(router)}
 }
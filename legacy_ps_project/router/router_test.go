@@ -0,0 +1,1383 @@
+package router
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"projektps/controllers/api"
+	"projektps/models"
+	"projektps/services/analytics"
+	"projektps/services/media"
+	"projektps/store"
+	"projektps/store/filestore"
+	"projektps/store/memstore"
+)
+
+func TestMain(m *testing.M) {
+	// The web controller loads its templates from ./web
+	if err := os.Chdir(".."); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func newTestRouter(t *testing.T, devAuthBypass bool) (http.Handler, store.Store) {
+	t.Helper()
+	return newTestRouterWithStore(t, memstore.NewStore(), devAuthBypass)
+}
+
+// newTestRouterWithStore creates a router on an existing store, to pick up
+// settings that are read when it is created
+func newTestRouterWithStore(t *testing.T, s store.Store, devAuthBypass bool) (http.Handler, store.Store) {
+	t.Helper()
+	return newTestRouterWithQuota(t, s, devAuthBypass, api.DefaultMediaQuota)
+}
+
+// newTestRouterWithQuota creates a router on an existing store where the
+// files of an adventure may use mediaQuota bytes
+func newTestRouterWithQuota(t *testing.T, s store.Store, devAuthBypass bool, mediaQuota int64) (http.Handler, store.Store) {
+	t.Helper()
+
+	media := filestore.NewFileStore("upload", "/upload/")
+	return NewRouter(s, media, "test", "", "test", devAuthBypass, mediaQuota).Handler, s
+}
+
+// do sends a request with body encoded as JSON and decodes the JSON response
+// into result, if given
+func do(t *testing.T, h http.Handler, method, path string, body interface{}, token string, result interface{}) int {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	r := httptest.NewRequest(method, path, reader)
+	r.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if result != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), result); err != nil {
+			t.Fatalf("%s %s: could not decode %q: %v", method, path, w.Body.String(), err)
+		}
+	}
+
+	return w.Code
+}
+
+func expectStatus(t *testing.T, method, path string, got, want int) {
+	t.Helper()
+
+	if got != want {
+		t.Fatalf("%s %s: expected status %d, got %d", method, path, want, got)
+	}
+}
+
+func createAdventure(t *testing.T, h http.Handler) *models.Adventure {
+	t.Helper()
+
+	var adventure models.Adventure
+	status := do(t, h, "POST", "/api/adventure", nil, "", &adventure)
+	expectStatus(t, "POST", "/api/adventure", status, http.StatusCreated)
+	return &adventure
+}
+
+func TestAuthentication(t *testing.T) {
+	h, s := newTestRouter(t, false)
+
+	user := &models.User{Username: "anna", Name: "Anna", Role: 1}
+	user.HashPassword("hemligt")
+	if _, err := s.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+
+	var failed map[string]string
+	status := do(t, h, "POST", "/api/auth", map[string]string{"username": "anna", "password": "fel"}, "", &failed)
+	expectStatus(t, "POST", "/api/auth", status, http.StatusBadRequest)
+	if failed["error"] != store.ErrInvalidPassword.Error() {
+		t.Errorf("expected %q, got %q", store.ErrInvalidPassword, failed["error"])
+	}
+
+	var token struct {
+		Token string `json:"token"`
+		ID    int64  `json:"id"`
+		Role  int64  `json:"role"`
+	}
+	status = do(t, h, "POST", "/api/auth", map[string]string{"username": "anna", "password": "hemligt"}, "", &token)
+	expectStatus(t, "POST", "/api/auth", status, http.StatusOK)
+	if token.Token == "" || token.ID != user.ID || token.Role != 1 {
+		t.Fatalf("unexpected token payload %+v", token)
+	}
+
+	status = do(t, h, "GET", "/api/admin/users", nil, "", nil)
+	expectStatus(t, "GET", "/api/admin/users", status, http.StatusBadRequest)
+
+	var users []models.User
+	status = do(t, h, "GET", "/api/admin/users", nil, token.Token, &users)
+	expectStatus(t, "GET", "/api/admin/users", status, http.StatusOK)
+	if len(users) != 1 || users[0].Username != "anna" {
+		t.Errorf("unexpected users %+v", users)
+	}
+
+	// Editors that are not admins only get access to their own adventures
+	editor := &models.User{Username: "erik", Name: "Erik", Role: 2}
+	editor.HashPassword("hemligt")
+	if _, err := s.CreateUser(editor); err != nil {
+		t.Fatal(err)
+	}
+	status = do(t, h, "POST", "/api/auth", map[string]string{"username": "erik", "password": "hemligt"}, "", &token)
+	expectStatus(t, "POST", "/api/auth", status, http.StatusOK)
+
+	adventure, err := s.CreateDefaultAdventure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/api/adventure/" + adventure.Slug + "/edit"
+	status = do(t, h, "GET", path, nil, token.Token, nil)
+	expectStatus(t, "GET", path, status, http.StatusBadRequest)
+
+	if err := s.AddUserToAdventure(editor, adventure); err != nil {
+		t.Fatal(err)
+	}
+	status = do(t, h, "GET", path, nil, token.Token, nil)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+}
+
+func TestAdventureContent(t *testing.T) {
+	h, _ := newTestRouter(t, true)
+	adventure := createAdventure(t, h)
+
+	var public models.Adventure
+	path := "/api/adventure/" + adventure.ViewSlug
+	status := do(t, h, "GET", path, nil, "", &public)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	if public.ID != adventure.ID || len(public.Nodes) != 3 {
+		t.Errorf("unexpected adventure %+v", public)
+	}
+
+	status = do(t, h, "GET", "/api/adventure/saknas", nil, "", nil)
+	expectStatus(t, "GET", "/api/adventure/saknas", status, http.StatusNotFound)
+
+	var edit models.Adventure
+	path = "/api/adventure/" + adventure.Slug + "/edit"
+	status = do(t, h, "GET", path, nil, "", &edit)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+
+	edit.Title = "Skogen"
+	edit.Nodes[1].Title = "Stigen"
+	edit.Nodes[1].Changed = true
+
+	var saved models.Adventure
+	path = "/api/adventure/" + adventure.Slug
+	status = do(t, h, "PUT", path, edit, "", &saved)
+	expectStatus(t, "PUT", path, status, http.StatusOK)
+	if saved.Title != "Skogen" || saved.Nodes[1].Title != "Stigen" || saved.EditVersion != edit.EditVersion+1 {
+		t.Errorf("unexpected adventure %+v", saved)
+	}
+
+	// Saving the same edit_version again is a conflict
+	var conflict struct {
+		Error       string `json:"error"`
+		EditVersion int64  `json:"edit_version"`
+	}
+	status = do(t, h, "PUT", path, edit, "", &conflict)
+	expectStatus(t, "PUT", path, status, http.StatusConflict)
+	if conflict.Error != "error.adventure.versionconflict" || conflict.EditVersion != saved.EditVersion {
+		t.Errorf("unexpected conflict %+v", conflict)
+	}
+
+	saved.Props = `{"menu_option":["fel"]}`
+	status = do(t, h, "PUT", path, saved, "", nil)
+	expectStatus(t, "PUT", path, status, http.StatusBadRequest)
+
+	var revisions []models.Revision
+	path = "/api/adventure/" + adventure.Slug + "/revisions"
+	status = do(t, h, "GET", path, nil, "", &revisions)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	if len(revisions) != 1 || revisions[0].Revision != 1 {
+		t.Errorf("expected a single revision, got %+v", revisions)
+	}
+
+	var revision models.Revision
+	path = "/api/adventure/" + adventure.Slug + "/revisions/1"
+	status = do(t, h, "GET", path, nil, "", &revision)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	if revision.Adventure == nil || revision.Adventure.Title != "Skogen" {
+		t.Errorf("unexpected revision %+v", revision)
+	}
+
+	path = "/api/adventure/" + adventure.Slug + "/revisions/2"
+	status = do(t, h, "GET", path, nil, "", nil)
+	expectStatus(t, "GET", path, status, http.StatusNotFound)
+
+	var lint struct {
+		Errors   []interface{} `json:"errors"`
+		Warnings []interface{} `json:"warnings"`
+	}
+	path = "/api/adventure/" + adventure.Slug + "/lint"
+	status = do(t, h, "GET", path, nil, "", &lint)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	if len(lint.Errors) != 0 {
+		t.Errorf("expected no lint errors, got %+v", lint.Errors)
+	}
+}
+
+func TestAdventureGraph(t *testing.T) {
+	h, _ := newTestRouter(t, true)
+	adventure := createAdventure(t, h)
+
+	patch := map[string]interface{}{
+		"edit_version": adventure.EditVersion,
+		"operations": []map[string]interface{}{
+			{"op": "replace", "path": "/nodes/1/title", "value": "Stigen"},
+			{"op": "add", "path": "/nodes/3", "value": map[string]interface{}{"title": "Sjön", "type": "default"}},
+			{"op": "add", "path": "/links/2", "value": map[string]interface{}{"source": 1, "target": 3, "type": "default"}},
+		},
+	}
+
+	var patched struct {
+		EditVersion int64         `json:"edit_version"`
+		Results     []interface{} `json:"results"`
+	}
+	path := "/api/adventure/" + adventure.Slug
+	status := do(t, h, "PATCH", path, patch, "", &patched)
+	expectStatus(t, "PATCH", path, status, http.StatusOK)
+	if patched.EditVersion != adventure.EditVersion+1 || len(patched.Results) != 3 {
+		t.Errorf("unexpected patch result %+v", patched)
+	}
+
+	// The patch was built on an old edit_version
+	status = do(t, h, "PATCH", path, patch, "", nil)
+	expectStatus(t, "PATCH", path, status, http.StatusConflict)
+
+	var node models.Node
+	path = "/api/adventure/" + adventure.Slug + "/nodes/3"
+	status = do(t, h, "GET", path, nil, "", &node)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	if node.Title != "Sjön" {
+		t.Errorf("unexpected node %+v", node)
+	}
+
+	var link models.Link
+	path = "/api/adventure/" + adventure.Slug + "/links/2"
+	status = do(t, h, "GET", path, nil, "", &link)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	if link.SourceNodeID != 1 || link.TargetNodeID != 3 {
+		t.Errorf("unexpected link %+v", link)
+	}
+
+	path = fmt.Sprintf("/api/adventure/%s/nodes/3?edit_version=%d", adventure.Slug, patched.EditVersion)
+	status = do(t, h, "DELETE", path, nil, "", nil)
+	expectStatus(t, "DELETE", path, status, http.StatusOK)
+
+	path = "/api/adventure/" + adventure.Slug + "/nodes/3"
+	status = do(t, h, "GET", path, nil, "", nil)
+	expectStatus(t, "GET", path, status, http.StatusNotFound)
+
+	// Links to a removed node are removed along with it
+	path = "/api/adventure/" + adventure.Slug + "/links/2"
+	status = do(t, h, "GET", path, nil, "", nil)
+	expectStatus(t, "GET", path, status, http.StatusNotFound)
+}
+
+func TestSlugs(t *testing.T) {
+	h, _ := newTestRouter(t, true)
+	adventure := createAdventure(t, h)
+	other := createAdventure(t, h)
+
+	var saved models.Adventure
+	path := "/api/adventure/" + adventure.Slug + "/slug"
+	status := do(t, h, "PUT", path, map[string]string{"view_slug": " Skolans-Vardegrund"}, "", &saved)
+	expectStatus(t, "PUT", path, status, http.StatusOK)
+	if saved.ViewSlug != "skolans-vardegrund" {
+		t.Errorf("expected the new play slug, got %q", saved.ViewSlug)
+	}
+
+	for slug, expected := range map[string]int{
+		"skolans-vardegrund": http.StatusConflict,
+		"static":             http.StatusBadRequest,
+		"skolans_vardegrund": http.StatusBadRequest,
+	} {
+		path = "/api/adventure/" + other.Slug + "/slug"
+		status = do(t, h, "PUT", path, map[string]string{"view_slug": slug}, "", nil)
+		expectStatus(t, "PUT", path+" "+slug, status, expected)
+	}
+
+	path = fmt.Sprintf("/api/admin/adventure/%d", other.ID)
+	status = do(t, h, "PUT", path, map[string]interface{}{"title": "Ett annat", "view_slug": adventure.ViewSlug}, "", nil)
+	expectStatus(t, "PUT", path, status, http.StatusConflict)
+
+	status = do(t, h, "GET", "/spela/skolans-vardegrund", nil, "", nil)
+	expectStatus(t, "GET", "/spela/skolans-vardegrund", status, http.StatusOK)
+
+	// The old play slug redirects to the new one
+	for _, path := range []string{"/spela/" + adventure.ViewSlug, "/" + adventure.ViewSlug, "/spela/" + adventure.ViewSlug + "/qr"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		expectStatus(t, "GET", path, w.Code, http.StatusMovedPermanently)
+
+		expected := strings.Replace(path, adventure.ViewSlug, "skolans-vardegrund", 1)
+		if location := w.Header().Get("Location"); location != expected {
+			t.Errorf("GET %s: expected a redirect to %s, got %s", path, expected, location)
+		}
+	}
+
+	var public models.Adventure
+	path = "/api/adventure/" + adventure.ViewSlug
+	status = do(t, h, "GET", path, nil, "", &public)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	if public.ID != adventure.ID {
+		t.Errorf("expected the renamed adventure, got %+v", public)
+	}
+}
+
+func TestTwineTransfer(t *testing.T) {
+	h, _ := newTestRouter(t, true)
+
+	twee := ":: StoryTitle\nSkogen\n\n:: StoryData\n{\"ifid\": \"X\", \"start\": \"Start\"}\n\n:: Start {\"position\":\"100,100\"}\nDu står i skogen.\n[[Stigen]]\n\n:: Stigen [mörk]\nSlut.\n"
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", "/api/admin/importAdventure/", strings.NewReader(twee)))
+	expectStatus(t, "PUT", "/api/admin/importAdventure/", w.Code, http.StatusOK)
+
+	var result struct {
+		Adventure models.Adventure `json:"adventure"`
+		Warnings  []struct {
+			Passage string `json:"passage"`
+			Message string `json:"message"`
+		} `json:"warnings"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Adventure.Title != "Skogen" || len(result.Adventure.Nodes) != 2 || len(result.Adventure.Links) != 1 {
+		t.Errorf("unexpected adventure %+v", result.Adventure)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].Passage != "Stigen" {
+		t.Errorf("expected a warning for the tag, got %+v", result.Warnings)
+	}
+
+	path := "/api/admin/exportAdventure/" + result.Adventure.Slug + "?format=html"
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	expectStatus(t, "GET", path, w.Code, http.StatusOK)
+	if !strings.Contains(w.Body.String(), `<tw-passagedata pid="2" name="Stigen"`) {
+		t.Errorf("unexpected export %s", w.Body.String())
+	}
+
+	path = "/api/admin/exportAdventure/" + result.Adventure.Slug + "?format=ink"
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	expectStatus(t, "GET", path, w.Code, http.StatusOK)
+	if !strings.Contains(w.Body.String(), "+ [Stigen] -> stigen_1") {
+		t.Errorf("unexpected export %s", w.Body.String())
+	}
+
+	path = "/api/admin/exportAdventure/" + result.Adventure.Slug + "?format=pdf"
+	status := do(t, h, "GET", path, nil, "", nil)
+	expectStatus(t, "GET", path, status, http.StatusBadRequest)
+}
+
+func TestOfflineExport(t *testing.T) {
+	h, _ := newTestRouter(t, true)
+	adventure := createAdventure(t, h)
+
+	// The export is written to ./upload, where the media of the adventure is
+	mediaDir := "upload/" + adventure.Slug + "/"
+	if err := os.MkdirAll(mediaDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mediaDir)
+	defer os.Remove("upload/PSadventure_" + adventure.Slug + ".zip")
+	if err := ioutil.WriteFile(mediaDir+"skog.jpg", []byte("jpg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var edit models.Adventure
+	path := "/api/adventure/" + adventure.Slug + "/edit"
+	status := do(t, h, "GET", path, nil, "", &edit)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+
+	edit.Nodes[0].ImageURL = "/" + mediaDir + "skog.jpg"
+	edit.Nodes[0].Props = `{"settings_chapterType":["start-node"],"audio_url":"/` + mediaDir + `fagel.mp3","node_statistics":["on"]}`
+	edit.Nodes[0].Changed = true
+	path = "/api/adventure/" + adventure.Slug
+	status = do(t, h, "PUT", path, edit, "", nil)
+	expectStatus(t, "PUT", path, status, http.StatusOK)
+
+	path = "/api/admin/exportAdventure/" + adventure.Slug
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	expectStatus(t, "GET", path, w.Code, http.StatusOK)
+
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(reader)
+		reader.Close()
+		files[file.Name] = string(data)
+	}
+
+	for _, name := range []string{"index.html", "PSadventure_" + adventure.Slug + ".json", mediaDir + "skog.jpg", "static/js/aventyr.player.js", "static/js/font_stupidity.js", "static/img/ConduitLight.woff2"} {
+		if _, exists := files[name]; !exists {
+			t.Errorf("expected %s in the export", name)
+		}
+	}
+
+	// The page has the adventure inlined with relative urls and no statistics
+	index := files["index.html"]
+	if !strings.Contains(index, "var offlineAdventure = ") || strings.Contains(index, "/api/") || strings.Contains(index, `src="/static/`) {
+		t.Errorf("unexpected index.html %s", index)
+	}
+	for _, url := range []string{`"upload/` + adventure.Slug + `/skog.jpg"`, `\"upload/` + adventure.Slug + `/fagel.mp3\"`} {
+		if !strings.Contains(index, url) {
+			t.Errorf("expected the relative url %s in index.html", url)
+		}
+	}
+	if strings.Contains(index, "/"+mediaDir) || strings.Contains(index, "node_statistics") {
+		t.Errorf("expected no absolute urls or statistics in index.html")
+	}
+
+	// The adventure file is kept as it is for import
+	if !strings.Contains(files["PSadventure_"+adventure.Slug+".json"], `"image_url":"/`+mediaDir+`skog.jpg"`) {
+		t.Errorf("unexpected adventure file %s", files["PSadventure_"+adventure.Slug+".json"])
+	}
+}
+
+func TestScormExport(t *testing.T) {
+	h, _ := newTestRouter(t, true)
+	adventure := createAdventure(t, h)
+	defer os.Remove("upload/PSadventure_" + adventure.Slug + "_scorm2004.zip")
+
+	if err := os.MkdirAll("upload", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	path := "/api/admin/exportAdventure/" + adventure.Slug + "?format=scorm2004&completion=80"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	expectStatus(t, "GET", path, w.Code, http.StatusOK)
+
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(reader)
+		reader.Close()
+		files[file.Name] = string(data)
+	}
+
+	if !strings.Contains(files["index.html"], `<script src="static/js/aventyr.scorm.js"></script>`) {
+		t.Errorf("expected the adapter to be loaded by index.html")
+	}
+	if files["static/js/scorm_settings.js"] != "var scormSettings = {\"version\":\"scorm2004\",\"completion_percent\":80};\n" {
+		t.Errorf("unexpected settings %q", files["static/js/scorm_settings.js"])
+	}
+
+	// The manifest lists every file of the package
+	var manifest struct {
+		Files []struct {
+			Href string `xml:"href,attr"`
+		} `xml:"resources>resource>file"`
+	}
+	if err := xml.Unmarshal([]byte(files["imsmanifest.xml"]), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	listed := make(map[string]bool)
+	for _, file := range manifest.Files {
+		if _, exists := files[file.Href]; !exists {
+			t.Errorf("the manifest lists the missing file %s", file.Href)
+		}
+		listed[file.Href] = true
+	}
+	for name := range files {
+		if !listed[name] && name != "imsmanifest.xml" {
+			t.Errorf("expected %s to be listed in the manifest", name)
+		}
+	}
+
+	for _, path := range []string{
+		"/api/admin/exportAdventure/" + adventure.Slug + "?format=scorm12&completion=alla",
+		"/api/admin/exportAdventure/" + adventure.Slug + "?format=scorm12&completion=101",
+	} {
+		status := do(t, h, "GET", path, nil, "", nil)
+		expectStatus(t, "GET", path, status, http.StatusBadRequest)
+	}
+	path = "/api/admin/exportAdventure/saknas?format=scorm12"
+	status := do(t, h, "GET", path, nil, "", nil)
+	expectStatus(t, "GET", path, status, http.StatusNotFound)
+}
+
+func TestScript(t *testing.T) {
+	h, _ := newTestRouter(t, true)
+	adventure := createAdventure(t, h)
+
+	// The script is public, by either slug
+	path := "/api/adventure/" + adventure.ViewSlug + "/script"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	expectStatus(t, "GET", path, w.Code, http.StatusOK)
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") || !strings.Contains(w.Body.String(), `<section id="avsnitt-3">`) {
+		t.Errorf("unexpected script %s", w.Body.String())
+	}
+
+	path = "/api/adventure/" + adventure.Slug + "/script?format=md"
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	expectStatus(t, "GET", path, w.Code, http.StatusOK)
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/markdown") || !strings.Contains(w.Body.String(), "\n## 1. ") {
+		t.Errorf("unexpected script %s", w.Body.String())
+	}
+
+	path = "/api/adventure/" + adventure.Slug + "/script?format=pdf"
+	status := do(t, h, "GET", path, nil, "", nil)
+	expectStatus(t, "GET", path, status, http.StatusBadRequest)
+
+	path = "/api/adventure/finnsinte/script"
+	status = do(t, h, "GET", path, nil, "", nil)
+	expectStatus(t, "GET", path, status, http.StatusNotFound)
+}
+
+// uploadMedia uploads data as name with the multipart form of the editor
+// postMedia uploads a file to the adventure slug and returns the status and
+// the decoded response
+func postMedia(t *testing.T, h http.Handler, slug, name string, data []byte, token string) (int, map[string]interface{}) {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("adventureId", slug)
+	file, err := form.CreateFormFile("media", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(data)
+	form.Close()
+
+	r := httptest.NewRequest("POST", "/api/media", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	// Requests stopped before the API do not get a JSON response
+	response := map[string]interface{}{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func uploadMedia(t *testing.T, h http.Handler, slug, name string, data []byte) string {
+	t.Helper()
+
+	status, image := postMedia(t, h, slug, name, data, "")
+	expectStatus(t, "POST", "/api/media", status, http.StatusOK)
+	url, _ := image["url"].(string)
+	return url
+}
+
+// pngOf returns a PNG with the pixels of text, so that every run uploads
+// another image
+func pngOf(t *testing.T, text string) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, len(text), 1))
+	copy(img.Pix, text)
+	var data bytes.Buffer
+	if err := png.Encode(&data, img); err != nil {
+		t.Fatal(err)
+	}
+	return data.Bytes()
+}
+
+func TestMedia(t *testing.T) {
+	h, s := newTestRouter(t, true)
+	adventure := createAdventure(t, h)
+
+	// The same content is stored once, whatever it is called
+	data := pngOf(t, adventure.Slug)
+	url := uploadMedia(t, h, adventure.Slug, "skog.png", data)
+	defer os.Remove(strings.TrimPrefix(url, "/"))
+	hash, ok := models.ParseMediaURL(url)
+	if !ok {
+		t.Fatalf("expected a url under %s, got %s", models.MediaURLPrefix, url)
+	}
+	// Images get a thumbnail
+	record, err := s.GetMediaByHash(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(strings.TrimPrefix(record.Thumbnail, "/"))
+	if record.Width != len(adventure.Slug) || record.Height != 1 || record.Thumbnail != models.MediaVariantURL(hash, "thumb", ".jpg") {
+		t.Errorf("unexpected media %+v", record)
+	}
+	if _, err := os.Stat(strings.TrimPrefix(record.Thumbnail, "/")); err != nil {
+		t.Errorf("expected the thumbnail: %v", err)
+	}
+	if again := uploadMedia(t, h, adventure.Slug, "skogen.png", data); again != url {
+		t.Errorf("expected %s, got %s", url, again)
+	}
+	if saved, err := ioutil.ReadFile(strings.TrimPrefix(url, "/")); err != nil || !bytes.Equal(saved, data) {
+		t.Errorf("expected the uploaded file at %s: %v", url, err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("expected %s to be served, got %d", url, w.Code)
+	}
+
+	// Files uploaded before are shared with a copy instead of copied
+	mediaDir := "upload/" + adventure.Slug + "/"
+	if err := os.MkdirAll(mediaDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mediaDir)
+	legacy := []byte("ID3" + adventure.Slug)
+	if err := ioutil.WriteFile(mediaDir+"fagel.mp3", legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var edit models.Adventure
+	path := "/api/adventure/" + adventure.Slug + "/edit"
+	status := do(t, h, "GET", path, nil, "", &edit)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	edit.CoverUrl = url
+	edit.Nodes[0].ImageURL = url
+	edit.Nodes[0].Props = `{"audio_url":"/` + mediaDir + `fagel.mp3"}`
+	edit.Nodes[0].Changed = true
+	path = "/api/adventure/" + adventure.Slug
+	status = do(t, h, "PUT", path, edit, "", nil)
+	expectStatus(t, "PUT", path, status, http.StatusOK)
+
+	var copied models.Adventure
+	path = "/api/admin/copy/" + adventure.Slug
+	status = do(t, h, "PUT", path, nil, "", &copied)
+	expectStatus(t, "PUT", path, status, http.StatusOK)
+	defer os.RemoveAll("upload/" + copied.Slug)
+
+	if copied.CoverUrl != url {
+		t.Errorf("expected the copy to share %s, got %s", url, copied.CoverUrl)
+	}
+	if _, err := os.Stat("upload/" + copied.Slug); !os.IsNotExist(err) {
+		t.Errorf("expected no upload folder for the copy, got %v", err)
+	}
+	var copiedEdit models.Adventure
+	path = "/api/adventure/" + copied.Slug + "/edit"
+	status = do(t, h, "GET", path, nil, "", &copiedEdit)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	props, err := models.ParseNodeProps(copiedEdit.Nodes[0].Props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props.AudioURL == nil {
+		t.Fatal("expected the audio of the copy")
+	}
+	if _, ok := models.ParseMediaURL(*props.AudioURL); !ok {
+		t.Errorf("expected the audio to be shared, got %s", *props.AudioURL)
+	}
+	defer os.Remove(strings.TrimPrefix(*props.AudioURL, "/"))
+
+	// A shared file is left for toolps media gc
+	path = "/api/media/" + adventure.Slug + "/" + url[strings.LastIndex(url, "/")+1:]
+	status = do(t, h, "DELETE", path, nil, "", nil)
+	expectStatus(t, "DELETE", path, status, http.StatusOK)
+	if _, err := os.Stat(strings.TrimPrefix(url, "/")); err != nil {
+		t.Errorf("expected the shared file to be kept: %v", err)
+	}
+}
+
+func TestMediaSeeking(t *testing.T) {
+	h, _ := newTestRouter(t, true)
+	adventure := createAdventure(t, h)
+
+	data := []byte("ID3\x03" + adventure.Slug + strings.Repeat("ljud", 1000))
+	url := uploadMedia(t, h, adventure.Slug, "pod.mp3", data)
+	defer os.Remove(strings.TrimPrefix(url, "/"))
+
+	get := func(path string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// Shared files never change and are cached, the API is not
+	w := get(url)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Fatalf("expected %s to be served, got %d", url, w.Code)
+	}
+	if cache := w.Header().Get("Cache-Control"); cache != "public, max-age=31536000, immutable" {
+		t.Errorf("expected %s to be cached, got %q", url, cache)
+	}
+	// The ETag is the hash in the name, which does not change when the file is copied
+	hash := strings.TrimSuffix(url[strings.LastIndex(url, "/")+1:], ".mp3")
+	if w.Header().Get("Content-Type") != "audio/mpeg" || etag != `"`+hash+`"` || w.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("unexpected headers %v", w.Header())
+	}
+	if cache := get("/api/adventure/" + adventure.Slug).Header().Get("Cache-Control"); !strings.Contains(cache, "no-store") {
+		t.Errorf("expected the API not to be cached, got %q", cache)
+	}
+
+	// Seeking asks for the rest of the file
+	w = get(url, "Range", "bytes=1000-")
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), data[1000:]) {
+		t.Errorf("expected the rest of the file, got %d with %d bytes", w.Code, w.Body.Len())
+	}
+	if expected := fmt.Sprintf("bytes 1000-%d/%d", len(data)-1, len(data)); w.Header().Get("Content-Range") != expected {
+		t.Errorf("expected %s, got %s", expected, w.Header().Get("Content-Range"))
+	}
+	w = get(url, "Range", "bytes=4-9", "If-Range", etag)
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), data[4:10]) {
+		t.Errorf("expected the range, got %d %q", w.Code, w.Body.String())
+	}
+	w = get(url, "Range", "bytes=4-9", "If-Range", `"gammal"`)
+	if w.Code != http.StatusOK || w.Body.Len() != len(data) {
+		t.Errorf("expected the whole changed file, got %d", w.Code)
+	}
+	w = get(url, "Range", fmt.Sprintf("bytes=%d-", len(data)))
+	if w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("expected 416, got %d", w.Code)
+	}
+	if w = get(url, "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", w.Code)
+	}
+
+	// Missing files are not cached
+	missing := models.MediaURL(strings.Repeat("0", 64), ".mp3")
+	if w = get(missing); w.Code != http.StatusNotFound || strings.Contains(w.Header().Get("Cache-Control"), "immutable") {
+		t.Errorf("expected a 404 that is not cached, got %d %v", w.Code, w.Header())
+	}
+
+	// Files that may be replaced are checked every time
+	mediaDir := "upload/" + adventure.Slug + "/"
+	if err := os.MkdirAll(mediaDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mediaDir)
+	if err := ioutil.WriteFile(mediaDir+"text.vtt", []byte("WEBVTT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w = get("/" + mediaDir + "text.vtt")
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-cache" || w.Header().Get("Content-Type") != "text/vtt" {
+		t.Errorf("unexpected response %d %v", w.Code, w.Header())
+	}
+}
+
+func TestUploadValidation(t *testing.T) {
+	h, s := newTestRouter(t, true)
+	adventure := createAdventure(t, h)
+
+	subtitles := func(text string) []byte {
+		return []byte("WEBVTT\n\n00:00.000 --> 00:01.000\n" + adventure.Slug + text)
+	}
+	expectError := func(name string, data []byte, slug string, status int, code string) {
+		t.Helper()
+		got, response := postMedia(t, h, slug, name, data, "")
+		if got != status || response["error"] != code {
+			t.Errorf("%s: expected %d %s, got %d %v", name, status, code, got, response)
+		}
+	}
+
+	expectError("skog.png", pngOf(t, adventure.Slug), "saknas", http.StatusNotFound, "error.media.adventurenotfound")
+	expectError("skog.png", []byte("<html><script>alert(1)</script>"), adventure.Slug, http.StatusUnsupportedMediaType, "error.media.typenotallowed")
+	expectError("skog.svg", []byte("<svg onload=alert(1)>"), adventure.Slug, http.StatusUnsupportedMediaType, "error.media.typenotallowed")
+	expectError("index.html", []byte("<html>"), adventure.Slug, http.StatusUnsupportedMediaType, "error.media.typenotallowed")
+	expectError("skog.png", []byte("\x89PNG\r\n\x1a\ntrasig"), adventure.Slug, http.StatusBadRequest, "error.media.invalidimage")
+
+	// The name is only used for the type of the file
+	url := uploadMedia(t, h, adventure.Slug, "../../../web/text.VTT", subtitles("namn"))
+	defer os.Remove(strings.TrimPrefix(url, "/"))
+	if _, ok := models.ParseMediaURL(url); !ok || !strings.HasSuffix(url, ".vtt") {
+		t.Errorf("expected a url under %s, got %s", models.MediaURLPrefix, url)
+	}
+
+	// Every kind has its size limit
+	limit := media.MaxSizes[media.KindSubtitles]
+	media.MaxSizes[media.KindSubtitles] = 20
+	expectError("text.vtt", subtitles(strings.Repeat("x", 20)), adventure.Slug, http.StatusRequestEntityTooLarge, "error.media.toolarge")
+	media.MaxSizes[media.KindSubtitles] = limit
+
+	// The files of the adventure count against its quota, a file it already
+	// has does not count again
+	used, err := s.GetAdventureMedia(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(used) != 1 || used[0].URL != url {
+		t.Errorf("expected the upload to be recorded, got %+v", used)
+	}
+	h, _ = newTestRouterWithQuota(t, s, true, used[0].Size+10)
+	if again := uploadMedia(t, h, adventure.Slug, "text.vtt", subtitles("namn")); again != url {
+		t.Errorf("expected %s, got %s", url, again)
+	}
+	expectError("text.vtt", subtitles("en längre text"), adventure.Slug, http.StatusRequestEntityTooLarge, "error.media.quotaexceeded")
+
+	// Deleting a file frees its space
+	path := "/api/media/" + adventure.Slug + "/" + url[strings.LastIndex(url, "/")+1:]
+	status := do(t, h, "DELETE", path, nil, "", nil)
+	expectStatus(t, "DELETE", path, status, http.StatusOK)
+	other := uploadMedia(t, h, adventure.Slug, "text.vtt", subtitles("namn två"))
+	defer os.Remove(strings.TrimPrefix(other, "/"))
+}
+
+func TestCaptions(t *testing.T) {
+	h, _ := newTestRouter(t, true)
+	adventure := createAdventure(t, h)
+
+	// SubRip is stored as WebVTT
+	srt := "1\r\n00:00:01,000 --> 00:00:04,000\r\n" + adventure.Slug + "\r\n\r\n2\r\n00:00:05,000 --> 00:00:07,500\r\nSlut\r\n"
+	status, response := postMedia(t, h, adventure.Slug, "text.srt", []byte(srt), "")
+	expectStatus(t, "POST", "/api/media", status, http.StatusOK)
+	url, _ := response["url"].(string)
+	defer os.Remove(strings.TrimPrefix(url, "/"))
+	if !strings.HasSuffix(url, ".vtt") || response["cues"] != 2.0 || response["duration"] != 7.5 {
+		t.Errorf("unexpected response %v", response)
+	}
+	if saved, err := ioutil.ReadFile(strings.TrimPrefix(url, "/")); err != nil || !strings.HasPrefix(string(saved), "WEBVTT\n\n1\n00:00:01.000 --> 00:00:04.000\n") {
+		t.Errorf("expected the WebVTT file at %s, got %q %v", url, saved, err)
+	}
+
+	status, response = postMedia(t, h, adventure.Slug, "text.vtt", []byte("WEBVTT\n\n00:00:02.000 --> 00:00:01.000\n"+adventure.Slug), "")
+	if status != http.StatusBadRequest || response["error"] != "error.media.invalidsubtitles" || response["line"] != 3.0 {
+		t.Errorf("expected the malformed cue to be refused, got %d %v", status, response)
+	}
+
+	var edit models.Adventure
+	path := "/api/adventure/" + adventure.Slug + "/edit"
+	status = do(t, h, "GET", path, nil, "", &edit)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	edit.Nodes[0].ImageURL = "/upload/" + adventure.Slug + "/film.mp4"
+	edit.Nodes[0].Props = `{"settings_chapterType":["videoplayer-node"],"subtitles_url":"` + url + `"}`
+	edit.Nodes[1].ImageURL = "/upload/" + adventure.Slug + "/film.webm"
+	edit.Nodes[2].Props = `{"settings_chapterType":["podplayer-node"],"audio_url":"/upload/` + adventure.Slug + `/pod.mp3","subtitles_url":"/upload/media/00/saknas.vtt"}`
+	for i := range edit.Nodes {
+		edit.Nodes[i].Changed = true
+	}
+	path = "/api/adventure/" + adventure.Slug
+	status = do(t, h, "PUT", path, edit, "", nil)
+	expectStatus(t, "PUT", path, status, http.StatusOK)
+
+	var report struct {
+		MediaNodes int `json:"media_nodes"`
+		Captioned  int `json:"captioned"`
+		Missing    []struct {
+			NodeID  int64  `json:"node_id"`
+			Kind    string `json:"kind"`
+			Problem string `json:"problem"`
+		} `json:"missing"`
+	}
+	path = "/api/adventure/" + adventure.Slug + "/captions"
+	status = do(t, h, "GET", path, nil, "", &report)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	if report.MediaNodes != 3 || report.Captioned != 1 || len(report.Missing) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Missing[0].NodeID != edit.Nodes[1].NodeID || report.Missing[0].Kind != "video" || report.Missing[0].Problem != "missing" {
+		t.Errorf("unexpected node %+v", report.Missing[0])
+	}
+	if report.Missing[1].NodeID != edit.Nodes[2].NodeID || report.Missing[1].Kind != "podcast" || report.Missing[1].Problem != "notfound" {
+		t.Errorf("unexpected node %+v", report.Missing[1])
+	}
+
+	// A SubRip file linked before uploads were converted is not a caption
+	path = "/api/adventure/" + adventure.Slug + "/edit"
+	status = do(t, h, "GET", path, nil, "", &edit)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	edit.Nodes[0].Props = `{"settings_chapterType":["videoplayer-node"],"subtitles_url":"/upload/` + adventure.Slug + `/text.srt"}`
+	edit.Nodes[0].Changed = true
+	path = "/api/adventure/" + adventure.Slug
+	status = do(t, h, "PUT", path, edit, "", nil)
+	expectStatus(t, "PUT", path, status, http.StatusOK)
+
+	path = "/api/adventure/" + adventure.Slug + "/captions"
+	status = do(t, h, "GET", path, nil, "", &report)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	if report.MediaNodes != 3 || report.Captioned != 0 || len(report.Missing) != 3 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Missing[0].NodeID != edit.Nodes[0].NodeID || report.Missing[0].Problem != "unsupported" {
+		t.Errorf("unexpected node %+v", report.Missing[0])
+	}
+}
+
+func TestUploadPermission(t *testing.T) {
+	h, s := newTestRouter(t, false)
+
+	editor := &models.User{Username: "erik", Name: "Erik", Role: 2}
+	editor.HashPassword("hemligt")
+	if _, err := s.CreateUser(editor); err != nil {
+		t.Fatal(err)
+	}
+	var token struct {
+		Token string `json:"token"`
+	}
+	status := do(t, h, "POST", "/api/auth", map[string]string{"username": "erik", "password": "hemligt"}, "", &token)
+	expectStatus(t, "POST", "/api/auth", status, http.StatusOK)
+
+	adventure, err := s.CreateDefaultAdventure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("WEBVTT\n\n00:00.000 --> 00:01.000\n" + adventure.Slug)
+
+	// Uploads need a token
+	status, _ = postMedia(t, h, adventure.Slug, "text.vtt", data, "")
+	expectStatus(t, "POST", "/api/media", status, http.StatusBadRequest)
+
+	// ..of a user who can edit the adventure
+	status, response := postMedia(t, h, adventure.Slug, "text.vtt", data, token.Token)
+	if status != http.StatusForbidden || response["error"] != "error.media.forbidden" {
+		t.Errorf("expected 403 error.media.forbidden, got %d %v", status, response)
+	}
+	path := "/api/media/" + adventure.Slug + "/skog.png"
+	status = do(t, h, "DELETE", path, nil, token.Token, nil)
+	expectStatus(t, "DELETE", path, status, http.StatusForbidden)
+
+	if err := s.AddUserToAdventure(editor, adventure); err != nil {
+		t.Fatal(err)
+	}
+	status, response = postMedia(t, h, adventure.Slug, "text.vtt", data, token.Token)
+	expectStatus(t, "POST", "/api/media", status, http.StatusOK)
+	if url, _ := response["url"].(string); url != "" {
+		os.Remove(strings.TrimPrefix(url, "/"))
+	}
+}
+
+func TestImport(t *testing.T) {
+	h, s := newTestRouter(t, true)
+	adventure := createAdventure(t, h)
+
+	mediaDir := "upload/" + adventure.Slug + "/"
+	if err := os.MkdirAll(mediaDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mediaDir)
+	defer os.Remove("upload/PSadventure_" + adventure.Slug + ".zip")
+	if err := ioutil.WriteFile(mediaDir+"skog.png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(mediaDir+"fagel.mp3", []byte("<html><script>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var edit models.Adventure
+	path := "/api/adventure/" + adventure.Slug + "/edit"
+	status := do(t, h, "GET", path, nil, "", &edit)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+
+	edit.Nodes[0].ImageURL = "/" + mediaDir + "skog.png"
+	edit.Nodes[0].Props = `{"settings_chapterType":["start-node"],"audio_url":"/` + mediaDir + `fagel.mp3"}`
+	edit.Nodes[0].Changed = true
+	path = "/api/adventure/" + adventure.Slug
+	status = do(t, h, "PUT", path, edit, "", nil)
+	expectStatus(t, "PUT", path, status, http.StatusOK)
+
+	path = "/api/admin/exportAdventure/" + adventure.Slug
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	expectStatus(t, "GET", path, w.Code, http.StatusOK)
+
+	// The export imports again, with its media under the new slug
+	path = "/api/admin/importAdventure/"
+	export := w.Body.Bytes()
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", path, bytes.NewReader(export)))
+	expectStatus(t, "PUT", path, w.Code, http.StatusOK)
+
+	var report struct {
+		Adventure models.Adventure `json:"adventure"`
+		Files     []struct {
+			Name        string `json:"name"`
+			ContentType string `json:"content_type"`
+		} `json:"files"`
+		Skipped []struct {
+			Code string `json:"code"`
+			Name string `json:"name"`
+		} `json:"skipped"`
+		Errors []interface{} `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	imported := report.Adventure
+	if imported.Slug == "" || imported.Slug == adventure.Slug || len(report.Errors) != 0 {
+		t.Fatalf("unexpected import %s", w.Body.String())
+	}
+	defer os.RemoveAll("upload/" + imported.Slug)
+
+	if len(report.Files) != 1 || report.Files[0].Name != "skog.png" || report.Files[0].ContentType != "image/png" {
+		t.Errorf("expected skog.png to be imported, got %+v", report.Files)
+	}
+	if len(report.Skipped) != 1 || report.Skipped[0].Code != "import.typenotallowed" {
+		t.Errorf("expected fagel.mp3 to be skipped, got %+v", report.Skipped)
+	}
+	if imported.Nodes[0].ImageURL != "/upload/"+imported.Slug+"/skog.png" {
+		t.Errorf("expected the image to be rebased, got %s", imported.Nodes[0].ImageURL)
+	}
+	if _, err := os.Stat("upload/" + imported.Slug + "/skog.png"); err != nil {
+		t.Errorf("expected the image to be written: %v", err)
+	}
+	if _, err := os.Stat("upload/" + imported.Slug + "/fagel.mp3"); err == nil {
+		t.Errorf("expected fagel.mp3 not to be written")
+	}
+
+	// The files have to fit in the quota of an adventure
+	limited, _ := newTestRouterWithQuota(t, s, true, 10)
+	w = httptest.NewRecorder()
+	limited.ServeHTTP(w, httptest.NewRequest("PUT", path, bytes.NewReader(export)))
+	expectStatus(t, "PUT", path, w.Code, http.StatusBadRequest)
+	if !strings.Contains(w.Body.String(), `"code":"import.quotaexceeded"`) {
+		t.Errorf("unexpected report %s", w.Body.String())
+	}
+
+	// Entries that point out of the upload folder refuse the whole archive
+	buffer := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(buffer)
+	for _, name := range []string{"PSadventure_" + adventure.Slug + ".json", "upload/" + adventure.Slug + "/../../evil.png"} {
+		writer, _ := zipWriter.Create(name)
+		writer.Write([]byte("{}"))
+	}
+	zipWriter.Close()
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", path, buffer))
+	expectStatus(t, "PUT", path, w.Code, http.StatusBadRequest)
+	if !strings.Contains(w.Body.String(), `"code":"import.unsafepath"`) || strings.Contains(w.Body.String(), `"adventure"`) {
+		t.Errorf("unexpected report %s", w.Body.String())
+	}
+}
+
+func TestAdminRoutes(t *testing.T) {
+	h, s := newTestRouter(t, true)
+	adventure := createAdventure(t, h)
+
+	var category models.Category
+	status := do(t, h, "POST", "/api/admin/categories", map[string]interface{}{"title": "Skog", "icon": "🌲", "sort_order": 1}, "", &category)
+	expectStatus(t, "POST", "/api/admin/categories", status, http.StatusOK)
+	if category.ID == 0 {
+		t.Fatal("expected the category to be created")
+	}
+
+	var categories []models.Category
+	status = do(t, h, "GET", "/api/categories", nil, "", &categories)
+	expectStatus(t, "GET", "/api/categories", status, http.StatusOK)
+	if len(categories) != 1 || categories[0].Title != "Skog" {
+		t.Errorf("unexpected categories %+v", categories)
+	}
+
+	path := fmt.Sprintf("/api/admin/category/%d", category.ID+1)
+	status = do(t, h, "GET", path, nil, "", nil)
+	expectStatus(t, "GET", path, status, http.StatusNotFound)
+
+	var list models.List
+	status = do(t, h, "POST", "/api/admin/lists", map[string]interface{}{"title": "utvalda"}, "", &list)
+	expectStatus(t, "POST", "/api/admin/lists", status, http.StatusOK)
+
+	// Adventures without a category are not shown in lists
+	edit, err := s.GetAdventure(adventure.Slug, models.ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit.Category = category
+	if err := s.UpdateAdventureContent(edit, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	path = fmt.Sprintf("/api/admin/list/%d", list.ID)
+	payload := map[string]interface{}{"title": "utvalda", "adventures": []models.Adventure{{ID: adventure.ID}}}
+	status = do(t, h, "PUT", path, payload, "", nil)
+	expectStatus(t, "PUT", path, status, http.StatusOK)
+
+	var adventures []models.Adventure
+	status = do(t, h, "GET", "/api/adventures/utvalda", nil, "", &adventures)
+	expectStatus(t, "GET", "/api/adventures/utvalda", status, http.StatusOK)
+	if len(adventures) != 1 || adventures[0].ID != adventure.ID {
+		t.Errorf("unexpected adventures %+v", adventures)
+	}
+
+	var user models.User
+	status = do(t, h, "POST", "/api/admin/users", map[string]interface{}{"username": "anna", "password": "hemligt", "name": "Anna", "role": 2}, "", &user)
+	expectStatus(t, "POST", "/api/admin/users", status, http.StatusOK)
+
+	path = fmt.Sprintf("/api/admin/user/%d", user.ID)
+	status = do(t, h, "PUT", path, map[string]interface{}{"id": user.ID, "username": "anna", "name": "Anna Andersson", "role": 2}, "", nil)
+	expectStatus(t, "PUT", path, status, http.StatusOK)
+
+	status = do(t, h, "GET", path, nil, "", &user)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	if user.Name != "Anna Andersson" {
+		t.Errorf("unexpected user %+v", user)
+	}
+	if _, err := s.Authenticate("anna", "hemligt"); err != nil {
+		t.Errorf("expected the password to be kept, got %v", err)
+	}
+
+	status = do(t, h, "DELETE", path, nil, "", nil)
+	expectStatus(t, "DELETE", path, status, http.StatusOK)
+	status = do(t, h, "GET", path, nil, "", nil)
+	expectStatus(t, "GET", path, status, http.StatusNotFound)
+
+	var result struct {
+		Adventures []models.Adventure `json:"adventures"`
+		Count      int64              `json:"count"`
+	}
+	filter := map[string]interface{}{
+		"filter":     map[string]interface{}{"type": "CATEGORY", "category_id": category.ID},
+		"pagination": map[string]interface{}{"page": 1, "size": 10},
+	}
+	status = do(t, h, "POST", "/api/admin/adventures", filter, "", &result)
+	expectStatus(t, "POST", "/api/admin/adventures", status, http.StatusOK)
+	if result.Count != 1 || len(result.Adventures) != 1 {
+		t.Errorf("unexpected filter result %+v", result)
+	}
+
+	other := createAdventure(t, h)
+	path = fmt.Sprintf("/api/admin/adventure/%d", other.ID)
+	status = do(t, h, "DELETE", path, nil, "", nil)
+	expectStatus(t, "DELETE", path, status, http.StatusOK)
+	status = do(t, h, "GET", path, nil, "", nil)
+	expectStatus(t, "GET", path, status, http.StatusNotFound)
+}
+
+func TestReportsAndStatistics(t *testing.T) {
+	h, _ := newTestRouter(t, true)
+	adventure := createAdventure(t, h)
+
+	path := "/api/adventure/" + adventure.ViewSlug + "/report"
+	status := do(t, h, "POST", path, map[string]string{"code": "spam", "comment": "Reklam"}, "", nil)
+	expectStatus(t, "POST", path, status, http.StatusCreated)
+
+	var result struct {
+		Adventures []models.Adventure `json:"adventures"`
+		Count      int64              `json:"count"`
+	}
+	filter := map[string]interface{}{
+		"filter":     map[string]interface{}{"type": "REPORT", "search_string": "spam"},
+		"pagination": map[string]interface{}{"page": 1, "size": 10},
+	}
+	status = do(t, h, "POST", "/api/admin/adventures", filter, "", &result)
+	expectStatus(t, "POST", "/api/admin/adventures", status, http.StatusOK)
+	if result.Count != 1 || len(result.Adventures) != 1 || result.Adventures[0].ID != adventure.ID {
+		t.Errorf("unexpected filter result %+v", result)
+	}
+
+	for _, nodeID := range []string{"0", "1", "1"} {
+		path = "/api/statistics/" + adventure.Slug + "/" + nodeID
+		status = do(t, h, "GET", path, nil, "", nil)
+		expectStatus(t, "GET", path, status, http.StatusOK)
+	}
+
+	format := "2006-01-02 15:04:05"
+	params := map[string]interface{}{
+		"adventureId": adventure.ID,
+		"startTime":   time.Now().UTC().Add(-time.Hour).Format(format),
+		"stopTime":    time.Now().UTC().Add(time.Hour).Format(format),
+	}
+
+	var stats []models.NodeStat
+	status = do(t, h, "PUT", "/api/admin/statistics/", params, "", &stats)
+	expectStatus(t, "PUT", "/api/admin/statistics/", status, http.StatusOK)
+
+	visits := map[int64]int64{}
+	for _, stat := range stats {
+		visits[stat.NodeId] = stat.VisitCount
+	}
+	if visits[0] != 1 || visits[1] != 2 {
+		t.Errorf("unexpected statistics %+v", stats)
+	}
+}
+
+func TestPlayAnalytics(t *testing.T) {
+	h, _ := newTestRouter(t, true)
+	adventure := createAdventure(t, h)
+
+	path := "/api/play/" + adventure.ViewSlug + "/events"
+	events := []map[string]interface{}{
+		{"seq": 1, "type": "start", "t": 0},
+		{"seq": 2, "type": "node", "node_id": 0, "t": 10},
+	}
+	var result map[string]interface{}
+	status := do(t, h, "POST", path, map[string]interface{}{"session_id": "0123456789abcdef", "events": events}, "", &result)
+	expectStatus(t, "POST", path, status, http.StatusOK)
+	if result["last_seq"] != 2.0 {
+		t.Errorf("unexpected result %v", result)
+	}
+
+	// Events that were sent before are skipped
+	events = append(events,
+		map[string]interface{}{"seq": 3, "type": "choice", "link_id": 0, "t": 4000},
+		map[string]interface{}{"seq": 4, "type": "node", "node_id": 1, "t": 4010},
+		map[string]interface{}{"seq": 5, "type": "end", "t": 4010},
+	)
+	status = do(t, h, "POST", path, map[string]interface{}{"session_id": "0123456789abcdef", "events": events}, "", &result)
+	expectStatus(t, "POST", path, status, http.StatusOK)
+	if result["last_seq"] != 5.0 {
+		t.Errorf("unexpected result %v", result)
+	}
+
+	invalid := []struct {
+		sessionID string
+		events    []map[string]interface{}
+		status    int
+		error     string
+	}{
+		{"0123456789abcdef", []map[string]interface{}{{"seq": 6, "type": "node", "node_id": 2, "t": 5000}}, http.StatusBadRequest, "error.play.invalidevents"},
+		{"fedcba9876543210", []map[string]interface{}{{"seq": 2, "type": "node", "node_id": 2, "t": 5000}}, http.StatusNotFound, "error.play.sessionnotfound"},
+		{"fedcba9876543210", []map[string]interface{}{{"seq": 1, "type": "start"}, {"seq": 3, "type": "end"}}, http.StatusBadRequest, "error.play.invalidevents"},
+		{"kort", events, http.StatusBadRequest, "error.play.invalidsession"},
+	}
+	for _, test := range invalid {
+		var failed map[string]string
+		status = do(t, h, "POST", path, map[string]interface{}{"session_id": test.sessionID, "events": test.events}, "", &failed)
+		expectStatus(t, "POST", path, status, test.status)
+		if failed["error"] != test.error {
+			t.Errorf("%v: expected %q, got %v", test.events, test.error, failed)
+		}
+	}
+	status = do(t, h, "POST", "/api/play/saknas/events", map[string]interface{}{"session_id": "fedcba9876543210", "events": events}, "", nil)
+	expectStatus(t, "POST", "/api/play/saknas/events", status, http.StatusNotFound)
+
+	// A session that has not ended yet
+	status = do(t, h, "POST", path, map[string]interface{}{"session_id": "fedcba9876543210", "events": events[:2]}, "", nil)
+	expectStatus(t, "POST", path, status, http.StatusOK)
+
+	var summary analytics.Summary
+	path = fmt.Sprintf("/api/admin/analytics/%d", adventure.ID)
+	status = do(t, h, "GET", path, nil, "", &summary)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	expected := analytics.Summary{Sessions: 2, Completed: 1, InProgress: 1, CompletionRate: 1}
+	if summary != expected {
+		t.Errorf("expected %+v, got %+v", expected, summary)
+	}
+
+	var nodes []analytics.NodeStats
+	path = fmt.Sprintf("/api/admin/analytics/%d/nodes", adventure.ID)
+	status = do(t, h, "GET", path, nil, "", &nodes)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	if len(nodes) != 3 || nodes[0].Visits != 2 || nodes[0].MedianMs != 3990 || nodes[1].Visits != 1 || nodes[2].Visits != 0 {
+		t.Errorf("unexpected nodes %+v", nodes)
+	}
+
+	var paths []analytics.Path
+	path = fmt.Sprintf("/api/admin/analytics/%d/paths?limit=1", adventure.ID)
+	status = do(t, h, "GET", path, nil, "", &paths)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	if len(paths) != 1 || len(paths[0].Nodes) != 2 || !paths[0].Completed || paths[0].Share != 0.5 {
+		t.Errorf("unexpected paths %+v", paths)
+	}
+
+	// Half of the players go left and half go right
+	path = "/api/play/" + adventure.ViewSlug + "/events"
+	events = []map[string]interface{}{
+		{"seq": 1, "type": "start", "t": 0},
+		{"seq": 2, "type": "node", "node_id": 0, "t": 10},
+		{"seq": 3, "type": "choice", "link_id": 1, "t": 2000},
+		{"seq": 4, "type": "node", "node_id": 2, "t": 2010},
+		{"seq": 5, "type": "end", "t": 2010},
+	}
+	status = do(t, h, "POST", path, map[string]interface{}{"session_id": "aaaaaaaaaaaaaaaa", "events": events}, "", nil)
+	expectStatus(t, "POST", path, status, http.StatusOK)
+
+	var flow analytics.Flow
+	path = fmt.Sprintf("/api/admin/analytics/%d/flow", adventure.ID)
+	status = do(t, h, "GET", path, nil, "", &flow)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	expectedLinks := []analytics.FlowLink{
+		{Source: 0, Target: 1, LinkID: 0, Value: 1, Sessions: 1, Percent: 50},
+		{Source: 0, Target: 2, LinkID: 1, Value: 1, Sessions: 1, Percent: 50},
+	}
+	if flow.Sessions != 3 || len(flow.Nodes) != 3 || flow.Nodes[0].Choices != 2 || !reflect.DeepEqual(flow.Links, expectedLinks) {
+		t.Errorf("unexpected flow %+v", flow)
+	}
+
+	path = fmt.Sprintf("/api/admin/analytics/%d?from=2000-01-01&to=2000-01-31", adventure.ID)
+	status = do(t, h, "GET", path, nil, "", &summary)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	if summary.Sessions != 0 {
+		t.Errorf("expected no sessions in the period, got %+v", summary)
+	}
+	for _, path := range []string{
+		fmt.Sprintf("/api/admin/analytics/%d?from=igår", adventure.ID),
+		fmt.Sprintf("/api/admin/analytics/%d?from=2000-02-01&to=2000-01-01", adventure.ID),
+		fmt.Sprintf("/api/admin/analytics/%d/paths?limit=0", adventure.ID),
+	} {
+		status = do(t, h, "GET", path, nil, "", nil)
+		expectStatus(t, "GET", path, status, http.StatusBadRequest)
+	}
+	path = fmt.Sprintf("/api/admin/analytics/%d", adventure.ID+100)
+	status = do(t, h, "GET", path, nil, "", nil)
+	expectStatus(t, "GET", path, status, http.StatusNotFound)
+}
+
+func TestImages(t *testing.T) {
+	h, s := newTestRouter(t, true)
+
+	category, err := s.CreateNewImageCategory(&models.ImageCategory{Active: true, Title: "Natur", UnsplashID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateNewImageCategory(&models.ImageCategory{Title: "Arkiv", UnsplashID: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateNewImage(&models.Image{Active: true, CategoryID: category.ID, Title: "Fjäll", UnsplashID: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var categories []models.ImageCategory
+	status := do(t, h, "GET", "/api/images/categories", nil, "", &categories)
+	expectStatus(t, "GET", "/api/images/categories", status, http.StatusOK)
+	if len(categories) != 1 || categories[0].ID != category.ID {
+		t.Errorf("expected the active category, got %+v", categories)
+	}
+
+	var images []models.Image
+	path := fmt.Sprintf("/api/images/category/%d", category.ID)
+	status = do(t, h, "GET", path, nil, "", &images)
+	expectStatus(t, "GET", path, status, http.StatusOK)
+	if len(images) != 1 || images[0].Title != "Fjäll" {
+		t.Errorf("unexpected images %+v", images)
+	}
+}
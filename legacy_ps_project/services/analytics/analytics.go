@@ -0,0 +1,165 @@
+// Package analytics reports on the play sessions of an adventure: how many
+// players finish it, how long they stay on each node, where they stop
+// playing and which paths they take. The store counts the sessions, see
+// store.PlayStore, and the reports are made from the counts.
+package analytics
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"projektps/models"
+)
+
+// IdleTimeout is how long a session that has not ended can go without events
+// before the player is thought to have left. Until then it is in progress
+// and left out of the completion and drop-off rates.
+const IdleTimeout = 30 * time.Minute
+
+// Summary tells how many sessions reached an end
+type Summary struct {
+	Sessions   int `json:"sessions"`
+	Completed  int `json:"completed"`
+	Abandoned  int `json:"abandoned"`
+	InProgress int `json:"in_progress"`
+	// CompletionRate is the share of the sessions that are not in progress
+	// that reached an end, 0 without such sessions
+	CompletionRate float64 `json:"completion_rate"`
+}
+
+// NodeStats is what the players did on a node
+type NodeStats struct {
+	NodeID int64  `json:"node_id"`
+	Title  string `json:"title"`
+	// Visits counts every time the node was shown, Sessions the sessions
+	// that showed it at least once
+	Visits   int `json:"visits"`
+	Sessions int `json:"sessions"`
+	// MedianMs is the median time from when the node was shown until the
+	// player made a choice, over the visits where one was made
+	MedianMs int64 `json:"median_ms"`
+	// DropOffs counts the abandoned sessions that stopped on the node,
+	// DropOffRate is their share of the sessions that showed the node and
+	// are not in progress
+	DropOffs    int     `json:"drop_offs"`
+	DropOffRate float64 `json:"drop_off_rate"`
+}
+
+// Path is the nodes a number of sessions were shown, in order. A node shown
+// again right after itself is only listed once.
+type Path struct {
+	Nodes     []int64 `json:"nodes"`
+	Completed bool    `json:"completed"`
+	Count     int     `json:"count"`
+	// Share is Count out of all sessions
+	Share float64 `json:"share"`
+}
+
+// Summarize tells how many of the counted sessions reached an end
+func Summarize(counts *models.PlayCounts) Summary {
+	summary := Summary{
+		Sessions:   counts.Sessions,
+		Completed:  counts.Completed,
+		Abandoned:  counts.Abandoned,
+		InProgress: counts.Sessions - counts.Completed - counts.Abandoned,
+	}
+	summary.CompletionRate = rate(summary.Completed, summary.Completed+summary.Abandoned)
+	return summary
+}
+
+// Nodes returns the stats of every node of adventure, by node id. Nodes that
+// have been removed from the adventure since they were shown are listed
+// without a title.
+func Nodes(adventure *models.Adventure, counts []models.PlayNodeCounts) []NodeStats {
+	stats := make(map[int64]*NodeStats)
+	for _, n := range adventure.Nodes {
+		stats[n.NodeID] = &NodeStats{NodeID: n.NodeID, Title: n.Title}
+	}
+	for _, c := range counts {
+		s := stats[c.NodeID]
+		if s == nil {
+			s = &NodeStats{NodeID: c.NodeID}
+			stats[c.NodeID] = s
+		}
+		s.Visits = c.Visits
+		s.Sessions = c.Sessions
+		s.MedianMs = median(c.Durations)
+		s.DropOffs = c.DropOffs
+		s.DropOffRate = rate(c.DropOffs, c.Concluded)
+	}
+
+	result := make([]NodeStats, 0, len(stats))
+	for _, s := range stats {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].NodeID < result[j].NodeID })
+	return result
+}
+
+// Paths returns the limit most common of the counted paths, the most common
+// first
+func Paths(paths []models.PlayPathCounts, limit int) []Path {
+	// Every session took one path
+	sessions := 0
+	keys := make([]string, len(paths))
+	for i, path := range paths {
+		sessions += path.Count
+		keys[i] = pathKey(path.Nodes, path.Completed)
+	}
+	order := make([]int, len(paths))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if paths[a].Count != paths[b].Count {
+			return paths[a].Count > paths[b].Count
+		}
+		return keys[a] < keys[b]
+	})
+	if limit >= 0 && len(order) > limit {
+		order = order[:limit]
+	}
+
+	result := make([]Path, 0, len(order))
+	for _, i := range order {
+		path := paths[i]
+		result = append(result, Path{
+			Nodes:     path.Nodes,
+			Completed: path.Completed,
+			Count:     path.Count,
+			Share:     rate(path.Count, sessions),
+		})
+	}
+	return result
+}
+
+func pathKey(nodes []int64, completed bool) string {
+	parts := make([]string, len(nodes))
+	for i, nodeID := range nodes {
+		parts[i] = strconv.FormatInt(nodeID, 10)
+	}
+	return strings.Join(parts, ",") + ";" + strconv.FormatBool(completed)
+}
+
+func median(values []int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]int64{}, values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+func rate(count, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(count) / float64(total)
+}
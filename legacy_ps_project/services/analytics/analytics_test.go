@@ -0,0 +1,118 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+
+	"projektps/models"
+)
+
+func TestSummarize(t *testing.T) {
+	summary := Summarize(&models.PlayCounts{Sessions: 5, Completed: 3, Abandoned: 1})
+	expected := Summary{Sessions: 5, Completed: 3, Abandoned: 1, InProgress: 1, CompletionRate: 0.75}
+	if summary != expected {
+		t.Errorf("expected %+v, got %+v", expected, summary)
+	}
+	if summary := Summarize(&models.PlayCounts{}); summary.CompletionRate != 0 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+func TestNodes(t *testing.T) {
+	adventure := &models.Adventure{Nodes: []models.Node{
+		{NodeID: 0, Title: "Start"},
+		{NodeID: 1, Title: "Vänster"},
+		{NodeID: 2, Title: "Höger"},
+		{NodeID: 3, Title: "Ingenstans"},
+	}}
+	counts := []models.PlayNodeCounts{
+		{NodeID: 0, Visits: 5, Sessions: 5, Concluded: 4, Durations: []int64{500, 990, 1990, 3990, 5990}},
+		{NodeID: 1, Visits: 3, Sessions: 3, Concluded: 3, Durations: []int64{}},
+		{NodeID: 2, Visits: 3, Sessions: 2, Concluded: 2, DropOffs: 1, Durations: []int64{1990, 4990}},
+		// A node that has been removed
+		{NodeID: 9, Visits: 1, Sessions: 1, Durations: []int64{}},
+	}
+
+	stats := Nodes(adventure, counts)
+	expected := []NodeStats{
+		{NodeID: 0, Title: "Start", Visits: 5, Sessions: 5, MedianMs: 1990},
+		{NodeID: 1, Title: "Vänster", Visits: 3, Sessions: 3},
+		{NodeID: 2, Title: "Höger", Visits: 3, Sessions: 2, MedianMs: (1990 + 4990) / 2, DropOffs: 1, DropOffRate: 0.5},
+		{NodeID: 3, Title: "Ingenstans"},
+		{NodeID: 9, Visits: 1, Sessions: 1},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected\n%+v\ngot\n%+v", expected, stats)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	counts := []models.PlayPathCounts{
+		{Nodes: []int64{0}, Count: 1},
+		{Nodes: []int64{0, 2, 1}, Completed: true, Count: 1},
+		{Nodes: []int64{0, 2}, Count: 1},
+		{Nodes: []int64{0, 1}, Completed: true, Count: 3},
+	}
+
+	paths := Paths(counts, 2)
+	expected := []Path{
+		{Nodes: []int64{0, 1}, Completed: true, Count: 3, Share: 0.5},
+		{Nodes: []int64{0, 2, 1}, Completed: true, Count: 1, Share: 1.0 / 6},
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %+v, got %+v", expected, paths)
+	}
+
+	paths = Paths(counts, -1)
+	if len(paths) != 4 || !reflect.DeepEqual(paths[3].Nodes, []int64{0}) {
+		t.Errorf("unexpected paths %+v", paths)
+	}
+}
+
+func TestLinkFlow(t *testing.T) {
+	adventure := &models.Adventure{
+		Nodes: []models.Node{
+			{NodeID: 0, Title: "Start", NodeType: "root"},
+			{NodeID: 1, Title: "Ja"},
+			{NodeID: 2, Title: "Nej"},
+			{NodeID: 3, Title: "Kanske"},
+		},
+	}
+	counts := []models.PlayChoiceCounts{
+		{Source: 0, Target: 1, LinkID: 1, Value: 4, Sessions: 3},
+		{Source: 0, Target: 2, LinkID: 2, Value: 2, Sessions: 2},
+		// Link 9 has been removed
+		{Source: 0, Target: 5, LinkID: 9, Value: 1, Sessions: 1},
+		{Source: 1, Target: 0, LinkID: 3, Value: 2, Sessions: 2},
+		{Source: 2, Target: 3, LinkID: 4, Value: 1, Sessions: 1},
+		{Source: 3, Target: 2, LinkID: 4, Value: 1, Sessions: 1},
+	}
+
+	flow := LinkFlow(adventure, counts, 6)
+	expected := Flow{
+		Sessions: 6,
+		Nodes: []FlowNode{
+			{ID: 0, Title: "Start", Choices: 7},
+			{ID: 1, Title: "Ja", Choices: 2},
+			{ID: 2, Title: "Nej", Choices: 1},
+			{ID: 3, Title: "Kanske", Choices: 1},
+			{ID: 5},
+		},
+		Links: []FlowLink{
+			{Source: 0, Target: 1, LinkID: 1, Value: 4, Sessions: 3, Percent: 57.1},
+			{Source: 0, Target: 2, LinkID: 2, Value: 2, Sessions: 2, Percent: 28.6},
+			{Source: 0, Target: 5, LinkID: 9, Value: 1, Sessions: 1, Percent: 14.3},
+			{Source: 1, Target: 0, LinkID: 3, Value: 2, Sessions: 2, Percent: 100, Circular: true},
+			{Source: 2, Target: 3, LinkID: 4, Value: 1, Sessions: 1, Percent: 100},
+			{Source: 3, Target: 2, LinkID: 4, Value: 1, Sessions: 1, Percent: 100, Circular: true},
+		},
+	}
+	if !reflect.DeepEqual(flow, expected) {
+		t.Errorf("expected\n%+v\ngot\n%+v", expected, flow)
+	}
+
+	flow = LinkFlow(adventure, nil, 0)
+	if flow.Sessions != 0 || len(flow.Nodes) != 0 || len(flow.Links) != 0 {
+		t.Errorf("unexpected flow %+v", flow)
+	}
+}
@@ -0,0 +1,142 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+
+	"projektps/models"
+)
+
+// Flow is the choices made in the sessions of an adventure as a graph, in
+// the shape of the data of a Sankey diagram: the links point out their
+// source and target by the id of the nodes.
+type Flow struct {
+	Sessions int        `json:"sessions"`
+	Nodes    []FlowNode `json:"nodes"`
+	Links    []FlowLink `json:"links"`
+}
+
+// FlowNode is a node that a choice was made on or led to
+type FlowNode struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	// Choices counts the choices made on the node
+	Choices int `json:"choices"`
+}
+
+// FlowLink is the choices of a link from one node to another. A
+// bidirectional link that was followed both ways is two flow links.
+type FlowLink struct {
+	Source int64 `json:"source"`
+	Target int64 `json:"target"`
+	LinkID int64 `json:"link_id"`
+	// Value counts the times the link was followed, Sessions the sessions
+	// that followed it at least once
+	Value    int `json:"value"`
+	Sessions int `json:"sessions"`
+	// Percent is Value out of the choices made on the source, rounded to one
+	// decimal
+	Percent float64 `json:"percent"`
+	// Circular is true for a link that leads back to a node before it. A
+	// Sankey diagram can not show a circle, so it has to leave these out.
+	Circular bool `json:"circular"`
+}
+
+// LinkFlow makes the flow of the counted choices, sessions is the number of
+// sessions they were counted in
+func LinkFlow(adventure *models.Adventure, counts []models.PlayChoiceCounts, sessions int) Flow {
+	choices := make(map[int64]int)
+	for _, c := range counts {
+		choices[c.Source] += c.Value
+	}
+
+	titles := make(map[int64]string)
+	for _, node := range adventure.Nodes {
+		titles[node.NodeID] = node.Title
+	}
+	nodes := make(map[int64]*FlowNode)
+	node := func(nodeID int64) {
+		if nodes[nodeID] == nil {
+			nodes[nodeID] = &FlowNode{ID: nodeID, Title: titles[nodeID], Choices: choices[nodeID]}
+		}
+	}
+
+	flow := Flow{Sessions: sessions, Nodes: []FlowNode{}, Links: []FlowLink{}}
+	for _, c := range counts {
+		flow.Links = append(flow.Links, FlowLink{
+			Source:   c.Source,
+			Target:   c.Target,
+			LinkID:   c.LinkID,
+			Value:    c.Value,
+			Sessions: c.Sessions,
+			Percent:  math.Round(1000*rate(c.Value, choices[c.Source])) / 10,
+		})
+		node(c.Source)
+		node(c.Target)
+	}
+	sort.Slice(flow.Links, func(i, j int) bool {
+		a, b := flow.Links[i], flow.Links[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.LinkID < b.LinkID
+	})
+	for _, n := range nodes {
+		flow.Nodes = append(flow.Nodes, *n)
+	}
+	sort.Slice(flow.Nodes, func(i, j int) bool { return flow.Nodes[i].ID < flow.Nodes[j].ID })
+
+	markCircular(flow.Links, rootNodeID(adventure))
+	return flow
+}
+
+func rootNodeID(adventure *models.Adventure) int64 {
+	for _, node := range adventure.Nodes {
+		if node.NodeType == "root" {
+			return node.NodeID
+		}
+	}
+	return 0
+}
+
+// markCircular marks the links that close a circle, found by a depth-first
+// search from the root and then from the other sources by id. links are
+// sorted by source.
+func markCircular(links []FlowLink, root int64) {
+	outgoing := make(map[int64][]int)
+	sources := []int64{root}
+	for i, link := range links {
+		if len(outgoing[link.Source]) == 0 {
+			sources = append(sources, link.Source)
+		}
+		outgoing[link.Source] = append(outgoing[link.Source], i)
+	}
+
+	const (
+		unvisited = iota
+		onPath
+		done
+	)
+	state := make(map[int64]int)
+	var visit func(nodeID int64)
+	visit = func(nodeID int64) {
+		state[nodeID] = onPath
+		for _, i := range outgoing[nodeID] {
+			switch state[links[i].Target] {
+			case onPath:
+				links[i].Circular = true
+			case unvisited:
+				visit(links[i].Target)
+			}
+		}
+		state[nodeID] = done
+	}
+	for _, nodeID := range sources {
+		if state[nodeID] == unvisited {
+			visit(nodeID)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// Package backup writes every table of the store and the uploaded files to a
+// versioned zip with a manifest of checksums, and restores such a zip into a
+// new instance. An incremental backup builds on an earlier one and only
+// contains what changed since then, along with the keys of the rows and the
+// names of the files that still exist so that the restore can remove what
+// was deleted.
+package backup
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+
+	"projektps/helpers/uniuri"
+	"projektps/store"
+	"projektps/store/sqlstore"
+)
+
+// Format is the version of the archive layout, a restore refuses others
+const Format = 1
+
+// The layout of the archive
+const (
+	manifestName = "manifest.json"
+	tablesDir    = "tables/"
+	keysDir      = "keys/"
+	uploadDir    = "upload/"
+	// fileList names every uploaded file in an incremental backup
+	fileList = keysDir + "upload.txt"
+)
+
+// Entry is a file of the archive
+type Entry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes a backup, it is the last file of the archive
+type Manifest struct {
+	Format int    `json:"format"`
+	ID     string `json:"id"`
+	// Schema is the version of the latest migration of the database
+	Schema int64 `json:"schema"`
+	// TakenAt is the database time the tables were read at
+	TakenAt string `json:"taken_at"`
+	// FilesTakenAt is the time the uploaded files were listed at
+	FilesTakenAt time.Time `json:"files_taken_at"`
+
+	// Base is the ID of the backup an incremental backup builds on, Since
+	// and FilesSince are when that backup was taken
+	Base       string     `json:"base,omitempty"`
+	Since      string     `json:"since,omitempty"`
+	FilesSince *time.Time `json:"files_since,omitempty"`
+
+	// Tables is the number of rows of each table, Files the number of files
+	Tables  map[string]int64 `json:"tables"`
+	Files   int64            `json:"files"`
+	Entries []Entry          `json:"entries"`
+}
+
+// Incremental is true if the backup builds on another one
+func (m *Manifest) Incremental() bool {
+	return m.Base != ""
+}
+
+// Options of a backup
+type Options struct {
+	// Schema is the version of the latest migration of the database
+	Schema int64
+	// Base is the manifest of the backup an incremental backup builds on,
+	// nil for a full backup
+	Base *Manifest
+}
+
+// Create writes a backup of db and the files of uploads to w
+func Create(w io.Writer, db *sqlstore.SQLStore, uploads store.MediaStore, options Options) (*Manifest, error) {
+	now := time.Now().UTC()
+	manifest := &Manifest{
+		Format:       Format,
+		ID:           now.Format("20060102T150405Z") + "-" + uniuri.NewLen(6),
+		Schema:       options.Schema,
+		FilesTakenAt: now,
+		Tables:       make(map[string]int64),
+		Entries:      []Entry{},
+	}
+	if base := options.Base; base != nil {
+		if base.Schema != options.Schema {
+			return nil, fmt.Errorf("the base backup %s has schema %d, not %d", base.ID, base.Schema, options.Schema)
+		}
+		manifest.Base = base.ID
+		manifest.Since = base.TakenAt
+		manifest.FilesSince = &base.FilesTakenAt
+	}
+
+	archive := &archiveWriter{zip: zip.NewWriter(w), manifest: manifest}
+
+	takenAt, err := db.DumpTables(manifest.Since, archive)
+	if err != nil {
+		return nil, err
+	}
+	manifest.TakenAt = takenAt
+
+	err = archive.writeUploads(uploads)
+	if err != nil {
+		return nil, err
+	}
+
+	err = archive.close()
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// archiveWriter writes the entries of a backup and sums them up for the
+// manifest. It is the sqlstore.Dumper of the tables.
+type archiveWriter struct {
+	zip      *zip.Writer
+	manifest *Manifest
+
+	current *entryWriter
+	encoder *json.Encoder
+	table   string
+	keys    bool
+}
+
+// entryWriter writes an entry and keeps its size and checksum
+type entryWriter struct {
+	name   string
+	writer io.Writer
+	hash   hash.Hash
+	size   int64
+}
+
+func (e *entryWriter) Write(p []byte) (int, error) {
+	n, err := e.writer.Write(p)
+	e.hash.Write(p[:n])
+	e.size += int64(n)
+	return n, err
+}
+
+// create finishes the current entry and starts a new one
+func (a *archiveWriter) create(name string) (io.Writer, error) {
+	a.finish()
+
+	writer, err := a.zip.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	a.current = &entryWriter{name: name, writer: writer, hash: sha256.New()}
+	return a.current, nil
+}
+
+func (a *archiveWriter) finish() {
+	if a.current == nil {
+		return
+	}
+	a.manifest.Entries = append(a.manifest.Entries, Entry{
+		Name:   a.current.name,
+		Size:   a.current.size,
+		SHA256: hex.EncodeToString(a.current.hash.Sum(nil)),
+	})
+	a.current = nil
+}
+
+// Begin starts the entry with the rows, or the keys, of table
+func (a *archiveWriter) Begin(table sqlstore.BackupTable, keys bool) error {
+	name := tablesDir + table.Name + ".jsonl"
+	if keys {
+		name = keysDir + table.Name + ".jsonl"
+	}
+
+	writer, err := a.create(name)
+	if err != nil {
+		return err
+	}
+	a.encoder = json.NewEncoder(writer)
+	a.table = table.Name
+	a.keys = keys
+	if !keys {
+		a.manifest.Tables[table.Name] = 0
+	}
+	return nil
+}
+
+// Row writes a row as a line of JSON
+func (a *archiveWriter) Row(row sqlstore.Row) error {
+	if !a.keys {
+		a.manifest.Tables[a.table]++
+	}
+	return a.encoder.Encode(row)
+}
+
+// writeUploads writes the files of the media store, those changed since the
+// base backup if the backup is incremental. The exported zips in the upload
+// folder itself are left out, they are made again by an export.
+func (a *archiveWriter) writeUploads(uploads store.MediaStore) error {
+	objects, err := uploads.List("")
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, object := range objects {
+		if !strings.Contains(object.Name, "/") {
+			continue
+		}
+
+		names = append(names, object.Name)
+		if since := a.manifest.FilesSince; since != nil && object.ModTime.Before(*since) {
+			continue
+		}
+		err = a.writeFile(uploads, object.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !a.manifest.Incremental() {
+		return nil
+	}
+	writer, err := a.create(fileList)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err := io.WriteString(writer, name+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *archiveWriter) writeFile(uploads store.MediaStore, name string) error {
+	reader, err := uploads.Get(name)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	writer, err := a.create(uploadDir + name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, reader)
+	a.manifest.Files++
+	return err
+}
+
+// close writes the manifest and finishes the archive
+func (a *archiveWriter) close() error {
+	a.finish()
+
+	writer, err := a.zip.Create(manifestName)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(a.manifest)
+	if err != nil {
+		return err
+	}
+
+	return a.zip.Close()
+}
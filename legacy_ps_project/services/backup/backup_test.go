@@ -0,0 +1,287 @@
+package backup
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"projektps/models"
+	"projektps/store/filestore"
+	"projektps/store/sqlstore"
+)
+
+func newTestStore(t *testing.T) *sqlstore.SQLStore {
+	t.Helper()
+
+	s, err := sqlstore.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// dumpTables returns the rows of a store, without updated_at which a restore
+// sets when it updates a row
+func dumpTables(t *testing.T, s *sqlstore.SQLStore) map[string][]sqlstore.Row {
+	t.Helper()
+
+	collector := &rowCollector{rows: make(map[string][]sqlstore.Row)}
+	if _, err := s.DumpTables("", collector); err != nil {
+		t.Fatal(err)
+	}
+	return collector.rows
+}
+
+type rowCollector struct {
+	rows  map[string][]sqlstore.Row
+	table string
+}
+
+func (c *rowCollector) Begin(table sqlstore.BackupTable, keys bool) error {
+	c.table = table.Name
+	c.rows[table.Name] = []sqlstore.Row{}
+	return nil
+}
+
+func (c *rowCollector) Row(row sqlstore.Row) error {
+	delete(row, "updated_at")
+	c.rows[c.table] = append(c.rows[c.table], row)
+	return nil
+}
+
+func writeFile(t *testing.T, file string, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(file)
+		name, _ := filepath.Rel(dir, file)
+		files[filepath.ToSlash(name)] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func createBackup(t *testing.T, s *sqlstore.SQLStore, upload string, base *Manifest) *Archive {
+	t.Helper()
+
+	buffer := new(bytes.Buffer)
+	uploads := filestore.NewFileStore(upload, "/upload/")
+	if _, err := Create(buffer, s, uploads, Options{Schema: 26, Base: base}); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := Open(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newTestStore(t)
+	defer s.Close()
+	upload := filepath.Join(dir, "upload")
+
+	adventure, err := s.CreateDefaultAdventure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := s.CreateUser(&models.User{Username: "anna", Password: "hemligt", Name: "Anna Ö", Role: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddUserToAdventure(user, adventure); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateNewCategory(&models.Category{Title: "Historia"}); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(upload, adventure.Slug, "skog.jpg"), "skog")
+	writeFile(t, filepath.Join(upload, adventure.Slug, "ljud", "fagel.mp3"), "fagel")
+	writeFile(t, filepath.Join(upload, "PSadventure_"+adventure.Slug+".zip"), "export")
+
+	full := createBackup(t, s, upload, nil)
+	if full.Manifest.Tables["adventure_node"] != 3 || full.Manifest.Tables["users"] != 1 || full.Manifest.Files != 2 {
+		t.Errorf("unexpected manifest %+v", full.Manifest)
+	}
+
+	// The adventure is changed after the full backup
+	nodes, err := s.GetNodesByAdventureID(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteNode(&nodes[2]); err != nil {
+		t.Fatal(err)
+	}
+	nodes[1].Title = "Vänster igen"
+	if err := s.UpdateNode(&nodes[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LogVisitedNode("1", adventure.ID); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(upload, adventure.Slug, "skog.jpg"))
+	writeFile(t, filepath.Join(upload, adventure.Slug, "ny.png"), "ny")
+
+	incremental := createBackup(t, s, upload, full.Manifest)
+	if !incremental.Manifest.Incremental() || incremental.Manifest.Base != full.Manifest.ID {
+		t.Errorf("expected an incremental backup of %s, got %+v", full.Manifest.ID, incremental.Manifest)
+	}
+	// Rows changed within the second the full backup was taken at are taken
+	// again, files are compared to the nanosecond
+	if incremental.Manifest.Tables["adventure_log"] != 1 || incremental.Manifest.Files != 1 {
+		t.Errorf("expected only what changed, got %+v", incremental.Manifest)
+	}
+
+	restored := newTestStore(t)
+	defer restored.Close()
+	restoredUpload := filepath.Join(dir, "restored")
+
+	err = Restore(restored, filestore.NewFileStore(restoredUpload, "/upload/"), 26, full, incremental)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := dumpTables(t, s), dumpTables(t, restored); !reflect.DeepEqual(want, got) {
+		t.Errorf("the restored tables differ\nwant %v\ngot  %v", want, got)
+	}
+	want := map[string]string{
+		adventure.Slug + "/ljud/fagel.mp3": "fagel",
+		adventure.Slug + "/ny.png":         "ny",
+	}
+	if got := readFiles(t, restoredUpload); !reflect.DeepEqual(want, got) {
+		t.Errorf("expected the files %v, got %v", want, got)
+	}
+
+	// A full backup is not restored on top of existing rows
+	if err := Restore(restored, filestore.NewFileStore(restoredUpload, "/upload/"), 26, full); err == nil || !strings.Contains(err.Error(), sqlstore.ErrNotEmpty.Error()) {
+		t.Errorf("expected the restore to be refused, got %v", err)
+	}
+}
+
+func TestIncrementalBackupOfUpdates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newTestStore(t)
+	defer s.Close()
+	upload := filepath.Join(dir, "upload")
+
+	category, err := s.CreateNewCategory(&models.Category{Title: "Historia"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.CreateNewList(&models.List{Title: "Veckans"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	media, err := s.CreateMedia(&models.Media{Hash: "abc", URL: "/upload/media/abc.jpg", Size: 10, ContentType: "image/jpeg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The rows are created before the second of the full backup, which an
+	// incremental backup takes again, and updated after it
+	time.Sleep(time.Second)
+	full := createBackup(t, s, upload, nil)
+
+	category.Title = "Geografi"
+	if err := s.UpdateCategory(category); err != nil {
+		t.Fatal(err)
+	}
+	list.Title = "Månadens"
+	if err := s.UpdateList(list); err != nil {
+		t.Fatal(err)
+	}
+	media.Size, media.Width, media.Height = 8, 40, 30
+	if err := s.UpdateMedia(media); err != nil {
+		t.Fatal(err)
+	}
+	incremental := createBackup(t, s, upload, full.Manifest)
+
+	restored := newTestStore(t)
+	defer restored.Close()
+	err = Restore(restored, filestore.NewFileStore(filepath.Join(dir, "restored"), "/upload/"), 26, full, incremental)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := dumpTables(t, s), dumpTables(t, restored); !reflect.DeepEqual(want, got) {
+		t.Errorf("the restored tables differ\nwant %v\ngot  %v", want, got)
+	}
+}
+
+func TestRestoreChecks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newTestStore(t)
+	defer s.Close()
+	if _, err := s.CreateDefaultAdventure(); err != nil {
+		t.Fatal(err)
+	}
+
+	full := createBackup(t, s, dir, nil)
+	other := createBackup(t, s, dir, nil)
+	incremental := createBackup(t, s, dir, full.Manifest)
+
+	tests := []struct {
+		name     string
+		schema   int64
+		archives []*Archive
+		err      string
+	}{
+		{"schema", 27, []*Archive{full}, "has schema 26"},
+		{"incremental", 26, []*Archive{incremental}, "is incremental"},
+		{"chain", 26, []*Archive{other, incremental}, "builds on " + full.Manifest.ID},
+	}
+	for _, test := range tests {
+		restored := newTestStore(t)
+		err := Restore(restored, filestore.NewFileStore(dir, "/upload/"), test.schema, test.archives...)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected %q, got %v", test.name, test.err, err)
+		}
+		if adventures := dumpTables(t, restored)["adventure"]; len(adventures) != 0 {
+			t.Errorf("%s: expected nothing to be restored, got %v", test.name, adventures)
+		}
+		restored.Close()
+	}
+
+	// A changed row does not match its checksum
+	full.Manifest.Entries[0].SHA256 = strings.Repeat("0", 64)
+	if err := full.Verify(); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("expected a checksum error, got %v", err)
+	}
+}
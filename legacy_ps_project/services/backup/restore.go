@@ -0,0 +1,271 @@
+package backup
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"projektps/services/media"
+	"projektps/store"
+	"projektps/store/sqlstore"
+)
+
+// Archive is a backup that is read for a restore
+type Archive struct {
+	Manifest *Manifest
+
+	files map[string]*zip.File
+}
+
+// Open reads the manifest of the backup in reader and checks that the
+// archive has exactly the files the manifest lists
+func Open(reader io.ReaderAt, size int64) (*Archive, error) {
+	zipReader, err := zip.NewReader(reader, size)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File)
+	for _, file := range zipReader.File {
+		files[file.Name] = file
+	}
+
+	manifestFile, exists := files[manifestName]
+	if !exists {
+		return nil, fmt.Errorf("the archive has no %s, it is not a backup", manifestName)
+	}
+	delete(files, manifestName)
+
+	data, err := readEntry(manifestFile, 64<<20)
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("the manifest is not valid: %v", err)
+	}
+	if manifest.Format != Format {
+		return nil, fmt.Errorf("the backup has format %d, this version reads format %d", manifest.Format, Format)
+	}
+
+	listed := make(map[string]bool)
+	for _, entry := range manifest.Entries {
+		if !safeName(entry.Name) {
+			return nil, fmt.Errorf("the backup has the unsafe name %s", entry.Name)
+		}
+		if _, exists := files[entry.Name]; !exists {
+			return nil, fmt.Errorf("%s is missing from the backup", entry.Name)
+		}
+		listed[entry.Name] = true
+	}
+	for name := range files {
+		if !listed[name] {
+			return nil, fmt.Errorf("%s is not in the manifest", name)
+		}
+	}
+
+	return &Archive{Manifest: &manifest, files: files}, nil
+}
+
+// Verify checks the size and checksum of every file of the backup
+func (a *Archive) Verify() error {
+	for _, entry := range a.Manifest.Entries {
+		reader, err := a.files[entry.Name].Open()
+		if err != nil {
+			return err
+		}
+
+		hash := sha256.New()
+		n, err := io.Copy(hash, io.LimitReader(reader, entry.Size+1))
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", entry.Name, err)
+		}
+		if n != entry.Size || hex.EncodeToString(hash.Sum(nil)) != entry.SHA256 {
+			return fmt.Errorf("%s does not match its checksum", entry.Name)
+		}
+	}
+	return nil
+}
+
+// Rows calls fn with the rows, or the keys, of table
+func (a *Archive) Rows(table sqlstore.BackupTable, keys bool, fn func(row sqlstore.Row) error) error {
+	name := tablesDir + table.Name + ".jsonl"
+	if keys {
+		name = keysDir + table.Name + ".jsonl"
+	}
+	file, exists := a.files[name]
+	if !exists {
+		return fmt.Errorf("%s is missing from the backup", name)
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// Numbers are kept as written, ids do not fit a float64
+	decoder := json.NewDecoder(reader)
+	decoder.UseNumber()
+	for {
+		var row sqlstore.Row
+		err := decoder.Decode(&row)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// Restore restores a full backup, and the incremental backups that build on
+// it in order, into db and uploads. Every backup is verified before anything
+// is restored. Each backup is restored in a transaction, the files of a
+// backup are written before it is committed.
+func Restore(db *sqlstore.SQLStore, uploads store.MediaStore, schema int64, archives ...*Archive) error {
+	if len(archives) == 0 {
+		return fmt.Errorf("no backup to restore")
+	}
+
+	for i, archive := range archives {
+		manifest := archive.Manifest
+		if manifest.Schema != schema {
+			return fmt.Errorf("the backup %s has schema %d, the database has %d", manifest.ID, manifest.Schema, schema)
+		}
+		if i == 0 && manifest.Incremental() {
+			return fmt.Errorf("the backup %s is incremental, restore the full backup %s first", manifest.ID, manifest.Base)
+		}
+		if i > 0 && manifest.Base != archives[i-1].Manifest.ID {
+			return fmt.Errorf("the backup %s builds on %s, not on %s", manifest.ID, manifest.Base, archives[i-1].Manifest.ID)
+		}
+		if err := archive.Verify(); err != nil {
+			return fmt.Errorf("the backup %s is damaged: %v", manifest.ID, err)
+		}
+	}
+
+	for _, archive := range archives {
+		err := db.RestoreTables(archive, archive.Manifest.Incremental(), func() error {
+			return archive.restoreUploads(uploads)
+		})
+		if err != nil {
+			return fmt.Errorf("restoring %s: %v", archive.Manifest.ID, err)
+		}
+	}
+	return nil
+}
+
+// restoreUploads writes the files of the backup to the media store. An
+// incremental backup also removes the files that were deleted since the
+// backup it builds on.
+func (a *Archive) restoreUploads(uploads store.MediaStore) error {
+	for _, entry := range a.Manifest.Entries {
+		if !strings.HasPrefix(entry.Name, uploadDir) {
+			continue
+		}
+		err := a.restoreFile(uploads, entry.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !a.Manifest.Incremental() {
+		return nil
+	}
+
+	kept, err := a.fileList()
+	if err != nil {
+		return err
+	}
+	objects, err := uploads.List("")
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if !strings.Contains(object.Name, "/") || kept[object.Name] {
+			continue
+		}
+		if err := uploads.Delete(object.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Archive) restoreFile(uploads store.MediaStore, name string) error {
+	reader, err := a.files[name].Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	target := strings.TrimPrefix(name, uploadDir)
+	contentType := "application/octet-stream"
+	if t, ok := media.TypeByName(target); ok {
+		contentType = t.ContentType
+	}
+	return uploads.Put(target, reader, contentType)
+}
+
+// fileList returns the files the upload folder had when an incremental
+// backup was taken
+func (a *Archive) fileList() (map[string]bool, error) {
+	file, exists := a.files[fileList]
+	if !exists {
+		return nil, fmt.Errorf("%s is missing from the backup", fileList)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		names[scanner.Text()] = true
+	}
+	return names, scanner.Err()
+}
+
+// safeName refuses names that are absolute or step out of the archive
+func safeName(name string) bool {
+	if name == "" || strings.ContainsAny(name, "\\:\x00") || strings.HasPrefix(name, "/") {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return path.Clean(name) == name
+}
+
+// readEntry reads a file of the archive of at most max bytes
+func readEntry(file *zip.File, max int64) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(reader, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%s is larger than %d bytes", file.Name, max)
+	}
+	return data, nil
+}
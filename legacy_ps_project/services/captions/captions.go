@@ -0,0 +1,186 @@
+// Package captions reads subtitles for the videos and podcasts of an
+// adventure. WebVTT is the format the player shows, SubRip (.srt) files are
+// converted to it. Files with cues the player can not show are refused with
+// the line that is wrong.
+package captions
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Cue is a caption shown from Start to End
+type Cue struct {
+	ID    string
+	Start time.Duration
+	End   time.Duration
+	// Settings are the WebVTT cue settings, like "line:0 align:start"
+	Settings string
+	Text     string
+}
+
+// Track is the cues of a subtitles file
+type Track struct {
+	Cues []Cue
+}
+
+// Duration is the time the last cue ends
+func (t *Track) Duration() time.Duration {
+	var duration time.Duration
+	for _, cue := range t.Cues {
+		if cue.End > duration {
+			duration = cue.End
+		}
+	}
+	return duration
+}
+
+// WebVTT writes the track as a WebVTT file
+func (t *Track) WebVTT() []byte {
+	var vtt bytes.Buffer
+	vtt.WriteString("WEBVTT\n")
+	for _, cue := range t.Cues {
+		vtt.WriteString("\n")
+		if cue.ID != "" {
+			vtt.WriteString(cue.ID + "\n")
+		}
+		vtt.WriteString(formatTimestamp(cue.Start) + " --> " + formatTimestamp(cue.End))
+		if cue.Settings != "" {
+			vtt.WriteString(" " + cue.Settings)
+		}
+		vtt.WriteString("\n")
+		if cue.Text != "" {
+			vtt.WriteString(cue.Text + "\n")
+		}
+	}
+	return vtt.Bytes()
+}
+
+// ErrMalformed is returned for a file that can not be read, Line is the
+// line of the file that is wrong, counted from 1
+type ErrMalformed struct {
+	Line   int
+	Reason string
+}
+
+func (e *ErrMalformed) Error() string {
+	return fmt.Sprintf("captions: line %d: %s", e.Line, e.Reason)
+}
+
+// lines splits a file into lines without the byte order mark and line
+// endings
+func lines(data []byte) []string {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	return strings.Split(text, "\n")
+}
+
+// block is a group of lines between empty lines, first is the number of its
+// first line
+type block struct {
+	first int
+	lines []string
+}
+
+// blocks splits lines into the groups separated by empty lines
+func blocks(lines []string, first int) []block {
+	var result []block
+	var current *block
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			current = nil
+			continue
+		}
+		if current == nil {
+			result = append(result, block{first: first + i})
+			current = &result[len(result)-1]
+		}
+		current.lines = append(current.lines, line)
+	}
+	return result
+}
+
+// parseTiming reads "start --> end settings", with the fraction of the
+// timestamps after separator
+func parseTiming(line string, separator byte) (time.Duration, time.Duration, string, error) {
+	parts := strings.SplitN(line, "-->", 2)
+	if len(parts) != 2 {
+		return 0, 0, "", fmt.Errorf("expected a cue timing like 00:00:01%c000 --> 00:00:04%c000", separator, separator)
+	}
+	start, err := parseTimestamp(strings.TrimSpace(parts[0]), separator)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	fields := strings.Fields(parts[1])
+	if len(fields) == 0 {
+		return 0, 0, "", fmt.Errorf("the cue has no end time")
+	}
+	end, err := parseTimestamp(fields[0], separator)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if end <= start {
+		return 0, 0, "", fmt.Errorf("the cue ends at %s, before it starts at %s", fields[0], strings.TrimSpace(parts[0]))
+	}
+	return start, end, strings.Join(fields[1:], " "), nil
+}
+
+// parseTimestamp reads [hh:]mm:ss.ttt, where the fraction follows
+// separator
+func parseTimestamp(value string, separator byte) (time.Duration, error) {
+	invalid := fmt.Errorf("%q is not a timestamp like 00:00:01%c000", value, separator)
+
+	dot := strings.IndexByte(value, separator)
+	if dot < 0 || len(value)-dot-1 != 3 {
+		return 0, invalid
+	}
+	millis, ok := digits(value[dot+1:])
+	if !ok {
+		return 0, invalid
+	}
+
+	parts := strings.Split(value[:dot], ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, invalid
+	}
+	var hours int64
+	if len(parts) == 3 {
+		if hours, ok = digits(parts[0]); !ok || len(parts[0]) < 2 {
+			return 0, invalid
+		}
+		parts = parts[1:]
+	}
+	minutes, ok := digits(parts[0])
+	if !ok || len(parts[0]) != 2 || minutes > 59 {
+		return 0, invalid
+	}
+	seconds, ok := digits(parts[1])
+	if !ok || len(parts[1]) != 2 || seconds > 59 {
+		return 0, invalid
+	}
+
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second + time.Duration(millis)*time.Millisecond, nil
+}
+
+func digits(value string) (int64, bool) {
+	if value == "" || len(value) > 9 {
+		return 0, false
+	}
+	var n int64
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int64(c-'0')
+	}
+	return n, true
+}
+
+func formatTimestamp(d time.Duration) string {
+	millis := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", millis/3600000, millis/60000%60, millis/1000%60, millis%1000)
+}
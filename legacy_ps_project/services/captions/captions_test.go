@@ -0,0 +1,92 @@
+package captions
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWebVTT(t *testing.T) {
+	data := "\ufeffWEBVTT - Skogen\r\nKind: captions\r\n\r\n" +
+		"NOTE skrivet av Anna\r\n\r\n" +
+		"STYLE\r\n::cue { color: yellow }\r\n\r\n" +
+		"intro\r\n00:01.000 --> 00:04.500 line:0\r\nDet var en gång\r\nen skog\r\n\r\n" +
+		"01:02:03.040 --> 01:02:05.000\r\n<i>Slut</i>\r\n"
+
+	track, err := ParseWebVTT([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(track.Cues) != 2 {
+		t.Fatalf("expected 2 cues, got %+v", track.Cues)
+	}
+	first := track.Cues[0]
+	if first.ID != "intro" || first.Start != time.Second || first.End != 4500*time.Millisecond || first.Settings != "line:0" || first.Text != "Det var en gång\nen skog" {
+		t.Errorf("unexpected cue %+v", first)
+	}
+	if track.Cues[1].Start != time.Hour+2*time.Minute+3040*time.Millisecond {
+		t.Errorf("unexpected start %v", track.Cues[1].Start)
+	}
+	if track.Duration() != time.Hour+2*time.Minute+5*time.Second {
+		t.Errorf("unexpected duration %v", track.Duration())
+	}
+}
+
+func TestParseWebVTTMalformed(t *testing.T) {
+	tests := []struct {
+		data string
+		line int
+	}{
+		{"WEBVTTX\n\n00:01.000 --> 00:02.000\nHej", 1},
+		{"<html>", 1},
+		{"WEBVTT\n", 2},
+		{"WEBVTT\n\n00:01.000 --> 00:02.000\nHej\n\n00:01,000 --> 00:02,000\nDå", 6},
+		{"WEBVTT\n\n00:01.000 --> 00:00.500\nHej", 3},
+		{"WEBVTT\n\n00:01.000 --> 00:60.000\nHej", 3},
+		{"WEBVTT\n\n00:03.000 --> 00:04.000\nHej\n\n00:01.000 --> 00:02.000\nDå", 6},
+		{"WEBVTT\n\nintro\nHej", 4},
+		{"WEBVTT\n\nintro", 3},
+		{"WEBVTT\n\n00:01.000 --> 00:02.000\nHej\n00:03.000 --> 00:04.000\nDå", 5},
+	}
+	for _, test := range tests {
+		_, err := ParseWebVTT([]byte(test.data))
+		malformed, ok := err.(*ErrMalformed)
+		if !ok {
+			t.Errorf("%q: expected ErrMalformed, got %v", test.data, err)
+			continue
+		}
+		if malformed.Line != test.line {
+			t.Errorf("%q: expected line %d, got %v", test.data, test.line, err)
+		}
+	}
+}
+
+func TestConvertSRT(t *testing.T) {
+	data := "1\r\n00:00:01,000 --> 00:00:04,000 X1:10 X2:20\r\n<font color=\"red\">Hej</font> & <I>välkommen</I>\r\n{\\an8}till skogen &amp; 1 < 2\r\n\r\n\r\n" +
+		"2\r\n00:00:05,250 --> 00:00:07,000\r\nSlut\r\n"
+
+	track, err := ParseSRT([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "WEBVTT\n\n" +
+		"1\n00:00:01.000 --> 00:00:04.000\nHej &amp; <i>välkommen</i>\ntill skogen &amp; 1 &lt; 2\n\n" +
+		"2\n00:00:05.250 --> 00:00:07.000\nSlut\n"
+	if vtt := string(track.WebVTT()); vtt != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, vtt)
+	}
+	if track.Duration() != 7*time.Second {
+		t.Errorf("unexpected duration %v", track.Duration())
+	}
+
+	// The converted file is valid WebVTT
+	converted, err := ParseWebVTT(track.WebVTT())
+	if err != nil || len(converted.Cues) != 2 {
+		t.Errorf("expected the converted file to be read, got %v", err)
+	}
+
+	for _, malformed := range []string{"", "Hej\n00:00:01,000 --> 00:00:02,000", "1\n00:00:01.000 --> 00:00:02.000\nHej", "1\n00:00:02,000 --> 00:00:01,000\nHej"} {
+		if _, err := ParseSRT([]byte(malformed)); err == nil {
+			t.Errorf("%q: expected an error", malformed)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package captions
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ParseSRT reads a SubRip file, to be written as WebVTT. The cues are
+// numbered, with a timing like 00:00:01,000 --> 00:00:04,000. The text keeps
+// the <b>, <i> and <u> tags, which WebVTT has too, other formatting like
+// <font> is removed.
+func ParseSRT(data []byte) (*Track, error) {
+	lines := lines(data)
+
+	track := &Track{}
+	for _, b := range blocks(lines, 1) {
+		if _, ok := digits(strings.TrimSpace(b.lines[0])); !ok {
+			return nil, &ErrMalformed{Line: b.first, Reason: "expected the number of a cue"}
+		}
+		if len(b.lines) < 2 {
+			return nil, &ErrMalformed{Line: b.first, Reason: "the cue has no timing"}
+		}
+
+		// Some files have the position of the text after the timing, which
+		// WebVTT can not use
+		start, end, _, err := parseTiming(b.lines[1], ',')
+		if err != nil {
+			return nil, &ErrMalformed{Line: b.first + 1, Reason: err.Error()}
+		}
+		if n := len(track.Cues); n > 0 && start < track.Cues[n-1].Start {
+			return nil, &ErrMalformed{Line: b.first + 1, Reason: "the cue starts before the one before it"}
+		}
+
+		text := []string{}
+		for i, line := range b.lines[2:] {
+			if strings.Contains(line, "-->") {
+				return nil, &ErrMalformed{Line: b.first + 2 + i, Reason: "a cue has to be followed by an empty line"}
+			}
+			text = append(text, srtText(line))
+		}
+		track.Cues = append(track.Cues, Cue{
+			ID:    strings.TrimSpace(b.lines[0]),
+			Start: start,
+			End:   end,
+			Text:  strings.Join(text, "\n"),
+		})
+	}
+
+	if len(track.Cues) == 0 {
+		return nil, &ErrMalformed{Line: len(lines), Reason: "the file has no cues"}
+	}
+	return track, nil
+}
+
+var (
+	// srtFormatting is the formatting of SubRip that WebVTT does not have:
+	// font tags and the position tags of SSA, like {\an8}
+	srtFormatting = regexp.MustCompile(`(?i)</?font[^>]*>|\{\\[^}]*\}`)
+	// srtTag is a tag WebVTT has as well
+	srtTag = regexp.MustCompile(`(?i)^</?[biu]>`)
+	// srtEntity is a character reference, which is kept
+	srtEntity = regexp.MustCompile(`^&(#[0-9]+|#x[0-9a-fA-F]+|[a-zA-Z]+);`)
+)
+
+// srtText converts a line of SubRip text to WebVTT, where & and < that are
+// not part of a tag have to be escaped
+func srtText(line string) string {
+	line = srtFormatting.ReplaceAllString(line, "")
+
+	var text strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '<':
+			if tag := srtTag.FindString(line[i:]); tag != "" {
+				text.WriteString(strings.ToLower(tag))
+				i += len(tag) - 1
+				continue
+			}
+			text.WriteString("&lt;")
+		case line[i] == '&':
+			if entity := srtEntity.FindString(line[i:]); entity != "" {
+				text.WriteString(entity)
+				i += len(entity) - 1
+				continue
+			}
+			text.WriteString("&amp;")
+		default:
+			text.WriteByte(line[i])
+		}
+	}
+	return text.String()
+}
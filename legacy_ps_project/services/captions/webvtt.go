@@ -0,0 +1,68 @@
+package captions
+
+import (
+	"strings"
+)
+
+// ParseWebVTT reads a WebVTT file. The header, notes, styles and regions are
+// skipped. Every cue needs a valid timing that ends after it starts, the
+// cues have to be in the order they start and a file without cues is
+// refused.
+func ParseWebVTT(data []byte) (*Track, error) {
+	lines := lines(data)
+	signature := lines[0]
+	if !strings.HasPrefix(signature, "WEBVTT") || len(signature) > 6 && signature[6] != ' ' && signature[6] != '\t' {
+		return nil, &ErrMalformed{Line: 1, Reason: "the file does not start with WEBVTT"}
+	}
+
+	track := &Track{}
+	// The first block is the header
+	for _, b := range blocks(lines, 1)[1:] {
+		first := b.lines[0]
+		if isBlock(first, "NOTE") || isBlock(first, "STYLE") || isBlock(first, "REGION") {
+			continue
+		}
+
+		cue := Cue{}
+		timing := 0
+		if !strings.Contains(first, "-->") {
+			cue.ID = first
+			timing = 1
+		}
+		if timing >= len(b.lines) {
+			return nil, &ErrMalformed{Line: b.first, Reason: "the cue has no timing"}
+		}
+
+		var err error
+		cue.Start, cue.End, cue.Settings, err = parseTiming(b.lines[timing], '.')
+		if err != nil {
+			return nil, &ErrMalformed{Line: b.first + timing, Reason: err.Error()}
+		}
+		if n := len(track.Cues); n > 0 && cue.Start < track.Cues[n-1].Start {
+			return nil, &ErrMalformed{Line: b.first + timing, Reason: "the cue starts before the one before it"}
+		}
+
+		text := b.lines[timing+1:]
+		for i, line := range text {
+			if strings.Contains(line, "-->") {
+				return nil, &ErrMalformed{Line: b.first + timing + 1 + i, Reason: "a cue has to be followed by an empty line"}
+			}
+		}
+		cue.Text = strings.Join(text, "\n")
+		track.Cues = append(track.Cues, cue)
+	}
+
+	if len(track.Cues) == 0 {
+		return nil, &ErrMalformed{Line: len(lines), Reason: "the file has no cues"}
+	}
+	return track, nil
+}
+
+// isBlock is true for a line that starts a block of kind, like NOTE
+func isBlock(line, kind string) bool {
+	if !strings.HasPrefix(line, kind) {
+		return false
+	}
+	rest := line[len(kind):]
+	return rest == "" || rest[0] == ' ' || rest[0] == '\t'
+}
@@ -0,0 +1,195 @@
+// Package imaging prepares uploaded photos for the player. The metadata,
+// with the camera and the GPS position, is removed, a photo taken sideways
+// is turned upright, and narrower copies are made for small screens along
+// with a JPEG thumbnail. JPEG and PNG images are processed, other files are
+// not.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+)
+
+var (
+	// ErrUnsupported is returned for files that are not JPEG or PNG images
+	ErrUnsupported = errors.New("imaging: unsupported image format")
+	// ErrInvalidImage is returned for images that can not be read
+	ErrInvalidImage = errors.New("imaging: invalid image")
+)
+
+// Widths are the widths of the variants of an image, the ones that are
+// narrower than the image are made
+var Widths = []int{480, 960, 1600}
+
+// ThumbnailSize is the size of the square a thumbnail fits in
+const ThumbnailSize = 320
+
+// MaxPixels is the size of the largest image that is decoded. Larger images
+// only have their metadata removed, as decoding them takes too much memory.
+const MaxPixels = 40 * 1000 * 1000
+
+// Quality is the JPEG quality of variants and re-encoded images
+const Quality = 85
+
+// ThumbnailName is the name of the thumbnail among the variants
+const ThumbnailName = "thumb"
+
+// Variant is a smaller copy of an image
+type Variant struct {
+	// Name is "w" and the width, like w960, or ThumbnailName
+	Name        string
+	Width       int
+	Height      int
+	ContentType string
+	// Extension is the file extension of ContentType, like .jpg
+	Extension string
+	Data      []byte
+}
+
+// Result is a processed image
+type Result struct {
+	// Data is the image without metadata, turned upright
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+	// Variants are narrower copies of the image, narrowest first, and the
+	// thumbnail last
+	Variants []Variant
+}
+
+// Clean removes the metadata of an image and turns it upright, without
+// making variants. The image data is kept as it is unless it has to be
+// turned. ErrUnsupported is returned for anything but JPEG and PNG.
+func Clean(data []byte) (*Result, error) {
+	result, _, err := clean(data)
+	return result, err
+}
+
+// Process cleans an image, see Clean, and makes its variants
+func Process(data []byte) (*Result, error) {
+	result, img, err := clean(data)
+	if err != nil {
+		return nil, err
+	}
+	if img == nil {
+		if result.Width*result.Height > MaxPixels || result.Width == 0 || result.Height == 0 {
+			return result, nil
+		}
+		decoded, _, err := image.Decode(bytes.NewReader(result.Data))
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+		img = toRGBA(decoded)
+	}
+
+	// Transparent images are kept as PNG, photos are made JPEG
+	contentType := "image/jpeg"
+	if !img.Opaque() {
+		contentType = "image/png"
+	}
+
+	for _, width := range Widths {
+		if width >= result.Width {
+			break
+		}
+		_, height := fit(result.Width, result.Height, width, result.Height)
+		variant, err := makeVariant(img, "w"+strconv.Itoa(width), width, height, contentType)
+		if err != nil {
+			return nil, err
+		}
+		result.Variants = append(result.Variants, *variant)
+	}
+
+	// The thumbnail is always a JPEG, transparent images are put on white
+	width, height := fit(result.Width, result.Height, ThumbnailSize, ThumbnailSize)
+	thumbnail, err := makeVariant(flatten(img), ThumbnailName, width, height, "image/jpeg")
+	if err != nil {
+		return nil, err
+	}
+	result.Variants = append(result.Variants, *thumbnail)
+
+	return result, nil
+}
+
+// clean removes the metadata of an image and turns it upright. The image is
+// returned if it had to be decoded to be turned.
+func clean(data []byte) (*Result, *image.RGBA, error) {
+	var stripped []byte
+	var orientation int
+	var err error
+	result := &Result{}
+	switch {
+	case bytes.HasPrefix(data, jpegStart):
+		result.ContentType = "image/jpeg"
+		stripped, orientation, err = stripJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		result.ContentType = "image/png"
+		stripped, orientation, err = stripPNG(data)
+	default:
+		return nil, nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	result.Data = stripped
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(stripped))
+	if err != nil {
+		return nil, nil, ErrInvalidImage
+	}
+	result.Width, result.Height = config.Width, config.Height
+	if orientation == 1 || config.Width*config.Height > MaxPixels {
+		return result, nil, nil
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		return nil, nil, ErrInvalidImage
+	}
+	img := orient(toRGBA(decoded), orientation)
+	result.Width, result.Height = img.Rect.Dx(), img.Rect.Dy()
+	result.Data, err = encode(img, result.ContentType)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, img, nil
+}
+
+func makeVariant(img *image.RGBA, name string, width, height int, contentType string) (*Variant, error) {
+	if width != img.Rect.Dx() || height != img.Rect.Dy() {
+		img = resize(img, width, height)
+	}
+	data, err := encode(img, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	extension := ".jpg"
+	if contentType == "image/png" {
+		extension = ".png"
+	}
+	return &Variant{
+		Name:        name,
+		Width:       width,
+		Height:      height,
+		ContentType: contentType,
+		Extension:   extension,
+		Data:        data,
+	}, nil
+}
+
+func encode(img image.Image, contentType string) ([]byte, error) {
+	var encoded bytes.Buffer
+	var err error
+	if contentType == "image/png" {
+		err = png.Encode(&encoded, img)
+	} else {
+		err = jpeg.Encode(&encoded, img, &jpeg.Options{Quality: Quality})
+	}
+	return encoded.Bytes(), err
+}
@@ -0,0 +1,215 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// photo is a landscape image with a red top left corner
+func photo(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{0, 0, 255, 255}
+			if x < width/4 && y < height/4 {
+				c = color.RGBA{255, 0, 0, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// withEXIF adds an EXIF segment with the orientation and a GPS position,
+// and a comment, after the start of the JPEG
+func withEXIF(t *testing.T, data []byte, orientation uint16) []byte {
+	t.Helper()
+
+	tiff := &bytes.Buffer{}
+	tiff.WriteString("II*\x00")
+	binary.Write(tiff, binary.LittleEndian, uint32(8))
+	binary.Write(tiff, binary.LittleEndian, uint16(2))
+	// Orientation, SHORT
+	binary.Write(tiff, binary.LittleEndian, []uint16{0x0112, 3})
+	binary.Write(tiff, binary.LittleEndian, uint32(1))
+	binary.Write(tiff, binary.LittleEndian, []uint16{orientation, 0})
+	// GPS IFD, LONG
+	binary.Write(tiff, binary.LittleEndian, []uint16{0x8825, 4})
+	binary.Write(tiff, binary.LittleEndian, []uint32{1, 38})
+	binary.Write(tiff, binary.LittleEndian, uint32(0))
+	tiff.WriteString("GPS 59.3293N 18.0686E")
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	comment := []byte("skogen")
+
+	result := &bytes.Buffer{}
+	result.Write(data[:2])
+	result.Write([]byte{0xff, markerAPP1})
+	binary.Write(result, binary.BigEndian, uint16(len(segment)+2))
+	result.Write(segment)
+	result.Write([]byte{0xff, markerCOM})
+	binary.Write(result, binary.BigEndian, uint16(len(comment)+2))
+	result.Write(comment)
+	result.Write(data[2:])
+	return result.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var data bytes.Buffer
+	if err := jpeg.Encode(&data, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return data.Bytes()
+}
+
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xc000 && g < 0x4000 && b < 0x4000
+}
+
+func TestProcessJPEG(t *testing.T) {
+	original := encodeJPEG(t, photo(2000, 1000))
+	data := withEXIF(t, original, 1)
+
+	result, err := Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(result.Data, []byte("Exif")) || bytes.Contains(result.Data, []byte("GPS")) || bytes.Contains(result.Data, []byte("skogen")) {
+		t.Error("expected the metadata to be removed")
+	}
+	// An upright image is not encoded again
+	if !bytes.Equal(result.Data, original) {
+		t.Errorf("expected the image data to be kept, got %d bytes", len(result.Data))
+	}
+	if result.ContentType != "image/jpeg" || result.Width != 2000 || result.Height != 1000 {
+		t.Errorf("unexpected result %s %dx%d", result.ContentType, result.Width, result.Height)
+	}
+
+	expected := []struct {
+		name          string
+		width, height int
+	}{
+		{"w480", 480, 240},
+		{"w960", 960, 480},
+		{"w1600", 1600, 800},
+		{"thumb", 320, 160},
+	}
+	if len(result.Variants) != len(expected) {
+		t.Fatalf("expected %d variants, got %d", len(expected), len(result.Variants))
+	}
+	for i, variant := range result.Variants {
+		if variant.Name != expected[i].name || variant.Width != expected[i].width || variant.Height != expected[i].height || variant.Extension != ".jpg" {
+			t.Errorf("expected %v, got %s %dx%d %s", expected[i], variant.Name, variant.Width, variant.Height, variant.Extension)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(variant.Data))
+		if err != nil {
+			t.Fatalf("%s: %v", variant.Name, err)
+		}
+		if img.Bounds().Dx() != variant.Width || img.Bounds().Dy() != variant.Height {
+			t.Errorf("%s: unexpected size %v", variant.Name, img.Bounds())
+		}
+		if !isRed(img.At(2, 2)) || isRed(img.At(variant.Width-3, variant.Height-3)) {
+			t.Errorf("%s: expected the red corner at the top left", variant.Name)
+		}
+	}
+}
+
+func TestProcessOrientation(t *testing.T) {
+	// Stored landscape, to be shown rotated 90° clockwise
+	result, err := Process(withEXIF(t, encodeJPEG(t, photo(400, 200)), 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Width != 200 || result.Height != 400 {
+		t.Fatalf("expected a portrait image, got %dx%d", result.Width, result.Height)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(result.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 200 || img.Bounds().Dy() != 400 {
+		t.Errorf("unexpected size %v", img.Bounds())
+	}
+	if !isRed(img.At(195, 5)) || isRed(img.At(5, 5)) {
+		t.Error("expected the red corner at the top right")
+	}
+	if bytes.Contains(result.Data, []byte("Exif")) {
+		t.Error("expected the metadata to be removed")
+	}
+
+	// Only the thumbnail is narrower than the image
+	if len(result.Variants) != 1 || result.Variants[0].Name != ThumbnailName || result.Variants[0].Width != 160 || result.Variants[0].Height != 320 {
+		t.Errorf("unexpected variants %+v", result.Variants)
+	}
+}
+
+func TestProcessPNG(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 600, 300))
+	img.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatal(err)
+	}
+
+	// A text chunk before the end
+	data := encoded.Bytes()
+	text := []byte("\x00\x00\x00\x0ctEXtComment\x00skog\x00\x00\x00\x00")
+	data = append(append(append([]byte{}, data[:len(data)-12]...), text...), data[len(data)-12:]...)
+
+	result, err := Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(result.Data, []byte("tEXt")) || !bytes.Equal(result.Data, encoded.Bytes()) {
+		t.Error("expected only the text to be removed")
+	}
+	// A transparent image keeps its transparency, but the thumbnail is a
+	// JPEG on white
+	if len(result.Variants) != 2 || result.Variants[0].Name != "w480" || result.Variants[0].Extension != ".png" ||
+		result.Variants[1].ContentType != "image/jpeg" || result.Variants[1].Extension != ".jpg" {
+		t.Fatalf("unexpected variants %+v", result.Variants)
+	}
+	thumbnail, err := jpeg.Decode(bytes.NewReader(result.Variants[1].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, b, _ := thumbnail.At(100, 100).RGBA(); r < 0xf000 || g < 0xf000 || b < 0xf000 {
+		t.Errorf("expected a white background, got %v", thumbnail.At(100, 100))
+	}
+}
+
+func TestProcessInvalid(t *testing.T) {
+	if _, err := Process([]byte("GIF89a")); err != ErrUnsupported {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+	for _, data := range []string{"\xff\xd8\xff\xe0\x00", "\xff\xd8\xff\xdb\x00\x04\x00\x00", "\x89PNG\r\n\x1a\n\x00\x00\x10\x00IHDR"} {
+		if _, err := Process([]byte(data)); err != ErrInvalidImage {
+			t.Errorf("%q: expected ErrInvalidImage, got %v", data, err)
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		width, height, maxWidth, maxHeight int
+		fitWidth, fitHeight                int
+	}{
+		{100, 50, 320, 320, 100, 50},
+		{1000, 500, 320, 320, 320, 160},
+		{500, 1000, 320, 320, 160, 320},
+		{5000, 1, 320, 320, 320, 1},
+	}
+	for _, test := range tests {
+		width, height := fit(test.width, test.height, test.maxWidth, test.maxHeight)
+		if width != test.fitWidth || height != test.fitHeight {
+			t.Errorf("%dx%d in %dx%d: expected %dx%d, got %dx%d", test.width, test.height, test.maxWidth, test.maxHeight, test.fitWidth, test.fitHeight, width, height)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+var (
+	jpegStart    = []byte{0xff, 0xd8}
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader   = []byte("Exif\x00\x00")
+	iccHeader    = []byte("ICC_PROFILE\x00")
+)
+
+// JPEG markers
+const (
+	markerSOS   = 0xda
+	markerEOI   = 0xd9
+	markerAPP0  = 0xe0
+	markerAPP1  = 0xe1
+	markerAPP2  = 0xe2
+	markerAPP14 = 0xee
+	markerAPP15 = 0xef
+	markerCOM   = 0xfe
+)
+
+// stripJPEG removes the metadata segments of a JPEG: EXIF and XMP, which
+// hold the camera, the time and the GPS position, IPTC and comments. The
+// JFIF header, the colour profile and the Adobe segment are kept, the image
+// data is copied as it is. It also returns the EXIF orientation, 1 if there
+// is none.
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if !bytes.HasPrefix(data, jpegStart) {
+		return nil, 0, ErrInvalidImage
+	}
+
+	stripped := bytes.NewBuffer(make([]byte, 0, len(data)))
+	stripped.Write(jpegStart)
+	orientation := 1
+	i := len(jpegStart)
+	for {
+		if i+2 > len(data) || data[i] != 0xff {
+			return nil, 0, ErrInvalidImage
+		}
+		marker := data[i+1]
+		// Markers may be padded with 0xff
+		if marker == 0xff {
+			i++
+			continue
+		}
+		// Markers without a segment
+		if marker == 0x01 || marker >= 0xd0 && marker <= 0xd7 {
+			stripped.Write(data[i : i+2])
+			i += 2
+			continue
+		}
+		if marker == markerEOI {
+			stripped.Write(data[i : i+2])
+			return stripped.Bytes(), orientation, nil
+		}
+		if i+4 > len(data) {
+			return nil, 0, ErrInvalidImage
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) || end < i+4 {
+			return nil, 0, ErrInvalidImage
+		}
+		// The compressed image follows the start of scan, up to the end
+		if marker == markerSOS {
+			stripped.Write(data[i:])
+			return stripped.Bytes(), orientation, nil
+		}
+
+		segment := data[i+4 : end]
+		keep := true
+		switch {
+		case marker == markerAPP1:
+			if bytes.HasPrefix(segment, exifHeader) {
+				orientation = exifOrientation(segment[len(exifHeader):])
+			}
+			keep = false
+		case marker == markerAPP2:
+			keep = bytes.HasPrefix(segment, iccHeader)
+		case marker > markerAPP2 && marker <= markerAPP15:
+			keep = marker == markerAPP14
+		case marker == markerCOM:
+			keep = false
+		}
+		if keep {
+			stripped.Write(data[i:end])
+		}
+		i = end
+	}
+}
+
+// strippedChunks are the PNG chunks with metadata
+var strippedChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// stripPNG removes the chunks of a PNG with metadata: EXIF, text and the
+// time it was changed. It also returns the EXIF orientation, 1 if there is
+// none.
+func stripPNG(data []byte) ([]byte, int, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, 0, ErrInvalidImage
+	}
+
+	stripped := bytes.NewBuffer(make([]byte, 0, len(data)))
+	stripped.Write(pngSignature)
+	orientation := 1
+	i := len(pngSignature)
+	for i < len(data) {
+		// length, type, data and CRC
+		if i+12 > len(data) {
+			return nil, 0, ErrInvalidImage
+		}
+		length := binary.BigEndian.Uint32(data[i:])
+		if length > uint32(len(data)-i-12) {
+			return nil, 0, ErrInvalidImage
+		}
+		end := i + 12 + int(length)
+		chunkType := string(data[i+4 : i+8])
+
+		if chunkType == "eXIf" {
+			orientation = exifOrientation(data[i+8 : end-4])
+		}
+		if !strippedChunks[chunkType] {
+			stripped.Write(data[i:end])
+		}
+		i = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+	return stripped.Bytes(), orientation, nil
+}
+
+// exifOrientation reads the orientation tag of the first IFD of EXIF data,
+// which starts with a TIFF header. It is 1, upright, if there is none.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := order.Uint32(tiff[4:])
+	if ifd > uint32(len(tiff)-2) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := int(ifd) + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		// The orientation is a SHORT in the value field
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
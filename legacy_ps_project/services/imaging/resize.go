@@ -0,0 +1,170 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+// toRGBA copies img to an RGBA image with its origin at 0, 0
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// flatten puts img on a white background, for formats without transparency
+func flatten(img *image.RGBA) *image.RGBA {
+	if img.Opaque() {
+		return img
+	}
+	flat := image.NewRGBA(img.Rect)
+	draw.Draw(flat, flat.Rect, image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Rect, img, img.Rect.Min, draw.Over)
+	return flat
+}
+
+// orient turns img upright by the EXIF orientation, which tells how the
+// stored image has to be flipped and rotated to be shown
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	oriented := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // flipped horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // flipped vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counterclockwise
+				dx, dy = y, w-1-x
+			}
+			copy(oriented.Pix[dy*oriented.Stride+dx*4:dy*oriented.Stride+dx*4+4], img.Pix[y*img.Stride+x*4:y*img.Stride+x*4+4])
+		}
+	}
+	return oriented
+}
+
+// fit returns the size of an image of width and height scaled down to fit
+// within maxWidth and maxHeight, keeping its aspect ratio
+func fit(width, height, maxWidth, maxHeight int) (int, int) {
+	if width <= maxWidth && height <= maxHeight {
+		return width, height
+	}
+	if width*maxHeight > height*maxWidth {
+		return maxWidth, max(1, (height*maxWidth+width/2)/width)
+	}
+	return max(1, (width*maxHeight+height/2)/height), maxHeight
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// resize scales img down to width and height. Every pixel is the average of
+// the pixels it covers, which keeps the details of a photo without the
+// aliasing of picking pixels. It is done in two passes, first the rows and
+// then the columns.
+func resize(img *image.RGBA, width, height int) *image.RGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+
+	rows := image.NewRGBA(image.Rect(0, 0, width, h))
+	weights := areaWeights(w, width)
+	for y := 0; y < h; y++ {
+		src := img.Pix[y*img.Stride : y*img.Stride+w*4]
+		dst := rows.Pix[y*rows.Stride : y*rows.Stride+width*4]
+		average(dst, 4, src, 4, weights)
+	}
+
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	weights = areaWeights(h, height)
+	for x := 0; x < width; x++ {
+		average(resized.Pix[x*4:], resized.Stride, rows.Pix[x*4:], rows.Stride, weights)
+	}
+	return resized
+}
+
+// areaWeight is how much of a source pixel a pixel of the result covers
+type areaWeight struct {
+	src    int
+	weight float32
+}
+
+// areaWeights returns for every pixel of a line of size the pixels of a line
+// of srcSize it covers
+func areaWeights(srcSize, size int) [][]areaWeight {
+	scale := float64(srcSize) / float64(size)
+	weights := make([][]areaWeight, size)
+	for i := range weights {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for src := int(start); src < srcSize && float64(src) < end; src++ {
+			covered := minFloat(end, float64(src+1)) - maxFloat(start, float64(src))
+			if covered > 0 {
+				weights[i] = append(weights[i], areaWeight{src: src, weight: float32(covered / scale)})
+			}
+		}
+	}
+	return weights
+}
+
+// average writes the weighted averages of the pixels of src to dst, the
+// pixels are step bytes apart
+func average(dst []byte, dstStep int, src []byte, srcStep int, weights [][]areaWeight) {
+	for i, pixel := range weights {
+		var r, g, b, a float32
+		for _, w := range pixel {
+			p := src[w.src*srcStep:]
+			r += float32(p[0]) * w.weight
+			g += float32(p[1]) * w.weight
+			b += float32(p[2]) * w.weight
+			a += float32(p[3]) * w.weight
+		}
+		d := dst[i*dstStep:]
+		d[0], d[1], d[2], d[3] = clamp(r), clamp(g), clamp(b), clamp(a)
+	}
+}
+
+func clamp(v float32) uint8 {
+	if v >= 255 {
+		return 255
+	}
+	if v <= 0 {
+		return 0
+	}
+	return uint8(v + 0.5)
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
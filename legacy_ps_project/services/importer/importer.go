@@ -0,0 +1,412 @@
+// Package importer reads adventure zips, as written by the export, without
+// trusting them: the archive is checked against size limits, entry names
+// that could escape the upload folder are refused, media has to be on the
+// allow-list of package media and the adventure is validated, all before
+// anything is created.
+package importer
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"projektps/models"
+	"projektps/services/media"
+	"projektps/services/validation"
+)
+
+// Limits bound what an import may contain
+type Limits struct {
+	// MaxArchiveSize is the size of the uploaded zip
+	MaxArchiveSize int64
+	// MaxAdventureSize is the size of the adventure JSON file
+	MaxAdventureSize int64
+	// MaxFileSize is the unpacked size of each media file
+	MaxFileSize int64
+	// MaxTotalSize is the unpacked size of all media files
+	MaxTotalSize int64
+	// MaxFiles is the number of entries in the zip
+	MaxFiles int
+}
+
+// DefaultLimits fit the largest adventures we have, the export refuses zips
+// over 100 MB
+var DefaultLimits = Limits{
+	MaxArchiveSize:   200 << 20,
+	MaxAdventureSize: 20 << 20,
+	MaxFileSize:      100 << 20,
+	MaxTotalSize:     400 << 20,
+	MaxFiles:         5000,
+}
+
+// Error codes of the report
+const (
+	CodeTooLarge           = "import.toolarge"
+	CodeTooManyFiles       = "import.toomanyfiles"
+	CodeInvalidArchive     = "import.invalidarchive"
+	CodeUnsafePath         = "import.unsafepath"
+	CodeMissingAdventure   = "import.missingadventure"
+	CodeAmbiguousAdventure = "import.ambiguousadventure"
+	CodeInvalidAdventure   = "import.invalidadventure"
+	CodeFileTooLarge       = "import.filetoolarge"
+	CodeTypeNotAllowed     = "import.typenotallowed"
+	CodeIgnored            = "import.ignored"
+	CodeMissingMedia       = "import.missingmedia"
+	CodeQuotaExceeded      = "import.quotaexceeded"
+)
+
+// Issue is a problem with the archive or an entry of it
+type Issue struct {
+	Code    string `json:"code"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+// File is a media file that is imported
+type File struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+
+	entry *zip.File
+}
+
+// Report tells what an import did, or why it failed. Errors stop the import,
+// skipped entries and warnings do not.
+type Report struct {
+	Error     string            `json:"error,omitempty"`
+	Adventure *models.Adventure `json:"adventure,omitempty"`
+	Files     []File            `json:"files"`
+	Skipped   []Issue           `json:"skipped"`
+	Warnings  []Issue           `json:"warnings"`
+	Errors    []Issue           `json:"errors"`
+}
+
+// NewReport returns an empty report
+func NewReport() *Report {
+	return &Report{Files: []File{}, Skipped: []Issue{}, Warnings: []Issue{}, Errors: []Issue{}}
+}
+
+// Valid is true if the report contains no errors
+func (r *Report) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// Fail adds an error
+func (r *Report) Fail(code, name, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, Issue{Code: code, Name: name, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *Report) skip(code, name, format string, args ...interface{}) {
+	r.Skipped = append(r.Skipped, Issue{Code: code, Name: name, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *Report) warn(code, name, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, Issue{Code: code, Name: name, Message: fmt.Sprintf(format, args...)})
+}
+
+// Archive is a checked adventure zip
+type Archive struct {
+	// Adventure is the decoded and validated adventure file
+	Adventure *models.Adventure
+	// Media are the files of upload/{slug}/, named relative to that folder
+	Media []File
+	// Shared are the files of upload/media/, which adventures share, named
+	// relative to the upload folder
+	Shared []File
+	limits Limits
+}
+
+// isExportFile is true for the files the export writes for the offline
+// player and SCORM, they are not imported and not reported either
+func isExportFile(name string) bool {
+	return name == "index.html" || name == "imsmanifest.xml" || strings.HasPrefix(name, "static/")
+}
+
+// Read checks the zip in reader. The report lists every problem found, the
+// archive is nil if there were errors.
+func Read(reader io.ReaderAt, size int64, limits Limits) (*Archive, *Report) {
+	report := NewReport()
+
+	if size > limits.MaxArchiveSize {
+		report.Fail(CodeTooLarge, "", "the archive is larger than %d MB", limits.MaxArchiveSize>>20)
+		return nil, report
+	}
+
+	zipReader, err := zip.NewReader(reader, size)
+	if err != nil {
+		report.Fail(CodeInvalidArchive, "", "the archive can not be read: %v", err)
+		return nil, report
+	}
+	if len(zipReader.File) > limits.MaxFiles {
+		report.Fail(CodeTooManyFiles, "", "the archive has more than %d files", limits.MaxFiles)
+		return nil, report
+	}
+
+	// Every name is checked before anything is read
+	var adventureFiles []*zip.File
+	var uploads []*zip.File
+	for _, entry := range zipReader.File {
+		name := entry.Name
+		if !safeName(name) {
+			report.Fail(CodeUnsafePath, name, "the name could point outside of the upload folder")
+			continue
+		}
+		if entry.Mode().IsDir() || strings.HasSuffix(name, "/") {
+			continue
+		}
+
+		switch {
+		case !strings.Contains(name, "/") && strings.HasSuffix(name, ".json"):
+			adventureFiles = append(adventureFiles, entry)
+		case strings.HasPrefix(name, "upload/"):
+			uploads = append(uploads, entry)
+		case isExportFile(name):
+		default:
+			report.skip(CodeIgnored, name, "the file is not part of an adventure")
+		}
+	}
+	if !report.Valid() {
+		return nil, report
+	}
+
+	adventureFile, ok := findAdventureFile(adventureFiles, report)
+	if !ok {
+		return nil, report
+	}
+
+	adventure := readAdventure(adventureFile, limits, report)
+	if adventure == nil {
+		return nil, report
+	}
+
+	archive := &Archive{Adventure: adventure, limits: limits}
+	prefix := "upload/" + adventure.Slug + "/"
+
+	var total int64
+	for _, entry := range uploads {
+		name := entry.Name
+		_, shared := models.ParseMediaURL("/" + name)
+		if !shared && (adventure.Slug == "" || !strings.HasPrefix(name, prefix)) {
+			report.skip(CodeIgnored, name, "the file is not in the upload folder of the adventure")
+			continue
+		}
+
+		size := int64(entry.UncompressedSize64)
+		if size > limits.MaxFileSize {
+			report.Fail(CodeFileTooLarge, name, "the file is larger than %d MB", limits.MaxFileSize>>20)
+			continue
+		}
+		total += size
+		if total > limits.MaxTotalSize {
+			report.Fail(CodeTooLarge, "", "the files are larger than %d MB unpacked", limits.MaxTotalSize>>20)
+			return nil, report
+		}
+
+		t, err := detect(entry)
+		if err != nil {
+			report.skip(CodeTypeNotAllowed, name, "%v", err)
+			continue
+		}
+
+		if shared {
+			archive.Shared = append(archive.Shared, File{
+				Name:        strings.TrimPrefix(name, "upload/"),
+				ContentType: t.ContentType,
+				Size:        size,
+				entry:       entry,
+			})
+			continue
+		}
+		archive.Media = append(archive.Media, File{
+			Name:        strings.TrimPrefix(name, prefix),
+			ContentType: t.ContentType,
+			Size:        size,
+			entry:       entry,
+		})
+	}
+	if !report.Valid() {
+		return nil, report
+	}
+
+	// Files the adventure uses that are not in the archive
+	imported := make(map[string]bool)
+	for _, file := range archive.Media {
+		imported["/"+prefix+file.Name] = true
+	}
+	for _, file := range archive.Shared {
+		imported["/upload/"+file.Name] = true
+	}
+	for _, url := range adventure.MediaURLs() {
+		_, shared := models.ParseMediaURL(url)
+		if (shared || strings.HasPrefix(url, "/"+prefix)) && !imported[url] {
+			report.warn(CodeMissingMedia, strings.TrimPrefix(url, "/"), "the adventure uses a file that is not imported")
+			imported[url] = true
+		}
+	}
+
+	report.Files = append(report.Files, archive.Media...)
+	report.Files = append(report.Files, archive.Shared...)
+	return archive, report
+}
+
+// safeName refuses names that are absolute or step out of the archive, also
+// when read as Windows paths
+func safeName(name string) bool {
+	if name == "" || strings.ContainsAny(name, "\\\x00") || strings.HasPrefix(name, "/") || strings.Contains(name, ":") {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." || part == "." {
+			return false
+		}
+	}
+	return path.Clean(name) == strings.TrimSuffix(name, "/")
+}
+
+// findAdventureFile picks the adventure file, PSadventure_{slug}.json of the
+// export or else the only JSON file in the root of the archive
+func findAdventureFile(files []*zip.File, report *Report) (*zip.File, bool) {
+	candidates := []*zip.File{}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name, "PSadventure_") {
+			candidates = append(candidates, file)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = files
+	}
+
+	switch len(candidates) {
+	case 0:
+		report.Fail(CodeMissingAdventure, "", "the archive has no adventure file")
+		return nil, false
+	case 1:
+		return candidates[0], true
+	}
+
+	names := []string{}
+	for _, file := range candidates {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	report.Fail(CodeAmbiguousAdventure, "", "the archive has more than one adventure file: %s", strings.Join(names, ", "))
+	return nil, false
+}
+
+// slugPattern matches the slugs uniuri makes, or no slug at all
+var slugPattern = regexp.MustCompile(`^[A-Za-z0-9_-]*$`)
+
+// readAdventure decodes and validates the adventure file
+func readAdventure(file *zip.File, limits Limits, report *Report) *models.Adventure {
+	if int64(file.UncompressedSize64) > limits.MaxAdventureSize {
+		report.Fail(CodeTooLarge, file.Name, "the adventure file is larger than %d MB", limits.MaxAdventureSize>>20)
+		return nil
+	}
+
+	data, err := readAll(file, limits.MaxAdventureSize)
+	if err != nil {
+		report.Fail(CodeInvalidAdventure, file.Name, "%v", err)
+		return nil
+	}
+
+	var adventure models.Adventure
+	if err := json.Unmarshal(data, &adventure); err != nil {
+		report.Fail(CodeInvalidAdventure, file.Name, "the adventure file is not valid: %v", err)
+		return nil
+	}
+	if len(adventure.Nodes) == 0 {
+		report.Fail(CodeInvalidAdventure, file.Name, "the adventure has no nodes")
+		return nil
+	}
+	if !slugPattern.MatchString(adventure.Slug) {
+		report.Fail(CodeInvalidAdventure, file.Name, "the adventure has an invalid slug")
+		return nil
+	}
+
+	validationReport := validation.ValidateAdventure(&adventure)
+	for _, issue := range validationReport.Errors {
+		report.Fail(CodeInvalidAdventure, file.Name, "%s", issue.Message)
+	}
+	for _, issue := range validationReport.Warnings {
+		report.warn(issue.Code, file.Name, "%s", issue.Message)
+	}
+	for _, fieldError := range models.ValidateProps(adventure.Props, adventure.Nodes, adventure.Links) {
+		report.warn("import.invalidprops", file.Name, "%s", describeFieldError(fieldError))
+	}
+	if !report.Valid() {
+		return nil
+	}
+
+	return &adventure
+}
+
+func describeFieldError(fieldError models.FieldError) string {
+	switch {
+	case fieldError.NodeID != nil:
+		return fmt.Sprintf("node %d: %s %s", *fieldError.NodeID, fieldError.Field, fieldError.Message)
+	case fieldError.LinkID != nil:
+		return fmt.Sprintf("link %d: %s %s", *fieldError.LinkID, fieldError.Field, fieldError.Message)
+	}
+	return fmt.Sprintf("%s %s", fieldError.Field, fieldError.Message)
+}
+
+// detect checks the start of a media file against the allow-list
+func detect(file *zip.File) (media.Type, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return media.Type{}, err
+	}
+	defer reader.Close()
+
+	head := make([]byte, media.SniffLength)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return media.Type{}, err
+	}
+	return media.Detect(path.Base(file.Name), head[:n])
+}
+
+// readAll reads a file of the archive, which may not unpack to more than max
+// bytes whatever its header says
+func readAll(file *zip.File, max int64) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(reader, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%s unpacks to more than %d bytes", file.Name, max)
+	}
+	return data, nil
+}
+
+// Copy writes the content of a media file to w. The zip header can lie about
+// the size, so the copy fails when the file unpacks to more than the limit.
+func (a *Archive) Copy(file File, w io.Writer) error {
+	reader, err := file.entry.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	n, err := io.Copy(w, io.LimitReader(reader, a.limits.MaxFileSize+1))
+	if err != nil {
+		return err
+	}
+	if n > a.limits.MaxFileSize || n != file.Size {
+		return fmt.Errorf("%s does not unpack to its size of %d bytes", file.Name, file.Size)
+	}
+	return nil
+}
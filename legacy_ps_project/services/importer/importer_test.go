@@ -0,0 +1,234 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"projektps/models"
+)
+
+var pngHead = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+type entry struct {
+	name string
+	data []byte
+}
+
+func buildZip(t *testing.T, entries ...entry) *bytes.Reader {
+	buffer := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(buffer)
+	for _, e := range entries {
+		writer, err := zipWriter.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.Write(e.data)
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buffer.Bytes())
+}
+
+func adventureJSON(t *testing.T, slug string) []byte {
+	adventure := models.Adventure{
+		Slug:     slug,
+		Title:    "Test",
+		CoverUrl: "/upload/" + slug + "/cover.png",
+		Nodes: []models.Node{
+			{NodeID: 0, NodeType: "root", ImageURL: "/upload/" + slug + "/missing.jpg"},
+		},
+	}
+	data, err := json.Marshal(adventure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func read(reader *bytes.Reader, limits Limits) (*Archive, *Report) {
+	return Read(reader, reader.Size(), limits)
+}
+
+func codes(issues []Issue) map[string]int {
+	result := make(map[string]int)
+	for _, issue := range issues {
+		result[issue.Code]++
+	}
+	return result
+}
+
+func TestReadArchive(t *testing.T) {
+	reader := buildZip(t,
+		entry{"PSadventure_abc.json", adventureJSON(t, "abc")},
+		entry{"index.html", []byte("<html>")},
+		entry{"static/js/aventyr.player.js", []byte("")},
+		entry{"upload/abc/cover.png", pngHead},
+		entry{"upload/abc/page.html", []byte("<script>")},
+		entry{"upload/abc/fake.jpg", []byte("<script>")},
+		entry{"upload/other/cover.png", pngHead},
+		entry{"notes.txt", []byte("notes")},
+	)
+
+	archive, report := read(reader, DefaultLimits)
+	if archive == nil || !report.Valid() {
+		t.Fatalf("Expected a valid archive, got %v", report.Errors)
+	}
+	if archive.Adventure.Title != "Test" {
+		t.Errorf("Wrong adventure %s", archive.Adventure.Title)
+	}
+	if len(archive.Media) != 1 || archive.Media[0].Name != "cover.png" || archive.Media[0].ContentType != "image/png" {
+		t.Errorf("Expected only cover.png, got %v", archive.Media)
+	}
+
+	skipped := codes(report.Skipped)
+	if skipped[CodeTypeNotAllowed] != 2 || skipped[CodeIgnored] != 2 {
+		t.Errorf("Wrong skipped files: %v", report.Skipped)
+	}
+	if len(report.Warnings) != 1 || report.Warnings[0].Code != CodeMissingMedia || report.Warnings[0].Name != "upload/abc/missing.jpg" {
+		t.Errorf("Expected missing.jpg to be reported, got %v", report.Warnings)
+	}
+
+	var copied bytes.Buffer
+	if err := archive.Copy(archive.Media[0], &copied); err != nil || !bytes.Equal(copied.Bytes(), pngHead) {
+		t.Errorf("Wrong copy of cover.png: %v", err)
+	}
+}
+
+func TestSharedMedia(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	missing := strings.Repeat("cd", 32)
+	adventure := models.Adventure{
+		Slug:     "abc",
+		Title:    "Test",
+		CoverUrl: models.MediaURL(hash, ".png"),
+		Nodes: []models.Node{
+			{NodeID: 0, NodeType: "root", ImageURL: models.MediaURL(missing, ".jpg")},
+		},
+	}
+	data, err := json.Marshal(adventure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := buildZip(t,
+		entry{"PSadventure_abc.json", data},
+		entry{strings.TrimPrefix(models.MediaURL(hash, ".png"), "/"), pngHead},
+		entry{"upload/media/zz/cover.png", pngHead},
+	)
+
+	archive, report := read(reader, DefaultLimits)
+	if archive == nil || !report.Valid() {
+		t.Fatalf("Expected a valid archive, got %v", report.Errors)
+	}
+	if len(archive.Media) != 0 || len(archive.Shared) != 1 || "/upload/"+archive.Shared[0].Name != adventure.CoverUrl {
+		t.Errorf("Expected only the shared cover, got %v and %v", archive.Media, archive.Shared)
+	}
+	if skipped := codes(report.Skipped); skipped[CodeIgnored] != 1 {
+		t.Errorf("Wrong skipped files: %v", report.Skipped)
+	}
+	if len(report.Warnings) != 1 || report.Warnings[0].Code != CodeMissingMedia || "/"+report.Warnings[0].Name != models.MediaURL(missing, ".jpg") {
+		t.Errorf("Expected the missing shared file to be reported, got %v", report.Warnings)
+	}
+}
+
+func TestUnsafeNames(t *testing.T) {
+	for _, name := range []string{
+		"../evil.png",
+		"upload/abc/../../evil.png",
+		"/etc/evil.png",
+		"upload\\abc\\..\\evil.png",
+		"C:/evil.png",
+		"upload/abc/./cover.png",
+		"upload//abc/cover.png",
+	} {
+		reader := buildZip(t,
+			entry{"PSadventure_abc.json", adventureJSON(t, "abc")},
+			entry{name, pngHead},
+		)
+		archive, report := read(reader, DefaultLimits)
+		if archive != nil || codes(report.Errors)[CodeUnsafePath] != 1 {
+			t.Errorf("Expected %s to be refused, got %v", name, report.Errors)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{MaxArchiveSize: 1 << 20, MaxAdventureSize: 1 << 10, MaxFileSize: 64, MaxTotalSize: 100, MaxFiles: 4}
+
+	tests := []struct {
+		name    string
+		entries []entry
+		code    string
+	}{
+		{"file", []entry{
+			{"PSadventure_abc.json", adventureJSON(t, "abc")},
+			{"upload/abc/cover.png", append(pngHead, make([]byte, 64)...)},
+		}, CodeFileTooLarge},
+		{"total", []entry{
+			{"PSadventure_abc.json", adventureJSON(t, "abc")},
+			{"upload/abc/a.png", append(pngHead, make([]byte, 40)...)},
+			{"upload/abc/b.png", append(pngHead, make([]byte, 40)...)},
+		}, CodeTooLarge},
+		{"adventure", []entry{
+			{"PSadventure_abc.json", append(adventureJSON(t, "abc"), bytes.Repeat([]byte(" "), 1<<10)...)},
+		}, CodeTooLarge},
+		{"count", []entry{
+			{"PSadventure_abc.json", adventureJSON(t, "abc")},
+			{"a", nil}, {"b", nil}, {"c", nil}, {"d", nil},
+		}, CodeTooManyFiles},
+	}
+
+	for _, test := range tests {
+		archive, report := read(buildZip(t, test.entries...), limits)
+		if archive != nil || codes(report.Errors)[test.code] != 1 {
+			t.Errorf("%s: expected %s, got %v", test.name, test.code, report.Errors)
+		}
+	}
+
+	reader := buildZip(t, entry{"PSadventure_abc.json", adventureJSON(t, "abc")})
+	limits.MaxArchiveSize = reader.Size() - 1
+	if archive, report := read(reader, limits); archive != nil || codes(report.Errors)[CodeTooLarge] != 1 {
+		t.Errorf("Expected the archive to be too large, got %v", report.Errors)
+	}
+}
+
+func TestInvalidAdventure(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []entry
+		code    string
+	}{
+		{"missing", []entry{{"upload/abc/cover.png", pngHead}}, CodeMissingAdventure},
+		{"ambiguous", []entry{{"a.json", []byte("{}")}, {"b.json", []byte("{}")}}, CodeAmbiguousAdventure},
+		{"json", []entry{{"PSadventure_abc.json", []byte(`{"nodes": [`)}}, CodeInvalidAdventure},
+		{"nodes", []entry{{"PSadventure_abc.json", []byte(`{"slug": "abc"}`)}}, CodeInvalidAdventure},
+		{"slug", []entry{{"PSadventure_abc.json", adventureJSON(t, "../abc")}}, CodeInvalidAdventure},
+		{"start", []entry{{"PSadventure_abc.json", []byte(`{"slug": "abc", "nodes": [{"node_id": 1}]}`)}}, CodeInvalidAdventure},
+	}
+
+	for _, test := range tests {
+		archive, report := read(buildZip(t, test.entries...), DefaultLimits)
+		if archive != nil || codes(report.Errors)[test.code] != 1 {
+			t.Errorf("%s: expected %s, got %v", test.name, test.code, report.Errors)
+		}
+	}
+
+	if archive, report := read(bytes.NewReader([]byte("not a zip")), DefaultLimits); archive != nil || codes(report.Errors)[CodeInvalidArchive] != 1 {
+		t.Errorf("Expected an invalid archive, got %v", report.Errors)
+	}
+}
+
+func TestAdventureFilePreferred(t *testing.T) {
+	reader := buildZip(t,
+		entry{"settings.json", []byte("{}")},
+		entry{"PSadventure_abc.json", adventureJSON(t, "abc")},
+	)
+	archive, report := read(reader, DefaultLimits)
+	if archive == nil {
+		t.Fatalf("Expected PSadventure_abc.json to be read, got %v", report.Errors)
+	}
+}
@@ -0,0 +1,397 @@
+// Package ink exports adventures as ink source, the scripting language of
+// inkle's Ink runtime. Every node becomes a knot and every link a sticky
+// choice with a divert, so the story plays like it does in the player. The
+// .ink file can be compiled to ink JSON with inklecate.
+package ink
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"projektps/models"
+)
+
+// Warning describes something in the adventure that ink can not express
+type Warning struct {
+	Node    string `json:"node,omitempty"`
+	Message string `json:"message"`
+}
+
+func (w Warning) String() string {
+	if w.Node == "" {
+		return w.Message
+	}
+	return fmt.Sprintf("%s: %s", w.Node, w.Message)
+}
+
+// choice is a button of a node in the player
+type choice struct {
+	link       models.Link
+	target     int64
+	title      string
+	conditions []string
+}
+
+type exporter struct {
+	adventure *models.Adventure
+	nodes     map[int64]*models.Node
+	props     map[int64]*models.NodeProps
+	knots     map[int64]string
+	warnings  []Warning
+}
+
+func (e *exporter) warn(nodeID int64, format string, args ...interface{}) {
+	node := ""
+	if nodeID >= 0 {
+		node = e.knots[nodeID]
+	}
+	e.warnings = append(e.warnings, Warning{Node: node, Message: fmt.Sprintf(format, args...)})
+}
+
+// Export writes adventure as ink source. The knots follow the graph from the
+// start node, nodes that can not be reached come last.
+func Export(adventure *models.Adventure) ([]byte, []Warning) {
+	e := &exporter{
+		adventure: adventure,
+		nodes:     make(map[int64]*models.Node),
+		props:     make(map[int64]*models.NodeProps),
+		knots:     make(map[int64]string),
+	}
+
+	nodes := append([]models.Node{}, adventure.Nodes...)
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].NodeID < nodes[j].NodeID })
+
+	used := make(map[string]bool)
+	start := int64(-1)
+	for i := range nodes {
+		node := &nodes[i]
+		e.nodes[node.NodeID] = node
+		e.knots[node.NodeID] = knotName(node, used)
+
+		props, err := models.ParseNodeProps(node.Props)
+		if err != nil {
+			e.warn(node.NodeID, "the props could not be read: %v", err)
+			props = &models.NodeProps{}
+		}
+		e.props[node.NodeID] = props
+
+		if node.NodeType == "root" && start < 0 {
+			start = node.NodeID
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// %s\n", oneLine(adventure.Title))
+	if adventure.ViewSlug != "" {
+		fmt.Fprintf(&out, "// https://www.textaventyr.se/spela/%s\n", adventure.ViewSlug)
+	}
+	out.WriteString("\n")
+
+	if start < 0 {
+		e.warn(-1, "the adventure has no start node")
+		out.WriteString("-> END\n")
+		return out.Bytes(), e.warnings
+	}
+	fmt.Fprintf(&out, "-> %s\n", e.knots[start])
+
+	// Breadth first from the start node, in the order of the choices
+	visited := map[int64]bool{start: true}
+	queue := []int64{start}
+	order := []int64{}
+	for len(queue) > 0 {
+		nodeID := queue[0]
+		queue = queue[1:]
+		order = append(order, nodeID)
+
+		for _, c := range e.choices(nodeID, false) {
+			if !visited[c.target] {
+				visited[c.target] = true
+				queue = append(queue, c.target)
+			}
+		}
+	}
+
+	for _, node := range nodes {
+		if !visited[node.NodeID] {
+			e.warn(node.NodeID, "the node can not be reached from the start node")
+			order = append(order, node.NodeID)
+		}
+	}
+
+	for _, nodeID := range order {
+		out.WriteString("\n")
+		e.writeKnot(&out, nodeID)
+	}
+
+	return out.Bytes(), e.warnings
+}
+
+func (e *exporter) writeKnot(out *bytes.Buffer, nodeID int64) {
+	node := e.nodes[nodeID]
+	props := e.props[nodeID]
+	chapterType := ""
+	if len(props.ChapterType) > 0 {
+		chapterType = props.ChapterType[0]
+	}
+
+	fmt.Fprintf(out, "=== %s ===\n", e.knots[nodeID])
+
+	if node.ImageURL != "" {
+		fmt.Fprintf(out, "# image: %s\n", escapeText(node.ImageURL))
+	}
+
+	text := contentText(node.Content)
+	if text == "" && node.ImageURL == "" {
+		// The player shows the title of nodes without content
+		text = node.Title
+	}
+	for _, line := range strings.Split(text, "\n") {
+		out.WriteString(escapeLine(line) + "\n")
+	}
+
+	if strings.HasPrefix(chapterType, "ref-node") {
+		e.warn(nodeID, "the reference node is exported as text, its link is not opened")
+	}
+
+	choices := e.choices(nodeID, true)
+
+	// A random node moves on to one of its targets at once
+	if chapterType == "random-node" {
+		targets := []string{}
+		for _, c := range choices {
+			if c.target == nodeID {
+				continue
+			}
+			if len(c.conditions) > 0 {
+				e.warn(nodeID, "the conditions of link %d are ignored, since it starts at a random node", c.link.LinkID)
+			}
+			targets = append(targets, e.knots[c.target])
+		}
+
+		if len(targets) > 1 {
+			out.WriteString("{shuffle:\n")
+			for _, target := range targets {
+				fmt.Fprintf(out, "- -> %s\n", target)
+			}
+			out.WriteString("}\n")
+			return
+		}
+		e.warn(nodeID, "the random node needs at least two targets")
+		if len(targets) == 1 {
+			fmt.Fprintf(out, "-> %s\n", targets[0])
+			return
+		}
+	}
+
+	if len(choices) == 0 {
+		out.WriteString("-> END\n")
+		return
+	}
+
+	for _, c := range choices {
+		conditions := ""
+		for _, condition := range c.conditions {
+			conditions += "{" + condition + "} "
+		}
+		fmt.Fprintf(out, "+ %s[%s] -> %s\n", conditions, escapeText(c.title), e.knots[c.target])
+	}
+}
+
+// choices returns the buttons of a node like the player shows them: links
+// from the node with their target_title, bidirectional links to it with
+// their source_title, in the order of ordered_link_ids
+func (e *exporter) choices(nodeID int64, report bool) []choice {
+	links := append([]models.Link{}, e.adventure.Links...)
+	sort.SliceStable(links, func(i, j int) bool { return links[i].LinkID < links[j].LinkID })
+
+	ordered := []models.Link{}
+	for _, id := range e.props[nodeID].OrderedLinkIDs {
+		linkID, ok := id.Int()
+		if !ok {
+			continue
+		}
+		for _, link := range links {
+			if link.LinkID == linkID {
+				ordered = append(ordered, link)
+			}
+		}
+	}
+	for _, link := range links {
+		if !containsLink(ordered, link.LinkID) {
+			ordered = append(ordered, link)
+		}
+	}
+
+	choices := []choice{}
+	for _, link := range ordered {
+		c := choice{link: link}
+		switch {
+		case link.SourceNodeID == nodeID:
+			c.target = link.TargetNodeID
+			c.title = link.TargetLinkTitle
+			c.conditions = e.conditions(link, report)
+		case link.TargetNodeID == nodeID && link.LinkType == "bidirectional":
+			c.target = link.SourceNodeID
+			c.title = link.SourceLinkTitle
+		default:
+			continue
+		}
+
+		target, exists := e.nodes[c.target]
+		if !exists {
+			if report {
+				e.warn(nodeID, "link %d leads to the missing node %d and is skipped", link.LinkID, c.target)
+			}
+			continue
+		}
+		if strings.TrimSpace(c.title) == "" {
+			c.title = target.Title
+		}
+
+		choices = append(choices, c)
+	}
+
+	return choices
+}
+
+// conditions turns positiveNodeList and negativeNodeList into visit counts.
+// The player shows a link when every node of positiveNodeList is visited,
+// and hides it when every node of negativeNodeList is.
+func (e *exporter) conditions(link models.Link, report bool) []string {
+	props, err := models.ParseLinkProps(link.Props)
+	if err != nil {
+		if report {
+			e.warn(link.SourceNodeID, "the props of link %d could not be read: %v", link.LinkID, err)
+		}
+		return nil
+	}
+
+	knots := func(ids []models.Number) []string {
+		names := []string{}
+		for _, id := range ids {
+			nodeID, ok := id.Int()
+			if !ok || e.knots[nodeID] == "" {
+				if report && !id.IsEmpty() {
+					e.warn(link.SourceNodeID, "the condition of link %d refers to the missing node %s", link.LinkID, id.String())
+				}
+				continue
+			}
+			names = append(names, e.knots[nodeID])
+		}
+		return names
+	}
+
+	conditions := []string{}
+	if positive := knots(props.PositiveNodeList); len(positive) > 0 {
+		conditions = append(conditions, strings.Join(positive, " && "))
+	}
+	if negative := knots(props.NegativeNodeList); len(negative) == 1 {
+		conditions = append(conditions, "not "+negative[0])
+	} else if len(negative) > 1 {
+		conditions = append(conditions, "not ("+strings.Join(negative, " && ")+")")
+	}
+	return conditions
+}
+
+func containsLink(links []models.Link, linkID int64) bool {
+	for _, link := range links {
+		if link.LinkID == linkID {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	identifierChars = regexp.MustCompile(`[^a-z0-9]+`)
+	accents         = strings.NewReplacer("å", "a", "ä", "a", "ö", "o", "é", "e", "è", "e", "ü", "u", "æ", "ae", "ø", "o")
+)
+
+// knotName makes a readable, unique ink identifier of the node title, e.g.
+// "Gå till sjön" with node_id 3 becomes ga_till_sjon_3
+func knotName(node *models.Node, used map[string]bool) string {
+	ascii := accents.Replace(strings.ToLower(node.Title))
+	name := strings.Trim(identifierChars.ReplaceAllString(ascii, "_"), "_")
+	if len(name) > 30 {
+		name = strings.TrimRight(name[:30], "_")
+	}
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "nod_" + name
+	}
+	name = fmt.Sprintf("%s_%d", strings.TrimRight(name, "_"), node.NodeID)
+	name = strings.Replace(name, "-", "m", 1)
+
+	for used[name] {
+		name += "_"
+	}
+	used[name] = true
+	return name
+}
+
+var (
+	lineBreaks = regexp.MustCompile(`(?i)<br\s*/?>`)
+	blockEnds  = regexp.MustCompile(`(?i)</(p|div|h[1-6]|li|blockquote|ul|ol|table|tr)>`)
+	listItems  = regexp.MustCompile(`(?i)<li\b[^>]*>`)
+	tags       = regexp.MustCompile(`<[^>]*>`)
+	manyBreaks = regexp.MustCompile(`\n{3,}`)
+)
+
+// contentText turns the HTML content of a node into plain text with blank
+// lines between paragraphs
+func contentText(content string) string {
+	text := lineBreaks.ReplaceAllString(content, "\n")
+	text = blockEnds.ReplaceAllString(text, "\n\n")
+	text = listItems.ReplaceAllString(text, "• ")
+	text = tags.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = strings.ReplaceAll(text, " ", " ")
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text = manyBreaks.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// escapeText escapes the characters that ink reads as markup anywhere in a
+// line: logic, choices, alternatives, tags, comments, diverts and glue
+func escapeText(text string) string {
+	runes := []rune(text)
+	var out strings.Builder
+	for i, r := range runes {
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+
+		switch {
+		case strings.ContainsRune(`\{}[]|#`, r),
+			r == '/' && (next == '/' || next == '*'),
+			r == '-' && next == '>',
+			r == '<' && (next == '>' || next == '-'):
+			out.WriteRune('\\')
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// escapeLine also escapes what ink reads as markup at the start of a line
+func escapeLine(line string) string {
+	line = escapeText(line)
+	trimmed := strings.TrimLeft(line, " \t")
+	if trimmed != "" && strings.ContainsRune("*+-=~", rune(trimmed[0])) {
+		return line[:len(line)-len(trimmed)] + `\` + trimmed
+	}
+	return line
+}
+
+func oneLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,79 @@
+package ink
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"projektps/models"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestExport compares the export of every adventure in testdata/*.json with
+// the .ink file next to it. Run go test -update to rewrite them.
+func TestExport(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test adventures found")
+	}
+
+	for _, file := range files {
+		file := file
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var adventure models.Adventure
+			if err := json.Unmarshal(data, &adventure); err != nil {
+				t.Fatal(err)
+			}
+
+			ink, warnings := Export(&adventure)
+			for _, warning := range warnings {
+				ink = append(ink, []byte("// WARNING "+warning.String()+"\n")...)
+			}
+
+			golden := strings.TrimSuffix(file, ".json") + ".ink"
+			if *update {
+				if err := ioutil.WriteFile(golden, ink, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(ink) != string(expected) {
+				t.Errorf("%s differs from the export:\n%s", golden, ink)
+			}
+		})
+	}
+}
+
+func TestEscape(t *testing.T) {
+	for text, expected := range map[string]string{
+		"Se http://example.com": `Se http:\//example.com`,
+		"{a} [b] | #c":          `\{a\} \[b\] \| \#c`,
+		"a -> b <> c <- d":      `a \-> b \<> c \<- d`,
+		"100 - 50 < 60":         "100 - 50 < 60",
+	} {
+		if escaped := escapeText(text); escaped != expected {
+			t.Errorf("%q: expected %q, got %q", text, expected, escaped)
+		}
+	}
+
+	if escaped := escapeLine("  * stjärna"); escaped != `  \* stjärna` {
+		t.Errorf("unexpected line %q", escaped)
+	}
+}
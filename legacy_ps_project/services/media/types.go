@@ -0,0 +1,162 @@
+// Package media knows which files adventures may contain: images, audio,
+// video, subtitles and fonts. Everything else, like HTML or scripts, would be
+// served back from /upload/ and is refused.
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Kind groups media types that are used the same way in the player
+type Kind string
+
+// The kinds of media
+const (
+	KindImage     Kind = "image"
+	KindAudio     Kind = "audio"
+	KindVideo     Kind = "video"
+	KindSubtitles Kind = "subtitles"
+	KindFont      Kind = "font"
+)
+
+// Type is a media type we accept
+type Type struct {
+	Kind        Kind
+	ContentType string
+	Extensions  []string
+	// sniffed are the results of http.DetectContentType the content may have
+	sniffed []string
+	// matches checks content that http.DetectContentType does not know
+	matches func(head []byte) bool
+}
+
+// Types is the allow-list of media types
+var Types = []Type{
+	{Kind: KindImage, ContentType: "image/jpeg", Extensions: []string{".jpg", ".jpeg"}, sniffed: []string{"image/jpeg"}},
+	{Kind: KindImage, ContentType: "image/png", Extensions: []string{".png"}, sniffed: []string{"image/png"}},
+	{Kind: KindImage, ContentType: "image/gif", Extensions: []string{".gif"}, sniffed: []string{"image/gif"}},
+	{Kind: KindImage, ContentType: "image/webp", Extensions: []string{".webp"}, sniffed: []string{"image/webp"}},
+	{Kind: KindAudio, ContentType: "audio/mpeg", Extensions: []string{".mp3"}, sniffed: []string{"audio/mpeg"}, matches: isMP3Frame},
+	{Kind: KindAudio, ContentType: "audio/mp4", Extensions: []string{".m4a"}, sniffed: []string{"video/mp4"}},
+	{Kind: KindAudio, ContentType: "audio/ogg", Extensions: []string{".ogg", ".oga"}, sniffed: []string{"application/ogg"}},
+	{Kind: KindAudio, ContentType: "audio/wav", Extensions: []string{".wav"}, sniffed: []string{"audio/wave"}},
+	{Kind: KindVideo, ContentType: "video/mp4", Extensions: []string{".mp4", ".m4v"}, sniffed: []string{"video/mp4"}},
+	{Kind: KindVideo, ContentType: "video/webm", Extensions: []string{".webm"}, sniffed: []string{"video/webm"}},
+	{Kind: KindSubtitles, ContentType: "text/vtt", Extensions: []string{".vtt"}, matches: isWebVTT},
+	// SubRip subtitles are converted to WebVTT when they are uploaded
+	{Kind: KindSubtitles, ContentType: "application/x-subrip", Extensions: []string{".srt"}, matches: isSubRip},
+	{Kind: KindFont, ContentType: "font/woff2", Extensions: []string{".woff2"}, sniffed: []string{"font/woff2"}},
+	{Kind: KindFont, ContentType: "font/woff", Extensions: []string{".woff"}, sniffed: []string{"font/woff"}},
+	{Kind: KindFont, ContentType: "font/ttf", Extensions: []string{".ttf"}, sniffed: []string{"font/ttf"}},
+	{Kind: KindFont, ContentType: "font/otf", Extensions: []string{".otf"}, sniffed: []string{"font/otf"}},
+}
+
+// MaxSizes are the sizes of the largest files of each kind that may be
+// uploaded
+var MaxSizes = map[Kind]int64{
+	KindImage:     25 << 20,
+	KindAudio:     50 << 20,
+	KindVideo:     200 << 20,
+	KindSubtitles: 1 << 20,
+	KindFont:      5 << 20,
+}
+
+// MaxSize is the size of the largest file of the type that may be uploaded
+func (t Type) MaxSize() int64 {
+	return MaxSizes[t.Kind]
+}
+
+// MaxUploadSize is the size of the largest file that may be uploaded
+func MaxUploadSize() int64 {
+	var max int64
+	for _, size := range MaxSizes {
+		if size > max {
+			max = size
+		}
+	}
+	return max
+}
+
+// SniffLength is how much of the content Detect looks at
+const SniffLength = 512
+
+// ErrNotAllowed is returned for files that are not on the allow-list
+type ErrNotAllowed struct {
+	Name   string
+	Reason string
+}
+
+func (e *ErrNotAllowed) Error() string {
+	return fmt.Sprintf("%s: %s", e.Name, e.Reason)
+}
+
+// TypeByName returns the type of the file extension of name
+func TypeByName(name string) (Type, bool) {
+	extension := strings.ToLower(path.Ext(name))
+	for _, t := range Types {
+		for _, e := range t.Extensions {
+			if e == extension {
+				return t, true
+			}
+		}
+	}
+	return Type{}, false
+}
+
+// Detect returns the type of a file from its name, and checks that head, the
+// start of the content, really is of that type
+func Detect(name string, head []byte) (Type, error) {
+	t, ok := TypeByName(name)
+	if !ok {
+		return Type{}, &ErrNotAllowed{Name: name, Reason: "the file type is not allowed"}
+	}
+
+	if len(head) > SniffLength {
+		head = head[:SniffLength]
+	}
+	sniffed := http.DetectContentType(head)
+	for _, s := range t.sniffed {
+		if s == sniffed {
+			return t, nil
+		}
+	}
+	if t.matches != nil && t.matches(head) {
+		return t, nil
+	}
+
+	return Type{}, &ErrNotAllowed{Name: name, Reason: fmt.Sprintf("the content is %s, not %s", sniffed, t.ContentType)}
+}
+
+// isMP3Frame matches MPEG audio without an ID3 tag, which starts with a frame
+// sync
+func isMP3Frame(head []byte) bool {
+	return len(head) >= 2 && head[0] == 0xff && head[1]&0xe0 == 0xe0
+}
+
+func isWebVTT(head []byte) bool {
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	if !bytes.HasPrefix(head, []byte("WEBVTT")) {
+		return false
+	}
+	rest := head[len("WEBVTT"):]
+	return len(rest) == 0 || rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n' || rest[0] == '\r'
+}
+
+// isSubRip matches a SubRip file, which starts with the number of the first
+// cue followed by its timing
+func isSubRip(head []byte) bool {
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	lines := strings.SplitN(strings.TrimLeft(string(head), " \t\r\n"), "\n", 3)
+	if len(lines) < 2 {
+		return false
+	}
+	number := strings.TrimSpace(lines[0])
+	if number == "" || strings.Trim(number, "0123456789") != "" {
+		return false
+	}
+	return strings.Contains(lines[1], "-->")
+}
@@ -0,0 +1,39 @@
+package media
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		head    string
+		allowed bool
+		kind    Kind
+	}{
+		{"skog.jpg", "\xff\xd8\xff\xe0", true, KindImage},
+		{"skog.PNG", "\x89PNG\r\n\x1a\n", true, KindImage},
+		{"fagel.mp3", "ID3\x03", true, KindAudio},
+		{"fagel.mp3", "\xff\xfb\x90\x00", true, KindAudio},
+		{"text.vtt", "\xef\xbb\xbfWEBVTT\n\n", true, KindSubtitles},
+		{"text.vtt", "WEBVTTX", false, ""},
+		{"text.srt", "\xef\xbb\xbf1\r\n00:00:01,000 --> 00:00:02,000\r\n", true, KindSubtitles},
+		{"text.srt", "<html>\n-->", false, ""},
+		{"skog.jpg", "<html><script>", false, ""},
+		{"skog.svg", "<svg>", false, ""},
+		{"index.html", "<html>", false, ""},
+		{"skog", "\x89PNG\r\n\x1a\n", false, ""},
+	}
+
+	for _, test := range tests {
+		detected, err := Detect(test.name, []byte(test.head))
+		if (err == nil) != test.allowed {
+			t.Errorf("%s %q: expected allowed %v, got %v", test.name, test.head, test.allowed, err)
+			continue
+		}
+		if err == nil && detected.Kind != test.kind {
+			t.Errorf("%s: expected %s, got %s", test.name, test.kind, detected.Kind)
+		}
+		if _, ok := err.(*ErrNotAllowed); err != nil && !ok {
+			t.Errorf("%s: expected ErrNotAllowed, got %T", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package scorm
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// The manifests are checked in Go against the content packaging rules of
+// IMS CP 1.1 and the ADL CAM, for the elements a package of ours can have:
+// the order and number of the elements, the namespaces, the attributes and
+// their types, the ids and what refers to them, the ADL metadata and the
+// SCORM type of the resources.
+
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+// ncName is the lexical space of xs:ID and xs:IDREF
+var ncName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// schemaVersions are the values of schemaversion ADL allows for a version
+var schemaVersions = map[Version][]string{
+	Version12:   {"1.2"},
+	Version2004: {"CAM 1.3", "2004 3rd Edition", "2004 4th Edition"},
+}
+
+type element struct {
+	name     xml.Name
+	attrs    map[xml.Name]string
+	children []*element
+	text     string
+}
+
+// occurs is an element of a sequence with its number of occurrences, max
+// -1 is unbounded
+type occurs struct {
+	name     string
+	min, max int
+}
+
+type manifestCheck struct {
+	version Version
+	schema  schema
+	ids     map[string]string
+	refs    []idRef
+}
+
+type idRef struct {
+	ref, kind, attr string
+}
+
+// checkManifest returns the first rule data breaks, nil for a valid manifest
+func checkManifest(version Version, data []byte) error {
+	s, exists := schemas[version]
+	if !exists {
+		return fmt.Errorf("unknown version %q", version)
+	}
+	root, err := parseElement(data)
+	if err != nil {
+		return err
+	}
+	c := &manifestCheck{version: version, schema: s, ids: make(map[string]string)}
+	if err := c.manifest(root); err != nil {
+		return err
+	}
+	for _, r := range c.refs {
+		if kind, exists := c.ids[r.ref]; !exists || kind != r.kind {
+			return fmt.Errorf("%s %q does not refer to a %s", r.attr, r.ref, r.kind)
+		}
+	}
+	return nil
+}
+
+func parseElement(data []byte) (*element, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*element
+	var root *element
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF && root != nil && len(stack) == 0 {
+				return root, nil
+			}
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			e := &element{name: t.Name, attrs: make(map[xml.Name]string)}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+					continue
+				}
+				e.attrs[attr.Name] = attr.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			} else if root != nil {
+				return nil, fmt.Errorf("more than one root element")
+			} else {
+				root = e
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			} else if strings.TrimSpace(string(t)) != "" {
+				return nil, fmt.Errorf("text outside the root element")
+			}
+		}
+	}
+}
+
+// sequence checks that the children of e are the elements of the sequence
+// in order, and returns them by name
+func (c *manifestCheck) sequence(e *element, sequence ...occurs) (map[string][]*element, error) {
+	found := make(map[string][]*element)
+	i := 0
+	for _, o := range sequence {
+		for i < len(e.children) && e.children[i].name.Local == o.name && e.children[i].name.Space == c.schema.namespace {
+			found[o.name] = append(found[o.name], e.children[i])
+			i++
+		}
+		n := len(found[o.name])
+		if n < o.min || (o.max >= 0 && n > o.max) {
+			return nil, fmt.Errorf("%s: expected %s %d to %d times, found %d", e.name.Local, o.name, o.min, o.max, n)
+		}
+	}
+	if i < len(e.children) {
+		child := e.children[i].name
+		return nil, fmt.Errorf("%s: unexpected element {%s}%s", e.name.Local, child.Space, child.Local)
+	}
+	if strings.TrimSpace(e.text) != "" {
+		return nil, fmt.Errorf("%s: unexpected text", e.name.Local)
+	}
+	return found, nil
+}
+
+// attributes checks that e has the required attributes and no others than
+// allowed
+func (c *manifestCheck) attributes(e *element, required []xml.Name, allowed ...xml.Name) error {
+	for _, name := range required {
+		if _, exists := e.attrs[name]; !exists {
+			return fmt.Errorf("%s: missing attribute %s", e.name.Local, name.Local)
+		}
+	}
+	known := append(append([]xml.Name{}, required...), allowed...)
+	for name := range e.attrs {
+		found := false
+		for _, k := range known {
+			found = found || k == name
+		}
+		if !found {
+			return fmt.Errorf("%s: unexpected attribute {%s}%s", e.name.Local, name.Space, name.Local)
+		}
+	}
+	return nil
+}
+
+// id records the xs:ID of e, which is unique in the document
+func (c *manifestCheck) id(e *element, kind string) error {
+	id := e.attrs[xml.Name{Local: "identifier"}]
+	if !ncName.MatchString(id) {
+		return fmt.Errorf("%s: %q is not an xs:ID", e.name.Local, id)
+	}
+	if _, exists := c.ids[id]; exists {
+		return fmt.Errorf("%s: the id %q is used twice", e.name.Local, id)
+	}
+	c.ids[id] = kind
+	return nil
+}
+
+func (c *manifestCheck) ref(e *element, attr string, kind string) error {
+	ref, exists := e.attrs[xml.Name{Local: attr}]
+	if !exists {
+		return nil
+	}
+	if !ncName.MatchString(ref) {
+		return fmt.Errorf("%s: %s %q is not an xs:IDREF", e.name.Local, attr, ref)
+	}
+	c.refs = append(c.refs, idRef{ref: ref, kind: kind, attr: attr})
+	return nil
+}
+
+func local(names ...string) []xml.Name {
+	result := make([]xml.Name, len(names))
+	for i, name := range names {
+		result[i] = xml.Name{Local: name}
+	}
+	return result
+}
+
+func (c *manifestCheck) manifest(e *element) error {
+	if e.name != (xml.Name{Space: c.schema.namespace, Local: "manifest"}) {
+		return fmt.Errorf("the root is {%s}%s, expected a manifest in %s", e.name.Space, e.name.Local, c.schema.namespace)
+	}
+	schemaLocation := xml.Name{Space: xsiNamespace, Local: "schemaLocation"}
+	if err := c.attributes(e, local("identifier"), append(local("version"), schemaLocation)...); err != nil {
+		return err
+	}
+	if err := c.id(e, "manifest"); err != nil {
+		return err
+	}
+	if err := c.schemaLocation(e.attrs[schemaLocation]); err != nil {
+		return err
+	}
+
+	children, err := c.sequence(e,
+		occurs{"metadata", 1, 1},
+		occurs{"organizations", 1, 1},
+		occurs{"resources", 1, 1},
+	)
+	if err != nil {
+		return err
+	}
+	if err := c.metadata(children["metadata"][0]); err != nil {
+		return err
+	}
+	if err := c.organizations(children["organizations"][0]); err != nil {
+		return err
+	}
+	return c.resources(children["resources"][0])
+}
+
+// schemaLocation checks that the locations are given for the content
+// packaging and the ADL namespaces
+func (c *manifestCheck) schemaLocation(value string) error {
+	fields := strings.Fields(value)
+	if len(fields)%2 != 0 {
+		return fmt.Errorf("schemaLocation has a namespace without a location")
+	}
+	locations := make(map[string]string)
+	for i := 0; i < len(fields); i += 2 {
+		locations[fields[i]] = fields[i+1]
+	}
+	for _, namespace := range []string{c.schema.namespace, c.schema.adlcpNamespace} {
+		if !strings.HasSuffix(locations[namespace], ".xsd") {
+			return fmt.Errorf("schemaLocation has no schema for %s", namespace)
+		}
+	}
+	return nil
+}
+
+func (c *manifestCheck) metadata(e *element) error {
+	if err := c.attributes(e, nil); err != nil {
+		return err
+	}
+	children, err := c.sequence(e, occurs{"schema", 1, 1}, occurs{"schemaversion", 1, 1})
+	if err != nil {
+		return err
+	}
+	if schema := children["schema"][0].text; schema != "ADL SCORM" {
+		return fmt.Errorf("schema is %q, expected ADL SCORM", schema)
+	}
+	version := children["schemaversion"][0].text
+	for _, allowed := range schemaVersions[c.version] {
+		if version == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("schemaversion %q is not one of %v", version, schemaVersions[c.version])
+}
+
+func (c *manifestCheck) organizations(e *element) error {
+	if err := c.attributes(e, nil, local("default")...); err != nil {
+		return err
+	}
+	if err := c.ref(e, "default", "organization"); err != nil {
+		return err
+	}
+	children, err := c.sequence(e, occurs{"organization", 0, -1})
+	if err != nil {
+		return err
+	}
+	for _, organization := range children["organization"] {
+		if err := c.attributes(organization, local("identifier"), local("structure")...); err != nil {
+			return err
+		}
+		if err := c.id(organization, "organization"); err != nil {
+			return err
+		}
+		found, err := c.sequence(organization, occurs{"title", 1, 1}, occurs{"item", 1, -1})
+		if err != nil {
+			return err
+		}
+		for _, item := range found["item"] {
+			if err := c.item(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *manifestCheck) item(e *element) error {
+	if err := c.attributes(e, local("identifier"), local("identifierref", "isvisible", "parameters")...); err != nil {
+		return err
+	}
+	if err := c.id(e, e.name.Local); err != nil {
+		return err
+	}
+	if err := c.ref(e, "identifierref", "resource"); err != nil {
+		return err
+	}
+	if visible, exists := e.attrs[xml.Name{Local: "isvisible"}]; exists {
+		switch visible {
+		case "true", "false", "1", "0":
+		default:
+			return fmt.Errorf("item: isvisible %q is not an xs:boolean", visible)
+		}
+	}
+	children, err := c.sequence(e, occurs{"title", 1, 1}, occurs{"item", 0, -1})
+	if err != nil {
+		return err
+	}
+	for _, item := range children["item"] {
+		if err := c.item(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *manifestCheck) resources(e *element) error {
+	if err := c.attributes(e, nil); err != nil {
+		return err
+	}
+	children, err := c.sequence(e, occurs{"resource", 0, -1})
+	if err != nil {
+		return err
+	}
+
+	scormType := xml.Name{Space: c.schema.adlcpNamespace, Local: "scormtype"}
+	if c.version == Version2004 {
+		scormType.Local = "scormType"
+	}
+	for _, resource := range children["resource"] {
+		if err := c.attributes(resource, []xml.Name{{Local: "identifier"}, {Local: "type"}, scormType}, local("href")...); err != nil {
+			return err
+		}
+		if err := c.id(resource, "resource"); err != nil {
+			return err
+		}
+		if t := resource.attrs[scormType]; t != "sco" && t != "asset" {
+			return fmt.Errorf("resource: %s %q is not sco or asset", scormType.Local, t)
+		}
+		files, err := c.sequence(resource, occurs{"file", 0, -1})
+		if err != nil {
+			return err
+		}
+		for _, file := range files["file"] {
+			if err := c.attributes(file, local("href")); err != nil {
+				return err
+			}
+			if _, err := c.sequence(file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+// Package scorm describes adventures as SCORM packages, so that a learning
+// management system can launch the offline player and get completion data
+// back. A package is a single SCO with every file of the player as resource.
+package scorm
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Version is a SCORM version
+type Version string
+
+// The supported SCORM versions
+const (
+	Version12   Version = "scorm12"
+	Version2004 Version = "scorm2004"
+)
+
+// schema holds what differs between the manifests of the versions
+type schema struct {
+	namespace      string
+	schemaLocation string
+	adlcpNamespace string
+	adlcpLocation  string
+	schemaVersion  string
+	scormTypeAttr  string
+}
+
+var schemas = map[Version]schema{
+	Version12: {
+		namespace:      "http://www.imsproject.org/xsd/imscp_rootv1p1p2",
+		schemaLocation: "imscp_rootv1p1p2.xsd",
+		adlcpNamespace: "http://www.adlnet.org/xsd/adlcp_rootv1p2",
+		adlcpLocation:  "adlcp_rootv1p2.xsd",
+		schemaVersion:  "1.2",
+		scormTypeAttr:  "adlcp:scormtype",
+	},
+	Version2004: {
+		namespace:      "http://www.imsglobal.org/xsd/imscp_v1p1",
+		schemaLocation: "imscp_v1p1.xsd",
+		adlcpNamespace: "http://www.adlnet.org/xsd/adlcp_v1p3",
+		adlcpLocation:  "adlcp_v1p3.xsd",
+		schemaVersion:  "2004 4th Edition",
+		scormTypeAttr:  "adlcp:scormType",
+	},
+}
+
+// Settings configure when the adapter reports the adventure as completed
+type Settings struct {
+	Version Version `json:"version"`
+	// CompletionPercent is the share of the nodes that have to be visited,
+	// 0 means that only reaching an end node completes the adventure
+	CompletionPercent int `json:"completion_percent"`
+}
+
+// Validate checks that the settings can be used for an export
+func (s Settings) Validate() error {
+	if _, exists := schemas[s.Version]; !exists {
+		return fmt.Errorf("unknown SCORM version %q", s.Version)
+	}
+	if s.CompletionPercent < 0 || s.CompletionPercent > 100 {
+		return fmt.Errorf("the completion percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// Script returns the settings as JavaScript for the adapter
+func (s Settings) Script() []byte {
+	data, _ := json.Marshal(s)
+	return []byte("var scormSettings = " + string(data) + ";\n")
+}
+
+type manifest struct {
+	XMLName       xml.Name      `xml:"manifest"`
+	Attrs         []xml.Attr    `xml:",any,attr"`
+	Metadata      metadata      `xml:"metadata"`
+	Organizations organizations `xml:"organizations"`
+	Resources     []resource    `xml:"resources>resource"`
+}
+
+type metadata struct {
+	Schema        string `xml:"schema"`
+	SchemaVersion string `xml:"schemaversion"`
+}
+
+type organizations struct {
+	Default       string         `xml:"default,attr"`
+	Organizations []organization `xml:"organization"`
+}
+
+type organization struct {
+	Identifier string `xml:"identifier,attr"`
+	Title      string `xml:"title"`
+	Items      []item `xml:"item"`
+}
+
+type item struct {
+	Identifier    string `xml:"identifier,attr"`
+	IdentifierRef string `xml:"identifierref,attr"`
+	IsVisible     string `xml:"isvisible,attr"`
+	Title         string `xml:"title"`
+}
+
+type resource struct {
+	Identifier string     `xml:"identifier,attr"`
+	Type       string     `xml:"type,attr"`
+	Attrs      []xml.Attr `xml:",any,attr"`
+	Href       string     `xml:"href,attr"`
+	Files      []file     `xml:"file"`
+}
+
+type file struct {
+	Href string `xml:"href,attr"`
+}
+
+var identifierChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// Identifier makes an xs:ID of slug, which has to start with a letter
+func Identifier(slug string) string {
+	return "textaventyr_" + identifierChars.ReplaceAllString(slug, "_")
+}
+
+// Manifest returns imsmanifest.xml for a package of the adventure with
+// title. files are the paths of the package, launch is the page the LMS
+// opens.
+func Manifest(version Version, slug, title, launch string, files []string) ([]byte, error) {
+	schema, exists := schemas[version]
+	if !exists {
+		return nil, fmt.Errorf("unknown SCORM version %q", version)
+	}
+
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = slug
+	}
+
+	identifier := Identifier(slug)
+	m := manifest{
+		Attrs: []xml.Attr{
+			{Name: xml.Name{Local: "identifier"}, Value: identifier},
+			{Name: xml.Name{Local: "version"}, Value: "1"},
+			{Name: xml.Name{Local: "xmlns"}, Value: schema.namespace},
+			{Name: xml.Name{Local: "xmlns:adlcp"}, Value: schema.adlcpNamespace},
+			{Name: xml.Name{Local: "xmlns:xsi"}, Value: "http://www.w3.org/2001/XMLSchema-instance"},
+			{Name: xml.Name{Local: "xsi:schemaLocation"}, Value: strings.Join([]string{
+				schema.namespace, schema.schemaLocation,
+				schema.adlcpNamespace, schema.adlcpLocation,
+			}, " ")},
+		},
+		Metadata: metadata{Schema: "ADL SCORM", SchemaVersion: schema.schemaVersion},
+		Organizations: organizations{
+			Default: identifier + "_org",
+			Organizations: []organization{{
+				Identifier: identifier + "_org",
+				Title:      title,
+				Items: []item{{
+					Identifier:    identifier + "_item",
+					IdentifierRef: identifier + "_sco",
+					IsVisible:     "true",
+					Title:         title,
+				}},
+			}},
+		},
+	}
+
+	sco := resource{
+		Identifier: identifier + "_sco",
+		Type:       "webcontent",
+		Attrs:      []xml.Attr{{Name: xml.Name{Local: schema.scormTypeAttr}, Value: "sco"}},
+		Href:       launch,
+	}
+	for _, name := range files {
+		href := &url.URL{Path: name}
+		sco.Files = append(sco.Files, file{Href: href.EscapedPath()})
+	}
+	m.Resources = []resource{sco}
+
+	data, err := xml.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
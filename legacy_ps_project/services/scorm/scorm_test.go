@@ -0,0 +1,102 @@
+package scorm
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	files := []string{"index.html", "static/js/aventyr.scorm.js", "upload/2abcde/stor sjö.jpg"}
+
+	for _, version := range []Version{Version12, Version2004} {
+		data, err := Manifest(version, "2abcde", "Sjön & skogen", "index.html", files)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var m struct {
+			Identifier    string `xml:"identifier,attr"`
+			SchemaVersion string `xml:"metadata>schemaversion"`
+			Organizations struct {
+				Default      string `xml:"default,attr"`
+				Organization struct {
+					Identifier string `xml:"identifier,attr"`
+					Title      string `xml:"title"`
+					Item       struct {
+						IdentifierRef string `xml:"identifierref,attr"`
+					} `xml:"item"`
+				} `xml:"organization"`
+			} `xml:"organizations"`
+			Resource struct {
+				Identifier string `xml:"identifier,attr"`
+				Href       string `xml:"href,attr"`
+				Files      []struct {
+					Href string `xml:"href,attr"`
+				} `xml:"file"`
+			} `xml:"resources>resource"`
+		}
+		if err := xml.Unmarshal(data, &m); err != nil {
+			t.Fatal(err)
+		}
+
+		organization := m.Organizations.Organization
+		if m.Identifier != "textaventyr_2abcde" || organization.Title != "Sjön & skogen" || m.Organizations.Default != organization.Identifier {
+			t.Errorf("%s: unexpected manifest %s", version, data)
+		}
+		if organization.Item.IdentifierRef != m.Resource.Identifier || m.Resource.Href != "index.html" {
+			t.Errorf("%s: expected the item to launch the resource, got %s", version, data)
+		}
+		if len(m.Resource.Files) != 3 || m.Resource.Files[2].Href != "upload/2abcde/stor%20sj%C3%B6.jpg" {
+			t.Errorf("%s: unexpected files %+v", version, m.Resource.Files)
+		}
+
+		if err := checkManifest(version, data); err != nil {
+			t.Errorf("%s: the manifest does not validate: %v\n%s", version, err, data)
+		}
+
+		for _, replace := range [][2]string{
+			// An unknown SCO type
+			{`="sco"`, `="lektion"`},
+			// An item that does not launch a resource
+			{`identifierref="textaventyr_2abcde_sco"`, `identifierref="textaventyr_2abcde_org"`},
+			// A file without href
+			{`<file href="index.html">`, `<file>`},
+			// Resources before organizations
+			{`<organizations`, `<resources></resources><organizations`},
+		} {
+			invalid := bytes.Replace(data, []byte(replace[0]), []byte(replace[1]), 1)
+			if bytes.Equal(invalid, data) {
+				t.Fatalf("%s: %s is not in the manifest", version, replace[0])
+			}
+			if err := checkManifest(version, invalid); err == nil {
+				t.Errorf("%s: expected the manifest with %s to fail validation", version, replace[1])
+			}
+		}
+	}
+
+	if _, err := Manifest("scorm3", "x", "", "index.html", nil); err == nil {
+		t.Error("expected an error for an unknown version")
+	}
+}
+
+func TestSettings(t *testing.T) {
+	for _, settings := range []Settings{
+		{Version: "scorm3"},
+		{Version: Version12, CompletionPercent: -1},
+		{Version: Version2004, CompletionPercent: 101},
+	} {
+		if settings.Validate() == nil {
+			t.Errorf("expected %+v to be invalid", settings)
+		}
+	}
+
+	settings := Settings{Version: Version2004, CompletionPercent: 80}
+	if err := settings.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if script := string(settings.Script()); !strings.HasPrefix(script, `var scormSettings = {"version":"scorm2004","completion_percent":80};`) {
+		t.Errorf("unexpected script %q", script)
+	}
+}
@@ -0,0 +1,268 @@
+package script
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// BlockKind is the kind of a block of text
+type BlockKind string
+
+// The kinds of blocks ParseContent keeps of the HTML of the editor
+const (
+	Paragraph BlockKind = "p"
+	Heading   BlockKind = "heading"
+	Item      BlockKind = "li"
+	Quote     BlockKind = "quote"
+)
+
+// Block is a paragraph, heading, list item or quote of the text of a node
+type Block struct {
+	Kind BlockKind
+	// Ordered and Number are set for items of numbered lists
+	Ordered bool
+	Number  int
+	Spans   []Span
+}
+
+// Span is a run of text within a block, or a line break
+type Span struct {
+	Text   string
+	Bold   bool
+	Italic bool
+	Break  bool
+}
+
+// skipped are elements whose content is never text of the node
+var skipped = map[string]bool{
+	"script": true, "style": true, "head": true, "title": true, "template": true,
+	"iframe": true, "object": true, "embed": true, "noscript": true, "svg": true,
+	"audio": true, "video": true, "select": true, "textarea": true,
+}
+
+// blocks are elements that start a new block
+var blocks = map[string]BlockKind{
+	"p": Paragraph, "div": Paragraph, "pre": Paragraph, "tr": Paragraph,
+	"section": Paragraph, "article": Paragraph, "figure": Paragraph, "table": Paragraph,
+	"h1": Heading, "h2": Heading, "h3": Heading, "h4": Heading, "h5": Heading, "h6": Heading,
+	"li":         Item,
+	"blockquote": Quote,
+}
+
+// ParseContent reads the HTML the editor stores for a node into blocks of
+// plain text. Only the structure of the text, bold and italic are kept: tags,
+// attributes, scripts, styles and media are left out.
+func ParseContent(content string) []Block {
+	p := &contentParser{}
+	tokenizer := html.NewTokenizer(strings.NewReader(content))
+
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+		token := tokenizer.Token()
+		name := token.Data
+
+		switch tokenType {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if skipped[name] {
+				if tokenType == html.StartTagToken {
+					p.skip = append(p.skip, name)
+				}
+				continue
+			}
+			if len(p.skip) > 0 {
+				continue
+			}
+			p.start(name, tokenType == html.SelfClosingTagToken)
+		case html.EndTagToken:
+			if len(p.skip) > 0 {
+				if p.skip[len(p.skip)-1] == name {
+					p.skip = p.skip[:len(p.skip)-1]
+				}
+				continue
+			}
+			p.end(name)
+		case html.TextToken:
+			if len(p.skip) == 0 {
+				p.text(token.Data)
+			}
+		}
+	}
+	p.flush()
+
+	return p.blocks
+}
+
+type contentParser struct {
+	blocks  []Block
+	current *Block
+	skip    []string
+	bold    int
+	italic  int
+	quote   int
+	// lists is true for each numbered list the parser is within, with the
+	// number of its last item
+	lists   []bool
+	numbers []int
+}
+
+func (p *contentParser) start(name string, selfClosing bool) {
+	switch name {
+	case "b", "strong":
+		p.bold++
+	case "i", "em":
+		p.italic++
+	case "br":
+		if p.current != nil {
+			p.current.Spans = append(p.current.Spans, Span{Break: true})
+		}
+	case "ul", "ol":
+		p.flush()
+		p.lists = append(p.lists, name == "ol")
+		p.numbers = append(p.numbers, 0)
+	case "blockquote":
+		p.flush()
+		p.quote++
+	default:
+		kind, exists := blocks[name]
+		if !exists || selfClosing {
+			return
+		}
+		p.flush()
+		p.current = &Block{Kind: kind}
+		if kind == Paragraph && p.quote > 0 {
+			p.current.Kind = Quote
+		}
+		if kind == Item && len(p.lists) > 0 {
+			last := len(p.lists) - 1
+			p.numbers[last]++
+			p.current.Ordered = p.lists[last]
+			p.current.Number = p.numbers[last]
+		}
+	}
+}
+
+func (p *contentParser) end(name string) {
+	switch name {
+	case "b", "strong":
+		if p.bold > 0 {
+			p.bold--
+		}
+	case "i", "em":
+		if p.italic > 0 {
+			p.italic--
+		}
+	case "ul", "ol":
+		p.flush()
+		if len(p.lists) > 0 {
+			p.lists = p.lists[:len(p.lists)-1]
+			p.numbers = p.numbers[:len(p.numbers)-1]
+		}
+	case "blockquote":
+		p.flush()
+		if p.quote > 0 {
+			p.quote--
+		}
+	default:
+		if _, exists := blocks[name]; exists {
+			p.flush()
+		}
+	}
+}
+
+// text adds text with its whitespace collapsed like a browser shows it, a
+// non-breaking space is a space on paper
+func (p *contentParser) text(text string) {
+	text = strings.ReplaceAll(text, "\u00a0", " ")
+	collapsed := strings.Join(strings.Fields(text), " ")
+	if collapsed == "" {
+		// Whitespace between words of different spans is kept
+		if text == "" || p.current == nil || len(p.current.Spans) == 0 {
+			return
+		}
+		text = " "
+	} else {
+		if strings.TrimLeft(text, " \t\r\n") != text {
+			collapsed = " " + collapsed
+		}
+		if strings.TrimRight(text, " \t\r\n") != text {
+			collapsed += " "
+		}
+		text = collapsed
+	}
+	if p.current == nil {
+		p.current = &Block{Kind: Paragraph}
+		if p.quote > 0 {
+			p.current.Kind = Quote
+		}
+	}
+
+	span := Span{Text: text, Bold: p.bold > 0, Italic: p.italic > 0}
+	spans := p.current.Spans
+	if n := len(spans); n > 0 && !spans[n-1].Break && spans[n-1].Bold == span.Bold && spans[n-1].Italic == span.Italic {
+		spans[n-1].Text += span.Text
+	} else {
+		p.current.Spans = append(spans, span)
+	}
+}
+
+// flush ends the current block, with the whitespace at its ends and
+// between spans collapsed
+func (p *contentParser) flush() {
+	block := p.current
+	p.current = nil
+	if block == nil {
+		return
+	}
+
+	spans := []Span{}
+	space := true
+	for _, span := range block.Spans {
+		if span.Break {
+			spans = trimEnd(spans)
+			spans = append(spans, span)
+			space = true
+			continue
+		}
+		if space {
+			span.Text = strings.TrimLeft(span.Text, " ")
+		}
+		span.Text = strings.ReplaceAll(span.Text, "  ", " ")
+		if span.Text == "" {
+			continue
+		}
+		space = strings.HasSuffix(span.Text, " ")
+		spans = append(spans, span)
+	}
+	spans = trimEnd(spans)
+	for len(spans) > 0 && spans[len(spans)-1].Break {
+		spans = trimEnd(spans[:len(spans)-1])
+	}
+	for len(spans) > 0 && spans[0].Break {
+		spans = spans[1:]
+	}
+	if len(spans) == 0 {
+		return
+	}
+
+	block.Spans = spans
+	p.blocks = append(p.blocks, *block)
+}
+
+func trimEnd(spans []Span) []Span {
+	for len(spans) > 0 {
+		last := &spans[len(spans)-1]
+		if last.Break {
+			return spans
+		}
+		last.Text = strings.TrimRight(last.Text, " ")
+		if last.Text != "" {
+			return spans
+		}
+		spans = spans[:len(spans)-1]
+	}
+	return spans
+}
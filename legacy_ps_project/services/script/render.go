@@ -0,0 +1,328 @@
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"strconv"
+	"strings"
+)
+
+// The words of the script, the site is in Swedish
+const (
+	goTo            = "gå till %d"
+	endText         = "Slut."
+	randomText      = "Slumpen avgör vilket avsnitt du går till:"
+	unreachableText = "Det här avsnittet nås inte från början av äventyret."
+	visitedText     = "om du har varit i %s"
+	notVisitedText  = "om du inte har varit i %s"
+)
+
+// condition describes when a choice is shown, or "" if it always is
+func (c Choice) condition() string {
+	conditions := []string{}
+	if len(c.Visited) > 0 {
+		conditions = append(conditions, fmt.Sprintf(visitedText, sectionList(c.Visited)))
+	}
+	if len(c.NotVisited) > 0 {
+		conditions = append(conditions, fmt.Sprintf(notVisitedText, sectionList(c.NotVisited)))
+	}
+	return strings.Join(conditions, " och ")
+}
+
+// sectionList joins sections like "avsnitt 2, 3 och 5"
+func sectionList(sections []int) string {
+	numbers := make([]string, len(sections))
+	for i, section := range sections {
+		numbers[i] = strconv.Itoa(section)
+	}
+	if len(numbers) == 1 {
+		return "avsnitt " + numbers[0]
+	}
+	return "avsnitt " + strings.Join(numbers[:len(numbers)-1], ", ") + " och " + numbers[len(numbers)-1]
+}
+
+// Markdown renders the script as Markdown
+func (s *Script) Markdown() []byte {
+	var out bytes.Buffer
+
+	fmt.Fprintf(&out, "# %s\n", markdownText(oneLine(s.Title)))
+	if description := strings.TrimSpace(s.Description); description != "" {
+		for _, line := range strings.Split(description, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				fmt.Fprintf(&out, "\n%s\n", markdownText(line))
+			}
+		}
+	}
+
+	for _, section := range s.Sections {
+		fmt.Fprintf(&out, "\n## %d. %s\n", section.Number, markdownText(oneLine(section.Title)))
+
+		if section.Unreachable {
+			fmt.Fprintf(&out, "\n*%s*\n", unreachableText)
+		}
+		if section.Image != "" {
+			fmt.Fprintf(&out, "\n![](<%s>)\n", strings.NewReplacer("<", "%3C", ">", "%3E", "\n", "").Replace(section.Image))
+		}
+
+		previous := BlockKind("")
+		for _, block := range section.Content {
+			// Items of the same list are not separated by a blank line
+			if block.Kind != Item || previous != Item {
+				out.WriteString("\n")
+			}
+			previous = block.Kind
+			out.WriteString(markdownBlock(block) + "\n")
+		}
+
+		out.WriteString("\n")
+		if len(section.Choices) == 0 {
+			out.WriteString("**" + endText + "**\n")
+			continue
+		}
+		if section.Random {
+			fmt.Fprintf(&out, "*%s*\n\n", randomText)
+		}
+		for _, choice := range section.Choices {
+			line := fmt.Sprintf("- **%s** – "+goTo, markdownText(oneLine(choice.Text)), choice.Section)
+			if condition := choice.condition(); condition != "" {
+				line += " (" + condition + ")"
+			}
+			out.WriteString(line + "\n")
+		}
+	}
+
+	return out.Bytes()
+}
+
+func markdownBlock(block Block) string {
+	var text strings.Builder
+	for _, span := range block.Spans {
+		if span.Break {
+			// Two trailing spaces are a line break, a quote continues on the line
+			text.WriteString("  \n")
+			if block.Kind == Quote {
+				text.WriteString("> ")
+			} else if block.Kind == Item {
+				text.WriteString("   ")
+			}
+			continue
+		}
+
+		// Emphasis does not start or end with whitespace
+		content := strings.TrimSpace(span.Text)
+		if content == "" {
+			text.WriteString(span.Text)
+			continue
+		}
+		leading := span.Text[:strings.Index(span.Text, content)]
+		trailing := span.Text[len(leading)+len(content):]
+		marker := ""
+		if span.Bold {
+			marker += "**"
+		}
+		if span.Italic {
+			marker += "_"
+		}
+		text.WriteString(leading + marker + markdownText(content) + reverse(marker) + trailing)
+	}
+
+	switch block.Kind {
+	case Heading:
+		return "### " + text.String()
+	case Quote:
+		return "> " + text.String()
+	case Item:
+		if block.Ordered {
+			return fmt.Sprintf("%d. %s", block.Number, text.String())
+		}
+		// A list of the text uses another marker than the choices, so that
+		// they are not read as one list
+		return "* " + text.String()
+	}
+	return escapeLineStart(text.String())
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`, "~", `\~`,
+)
+
+// markdownText escapes the characters that are markup in Markdown
+func markdownText(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// escapeLineStart escapes a paragraph that would be read as a list or a
+// heading
+func escapeLineStart(text string) string {
+	for _, marker := range []string{"- ", "+ ", "= "} {
+		if strings.HasPrefix(text, marker) {
+			return `\` + text
+		}
+	}
+	if i := strings.IndexFunc(text, func(r rune) bool { return r < '0' || r > '9' }); i > 0 && strings.HasPrefix(text[i:], ". ") {
+		return text[:i] + `\` + text[i:]
+	}
+	return text
+}
+
+func reverse(marker string) string {
+	runes := []rune(marker)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func oneLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// HTML renders the script as a page styled to be printed
+func (s *Script) HTML() ([]byte, error) {
+	type htmlChoice struct {
+		Text      string
+		Section   int
+		GoTo      string
+		Condition string
+	}
+	type htmlSection struct {
+		*Section
+		Content template.HTML
+		Choices []htmlChoice
+	}
+
+	sections := make([]htmlSection, len(s.Sections))
+	for i, section := range s.Sections {
+		sections[i] = htmlSection{Section: section, Content: htmlContent(section.Content)}
+		for _, choice := range section.Choices {
+			sections[i].Choices = append(sections[i].Choices, htmlChoice{
+				Text:      oneLine(choice.Text),
+				Section:   choice.Section,
+				GoTo:      fmt.Sprintf(goTo, choice.Section),
+				Condition: choice.condition(),
+			})
+		}
+	}
+
+	description := []string{}
+	for _, line := range strings.Split(s.Description, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			description = append(description, line)
+		}
+	}
+
+	var out bytes.Buffer
+	err := scriptTemplate.Execute(&out, map[string]interface{}{
+		"Title":       oneLine(s.Title),
+		"Description": description,
+		"Sections":    sections,
+		"End":         endText,
+		"Random":      randomText,
+		"Unreachable": unreachableText,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// htmlContent writes the blocks of a section as HTML, every text is escaped
+func htmlContent(content []Block) template.HTML {
+	var out strings.Builder
+	list := ""
+	for _, block := range content {
+		want := ""
+		if block.Kind == Item {
+			want = "ul"
+			if block.Ordered {
+				want = "ol"
+			}
+		}
+		if list != want || (want == "ol" && block.Number == 1 && list != "") {
+			if list != "" {
+				out.WriteString("</" + list + ">\n")
+			}
+			if want != "" {
+				out.WriteString("<" + want + ">\n")
+			}
+			list = want
+		}
+
+		tag := map[BlockKind]string{Paragraph: "p", Heading: "h3", Item: "li", Quote: "blockquote"}[block.Kind]
+		out.WriteString("<" + tag + ">")
+		for _, span := range block.Spans {
+			if span.Break {
+				out.WriteString("<br>")
+				continue
+			}
+			text := html.EscapeString(span.Text)
+			if span.Italic {
+				text = "<em>" + text + "</em>"
+			}
+			if span.Bold {
+				text = "<strong>" + text + "</strong>"
+			}
+			out.WriteString(text)
+		}
+		out.WriteString("</" + tag + ">\n")
+	}
+	if list != "" {
+		out.WriteString("</" + list + ">\n")
+	}
+	return template.HTML(out.String())
+}
+
+var scriptTemplate = template.Must(template.New("script").Parse(`<!DOCTYPE html>
+<html lang="sv">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+@page { size: A4; margin: 2cm; }
+body { font-family: Georgia, "Times New Roman", serif; font-size: 12pt; line-height: 1.5; max-width: 40em; margin: 2em auto; padding: 0 1em; color: #000; }
+h1 { text-align: center; font-size: 24pt; }
+.description { text-align: center; font-style: italic; page-break-after: always; break-after: page; }
+section { margin-top: 2em; page-break-inside: avoid; break-inside: avoid; }
+h2 { font-size: 14pt; border-bottom: 1px solid #000; page-break-after: avoid; break-after: avoid; }
+h2 .number { display: inline-block; min-width: 2em; }
+h3 { font-size: 12pt; }
+img { display: block; max-width: 100%; max-height: 8cm; margin: 0 auto; }
+blockquote { margin-left: 2em; font-style: italic; }
+.note, .end, .random { font-style: italic; }
+.end { font-weight: bold; }
+ul.choices { list-style: none; padding-left: 0; }
+ul.choices li { margin: 0.25em 0; }
+ul.choices li::before { content: "\2192\00a0"; }
+.goto { font-weight: bold; white-space: nowrap; }
+.condition { font-size: 10pt; }
+@media print { body { margin: 0; max-width: none; } }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Description}}<div class="description">
+{{range .Description}}<p>{{.}}</p>
+{{end}}</div>
+{{end}}
+{{- range .Sections}}
+<section id="avsnitt-{{.Number}}">
+<h2><span class="number">{{.Number}}.</span> {{.Title}}</h2>
+{{if .Unreachable}}<p class="note">{{$.Unreachable}}</p>
+{{end}}
+{{- if .Image}}<img src="{{.Image}}" alt="">
+{{end}}
+{{- .Content}}
+{{- if not .Choices}}<p class="end">{{$.End}}</p>
+{{else}}
+{{- if .Random}}<p class="random">{{$.Random}}</p>
+{{end}}<ul class="choices">
+{{range .Choices}}<li>{{.Text}} – <a class="goto" href="#avsnitt-{{.Section}}">{{.GoTo}}</a>{{if .Condition}} <span class="condition">({{.Condition}})</span>{{end}}</li>
+{{end}}</ul>
+{{end}}</section>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,235 @@
+// Package script renders an adventure as a manuscript to read on paper, in
+// the style of a gamebook: every node is a numbered section with its title
+// and text, and every choice tells which section to go to. The sections
+// follow the graph from the start node, nodes that can not be reached come
+// last.
+package script
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"projektps/models"
+)
+
+// Format is a format the script is rendered in
+type Format string
+
+// The formats of Render
+const (
+	FormatMarkdown Format = "md"
+	FormatHTML     Format = "html"
+)
+
+// Script is an adventure ordered into sections
+type Script struct {
+	Title       string
+	Description string
+	Sections    []*Section
+}
+
+// Section is a node of the adventure
+type Section struct {
+	Number int
+	Title  string
+	// Image is the image of the node, shown above its text
+	Image   string
+	Content []Block
+	Choices []Choice
+	// Random is set for random nodes, which go on to one of their choices
+	Random bool
+	// Unreachable is set for nodes that can not be reached from the start
+	Unreachable bool
+}
+
+// Choice is a button of a node, as the player shows it
+type Choice struct {
+	Text    string
+	Section int
+	// Visited and NotVisited are the sections of the conditions of the link:
+	// it is shown when every Visited section has been visited, and hidden when
+	// every NotVisited section has
+	Visited    []int
+	NotVisited []int
+}
+
+// Build orders the nodes of adventure into sections
+func Build(adventure *models.Adventure) *Script {
+	nodes := append([]models.Node{}, adventure.Nodes...)
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].NodeID < nodes[j].NodeID })
+
+	byID := make(map[int64]*models.Node)
+	props := make(map[int64]*models.NodeProps)
+	start := int64(-1)
+	for i := range nodes {
+		node := &nodes[i]
+		byID[node.NodeID] = node
+
+		parsed, err := models.ParseNodeProps(node.Props)
+		if err != nil {
+			parsed = &models.NodeProps{}
+		}
+		props[node.NodeID] = parsed
+
+		if node.NodeType == "root" && start < 0 {
+			start = node.NodeID
+		}
+	}
+
+	links := append([]models.Link{}, adventure.Links...)
+	sort.SliceStable(links, func(i, j int) bool { return links[i].LinkID < links[j].LinkID })
+
+	choices := func(nodeID int64) []models.Link {
+		return orderedLinks(nodeID, links, props[nodeID], byID)
+	}
+
+	// Breadth first from the start node, in the order of the choices
+	order := []int64{}
+	visited := make(map[int64]bool)
+	if start >= 0 {
+		visited[start] = true
+		queue := []int64{start}
+		for len(queue) > 0 {
+			nodeID := queue[0]
+			queue = queue[1:]
+			order = append(order, nodeID)
+
+			for _, link := range choices(nodeID) {
+				target := linkTarget(link, nodeID)
+				if !visited[target] {
+					visited[target] = true
+					queue = append(queue, target)
+				}
+			}
+		}
+	}
+	for _, node := range nodes {
+		if !visited[node.NodeID] {
+			order = append(order, node.NodeID)
+		}
+	}
+
+	numbers := make(map[int64]int)
+	for i, nodeID := range order {
+		numbers[nodeID] = i + 1
+	}
+
+	script := &Script{Title: adventure.Title, Description: adventure.Description}
+	for _, nodeID := range order {
+		node := byID[nodeID]
+		chapterType := ""
+		if len(props[nodeID].ChapterType) > 0 {
+			chapterType = props[nodeID].ChapterType[0]
+		}
+
+		section := &Section{
+			Number:      numbers[nodeID],
+			Title:       strings.TrimSpace(node.Title),
+			Image:       node.ImageURL,
+			Content:     ParseContent(node.Content),
+			Random:      chapterType == "random-node",
+			Unreachable: !visited[nodeID] || start < 0,
+		}
+		if section.Title == "" {
+			section.Title = fmt.Sprintf("Avsnitt %d", section.Number)
+		}
+
+		for _, link := range choices(nodeID) {
+			target := linkTarget(link, nodeID)
+			if section.Random && target == nodeID {
+				continue
+			}
+
+			choice := Choice{Section: numbers[target]}
+			if link.SourceNodeID == nodeID {
+				choice.Text = link.TargetLinkTitle
+				// The player ignores the conditions of links from random nodes
+				if linkProps, err := models.ParseLinkProps(link.Props); err == nil && !section.Random {
+					choice.Visited = sectionNumbers(linkProps.PositiveNodeList, numbers)
+					choice.NotVisited = sectionNumbers(linkProps.NegativeNodeList, numbers)
+				}
+			} else {
+				choice.Text = link.SourceLinkTitle
+			}
+			choice.Text = strings.TrimSpace(choice.Text)
+			if choice.Text == "" {
+				choice.Text = strings.TrimSpace(byID[target].Title)
+			}
+
+			section.Choices = append(section.Choices, choice)
+		}
+
+		script.Sections = append(script.Sections, section)
+	}
+
+	return script
+}
+
+// orderedLinks returns the links that are buttons of a node like the player
+// shows them: links from the node and bidirectional links to it, in the
+// order of ordered_link_ids. Links to nodes that do not exist are left out.
+func orderedLinks(nodeID int64, links []models.Link, props *models.NodeProps, nodes map[int64]*models.Node) []models.Link {
+	buttons := []models.Link{}
+	for _, link := range links {
+		if link.SourceNodeID != nodeID && !(link.TargetNodeID == nodeID && link.LinkType == "bidirectional") {
+			continue
+		}
+		if _, exists := nodes[linkTarget(link, nodeID)]; !exists {
+			continue
+		}
+		buttons = append(buttons, link)
+	}
+
+	position := make(map[int64]int)
+	for i, id := range props.OrderedLinkIDs {
+		if linkID, ok := id.Int(); ok {
+			if _, exists := position[linkID]; !exists {
+				position[linkID] = i
+			}
+		}
+	}
+	rank := func(link models.Link) int {
+		if i, exists := position[link.LinkID]; exists {
+			return i
+		}
+		return len(props.OrderedLinkIDs)
+	}
+	sort.SliceStable(buttons, func(i, j int) bool { return rank(buttons[i]) < rank(buttons[j]) })
+
+	return buttons
+}
+
+// linkTarget is where a button of the node leads
+func linkTarget(link models.Link, nodeID int64) int64 {
+	if link.SourceNodeID == nodeID {
+		return link.TargetNodeID
+	}
+	return link.SourceNodeID
+}
+
+func sectionNumbers(ids []models.Number, numbers map[int64]int) []int {
+	sections := []int{}
+	for _, id := range ids {
+		nodeID, ok := id.Int()
+		if !ok {
+			continue
+		}
+		if number, exists := numbers[nodeID]; exists {
+			sections = append(sections, number)
+		}
+	}
+	return sections
+}
+
+// Render renders the script of adventure in format
+func Render(adventure *models.Adventure, format Format) ([]byte, error) {
+	script := Build(adventure)
+	switch format {
+	case FormatMarkdown:
+		return script.Markdown(), nil
+	case FormatHTML:
+		return script.HTML()
+	}
+	return nil, fmt.Errorf("unknown script format %q", format)
+}
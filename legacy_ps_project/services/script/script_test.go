@@ -0,0 +1,86 @@
+package script
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"projektps/models"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestRender compares the scripts of every adventure in testdata/*.json with
+// the .md and .html files next to it. Run go test -update to rewrite them.
+func TestRender(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test adventures found")
+	}
+
+	for _, file := range files {
+		file := file
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var adventure models.Adventure
+			if err := json.Unmarshal(data, &adventure); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, format := range []Format{FormatMarkdown, FormatHTML} {
+				script, err := Render(&adventure, format)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				golden := strings.TrimSuffix(file, ".json") + "." + string(format)
+				if *update {
+					if err := ioutil.WriteFile(golden, script, 0644); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+
+				expected, err := ioutil.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(script) != string(expected) {
+					t.Errorf("%s differs from the script:\n%s", golden, script)
+				}
+			}
+		})
+	}
+}
+
+func TestParseContent(t *testing.T) {
+	blocks := ParseContent(`<p>Hej <b>där</b>, <i onclick="x()">du</i>!<script>alert(1)</script></p><ol><li>Ett</li></ol>`)
+	expected := []Block{
+		{Kind: Paragraph, Spans: []Span{{Text: "Hej "}, {Text: "där", Bold: true}, {Text: ", "}, {Text: "du", Italic: true}, {Text: "!"}}},
+		{Kind: Item, Ordered: true, Number: 1, Spans: []Span{{Text: "Ett"}}},
+	}
+	if !reflect.DeepEqual(blocks, expected) {
+		t.Errorf("expected %+v, got %+v", expected, blocks)
+	}
+
+	if blocks := ParseContent("<style>p {}</style><p> \n </p>"); len(blocks) != 0 {
+		t.Errorf("expected no text, got %+v", blocks)
+	}
+}
+
+func TestRenderFormat(t *testing.T) {
+	if _, err := Render(&models.Adventure{}, Format("pdf")); err == nil {
+		t.Error("expected an unknown format to fail")
+	}
+}
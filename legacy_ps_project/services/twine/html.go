@@ -0,0 +1,115 @@
+package twine
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	storyDataPattern  = regexp.MustCompile(`(?s)<tw-storydata\b([^>]*)>`)
+	passagePattern    = regexp.MustCompile(`(?s)<tw-passagedata\b([^>]*)>(.*?)</tw-passagedata>`)
+	stylesheetPattern = regexp.MustCompile(`(?s)<style\b[^>]*type="text/twine-css"[^>]*>(.*?)</style>`)
+	scriptPattern     = regexp.MustCompile(`(?s)<script\b[^>]*type="text/twine-javascript"[^>]*>(.*?)</script>`)
+	attributePattern  = regexp.MustCompile(`([\w-]+)(?:\s*=\s*"([^"]*)")?`)
+)
+
+// ParseHTML reads the story of a Twine 2 HTML file, either a published
+// story or an archive from the Twine library
+func ParseHTML(data []byte) (*Story, error) {
+	text := string(data)
+
+	match := storyDataPattern.FindStringSubmatch(text)
+	if match == nil {
+		return nil, fmt.Errorf("no <tw-storydata> element found")
+	}
+	attributes := parseAttributes(match[1])
+
+	story := &Story{
+		Name:          attributes["name"],
+		IFID:          attributes["ifid"],
+		Format:        attributes["format"],
+		FormatVersion: attributes["format-version"],
+	}
+	story.Zoom, _ = strconv.ParseFloat(attributes["zoom"], 64)
+
+	if match := stylesheetPattern.FindStringSubmatch(text); match != nil {
+		story.Stylesheet = html.UnescapeString(match[1])
+	}
+	if match := scriptPattern.FindStringSubmatch(text); match != nil {
+		story.Script = html.UnescapeString(match[1])
+	}
+
+	startNode := attributes["startnode"]
+	for _, match := range passagePattern.FindAllStringSubmatch(text, -1) {
+		attributes := parseAttributes(match[1])
+
+		passage := Passage{
+			Name:     attributes["name"],
+			Tags:     strings.Fields(attributes["tags"]),
+			Position: attributes["position"],
+			Size:     attributes["size"],
+			Text:     html.UnescapeString(match[2]),
+		}
+		if attributes["pid"] == startNode {
+			story.Start = passage.Name
+		}
+		story.Passages = append(story.Passages, passage)
+	}
+
+	return story, nil
+}
+
+func parseAttributes(element string) map[string]string {
+	attributes := make(map[string]string)
+	for _, match := range attributePattern.FindAllStringSubmatch(element, -1) {
+		attributes[strings.ToLower(match[1])] = html.UnescapeString(match[2])
+	}
+	return attributes
+}
+
+// WriteHTML writes story as a Twine 2 archive, which can be imported into the
+// Twine library
+func WriteHTML(story *Story) []byte {
+	var out bytes.Buffer
+
+	startNode := ""
+	for i, passage := range story.Passages {
+		if passage.Name == story.Start {
+			startNode = strconv.Itoa(i + 1)
+			break
+		}
+	}
+
+	fmt.Fprintf(&out, `<tw-storydata name="%s" startnode="%s" creator="Textäventyr" creator-version="1.0" ifid="%s" zoom="%s" format="%s" format-version="%s" options="" hidden>`,
+		html.EscapeString(story.Name),
+		startNode,
+		html.EscapeString(story.IFID),
+		strconv.FormatFloat(story.Zoom, 'f', -1, 64),
+		html.EscapeString(story.Format),
+		html.EscapeString(story.FormatVersion))
+	out.WriteString("\n")
+
+	fmt.Fprintf(&out, `<style role="stylesheet" id="twine-user-stylesheet" type="text/twine-css">%s</style>`, html.EscapeString(story.Stylesheet))
+	out.WriteString("\n")
+	fmt.Fprintf(&out, `<script role="script" id="twine-user-script" type="text/twine-javascript">%s</script>`, html.EscapeString(story.Script))
+	out.WriteString("\n")
+
+	for i, passage := range story.Passages {
+		fmt.Fprintf(&out, `<tw-passagedata pid="%d" name="%s" tags="%s" position="%s" size="%s">%s</tw-passagedata>`,
+			i+1,
+			html.EscapeString(passage.Name),
+			html.EscapeString(strings.Join(passage.Tags, " ")),
+			html.EscapeString(passage.Position),
+			html.EscapeString(passage.Size),
+			html.EscapeString(passage.Text))
+		out.WriteString("\n")
+	}
+
+	out.WriteString("</tw-storydata>\n")
+
+	return out.Bytes()
+}
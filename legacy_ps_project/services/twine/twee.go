@@ -0,0 +1,230 @@
+package twine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// storyData is the StoryData passage of Twee 3
+type storyData struct {
+	IFID          string  `json:"ifid"`
+	Format        string  `json:"format,omitempty"`
+	FormatVersion string  `json:"format-version,omitempty"`
+	Start         string  `json:"start,omitempty"`
+	Zoom          float64 `json:"zoom,omitempty"`
+}
+
+// passageMetadata is the optional JSON at the end of a passage header
+type passageMetadata struct {
+	Position string `json:"position,omitempty"`
+	Size     string `json:"size,omitempty"`
+}
+
+// ParseTwee reads Twee 3 source. The special passages StoryTitle and
+// StoryData, and passages tagged script or stylesheet, make up the story
+// itself and are not returned as passages.
+func ParseTwee(data []byte) (*Story, error) {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	story := &Story{}
+	var current *Passage
+	var body []string
+
+	flush := func() error {
+		if current == nil {
+			return nil
+		}
+		current.Text = strings.TrimRight(strings.Join(body, "\n"), " \t\n")
+
+		switch {
+		case current.Name == "StoryTitle":
+			story.Name = strings.TrimSpace(current.Text)
+		case current.Name == "StoryData":
+			var metadata storyData
+			if err := json.Unmarshal([]byte(current.Text), &metadata); err != nil {
+				return fmt.Errorf("invalid StoryData: %v", err)
+			}
+			story.IFID = metadata.IFID
+			story.Format = metadata.Format
+			story.FormatVersion = metadata.FormatVersion
+			story.Start = metadata.Start
+			story.Zoom = metadata.Zoom
+		case hasTag(current.Tags, "script"):
+			story.Script += current.Text
+		case hasTag(current.Tags, "stylesheet"):
+			story.Stylesheet += current.Text
+		default:
+			story.Passages = append(story.Passages, *current)
+		}
+		return nil
+	}
+
+	for i, line := range strings.Split(text, "\n") {
+		if !strings.HasPrefix(line, "::") {
+			if current != nil {
+				// A line of text that starts with :: is escaped as \::
+				if strings.HasPrefix(line, `\::`) {
+					line = line[1:]
+				}
+				body = append(body, line)
+			}
+			continue
+		}
+
+		if err := flush(); err != nil {
+			return nil, err
+		}
+
+		passage, err := parseHeader(line[2:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		current = passage
+		body = nil
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	if story.Start == "" && len(story.Passages) > 0 {
+		for _, passage := range story.Passages {
+			if passage.Name == "Start" {
+				story.Start = passage.Name
+				break
+			}
+		}
+	}
+
+	return story, nil
+}
+
+// parseHeader reads "Name [tags] {metadata}", where [ ] { } and \ are
+// escaped with a backslash in names and tags
+func parseHeader(header string) (*Passage, error) {
+	passage := &Passage{}
+	runes := []rune(strings.TrimSpace(header))
+
+	var name strings.Builder
+	i := 0
+	for ; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\\' && i+1 < len(runes) {
+			i++
+			name.WriteRune(runes[i])
+			continue
+		}
+		if r == '[' || r == '{' {
+			break
+		}
+		name.WriteRune(r)
+	}
+	passage.Name = strings.TrimSpace(name.String())
+	if passage.Name == "" {
+		return nil, fmt.Errorf("passage without a name")
+	}
+
+	if i < len(runes) && runes[i] == '[' {
+		var tag strings.Builder
+		closed := false
+		for i++; i < len(runes); i++ {
+			r := runes[i]
+			if r == '\\' && i+1 < len(runes) {
+				i++
+				tag.WriteRune(runes[i])
+				continue
+			}
+			if r == ']' {
+				closed = true
+				i++
+				break
+			}
+			tag.WriteRune(r)
+		}
+		if !closed {
+			return nil, fmt.Errorf("unterminated tags of passage %q", passage.Name)
+		}
+		passage.Tags = strings.Fields(tag.String())
+	}
+
+	rest := strings.TrimSpace(string(runes[i:]))
+	if strings.HasPrefix(rest, "{") {
+		var metadata passageMetadata
+		if err := json.Unmarshal([]byte(rest), &metadata); err != nil {
+			return nil, fmt.Errorf("invalid metadata of passage %q: %v", passage.Name, err)
+		}
+		passage.Position = metadata.Position
+		passage.Size = metadata.Size
+	}
+
+	return passage, nil
+}
+
+// WriteTwee writes story as Twee 3 source
+func WriteTwee(story *Story) []byte {
+	var out bytes.Buffer
+
+	fmt.Fprintf(&out, ":: StoryTitle\n%s\n\n", story.Name)
+
+	metadata, _ := json.MarshalIndent(storyData{
+		IFID:          story.IFID,
+		Format:        story.Format,
+		FormatVersion: story.FormatVersion,
+		Start:         story.Start,
+		Zoom:          story.Zoom,
+	}, "", "  ")
+	fmt.Fprintf(&out, ":: StoryData\n%s\n", metadata)
+
+	if story.Script != "" {
+		fmt.Fprintf(&out, "\n:: Story JavaScript [script]\n%s\n", story.Script)
+	}
+	if story.Stylesheet != "" {
+		fmt.Fprintf(&out, "\n:: Story Stylesheet [stylesheet]\n%s\n", story.Stylesheet)
+	}
+
+	for _, passage := range story.Passages {
+		out.WriteString("\n:: ")
+		out.WriteString(escapeHeader(passage.Name))
+
+		if len(passage.Tags) > 0 {
+			tags := []string{}
+			for _, tag := range passage.Tags {
+				tags = append(tags, escapeHeader(tag))
+			}
+			out.WriteString(" [" + strings.Join(tags, " ") + "]")
+		}
+
+		if passage.Position != "" || passage.Size != "" {
+			metadata, _ := json.Marshal(passageMetadata{Position: passage.Position, Size: passage.Size})
+			out.WriteString(" ")
+			out.Write(metadata)
+		}
+		out.WriteString("\n")
+
+		for _, line := range strings.Split(passage.Text, "\n") {
+			if strings.HasPrefix(line, "::") {
+				line = `\` + line
+			}
+			out.WriteString(line + "\n")
+		}
+	}
+
+	return out.Bytes()
+}
+
+var headerEscaper = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, "{", `\{`, "}", `\}`)
+
+func escapeHeader(value string) string {
+	return headerEscaper.Replace(value)
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
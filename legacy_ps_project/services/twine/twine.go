@@ -0,0 +1,453 @@
+// Package twine converts adventures to and from Twine stories, both as Twee 3
+// source and as Twine 2 HTML. Passages become nodes and [[links]] become
+// links. Anything that has no counterpart on the other side, like Twine
+// macros or the props of a node, is reported as a Warning.
+package twine
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"html"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"projektps/models"
+)
+
+// Format is a file format of a Twine story
+type Format string
+
+const (
+	// FormatTwee is Twee 3 source, as written by Tweego and Twine 2.6+
+	FormatTwee Format = "twee"
+	// FormatHTML is a Twine 2 HTML story archive
+	FormatHTML Format = "html"
+)
+
+// Story format that exported stories are set up for, Harlowe is the default
+// format of Twine 2
+const (
+	DefaultStoryFormat        = "Harlowe"
+	DefaultStoryFormatVersion = "3.3.8"
+)
+
+// maxTitleLength is the width of the title column of a node
+const maxTitleLength = 100
+
+// Story is a Twine story, independent of the file format it was read from
+type Story struct {
+	Name          string
+	IFID          string
+	Format        string
+	FormatVersion string
+	Start         string
+	Zoom          float64
+	Script        string
+	Stylesheet    string
+	Passages      []Passage
+}
+
+// Passage is a named piece of text in a story. Position is "x,y" and Size
+// "width,height", like Twine stores them.
+type Passage struct {
+	Name     string
+	Tags     []string
+	Position string
+	Size     string
+	Text     string
+}
+
+// Warning describes something that could not be converted
+type Warning struct {
+	Passage string `json:"passage,omitempty"`
+	Message string `json:"message"`
+}
+
+func (w Warning) String() string {
+	if w.Passage == "" {
+		return w.Message
+	}
+	return fmt.Sprintf("%s: %s", w.Passage, w.Message)
+}
+
+type warnings []Warning
+
+func (w *warnings) add(passage string, format string, args ...interface{}) {
+	*w = append(*w, Warning{Passage: passage, Message: fmt.Sprintf(format, args...)})
+}
+
+// DetectFormat tells which Twine format data is in, or "" if it is neither
+func DetectFormat(data []byte) Format {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	if strings.HasPrefix(strings.TrimSpace(text), "::") {
+		return FormatTwee
+	}
+	if strings.Contains(text, "<tw-storydata") {
+		return FormatHTML
+	}
+	return ""
+}
+
+// Parse reads a story in either format
+func Parse(data []byte) (*Story, error) {
+	switch DetectFormat(data) {
+	case FormatTwee:
+		return ParseTwee(data)
+	case FormatHTML:
+		return ParseHTML(data)
+	}
+	return nil, fmt.Errorf("not a Twee or Twine HTML story")
+}
+
+// Write writes story in format
+func Write(story *Story, format Format) ([]byte, error) {
+	switch format {
+	case FormatTwee:
+		return WriteTwee(story), nil
+	case FormatHTML:
+		return WriteHTML(story), nil
+	}
+	return nil, fmt.Errorf("unknown story format %q", format)
+}
+
+var (
+	linkPattern     = regexp.MustCompile(`\[\[([^\]]*)\](?:\[([^\]]*)\])?\]`)
+	macroPattern    = regexp.MustCompile(`\([a-zA-Z][\w-]*:|<<[/a-zA-Z]|\$[a-zA-Z_]\w*`)
+	htmlBlock       = regexp.MustCompile(`(?i)^\s*<(p|div|h[1-6]|ul|ol|blockquote|table|figure|section)\b`)
+	blankLines      = regexp.MustCompile(`\n\s*\n`)
+	linkLine        = regexp.MustCompile(`^(\s*\[\[[^\]]*\](?:\[[^\]]*\])?\]\s*)+$`)
+	unsafeNameChars = strings.NewReplacer("[", "(", "]", ")", "|", "/", "->", "→", "<-", "←")
+)
+
+// twineLink is a [[link]] in the text of a passage
+type twineLink struct {
+	text   string
+	target string
+	setter string
+}
+
+// parseLink reads the inside of a [[link]]. Like Twine, the rightmost -> and
+// the leftmost <- divide text and target before | does.
+func parseLink(inside string, setter string) twineLink {
+	link := twineLink{setter: setter}
+	if i := strings.LastIndex(inside, "->"); i >= 0 {
+		link.text, link.target = inside[:i], inside[i+2:]
+	} else if i := strings.Index(inside, "<-"); i >= 0 {
+		link.target, link.text = inside[:i], inside[i+2:]
+	} else if i := strings.Index(inside, "|"); i >= 0 {
+		link.text, link.target = inside[:i], inside[i+1:]
+	} else {
+		link.text, link.target = inside, inside
+	}
+	link.text = strings.TrimSpace(link.text)
+	link.target = strings.TrimSpace(link.target)
+	return link
+}
+
+// splitText separates the links of a passage from its text. Lines that only
+// hold links are removed, links within a sentence are replaced by their text.
+func splitText(text string) (string, []twineLink) {
+	links := []twineLink{}
+	for _, match := range linkPattern.FindAllStringSubmatch(text, -1) {
+		links = append(links, parseLink(match[1], match[2]))
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if linkLine.MatchString(line) {
+			continue
+		}
+		lines = append(lines, linkPattern.ReplaceAllStringFunc(line, func(match string) string {
+			submatch := linkPattern.FindStringSubmatch(match)
+			return parseLink(submatch[1], submatch[2]).text
+		}))
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n")), links
+}
+
+// passageContent turns the text of a passage into node content. Text that
+// already is HTML, like the content of an exported adventure, is kept as it
+// is, anything else becomes paragraphs.
+func passageContent(text string) string {
+	if text == "" || htmlBlock.MatchString(text) {
+		return text
+	}
+
+	paragraphs := []string{}
+	for _, paragraph := range blankLines.Split(text, -1) {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		paragraph = strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>")
+		paragraphs = append(paragraphs, "<p>"+paragraph+"</p>")
+	}
+	return strings.Join(paragraphs, "")
+}
+
+// ToAdventure converts a story to an adventure. The start passage becomes
+// the root node with node_id 0, the other passages follow in story order.
+func ToAdventure(story *Story) (*models.Adventure, []Warning) {
+	w := warnings{}
+
+	if strings.TrimSpace(story.Script) != "" {
+		w.add("", "the story JavaScript is not imported")
+	}
+	if strings.TrimSpace(story.Stylesheet) != "" {
+		w.add("", "the story stylesheet is not imported")
+	}
+
+	adventure := &models.Adventure{
+		Title: story.Name,
+		Nodes: []models.Node{},
+		Links: []models.Link{},
+	}
+
+	start := -1
+	for i, passage := range story.Passages {
+		if passage.Name == story.Start {
+			start = i
+			break
+		}
+	}
+	if start < 0 && len(story.Passages) > 0 {
+		start = 0
+		w.add("", "the story has no start passage, %q is used", story.Passages[0].Name)
+	}
+
+	// The start passage goes first, so it gets node_id 0
+	order := []int{}
+	if start >= 0 {
+		order = append(order, start)
+	}
+	for i := range story.Passages {
+		if i != start {
+			order = append(order, i)
+		}
+	}
+
+	nodeIDs := make(map[string]int64)
+	for nodeID, i := range order {
+		passage := story.Passages[i]
+
+		title := passage.Name
+		if len([]rune(title)) > maxTitleLength {
+			title = string([]rune(title)[:maxTitleLength])
+			w.add(passage.Name, "the name is cut to %d characters", maxTitleLength)
+		}
+
+		node := models.Node{
+			NodeID:   int64(nodeID),
+			Title:    title,
+			NodeType: "default",
+		}
+		if i == start {
+			node.NodeType = "root"
+		}
+		node.X, node.Y = parsePosition(passage.Position)
+
+		if len(passage.Tags) > 0 {
+			w.add(passage.Name, "the tags %s are not imported", strings.Join(passage.Tags, ", "))
+		}
+
+		nodeIDs[passage.Name] = node.NodeID
+		adventure.Nodes = append(adventure.Nodes, node)
+	}
+
+	type linkKey struct {
+		source, target int64
+		title          string
+	}
+	seen := make(map[linkKey]bool)
+
+	for nodeID, i := range order {
+		passage := story.Passages[i]
+		text, links := splitText(passage.Text)
+
+		if macroPattern.MatchString(text) {
+			w.add(passage.Name, "macros and variables are kept as plain text")
+		}
+		adventure.Nodes[nodeID].Content = passageContent(text)
+
+		for _, link := range links {
+			target, exists := nodeIDs[link.target]
+			if !exists {
+				w.add(passage.Name, "the link to the missing passage %q is skipped", link.target)
+				continue
+			}
+			if link.setter != "" {
+				w.add(passage.Name, "the setter [%s] of the link to %q is not imported", link.setter, link.target)
+			}
+
+			title := link.text
+			if title == link.target {
+				title = ""
+			}
+
+			key := linkKey{int64(nodeID), target, title}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			adventure.Links = append(adventure.Links, models.Link{
+				LinkID:          int64(len(adventure.Links)),
+				SourceNodeID:    int64(nodeID),
+				TargetNodeID:    target,
+				TargetLinkTitle: title,
+				LinkType:        "default",
+			})
+		}
+	}
+
+	return adventure, w
+}
+
+// FromAdventure converts an adventure to a story. Node titles become passage
+// names, made unique and safe to use in [[links]].
+func FromAdventure(adventure *models.Adventure) (*Story, []Warning) {
+	w := warnings{}
+
+	if hasProps(adventure.Props) {
+		w.add("", "the adventure props are not exported")
+	}
+	if adventure.Description != "" {
+		w.add("", "the description is not exported")
+	}
+	if adventure.CoverUrl != "" {
+		w.add("", "the cover image is not exported")
+	}
+
+	nodes := append([]models.Node{}, adventure.Nodes...)
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].NodeID < nodes[j].NodeID })
+	links := append([]models.Link{}, adventure.Links...)
+	sort.SliceStable(links, func(i, j int) bool { return links[i].LinkID < links[j].LinkID })
+
+	story := &Story{
+		Name:          adventure.Title,
+		IFID:          ifid(adventure),
+		Format:        DefaultStoryFormat,
+		FormatVersion: DefaultStoryFormatVersion,
+		Zoom:          1,
+	}
+
+	names := make(map[int64]string)
+	used := make(map[string]bool)
+	for _, node := range nodes {
+		name := strings.TrimSpace(node.Title)
+		if name == "" {
+			name = fmt.Sprintf("Nod %d", node.NodeID)
+		}
+		if safe := unsafeNameChars.Replace(name); safe != name {
+			w.add(name, "renamed to %q, since [ ] | -> and <- can not be used in passage names", safe)
+			name = safe
+		}
+		if used[name] || name == "StoryTitle" || name == "StoryData" {
+			unique := fmt.Sprintf("%s (%d)", name, node.NodeID)
+			w.add(name, "renamed to %q, since passage names have to be unique", unique)
+			name = unique
+		}
+		used[name] = true
+		names[node.NodeID] = name
+
+		if node.NodeType == "root" && story.Start == "" {
+			story.Start = name
+		}
+	}
+
+	passages := make(map[int64]int)
+	for _, node := range nodes {
+		name := names[node.NodeID]
+
+		if node.NodeType != "root" && node.NodeType != "default" && node.NodeType != "" {
+			w.add(name, "the node type %q is not exported", node.NodeType)
+		}
+		if node.Icon != "" {
+			w.add(name, "the icon is not exported")
+		}
+		if node.ImageURL != "" || node.ImageID != 0 {
+			w.add(name, "the image is not exported")
+		}
+		if hasProps(node.Props) {
+			w.add(name, "the props are not exported")
+		}
+		if macroPattern.MatchString(node.Content) || linkPattern.MatchString(node.Content) {
+			w.add(name, "the text contains markup that Twine reads as links, macros or variables")
+		}
+
+		story.Passages = append(story.Passages, Passage{
+			Name:     name,
+			Position: fmt.Sprintf("%d,%d", node.X, node.Y),
+			Size:     "100,100",
+			Text:     node.Content,
+		})
+		passages[node.NodeID] = len(story.Passages) - 1
+	}
+
+	linkLines := make(map[int64][]string)
+	addLink := func(source, target int64, title string) {
+		text := unsafeNameChars.Replace(strings.TrimSpace(title))
+		if text == "" || text == names[target] {
+			linkLines[source] = append(linkLines[source], "[["+names[target]+"]]")
+		} else {
+			linkLines[source] = append(linkLines[source], "[["+text+"->"+names[target]+"]]")
+		}
+	}
+
+	for _, link := range links {
+		_, sourceExists := names[link.SourceNodeID]
+		_, targetExists := names[link.TargetNodeID]
+		if !sourceExists || !targetExists {
+			w.add("", "link %d between the missing nodes %d and %d is skipped", link.LinkID, link.SourceNodeID, link.TargetNodeID)
+			continue
+		}
+
+		addLink(link.SourceNodeID, link.TargetNodeID, link.TargetLinkTitle)
+		if link.LinkType == "bidirectional" {
+			addLink(link.TargetNodeID, link.SourceNodeID, link.SourceLinkTitle)
+			w.add(names[link.TargetNodeID], "the way back to %q is exported as a separate link", names[link.SourceNodeID])
+		}
+		if hasProps(link.Props) {
+			w.add(names[link.SourceNodeID], "the props of the link to %q are not exported", names[link.TargetNodeID])
+		}
+	}
+
+	for nodeID, lines := range linkLines {
+		passage := &story.Passages[passages[nodeID]]
+		if passage.Text != "" {
+			passage.Text += "\n\n"
+		}
+		passage.Text += strings.Join(lines, "\n")
+	}
+
+	return story, w
+}
+
+func hasProps(props string) bool {
+	props = strings.TrimSpace(props)
+	return props != "" && props != "{}"
+}
+
+// parsePosition reads "x,y", Twine positions may have decimals
+func parsePosition(position string) (int64, int64) {
+	parts := strings.Split(position, ",")
+	if len(parts) != 2 {
+		return 0, 0
+	}
+	x, _ := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	y, _ := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	return int64(math.Round(x)), int64(math.Round(y))
+}
+
+// ifid returns a stable story id, so exporting the same adventure again
+// replaces the story in the Twine library instead of adding a copy
+func ifid(adventure *models.Adventure) string {
+	sum := sha1.Sum([]byte("projektps/" + adventure.ViewSlug))
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return strings.ToUpper(fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16]))
+}
@@ -0,0 +1,199 @@
+package twine
+
+import (
+	"strings"
+	"testing"
+
+	"projektps/models"
+	"projektps/store"
+)
+
+const testTwee = `:: StoryTitle
+Skogen
+
+:: StoryData
+{
+  "ifid": "D674C58C-DEFA-4F70-B7A2-27742230C0FC",
+  "format": "SugarCube",
+  "format-version": "2.36.1",
+  "start": "Början"
+}
+
+:: Story JavaScript [script]
+window.x = 1;
+
+:: Stigen [mörk skog] {"position":"300.5,200","size":"100,100"}
+Du går på stigen. (set: $lykta to true)
+\:: inte en rubrik
+[[Tillbaka|Början]]
+
+:: Början {"position":"100,100"}
+Du står i skogen och kan gå [[åt vänster->Stigen]] eller till sjön.
+
+[[Stigen]]
+[[Sjön]]
+[[Stigen<-Ta stigen][$steg to 1]]
+
+:: Kant \[1\]
+Inga länkar här.
+`
+
+func TestParseTwee(t *testing.T) {
+	story, err := ParseTwee([]byte(testTwee))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if story.Name != "Skogen" || story.Start != "Början" || story.Format != "SugarCube" || story.Script != "window.x = 1;" {
+		t.Errorf("unexpected story %+v", story)
+	}
+	if len(story.Passages) != 3 {
+		t.Fatalf("expected 3 passages, got %+v", story.Passages)
+	}
+
+	path := story.Passages[0]
+	if path.Name != "Stigen" || strings.Join(path.Tags, ",") != "mörk,skog" || path.Position != "300.5,200" {
+		t.Errorf("unexpected passage %+v", path)
+	}
+	if !strings.Contains(path.Text, "\n:: inte en rubrik\n") {
+		t.Errorf("expected the escaped line to be unescaped, got %q", path.Text)
+	}
+	if story.Passages[2].Name != "Kant [1]" {
+		t.Errorf("expected an unescaped name, got %q", story.Passages[2].Name)
+	}
+}
+
+func TestToAdventure(t *testing.T) {
+	story, err := ParseTwee([]byte(testTwee))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adventure, warnings := ToAdventure(story)
+
+	if adventure.Title != "Skogen" || len(adventure.Nodes) != 3 {
+		t.Fatalf("unexpected adventure %+v", adventure)
+	}
+
+	start := adventure.Nodes[0]
+	if start.NodeID != 0 || start.NodeType != "root" || start.Title != "Början" || start.X != 100 || start.Y != 100 {
+		t.Errorf("unexpected start node %+v", start)
+	}
+	if start.Content != "<p>Du står i skogen och kan gå åt vänster eller till sjön.</p>" {
+		t.Errorf("unexpected content %q", start.Content)
+	}
+	if path := adventure.Nodes[1]; path.NodeType != "default" || path.X != 301 || path.Y != 200 {
+		t.Errorf("unexpected node %+v", path)
+	}
+
+	expected := []models.Link{
+		{LinkID: 0, SourceNodeID: 0, TargetNodeID: 1, TargetLinkTitle: "åt vänster", LinkType: "default"},
+		{LinkID: 1, SourceNodeID: 0, TargetNodeID: 1, LinkType: "default"},
+		{LinkID: 2, SourceNodeID: 0, TargetNodeID: 1, TargetLinkTitle: "Ta stigen", LinkType: "default"},
+		{LinkID: 3, SourceNodeID: 1, TargetNodeID: 0, TargetLinkTitle: "Tillbaka", LinkType: "default"},
+	}
+	if len(adventure.Links) != len(expected) {
+		t.Fatalf("expected %d links, got %+v", len(expected), adventure.Links)
+	}
+	for i, link := range expected {
+		if adventure.Links[i] != link {
+			t.Errorf("expected link %+v, got %+v", link, adventure.Links[i])
+		}
+	}
+
+	messages := []string{}
+	for _, warning := range warnings {
+		messages = append(messages, warning.String())
+	}
+	for _, message := range []string{
+		"the story JavaScript is not imported",
+		"Stigen: the tags mörk, skog are not imported",
+		"Stigen: macros and variables are kept as plain text",
+		`Början: the link to the missing passage "Sjön" is skipped`,
+		`Början: the setter [$steg to 1] of the link to "Stigen" is not imported`,
+	} {
+		if !strings.Contains(strings.Join(messages, "\n"), message) {
+			t.Errorf("expected the warning %q, got %q", message, messages)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	nodes, links := store.DefaultAdventureContent(1)
+	nodes[2].Title = "Vänster"
+	nodes[2].Props = `{"background_color":["#ffffff"]}`
+	links[1].TargetLinkTitle = "Gå -> höger"
+	links[1].SourceLinkTitle = "Tillbaka"
+
+	adventure := &models.Adventure{Title: "Vägval", ViewSlug: "vagval", Nodes: nodes, Links: links}
+
+	for _, format := range []Format{FormatTwee, FormatHTML} {
+		story, warnings := FromAdventure(adventure)
+		if len(warnings) == 0 {
+			t.Errorf("%s: expected warnings for the props and the renamed passage", format)
+		}
+
+		data, err := Write(story, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if DetectFormat(data) != format {
+			t.Fatalf("%s: detected %q in %s", format, DetectFormat(data), data)
+		}
+
+		parsed, err := Parse(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		imported, _ := ToAdventure(parsed)
+
+		if imported.Title != adventure.Title || len(imported.Nodes) != 3 {
+			t.Fatalf("%s: unexpected adventure %+v", format, imported)
+		}
+		for i, node := range imported.Nodes {
+			original := nodes[i]
+			if node.NodeID != original.NodeID || node.NodeType != original.NodeType || node.Content != original.Content || node.X != original.X || node.Y != original.Y {
+				t.Errorf("%s: expected node %+v, got %+v", format, original, node)
+			}
+		}
+		if imported.Nodes[2].Title != "Vänster (2)" {
+			t.Errorf("%s: expected the duplicate title to be renamed, got %q", format, imported.Nodes[2].Title)
+		}
+
+		// The bidirectional links come back as a link each way
+		if len(imported.Links) != 4 {
+			t.Fatalf("%s: expected 4 links, got %+v", format, imported.Links)
+		}
+		if link := imported.Links[1]; link.SourceNodeID != 0 || link.TargetNodeID != 2 || link.TargetLinkTitle != "Gå → höger" {
+			t.Errorf("%s: unexpected link %+v", format, link)
+		}
+		if link := imported.Links[3]; link.SourceNodeID != 2 || link.TargetNodeID != 0 || link.TargetLinkTitle != "Tillbaka" {
+			t.Errorf("%s: unexpected link %+v", format, link)
+		}
+	}
+}
+
+func TestParseHTML(t *testing.T) {
+	data := `<html><body><tw-storydata name="Sj&ouml;n &amp; skogen" startnode="2" ifid="X" format="Harlowe" zoom="0.6" hidden>
+<style role="stylesheet" id="twine-user-stylesheet" type="text/twine-css">body { color: red; }</style>
+<script role="script" id="twine-user-script" type="text/twine-javascript"></script>
+<tw-passagedata pid="1" name="Sjön" tags="" position="400,100" size="100,100">Vattnet är &lt;kallt&gt;.</tw-passagedata>
+<tw-passagedata pid="2" name="Start" tags="" position="100,100" size="100,100">[[Sjön]]</tw-passagedata>
+</tw-storydata></body></html>`
+
+	story, err := ParseHTML([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if story.Name != "Sjön & skogen" || story.Start != "Start" || story.Zoom != 0.6 || story.Stylesheet != "body { color: red; }" {
+		t.Errorf("unexpected story %+v", story)
+	}
+	if len(story.Passages) != 2 || story.Passages[0].Text != "Vattnet är <kallt>." {
+		t.Errorf("unexpected passages %+v", story.Passages)
+	}
+
+	adventure, _ := ToAdventure(story)
+	if adventure.Nodes[1].Content != "<p>Vattnet är &lt;kallt&gt;.</p>" {
+		t.Errorf("expected the text to be escaped, got %q", adventure.Nodes[1].Content)
+	}
+}
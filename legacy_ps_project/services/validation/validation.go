@@ -0,0 +1,237 @@
+// Package validation checks that the graph of an adventure is consistent
+// before it is published: links, start node, reachability and node ids
+// referenced from props.
+package validation
+
+import (
+	"fmt"
+	"sort"
+
+	"projektps/models"
+)
+
+// Severity tells whether an issue breaks the adventure or only looks suspicious
+type Severity string
+
+const (
+	// SeverityError is used for problems that break playback
+	SeverityError Severity = "error"
+	// SeverityWarning is used for problems the author probably wants to know about
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a single finding, NodeID/LinkID point out where it was found
+type Issue struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	NodeID   *int64   `json:"node_id,omitempty"`
+	LinkID   *int64   `json:"link_id,omitempty"`
+}
+
+// Report contains all issues found in an adventure
+type Report struct {
+	Errors   []Issue `json:"errors"`
+	Warnings []Issue `json:"warnings"`
+}
+
+// Valid is true if the report contains no errors
+func (r *Report) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+func (r *Report) add(severity Severity, code string, nodeID, linkID *int64, format string, args ...interface{}) {
+	issue := Issue{
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		NodeID:   nodeID,
+		LinkID:   linkID,
+	}
+
+	if severity == SeverityError {
+		r.Errors = append(r.Errors, issue)
+	} else {
+		r.Warnings = append(r.Warnings, issue)
+	}
+}
+
+// ValidateAdventure walks the nodes and links of an adventure and reports
+// everything that is inconsistent
+func ValidateAdventure(adventure *models.Adventure) Report {
+	report := Report{
+		Errors:   []Issue{},
+		Warnings: []Issue{},
+	}
+
+	nodes := make(map[int64]*models.Node)
+	for i := range adventure.Nodes {
+		node := &adventure.Nodes[i]
+		if _, exists := nodes[node.NodeID]; exists {
+			report.add(SeverityError, "node.duplicate_id", ref(node.NodeID), nil, "Node id %d is used by more than one node", node.NodeID)
+			continue
+		}
+		nodes[node.NodeID] = node
+	}
+
+	links := make(map[int64]*models.Link)
+	for i := range adventure.Links {
+		link := &adventure.Links[i]
+		if _, exists := links[link.LinkID]; exists {
+			report.add(SeverityError, "link.duplicate_id", nil, ref(link.LinkID), "Link id %d is used by more than one link", link.LinkID)
+			continue
+		}
+		links[link.LinkID] = link
+	}
+
+	// Links must connect existing nodes
+	for _, link := range adventure.Links {
+		if _, exists := nodes[link.SourceNodeID]; !exists {
+			report.add(SeverityError, "link.missing_source", ref(link.SourceNodeID), ref(link.LinkID), "Link %d starts at missing node %d", link.LinkID, link.SourceNodeID)
+		}
+		if _, exists := nodes[link.TargetNodeID]; !exists {
+			report.add(SeverityError, "link.missing_target", ref(link.TargetNodeID), ref(link.LinkID), "Link %d points to missing node %d", link.LinkID, link.TargetNodeID)
+		}
+
+		if link.Props == "" {
+			continue
+		}
+
+		props, err := models.ParseLinkProps(link.Props)
+		if err != nil {
+			report.add(SeverityError, "link.invalid_props", nil, ref(link.LinkID), "Link %d has props that can not be read", link.LinkID)
+			continue
+		}
+
+		checkNodeList(&report, nodes, link.LinkID, "positiveNodeList", props.PositiveNodeList)
+		checkNodeList(&report, nodes, link.LinkID, "negativeNodeList", props.NegativeNodeList)
+	}
+
+	// Exactly one start node, the player always begins at the root node
+	var startNodes []int64
+	var startTypeNodes []int64
+	for _, node := range adventure.Nodes {
+		if node.NodeType == "root" {
+			startNodes = append(startNodes, node.NodeID)
+		}
+
+		if node.Props == "" {
+			continue
+		}
+
+		props, err := models.ParseNodeProps(node.Props)
+		if err != nil {
+			report.add(SeverityError, "node.invalid_props", ref(node.NodeID), nil, "Node %d has props that can not be read", node.NodeID)
+			continue
+		}
+
+		if len(props.ChapterType) > 0 && props.ChapterType[0] == "start-node" {
+			startTypeNodes = append(startTypeNodes, node.NodeID)
+		}
+
+		for _, id := range props.OrderedLinkIDs {
+			linkID, valid := id.Int()
+
+			// -1 is the node itself in the button order
+			if valid && linkID == -1 {
+				continue
+			}
+			if _, exists := links[linkID]; !valid || !exists {
+				report.add(SeverityWarning, "node.missing_ordered_link", ref(node.NodeID), nil, "Node %d orders its buttons by link %s, which does not exist", node.NodeID, id.String())
+			}
+		}
+	}
+
+	if len(startNodes) == 0 {
+		report.add(SeverityError, "adventure.missing_start", nil, nil, "The adventure has no start node")
+	}
+	if len(startNodes) > 1 {
+		for _, id := range startNodes[1:] {
+			report.add(SeverityError, "adventure.multiple_start", ref(id), nil, "Node %d is an additional start node", id)
+		}
+	}
+	if len(startTypeNodes) > 1 {
+		for _, id := range startTypeNodes {
+			report.add(SeverityWarning, "node.multiple_start_type", ref(id), nil, "Node %d is one of %d nodes with the node type Start", id, len(startTypeNodes))
+		}
+	}
+
+	// Menu shortcuts must lead somewhere
+	var shortcutNodes []int64
+	props, err := models.ParseAdventureProps(adventure.Props)
+	if err != nil {
+		report.add(SeverityError, "adventure.invalid_props", nil, nil, "The adventure has props that can not be read")
+	} else {
+		for i, shortcut := range props.MenuShortcuts {
+			// Unused shortcut slots are saved with an empty node id
+			if shortcut.NodeID.IsEmpty() {
+				continue
+			}
+			shortcutID, valid := shortcut.NodeID.Int()
+			if _, exists := nodes[shortcutID]; !valid || !exists {
+				report.add(SeverityError, "adventure.missing_shortcut_node", nil, nil, "Menu shortcut %d points to missing node %s", i+1, shortcut.NodeID.String())
+				continue
+			}
+			shortcutNodes = append(shortcutNodes, shortcutID)
+		}
+	}
+
+	// Every node should be reachable from the start node or a menu shortcut
+	if len(startNodes) > 0 {
+		reached := reachableNodes(adventure.Links, append(startNodes, shortcutNodes...))
+
+		unreachable := []int64{}
+		for id := range nodes {
+			if !reached[id] {
+				unreachable = append(unreachable, id)
+			}
+		}
+		sort.Slice(unreachable, func(i, j int) bool { return unreachable[i] < unreachable[j] })
+
+		for _, id := range unreachable {
+			report.add(SeverityWarning, "node.unreachable", ref(id), nil, "Node %d can not be reached from the start node", id)
+		}
+	}
+
+	return report
+}
+
+func checkNodeList(report *Report, nodes map[int64]*models.Node, linkID int64, name string, list []models.Number) {
+	for _, id := range list {
+		nodeID, valid := id.Int()
+		if _, exists := nodes[nodeID]; !valid || !exists {
+			report.add(SeverityError, "link.missing_condition_node", nil, ref(linkID), "Link %d has node %s in its %s, which does not exist", linkID, id.String(), name)
+		}
+	}
+}
+
+// reachableNodes follows links from the given nodes, bidirectional links
+// can be followed both ways
+func reachableNodes(links []models.Link, from []int64) map[int64]bool {
+	edges := make(map[int64][]int64)
+	for _, link := range links {
+		edges[link.SourceNodeID] = append(edges[link.SourceNodeID], link.TargetNodeID)
+		if link.LinkType == "bidirectional" {
+			edges[link.TargetNodeID] = append(edges[link.TargetNodeID], link.SourceNodeID)
+		}
+	}
+
+	reached := make(map[int64]bool)
+	queue := append([]int64{}, from...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		if reached[id] {
+			continue
+		}
+		reached[id] = true
+		queue = append(queue, edges[id]...)
+	}
+
+	return reached
+}
+
+func ref(id int64) *int64 {
+	return &id
+}
@@ -0,0 +1,72 @@
+package validation
+
+import "testing"
+
+import "projektps/models"
+
+func codes(issues []Issue) map[string]int {
+	result := make(map[string]int)
+	for _, issue := range issues {
+		result[issue.Code]++
+	}
+	return result
+}
+
+func TestValidAdventure(t *testing.T) {
+	adventure := &models.Adventure{
+		Props: `{"menu_shortcuts":[{"nodeId":"1","text":"Hem"},{"nodeId":"","text":""}]}`,
+		Nodes: []models.Node{
+			{NodeID: 0, NodeType: "root", Props: `{"settings_chapterType":["start-node"],"ordered_link_ids":["1",-1]}`},
+			{NodeID: 1},
+			{NodeID: 2},
+		},
+		Links: []models.Link{
+			{LinkID: 1, SourceNodeID: 0, TargetNodeID: 1, Props: `{"positiveNodeList":["0"],"negativeNodeList":[]}`},
+			{LinkID: 2, SourceNodeID: 2, TargetNodeID: 1, LinkType: "bidirectional"},
+		},
+	}
+
+	report := ValidateAdventure(adventure)
+	if !report.Valid() || len(report.Warnings) != 0 {
+		t.Errorf("Expected no issues, got %v %v", report.Errors, report.Warnings)
+	}
+}
+
+func TestBrokenAdventure(t *testing.T) {
+	adventure := &models.Adventure{
+		Props: `{"menu_shortcuts":[{"nodeId":"9","text":"Hem"}]}`,
+		Nodes: []models.Node{
+			{NodeID: 0, NodeType: "root", Props: `{"ordered_link_ids":["7"]}`},
+			{NodeID: 1, NodeType: "root"},
+			{NodeID: 2},
+		},
+		Links: []models.Link{
+			{LinkID: 1, SourceNodeID: 0, TargetNodeID: 5},
+			{LinkID: 2, SourceNodeID: 0, TargetNodeID: 1, Props: `{"positiveNodeList":["8"]}`},
+		},
+	}
+
+	report := ValidateAdventure(adventure)
+
+	errors := codes(report.Errors)
+	for _, code := range []string{"link.missing_target", "adventure.multiple_start", "link.missing_condition_node", "adventure.missing_shortcut_node"} {
+		if errors[code] != 1 {
+			t.Errorf("Expected error %s, got %v", code, report.Errors)
+		}
+	}
+
+	warnings := codes(report.Warnings)
+	if warnings["node.missing_ordered_link"] != 1 || warnings["node.unreachable"] != 1 {
+		t.Errorf("Wrong warnings: %v", report.Warnings)
+	}
+	if *report.Warnings[1].NodeID != 2 {
+		t.Errorf("Expected node 2 to be unreachable, got %d", *report.Warnings[1].NodeID)
+	}
+}
+
+func TestMissingStartNode(t *testing.T) {
+	report := ValidateAdventure(&models.Adventure{Nodes: []models.Node{{NodeID: 1}}})
+	if codes(report.Errors)["adventure.missing_start"] != 1 {
+		t.Errorf("Expected missing start node, got %v", report.Errors)
+	}
+}
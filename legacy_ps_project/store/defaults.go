@@ -0,0 +1,57 @@
+package store
+
+import "projektps/models"
+
+// DefaultAdventureContent returns the start node and two choices that an
+// adventure created with CreateDefaultAdventure begins with
+func DefaultAdventureContent(adventureID int64) ([]models.Node, []models.Link) {
+	nodes := []models.Node{
+		{
+			AdventureID: adventureID,
+			NodeID:      0,
+			NodeType:    "root",
+			Title:       "Start",
+			Icon:        "🏠",
+			Content:     "<p>Detta är starten på ditt nya PS.</p>",
+			X:           345,
+			Y:           100,
+		},
+		{
+			AdventureID: adventureID,
+			NodeID:      1,
+			NodeType:    "default",
+			Title:       "Vänster",
+			Content:     "<p>Du har gått till vänster.</p>",
+			X:           144,
+			Y:           383,
+		},
+		{
+			AdventureID: adventureID,
+			NodeID:      2,
+			NodeType:    "default",
+			Title:       "Höger",
+			Content:     "<p>Du har gått till höger.</p>",
+			X:           546,
+			Y:           383,
+		},
+	}
+
+	links := []models.Link{
+		{
+			AdventureID:  adventureID,
+			LinkID:       0,
+			SourceNodeID: 0,
+			TargetNodeID: 1,
+			LinkType:     "bidirectional",
+		},
+		{
+			AdventureID:  adventureID,
+			LinkID:       1,
+			SourceNodeID: 0,
+			TargetNodeID: 2,
+			LinkType:     "bidirectional",
+		},
+	}
+
+	return nodes, links
+}
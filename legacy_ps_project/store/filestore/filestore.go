@@ -0,0 +1,234 @@
+// Package filestore keeps the uploaded files in a folder of the server, the
+// way they always were kept in upload/
+package filestore
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"projektps/store"
+)
+
+// FileStore is a store.MediaStore in a folder
+type FileStore struct {
+	root    string
+	baseURL string
+}
+
+// NewFileStore creates a media store in the folder root, whose files are
+// served at baseURL, like /upload/
+func NewFileStore(root string, baseURL string) *FileStore {
+	return &FileStore{root: filepath.Clean(root), baseURL: baseURL}
+}
+
+// Root is the folder of the store
+func (s *FileStore) Root() string {
+	return s.root
+}
+
+// path returns the file of name, or an error if the name is not valid
+func (s *FileStore) path(name string) (string, error) {
+	if !store.ValidMediaName(name) {
+		return "", store.ErrInvalidMediaName
+	}
+	return filepath.Join(s.root, filepath.FromSlash(name)), nil
+}
+
+// Put writes the content next to the file and renames it when it is complete
+func (s *FileStore) Put(name string, content io.Reader, contentType string) error {
+	fileName, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(fileName), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(fileName), ".upload-")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(temp, content)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), fileName)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
+
+func (s *FileStore) Get(name string) (io.ReadCloser, error) {
+	fileName, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return nil, store.ErrMediaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info, err := file.Stat(); err != nil || info.IsDir() {
+		file.Close()
+		return nil, store.ErrMediaNotFound
+	}
+	return file, nil
+}
+
+func (s *FileStore) Stat(name string) (*store.MediaObject, error) {
+	fileName, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(fileName)
+	if os.IsNotExist(err) || (err == nil && !info.Mode().IsRegular()) {
+		return nil, store.ErrMediaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return object(name, info), nil
+}
+
+// Delete removes the file and the folders it leaves empty
+func (s *FileStore) Delete(name string) error {
+	fileName, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(fileName)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for folder := filepath.Dir(fileName); folder != s.root && strings.HasPrefix(folder, s.root); folder = filepath.Dir(folder) {
+		if os.Remove(folder) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// List walks the folder, the files being written by Put are left out
+func (s *FileStore) List(prefix string) ([]store.MediaObject, error) {
+	objects := []store.MediaObject{}
+	err := filepath.Walk(s.root, func(fileName string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && fileName == s.root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		relative, err := filepath.Rel(s.root, fileName)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relative)
+
+		if info.IsDir() {
+			// Folders that can not contain a match are not walked
+			if name != "." && !strings.HasPrefix(name+"/", prefix) && !strings.HasPrefix(prefix, name+"/") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), ".upload-") || !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		objects = append(objects, *object(name, info))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
+
+func (s *FileStore) CopyPrefix(from, to string) error {
+	objects, err := s.List(from)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		file, err := s.Get(object.Name)
+		if err != nil {
+			return err
+		}
+		err = s.Put(to+strings.TrimPrefix(object.Name, from), file, object.ContentType)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SignedURL returns the url the file is served at. The folder is served to
+// everyone, so the url is not signed and does not expire.
+func (s *FileStore) SignedURL(name string, expires time.Duration) (string, error) {
+	if !store.ValidMediaName(name) {
+		return "", store.ErrInvalidMediaName
+	}
+	return s.baseURL + (&url.URL{Path: name}).EscapedPath(), nil
+}
+
+// ServeHTTP serves the files of the folder, with the path relative to it.
+// Ranges, for seeking in audio and video, and conditional requests are
+// answered by http.ServeContent. Unless the caller has set an ETag, a weak
+// one is made from the time the file was written and its size, which two
+// files may share. Folders and the files being written by Put are not
+// served.
+func (s *FileStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	fileName, err := s.path(name)
+	if err != nil || strings.HasPrefix(path.Base(name), ".upload-") {
+		http.NotFound(w, r)
+		return
+	}
+	file, err := os.Open(fileName)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+
+	if w.Header().Get("ETag") == "" {
+		w.Header().Set("ETag", fmt.Sprintf(`W/"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	}
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+func object(name string, info os.FileInfo) *store.MediaObject {
+	return &store.MediaObject{
+		Name:        name,
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		ContentType: mime.TypeByExtension(path.Ext(name)),
+	}
+}
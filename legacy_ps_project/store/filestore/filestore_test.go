@@ -0,0 +1,116 @@
+package filestore
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"projektps/store"
+	"projektps/store/storetest"
+)
+
+func newTestStore(t *testing.T) *FileStore {
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return NewFileStore(filepath.Join(dir, "upload"), "/upload/")
+}
+
+func TestConformance(t *testing.T) {
+	storetest.RunMediaStore(t, func(t *testing.T) store.MediaStore {
+		return newTestStore(t)
+	})
+}
+
+func TestFolders(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.Put("abc/ljud/fagel.mp3", strings.NewReader("fågel"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files being written are not listed
+	if err := ioutil.WriteFile(filepath.Join(s.Root(), "abc", ".upload-123"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := s.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 {
+		t.Errorf("expected only fagel.mp3, got %+v", objects)
+	}
+	os.Remove(filepath.Join(s.Root(), "abc", ".upload-123"))
+
+	// The folders a deleted file leaves empty are removed, not the store
+	if err := s.Delete("abc/ljud/fagel.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(s.Root(), "abc")); !os.IsNotExist(err) {
+		t.Errorf("expected abc/ to be removed, got %v", err)
+	}
+	if _, err := os.Stat(s.Root()); err != nil {
+		t.Errorf("expected the store to be kept, got %v", err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.Put("abc/en skog.png", strings.NewReader("skog"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := s.SignedURL("abc/en skog.png", time.Hour)
+	if err != nil || url != "/upload/abc/en%20skog.png" {
+		t.Fatalf("expected the served url, got %q: %v", url, err)
+	}
+
+	serve := func(path string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		http.StripPrefix("/upload/", s).ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(url)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != "skog" {
+		t.Errorf("expected the file, got %d %q", w.Code, w.Body.String())
+	}
+	if !strings.HasPrefix(etag, `W/"`) || w.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("expected a weak ETag and ranges, got %v", w.Header())
+	}
+
+	w = serve(url, "Range", "bytes=1-2")
+	if w.Code != http.StatusPartialContent || w.Body.String() != "ko" || w.Header().Get("Content-Range") != "bytes 1-2/4" {
+		t.Errorf("expected the range, got %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+	w = serve(url, "If-None-Match", etag)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", w.Code)
+	}
+	// A range of a file that has changed gives the whole file
+	w = serve(url, "Range", "bytes=1-2", "If-Range", `"gammal"`)
+	if w.Code != http.StatusOK || w.Body.String() != "skog" {
+		t.Errorf("expected the whole file, got %d %q", w.Code, w.Body.String())
+	}
+
+	// Folders and files being written are not served
+	if err := ioutil.WriteFile(filepath.Join(s.Root(), "abc", ".upload-123"), []byte("halv"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/upload/abc/", "/upload/abc", "/upload/abc/.upload-123", "/upload/abc/saknas.png"} {
+		if w := serve(path); w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrMediaNotFound is returned when a file is not in the media store
+var ErrMediaNotFound = errors.New("media file not found")
+
+// ErrInvalidMediaName is returned for names that are not valid, see
+// ValidMediaName
+var ErrInvalidMediaName = errors.New("invalid media file name")
+
+// MediaObject describes a file of a media store
+type MediaObject struct {
+	// Name is the name of the file, like media/ab/ab12….jpg
+	Name        string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// MediaStore describes a storage facility for the uploaded files, the ones
+// served under /upload/. Files are named by slash separated paths relative
+// to the upload folder, like media/ab/ab12….jpg or {slug}/cover.png.
+type MediaStore interface {
+	// Put stores the content as name, replacing the file if there is one.
+	// A reader never sees a partly written file.
+	Put(name string, content io.Reader, contentType string) error
+	// Get returns the content of name or ErrMediaNotFound
+	Get(name string) (io.ReadCloser, error)
+	// Stat describes name or returns ErrMediaNotFound
+	Stat(name string) (*MediaObject, error)
+	// Delete removes name, it is not an error if there is no such file
+	Delete(name string) error
+	// List returns the files whose names start with prefix, ordered by name
+	List(prefix string) ([]MediaObject, error)
+	// CopyPrefix copies every file whose name starts with from to the same
+	// name starting with to instead
+	CopyPrefix(from, to string) error
+	// SignedURL returns a url that name can be downloaded from until expires
+	// has passed
+	SignedURL(name string, expires time.Duration) (string, error)
+}
+
+// ValidMediaName is false for names that are empty, absolute, not clean or
+// step out of the store, also when read as Windows paths
+func ValidMediaName(name string) bool {
+	if name == "" || strings.ContainsAny(name, "\\\x00:") || strings.HasPrefix(name, "/") {
+		return false
+	}
+	if path.Clean(name) != name {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." || part == "." {
+			return false
+		}
+	}
+	return true
+}
+
+// DeleteMediaPrefix removes every file whose name starts with prefix
+func DeleteMediaPrefix(media MediaStore, prefix string) error {
+	objects, err := media.List(prefix)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := media.Delete(object.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,681 @@
+package memstore
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"projektps/helpers/uniuri"
+	"projektps/models"
+	"projektps/store"
+)
+
+// CreateNewAdventure creates a new adventure with unique random slugs
+func (s *MemStore) CreateNewAdventure() (*models.Adventure, error) {
+	newAdventure := &models.Adventure{}
+
+	err := s.locked(func(tx *MemStore) error {
+		for attempt := 0; ; attempt++ {
+			if attempt == store.MaxSlugAttempts {
+				return fmt.Errorf("no unique slug found in %d attempts", store.MaxSlugAttempts)
+			}
+
+			newAdventure.ViewSlug = uniuri.New()
+			newAdventure.Slug = uniuri.NewLen(8)
+			if newAdventure.Slug != newAdventure.ViewSlug && !tx.slugInUse(newAdventure.Slug) && !tx.slugInUse(newAdventure.ViewSlug) {
+				break
+			}
+		}
+
+		newAdventure.ID = tx.db.nextID("adventure")
+		tx.db.adventures[newAdventure.ID] = adventureRow{
+			id:         newAdventure.ID,
+			categoryID: sql.NullInt64{Int64: 1, Valid: true},
+			slug:       newAdventure.Slug,
+			viewSlug:   newAdventure.ViewSlug,
+			title:      "Nytt äventyr",
+			createdAt:  now(),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newAdventure, nil
+}
+
+// CreateDefaultAdventure creates a new adventure with a start node and two choices
+func (s *MemStore) CreateDefaultAdventure() (*models.Adventure, error) {
+	var adventure *models.Adventure
+	err := s.transaction(func(tx *MemStore) error {
+		var err error
+		adventure, err = tx.CreateNewAdventure()
+		if err != nil {
+			return err
+		}
+
+		nodes, links := store.DefaultAdventureContent(adventure.ID)
+		for i := range nodes {
+			if _, err := tx.CreateNewNode(&nodes[i]); err != nil {
+				return err
+			}
+		}
+		for i := range links {
+			if _, err := tx.CreateNewLink(&links[i]); err != nil {
+				return err
+			}
+		}
+
+		adventure.Nodes, adventure.Links, adventure.Users, err = tx.getAdventureContent(adventure.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return adventure, nil
+}
+
+// UpdateAdventure updates the settings and members of an adventure
+func (s *MemStore) UpdateAdventure(adventure *models.Adventure) error {
+	return s.transaction(func(tx *MemStore) error {
+		existingAdventure, err := tx.GetAdventure(adventure.Slug, models.ReadWrite)
+		if err != nil {
+			return err
+		}
+
+		if row, exists := tx.db.adventures[adventure.ID]; exists {
+			row.title = adventure.Title
+			row.description = adventure.Description
+			row.categoryID = sql.NullInt64{Int64: adventure.Category.ID, Valid: true}
+			row.locked = adventure.Locked
+			tx.updateAdventureRow(row)
+		}
+
+		if err := tx.UpdateViewSlug(adventure.ID, adventure.ViewSlug); err != nil {
+			return err
+		}
+
+		for _, user := range existingAdventure.Users {
+			if !containsUser(adventure.Users, user.ID) {
+				if err := tx.DeleteUserFromAdventure(&user, existingAdventure); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, user := range adventure.Users {
+			if !containsUser(existingAdventure.Users, user.ID) {
+				if err := tx.AddUserToAdventure(&user, existingAdventure); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// UpdateAdventureContent saves the adventure, its nodes and links as one
+// change, see sqlstore.SQLStore.UpdateAdventureContent
+func (s *MemStore) UpdateAdventureContent(newAdventure *models.Adventure, userID int64) error {
+	return s.transaction(func(tx *MemStore) error {
+		err := tx.bumpEditVersion(newAdventure.Slug, newAdventure.EditVersion)
+		if err != nil {
+			return err
+		}
+
+		err = tx.updateAdventureContent(newAdventure)
+		if err != nil {
+			return err
+		}
+		return tx.createRevisionSnapshot(newAdventure.Slug, userID)
+	})
+}
+
+// EditAdventureContent runs fn as a single save of the adventure content
+func (s *MemStore) EditAdventureContent(slug string, editVersion int64, userID int64, fn func(tx store.Store) error) error {
+	return s.transaction(func(tx *MemStore) error {
+		err := tx.bumpEditVersion(slug, editVersion)
+		if err != nil {
+			return err
+		}
+
+		err = fn(tx)
+		if err != nil {
+			return err
+		}
+		return tx.createRevisionSnapshot(slug, userID)
+	})
+}
+
+func (s *MemStore) updateAdventureContent(newAdventure *models.Adventure) error {
+	a, err := s.GetAdventure(newAdventure.Slug, models.ReadWrite)
+	if err != nil {
+		return err
+	}
+
+	row := s.db.adventures[a.ID]
+	row.title = newAdventure.Title
+	row.description = newAdventure.Description
+	row.categoryID = sql.NullInt64{Int64: newAdventure.Category.ID, Valid: true}
+	row.locked = newAdventure.Locked
+	row.coverURL = newAdventure.CoverUrl
+	row.props = newAdventure.Props
+	s.updateAdventureRow(row)
+
+	// Delete nodes that have been removed
+	for _, node := range a.Nodes {
+		if !containsNode(newAdventure.Nodes, node.ID) {
+			node.AdventureID = a.ID
+			if err := s.DeleteNode(&node); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, node := range newAdventure.Nodes {
+		node.AdventureID = a.ID
+		if node.ID == 0 {
+			if _, err := s.CreateNewNode(&node); err != nil {
+				return err
+			}
+		} else if node.Changed {
+			if err := s.UpdateNode(&node); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Delete links that have been removed
+	for _, link := range a.Links {
+		if !containsLink(newAdventure.Links, link.ID) {
+			link.AdventureID = a.ID
+			if err := s.DeleteLink(&link); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, link := range newAdventure.Links {
+		link.AdventureID = a.ID
+		if link.ID == 0 {
+			if _, err := s.CreateNewLink(&link); err != nil {
+				return err
+			}
+		} else if link.Changed {
+			if err := s.UpdateLink(&link); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// DeleteAdventureByID removes an adventure along with its nodes, links,
+// members and revisions
+func (s *MemStore) DeleteAdventureByID(adventureID int64) error {
+	return s.locked(func(tx *MemStore) error {
+		if _, exists := tx.db.adventures[adventureID]; !exists {
+			return nil
+		}
+
+		// Lists, reports and logs keep the adventure, like the foreign keys do
+		for _, item := range tx.db.listItems {
+			if item.adventureID == adventureID {
+				return errConstraint
+			}
+		}
+		for _, report := range tx.db.reports {
+			if report.adventureID == adventureID {
+				return errConstraint
+			}
+		}
+		for _, log := range tx.db.logs {
+			if log.adventureID == adventureID {
+				return errConstraint
+			}
+		}
+
+		delete(tx.db.adventures, adventureID)
+		for id, node := range tx.db.nodes {
+			if node.AdventureID == adventureID {
+				delete(tx.db.nodes, id)
+			}
+		}
+		for id, link := range tx.db.links {
+			if link.AdventureID == adventureID {
+				delete(tx.db.links, id)
+			}
+		}
+		for id, revision := range tx.db.revisions {
+			if revision.adventureID == adventureID {
+				delete(tx.db.revisions, id)
+			}
+		}
+		for slug, id := range tx.db.slugRedirects {
+			if id == adventureID {
+				delete(tx.db.slugRedirects, slug)
+			}
+		}
+		for key := range tx.db.mediaReferences {
+			if key.adventureID == adventureID {
+				delete(tx.db.mediaReferences, key)
+			}
+		}
+		for key := range tx.db.mediaUploads {
+			if key.adventureID == adventureID {
+				delete(tx.db.mediaUploads, key)
+			}
+		}
+		for id, session := range tx.db.playSessions {
+			if session.adventureID == adventureID {
+				delete(tx.db.playSessions, id)
+			}
+		}
+
+		memberships := []membership{}
+		for _, m := range tx.db.memberships {
+			if m.adventureID != adventureID {
+				memberships = append(memberships, m)
+			}
+		}
+		tx.db.memberships = memberships
+
+		return nil
+	})
+}
+
+// CountViewAdventure increments the view counter of an adventure
+func (s *MemStore) CountViewAdventure(adventureID int64) error {
+	return s.locked(func(tx *MemStore) error {
+		if row, exists := tx.db.adventures[adventureID]; exists {
+			row.viewCount++
+			tx.updateAdventureRow(row)
+		}
+		return nil
+	})
+}
+
+// bumpEditVersion increments edit_version if it still equals expectedVersion
+func (s *MemStore) bumpEditVersion(slug string, expectedVersion int64) error {
+	for _, row := range s.db.adventures {
+		if row.slug == slug && row.editVersion == expectedVersion {
+			row.editVersion++
+			s.updateAdventureRow(row)
+			return nil
+		}
+	}
+	return store.ErrVersionConflict
+}
+
+// updateAdventureRow saves row, setting updated_at like the trigger on the
+// adventure table does for every update
+func (s *MemStore) updateAdventureRow(row adventureRow) {
+	row.updatedAt = now()
+	s.db.adventures[row.id] = row
+}
+
+// GetAdventure retrieves an adventure along with its content
+func (s *MemStore) GetAdventure(slug string, permission models.Permission) (*models.Adventure, error) {
+	var adventure *models.Adventure
+	err := s.locked(func(tx *MemStore) error {
+		var found *adventureRow
+		for _, row := range tx.sortedAdventures() {
+			matches := false
+			switch permission {
+			case models.ReadOnly:
+				matches = row.viewSlug == slug
+			case models.ReadWrite:
+				matches = row.slug == slug
+			case models.Ignore:
+				matches = row.slug == slug || row.viewSlug == slug
+			}
+			if matches {
+				r := row
+				found = &r
+				break
+			}
+		}
+		if found == nil {
+			return sql.ErrNoRows
+		}
+
+		a := found.toModel()
+		a.Props = found.props
+		a.Category = models.Category{}
+		if found.categoryID.Valid {
+			if category, err := tx.GetCategory(found.categoryID.Int64); err == nil {
+				a.Category = *category
+			}
+		}
+
+		var err error
+		a.Nodes, a.Links, a.Users, err = tx.getAdventureContent(a.ID)
+		if err != nil {
+			return err
+		}
+
+		if slug == a.ViewSlug {
+			a.Permission = models.ReadOnly
+		} else {
+			a.Permission = models.ReadWrite
+		}
+
+		adventure = &a
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return adventure, nil
+}
+
+// GetAdventures retrieves the adventures of a list, in list order
+func (s *MemStore) GetAdventures(list string) ([]models.Adventure, error) {
+	adventures := []models.Adventure{}
+	err := s.locked(func(tx *MemStore) error {
+		items := []listItem{}
+		for _, item := range tx.db.listItems {
+			if l, exists := tx.db.lists[item.listID]; exists && l.title == list {
+				items = append(items, item)
+			}
+		}
+		sort.SliceStable(items, func(i, j int) bool { return items[i].ordinal < items[j].ordinal })
+
+		for _, item := range items {
+			row, exists := tx.db.adventures[item.adventureID]
+			if !exists || !row.categoryID.Valid {
+				continue
+			}
+			category, exists := tx.db.categories[row.categoryID.Int64]
+			if !exists {
+				continue
+			}
+
+			adventures = append(adventures, models.Adventure{
+				ID:          row.id,
+				Title:       row.title,
+				Description: row.description,
+				ViewSlug:    row.viewSlug,
+				UpdatedAt:   row.updatedAt,
+				CoverUrl:    row.coverURL,
+				Category: models.Category{
+					Title: category.title,
+					Icon:  category.icon,
+					Image: category.image,
+				},
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return adventures, nil
+}
+
+// GetAdventuresByCategory retrieves adventures by category
+func (s *MemStore) GetAdventuresByCategory(categoryID, pageSize, pageIndex int64) ([]models.Adventure, int64, error) {
+	adventures := []models.Adventure{}
+	var count int64
+	err := s.locked(func(tx *MemStore) error {
+		matches := []adventureRow{}
+		for _, row := range tx.sortedAdventures() {
+			if categoryID == 0 && !row.categoryID.Valid {
+				count++
+			}
+			if row.categoryID.Valid && row.categoryID.Int64 == categoryID {
+				if categoryID != 0 {
+					count++
+				}
+				matches = append(matches, row)
+			}
+		}
+		if count == 0 {
+			return nil
+		}
+
+		for _, row := range page(matches, pageSize, pageIndex) {
+			adventures = append(adventures, row.toModel())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return adventures, count, nil
+}
+
+// GetAdventuresBySearchString retrieves adventures where the title,
+// description, a node or a link contains the search string
+func (s *MemStore) GetAdventuresBySearchString(searchString string, pageSize, pageIndex int64) ([]models.Adventure, int64, error) {
+	adventures := []models.Adventure{}
+	var count int64
+	err := s.locked(func(tx *MemStore) error {
+		search := strings.ToLower(searchString)
+		like := func(value string) bool {
+			return strings.Contains(strings.ToLower(value), search)
+		}
+
+		matching := make(map[int64]bool)
+		for _, node := range tx.db.nodes {
+			if like(node.Content) || like(node.Title) {
+				matching[node.AdventureID] = true
+			}
+		}
+		for _, link := range tx.db.links {
+			if like(link.SourceLinkTitle) || like(link.TargetLinkTitle) {
+				matching[link.AdventureID] = true
+			}
+		}
+
+		matches := []adventureRow{}
+		for _, row := range tx.sortedAdventures() {
+			if like(row.title) || like(row.description) || matching[row.id] {
+				matches = append(matches, row)
+			}
+		}
+
+		count = int64(len(matches))
+		for _, row := range page(matches, pageSize, pageIndex) {
+			adventures = append(adventures, row.toModel())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return adventures, count, nil
+}
+
+// GetAdventureIDs returns the id of every adventure
+func (s *MemStore) GetAdventureIDs() ([]int64, error) {
+	ids := []int64{}
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.sortedAdventures() {
+			ids = append(ids, row.id)
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// GetAdventureByID retrieves an adventure along with its content
+func (s *MemStore) GetAdventureByID(adventureID int64) (*models.Adventure, error) {
+	var adventure *models.Adventure
+	err := s.locked(func(tx *MemStore) error {
+		row, exists := tx.db.adventures[adventureID]
+		if !exists {
+			return sql.ErrNoRows
+		}
+
+		a := &models.Adventure{
+			ID:          row.id,
+			Title:       row.title,
+			Description: row.description,
+			Slug:        row.slug,
+			ViewSlug:    row.viewSlug,
+			Locked:      row.locked,
+			ViewCount:   row.viewCount,
+			CoverUrl:    row.coverURL,
+		}
+		if row.categoryID.Valid {
+			if category, err := tx.GetCategory(row.categoryID.Int64); err == nil {
+				a.Category = *category
+			}
+		}
+
+		var err error
+		a.Nodes, a.Links, a.Users, err = tx.getAdventureContent(a.ID)
+		if err != nil {
+			return err
+		}
+
+		adventure = a
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return adventure, nil
+}
+
+// GetAdventuresByReportReason retrieves reported adventures
+func (s *MemStore) GetAdventuresByReportReason(reportReason string, pageSize, pageIndex int64) ([]models.Adventure, int64, error) {
+	adventures := []models.Adventure{}
+	var count int64
+	err := s.locked(func(tx *MemStore) error {
+		reported := make(map[int64]bool)
+		for _, report := range tx.db.reports {
+			if report.reportReason == reportReason {
+				// Like the SQL store, the count is the number of reports
+				count++
+				reported[report.adventureID] = true
+			}
+		}
+		if count == 0 {
+			return nil
+		}
+
+		matches := []adventureRow{}
+		for _, row := range tx.sortedAdventures() {
+			if reported[row.id] {
+				matches = append(matches, row)
+			}
+		}
+
+		for _, row := range page(matches, pageSize, pageIndex) {
+			adventures = append(adventures, row.toModel())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return adventures, count, nil
+}
+
+// getAdventureContent retrieves all related entities to adventure
+func (s *MemStore) getAdventureContent(adventureID int64) ([]models.Node, []models.Link, []models.User, error) {
+	nodes, err := s.GetNodesByAdventureID(adventureID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	links, err := s.GetLinksByAdventureID(adventureID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	users, err := s.GetUsersByAdventureID(adventureID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return nodes, links, users, nil
+}
+
+// sortedAdventures returns all adventures ordered by id
+func (s *MemStore) sortedAdventures() []adventureRow {
+	rows := make([]adventureRow, 0, len(s.db.adventures))
+	for _, row := range s.db.adventures {
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].id < rows[j].id })
+	return rows
+}
+
+// toModel returns the fields the SQL store reads for lists of adventures
+func (row adventureRow) toModel() models.Adventure {
+	a := models.Adventure{
+		ID:          row.id,
+		Title:       row.title,
+		Description: row.description,
+		Slug:        row.slug,
+		ViewSlug:    row.viewSlug,
+		Locked:      row.locked,
+		CreatedAt:   row.createdAt,
+		UpdatedAt:   row.updatedAt,
+		EditVersion: row.editVersion,
+		ViewCount:   row.viewCount,
+		CoverUrl:    row.coverURL,
+	}
+	if row.categoryID.Valid {
+		a.Category.ID = row.categoryID.Int64
+	}
+	return a
+}
+
+// page applies LIMIT pageSize OFFSET (pageIndex-1)*pageSize
+func page(rows []adventureRow, pageSize, pageIndex int64) []adventureRow {
+	offset := (pageIndex - 1) * pageSize
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= int64(len(rows)) {
+		return nil
+	}
+
+	rows = rows[offset:]
+	if pageSize >= 0 && pageSize < int64(len(rows)) {
+		rows = rows[:pageSize]
+	}
+	return rows
+}
+
+func containsUser(users []models.User, id int64) bool {
+	for _, user := range users {
+		if user.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsNode(nodes []models.Node, id int64) bool {
+	for _, node := range nodes {
+		if node.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsLink(links []models.Link, id int64) bool {
+	for _, link := range links {
+		if link.ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package memstore
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"projektps/models"
+)
+
+type categoryRow struct {
+	id          int64
+	sortOrder   int64
+	title       string
+	description string
+	icon        string
+	image       string
+	createdAt   time.Time
+}
+
+func (row categoryRow) toModel() models.Category {
+	return models.Category{
+		ID:          row.id,
+		SortOrder:   row.sortOrder,
+		Title:       row.title,
+		Description: row.description,
+		Icon:        row.icon,
+		Image:       row.image,
+	}
+}
+
+// GetCategories retrieves all categories
+func (s *MemStore) GetCategories() ([]models.Category, error) {
+	categories := []models.Category{}
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.db.categories {
+			categories = append(categories, row.toModel())
+		}
+		sort.SliceStable(categories, func(i, j int) bool {
+			if categories[i].SortOrder != categories[j].SortOrder {
+				return categories[i].SortOrder < categories[j].SortOrder
+			}
+			return categories[i].ID < categories[j].ID
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+// GetCategory retrieves a single category
+func (s *MemStore) GetCategory(categoryID int64) (*models.Category, error) {
+	var category models.Category
+	err := s.locked(func(tx *MemStore) error {
+		row, exists := tx.db.categories[categoryID]
+		if !exists {
+			return sql.ErrNoRows
+		}
+		category = row.toModel()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &category, nil
+}
+
+// CreateNewCategory creates a new category
+func (s *MemStore) CreateNewCategory(category *models.Category) (*models.Category, error) {
+	err := s.locked(func(tx *MemStore) error {
+		category.ID = tx.db.nextID("adventure_category")
+		tx.db.categories[category.ID] = categoryRow{
+			id:        category.ID,
+			sortOrder: category.SortOrder,
+			title:     category.Title,
+			icon:      category.Icon,
+			createdAt: now(),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return category, nil
+}
+
+// UpdateCategory updates an existing category
+func (s *MemStore) UpdateCategory(category *models.Category) error {
+	return s.locked(func(tx *MemStore) error {
+		if row, exists := tx.db.categories[category.ID]; exists {
+			row.title = category.Title
+			row.icon = category.Icon
+			row.sortOrder = category.SortOrder
+			tx.db.categories[category.ID] = row
+		}
+		return nil
+	})
+}
+
+// DeleteCategory removes a category, adventures in it are left without category
+func (s *MemStore) DeleteCategory(category *models.Category) error {
+	return s.locked(func(tx *MemStore) error {
+		for _, row := range tx.sortedAdventures() {
+			if row.categoryID.Valid && row.categoryID.Int64 == category.ID {
+				row.categoryID = sql.NullInt64{}
+				tx.updateAdventureRow(row)
+			}
+		}
+
+		delete(tx.db.categories, category.ID)
+		return nil
+	})
+}
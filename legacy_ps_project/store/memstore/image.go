@@ -0,0 +1,123 @@
+package memstore
+
+import (
+	"database/sql"
+	"sort"
+
+	"projektps/models"
+)
+
+type imageRow = models.Image
+
+// CreateNewImage stores an image
+func (s *MemStore) CreateNewImage(image *models.Image) (*models.Image, error) {
+	err := s.locked(func(tx *MemStore) error {
+		row := *image
+		row.ID = tx.db.nextID("image_item")
+		row.CreatedAt = now()
+		tx.db.images[row.ID] = row
+
+		image.ID = row.ID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// UpdateImage updates an image
+func (s *MemStore) UpdateImage(image *models.Image) error {
+	return s.locked(func(tx *MemStore) error {
+		row, exists := tx.db.images[image.ID]
+		if !exists {
+			return nil
+		}
+
+		createdAt := row.CreatedAt
+		row = *image
+		row.CreatedAt = createdAt
+		tx.db.images[image.ID] = row
+		return nil
+	})
+}
+
+// DeleteImage removes an image and all references to it from nodes
+func (s *MemStore) DeleteImage(image models.Image) error {
+	return s.locked(func(tx *MemStore) error {
+		for id, node := range tx.db.nodes {
+			if node.ImageID == image.ID {
+				node.ImageID = 0
+				tx.db.nodes[id] = node
+			}
+		}
+
+		delete(tx.db.images, image.ID)
+		return nil
+	})
+}
+
+// GetImage retrieves an image
+func (s *MemStore) GetImage(imageID int64) (*models.Image, error) {
+	var image models.Image
+	err := s.locked(func(tx *MemStore) error {
+		row, exists := tx.db.images[imageID]
+		if !exists {
+			return sql.ErrNoRows
+		}
+		image = row
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &image, nil
+}
+
+// GetImageByUnsplashID retrieves an image by its Unsplash id
+func (s *MemStore) GetImageByUnsplashID(unsplashID string) (*models.Image, error) {
+	var image models.Image
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.sortedImages() {
+			if row.UnsplashID == unsplashID {
+				image = row
+				return nil
+			}
+		}
+		return sql.ErrNoRows
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &image, nil
+}
+
+// GetImagesByCategory retrieves the active images of a category
+func (s *MemStore) GetImagesByCategory(categoryID int64) ([]models.Image, error) {
+	images := []models.Image{}
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.sortedImages() {
+			if row.CategoryID == categoryID && row.Active {
+				images = append(images, row)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+func (s *MemStore) sortedImages() []imageRow {
+	rows := make([]imageRow, 0, len(s.db.images))
+	for _, row := range s.db.images {
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+	return rows
+}
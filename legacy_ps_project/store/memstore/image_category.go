@@ -0,0 +1,137 @@
+package memstore
+
+import (
+	"database/sql"
+	"sort"
+	"strconv"
+
+	"projektps/models"
+)
+
+type imageCategoryRow = models.ImageCategory
+
+// CreateNewImageCategory stores an image category
+func (s *MemStore) CreateNewImageCategory(category *models.ImageCategory) (*models.ImageCategory, error) {
+	err := s.locked(func(tx *MemStore) error {
+		category.ID = tx.db.nextID("image_category")
+		tx.db.imageCategories[category.ID] = imageCategoryRow{
+			ID:         category.ID,
+			Active:     category.Active,
+			Title:      category.Title,
+			UnsplashID: category.UnsplashID,
+			CreatedAt:  now(),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return category, nil
+}
+
+// UpdateImageCategory updates an image category
+func (s *MemStore) UpdateImageCategory(category *models.ImageCategory) error {
+	return s.locked(func(tx *MemStore) error {
+		row, exists := tx.db.imageCategories[category.ID]
+		if !exists {
+			return nil
+		}
+
+		row.Active = category.Active
+		row.Title = category.Title
+		row.UnsplashID = category.UnsplashID
+		tx.db.imageCategories[category.ID] = row
+		return nil
+	})
+}
+
+// DeleteImageCategory removes an image category along with its images
+func (s *MemStore) DeleteImageCategory(category models.ImageCategory) error {
+	return s.locked(func(tx *MemStore) error {
+		for id, image := range tx.db.images {
+			if image.CategoryID != category.ID {
+				continue
+			}
+
+			for nodeID, node := range tx.db.nodes {
+				if node.ImageID == id {
+					node.ImageID = 0
+					node.ImageLayoutType = ""
+					tx.db.nodes[nodeID] = node
+				}
+			}
+			delete(tx.db.images, id)
+		}
+
+		delete(tx.db.imageCategories, category.ID)
+		return nil
+	})
+}
+
+// GetImageCategory retrieves an image category
+func (s *MemStore) GetImageCategory(categoryID string) (*models.ImageCategory, error) {
+	id, err := strconv.ParseInt(categoryID, 10, 64)
+	if err != nil {
+		return nil, sql.ErrNoRows
+	}
+
+	return s.findImageCategory(func(row imageCategoryRow) bool { return row.ID == id })
+}
+
+// GetImageCategoryByUnsplashID retrieves an image category by its Unsplash id
+func (s *MemStore) GetImageCategoryByUnsplashID(unsplashID string) (*models.ImageCategory, error) {
+	id, err := strconv.ParseInt(unsplashID, 10, 64)
+	if err != nil {
+		return nil, sql.ErrNoRows
+	}
+
+	return s.findImageCategory(func(row imageCategoryRow) bool { return row.UnsplashID == id })
+}
+
+// GetImageCategories retrieves the active image categories, or all of them
+// if fetchAll is set, ordered by title
+func (s *MemStore) GetImageCategories(fetchAll bool) ([]models.ImageCategory, error) {
+	categories := []models.ImageCategory{}
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.sortedImageCategories() {
+			if row.Active || fetchAll {
+				categories = append(categories, row)
+			}
+		}
+		sort.SliceStable(categories, func(i, j int) bool { return categories[i].Title < categories[j].Title })
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+func (s *MemStore) findImageCategory(match func(row imageCategoryRow) bool) (*models.ImageCategory, error) {
+	var category models.ImageCategory
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.sortedImageCategories() {
+			if match(row) {
+				category = row
+				return nil
+			}
+		}
+		return sql.ErrNoRows
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &category, nil
+}
+
+func (s *MemStore) sortedImageCategories() []imageCategoryRow {
+	rows := make([]imageCategoryRow, 0, len(s.db.imageCategories))
+	for _, row := range s.db.imageCategories {
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+	return rows
+}
@@ -0,0 +1,112 @@
+package memstore
+
+import (
+	"database/sql"
+	"sort"
+
+	"projektps/models"
+)
+
+// linkRow is a link as stored in adventure_link
+type linkRow = models.Link
+
+// CreateNewLink creates a new link
+func (s *MemStore) CreateNewLink(link *models.Link) (*models.Link, error) {
+	err := s.locked(func(tx *MemStore) error {
+		if _, exists := tx.db.adventures[link.AdventureID]; !exists {
+			return errConstraint
+		}
+
+		link.ID = tx.db.nextID("adventure_link")
+
+		row := *link
+		row.Changed = false
+		tx.db.links[link.ID] = row
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// UpdateLink updates an existing link
+func (s *MemStore) UpdateLink(link *models.Link) error {
+	return s.locked(func(tx *MemStore) error {
+		row, exists := tx.db.links[link.ID]
+		if !exists || row.AdventureID != link.AdventureID {
+			return nil
+		}
+
+		row.SourceNodeID = link.SourceNodeID
+		row.SourceLinkTitle = link.SourceLinkTitle
+		row.TargetNodeID = link.TargetNodeID
+		row.TargetLinkTitle = link.TargetLinkTitle
+		row.LinkType = link.LinkType
+		row.Props = link.Props
+		tx.db.links[link.ID] = row
+		return nil
+	})
+}
+
+// DeleteLink removes a link
+func (s *MemStore) DeleteLink(link *models.Link) error {
+	return s.locked(func(tx *MemStore) error {
+		row, exists := tx.db.links[link.ID]
+		if exists && row.AdventureID == link.AdventureID && row.LinkID == link.LinkID {
+			delete(tx.db.links, link.ID)
+		}
+		return nil
+	})
+}
+
+// GetLink retrieves a single link by its link_id within an adventure
+func (s *MemStore) GetLink(adventureID int64, linkID int64) (*models.Link, error) {
+	var link *models.Link
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.linksOf(adventureID) {
+			if row.LinkID == linkID {
+				l := row
+				link = &l
+				return nil
+			}
+		}
+		return sql.ErrNoRows
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// GetLinksByAdventureID retrieves all links in a specific adventure
+func (s *MemStore) GetLinksByAdventureID(adventureID int64) ([]models.Link, error) {
+	links := []models.Link{}
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.linksOf(adventureID) {
+			// The SQL store does not read adventure_id for lists of links
+			row.AdventureID = 0
+			links = append(links, row)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// linksOf returns the links of an adventure in insertion order
+func (s *MemStore) linksOf(adventureID int64) []linkRow {
+	links := []linkRow{}
+	for _, row := range s.db.links {
+		if row.AdventureID == adventureID {
+			links = append(links, row)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].ID < links[j].ID })
+	return links
+}
@@ -0,0 +1,201 @@
+package memstore
+
+import (
+	"database/sql"
+	"sort"
+
+	"projektps/models"
+)
+
+// GetList retrieves a list by its slug
+func (s *MemStore) GetList(listSlug string) (*models.List, error) {
+	var list *models.List
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.sortedLists() {
+			if row.title == listSlug {
+				list = &models.List{
+					ID:          row.id,
+					Title:       row.title,
+					Description: row.description,
+					ParentID:    row.parentID,
+				}
+				return nil
+			}
+		}
+		return sql.ErrNoRows
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// GetListByID retrieves a list by its ID along with its adventures
+func (s *MemStore) GetListByID(listID int64) (*models.List, error) {
+	var list *models.List
+	err := s.locked(func(tx *MemStore) error {
+		row, exists := tx.db.lists[listID]
+		if !exists {
+			return sql.ErrNoRows
+		}
+
+		list = &models.List{
+			ID:          row.id,
+			Title:       row.title,
+			Description: row.description,
+			ParentID:    row.parentID,
+			CreatedAt:   row.createdAt,
+			Adventures:  tx.adventuresInList(listID),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// GetListsByParent retrieves all lists by their parents slug
+func (s *MemStore) GetListsByParent(listSlug string) ([]models.List, error) {
+	lists := []models.List{}
+	err := s.locked(func(tx *MemStore) error {
+		parentList, err := tx.GetList(listSlug)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range tx.sortedLists() {
+			if row.parentID == parentList.ID {
+				lists = append(lists, row.toModel())
+			}
+		}
+		sort.SliceStable(lists, func(i, j int) bool { return lists[i].Title < lists[j].Title })
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+// GetLists retrieves all lists
+func (s *MemStore) GetLists() ([]models.List, error) {
+	lists := []models.List{}
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.sortedLists() {
+			lists = append(lists, row.toModel())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+// CreateNewList creates a new list
+func (s *MemStore) CreateNewList(list *models.List) (*models.List, error) {
+	err := s.locked(func(tx *MemStore) error {
+		list.ID = tx.db.nextID("adventure_list")
+		tx.db.lists[list.ID] = listRow{
+			id:          list.ID,
+			parentID:    list.ParentID,
+			title:       list.Title,
+			description: list.Description,
+			createdAt:   now(),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// UpdateList updates a list and replaces its items
+func (s *MemStore) UpdateList(list *models.List) error {
+	return s.locked(func(tx *MemStore) error {
+		if row, exists := tx.db.lists[list.ID]; exists {
+			row.title = list.Title
+			row.description = list.Description
+			row.parentID = list.ParentID
+			tx.db.lists[list.ID] = row
+		}
+
+		items := tx.itemsNotInList(list.ID)
+		added := make(map[int64]bool)
+		for i, adventure := range list.Adventures {
+			_, listExists := tx.db.lists[list.ID]
+			_, adventureExists := tx.db.adventures[adventure.ID]
+			if !listExists || !adventureExists || added[adventure.ID] {
+				return errConstraint
+			}
+			added[adventure.ID] = true
+			items = append(items, listItem{listID: list.ID, adventureID: adventure.ID, ordinal: int64(i)})
+		}
+		tx.db.listItems = items
+		return nil
+	})
+}
+
+// DeleteListByID removes a list and its items
+func (s *MemStore) DeleteListByID(listID int64) error {
+	return s.locked(func(tx *MemStore) error {
+		tx.db.listItems = tx.itemsNotInList(listID)
+		delete(tx.db.lists, listID)
+		return nil
+	})
+}
+
+func (s *MemStore) itemsNotInList(listID int64) []listItem {
+	items := []listItem{}
+	for _, item := range s.db.listItems {
+		if item.listID != listID {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// adventuresInList returns the adventures of a list in list order
+func (s *MemStore) adventuresInList(listID int64) []models.Adventure {
+	items := []listItem{}
+	for _, item := range s.db.listItems {
+		if item.listID == listID {
+			items = append(items, item)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].ordinal < items[j].ordinal })
+
+	adventures := []models.Adventure{}
+	for _, item := range items {
+		if row, exists := s.db.adventures[item.adventureID]; exists {
+			adventures = append(adventures, row.toModel())
+		}
+	}
+	return adventures
+}
+
+func (s *MemStore) sortedLists() []listRow {
+	rows := make([]listRow, 0, len(s.db.lists))
+	for _, row := range s.db.lists {
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].id < rows[j].id })
+	return rows
+}
+
+func (row listRow) toModel() models.List {
+	return models.List{
+		ID:          row.id,
+		Title:       row.title,
+		Description: row.description,
+		ParentID:    row.parentID,
+		CreatedAt:   row.createdAt,
+	}
+}
@@ -0,0 +1,62 @@
+package memstore
+
+import (
+	"sort"
+	"strconv"
+
+	"projektps/models"
+)
+
+// LogVisitedNode logs a visit to a node
+func (s *MemStore) LogVisitedNode(nodeId string, adventureId int64) error {
+	return s.locked(func(tx *MemStore) error {
+		tx.db.logs = append(tx.db.logs, logRow{
+			id:          tx.db.nextID("adventure_log"),
+			createdAt:   now(),
+			logType:     0,
+			data:        nodeId,
+			adventureID: adventureId,
+		})
+		return nil
+	})
+}
+
+// GetStatisticsByAdventureID counts the visits per node between startTime
+// and stopTime, which are compared as "YYYY-MM-DD hh:mm:ss" strings like the
+// SQL store does
+func (s *MemStore) GetStatisticsByAdventureID(adventureId int64, startTime string, stopTime string) ([]models.NodeStat, error) {
+	nodeStats := []models.NodeStat{}
+	err := s.locked(func(tx *MemStore) error {
+		nodes := make(map[string]nodeRow)
+		for _, node := range tx.nodesOf(adventureId) {
+			nodes[strconv.FormatInt(node.NodeID, 10)] = node
+		}
+
+		counts := make(map[string]int64)
+		for _, log := range tx.db.logs {
+			createdAt := log.createdAt.Format("2006-01-02 15:04:05")
+			if log.adventureID != adventureId || log.logType != 0 || createdAt < startTime || createdAt > stopTime {
+				continue
+			}
+			if _, exists := nodes[log.data]; exists {
+				counts[log.data]++
+			}
+		}
+
+		for data, count := range counts {
+			node := nodes[data]
+			nodeStats = append(nodeStats, models.NodeStat{
+				NodeId:     node.NodeID,
+				Title:      node.Title,
+				VisitCount: count,
+			})
+		}
+		sort.Slice(nodeStats, func(i, j int) bool { return nodeStats[i].NodeId < nodeStats[j].NodeId })
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return nodeStats, nil
+}
@@ -0,0 +1,205 @@
+package memstore
+
+import (
+	"database/sql"
+	"sort"
+
+	"projektps/models"
+)
+
+// CreateMedia records an uploaded file, or returns the record of the file
+// with the same hash if there is one
+func (s *MemStore) CreateMedia(media *models.Media) (*models.Media, error) {
+	var created *models.Media
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.db.media {
+			if row.hash == media.Hash {
+				created = tx.mediaModel(row)
+				return nil
+			}
+		}
+
+		row := mediaRow{
+			id:          tx.db.nextID("media"),
+			hash:        media.Hash,
+			url:         media.URL,
+			size:        media.Size,
+			contentType: media.ContentType,
+			createdAt:   now(),
+			width:       media.Width,
+			height:      media.Height,
+			thumbnail:   media.Thumbnail,
+			variants:    append([]models.MediaVariant(nil), media.Variants...),
+		}
+		tx.db.media[row.id] = row
+		created = tx.mediaModel(row)
+		return nil
+	})
+	return created, err
+}
+
+// GetMediaByHash returns the record of the file with the SHA-256 hash
+func (s *MemStore) GetMediaByHash(hash string) (*models.Media, error) {
+	var media *models.Media
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.db.media {
+			if row.hash == hash {
+				media = tx.mediaModel(row)
+				return nil
+			}
+		}
+		return sql.ErrNoRows
+	})
+	return media, err
+}
+
+// GetMedia returns the records of every uploaded file, oldest first
+func (s *MemStore) GetMedia() ([]models.Media, error) {
+	media := []models.Media{}
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.db.media {
+			media = append(media, *tx.mediaModel(row))
+		}
+		return nil
+	})
+	sort.Slice(media, func(i, j int) bool { return media[i].ID < media[j].ID })
+	return media, err
+}
+
+// UpdateMedia saves the size, type and variants of a file that was
+// processed again
+func (s *MemStore) UpdateMedia(media *models.Media) error {
+	return s.locked(func(tx *MemStore) error {
+		row, exists := tx.db.media[media.ID]
+		if !exists {
+			return sql.ErrNoRows
+		}
+		row.size = media.Size
+		row.contentType = media.ContentType
+		row.width = media.Width
+		row.height = media.Height
+		row.thumbnail = media.Thumbnail
+		row.variants = append([]models.MediaVariant(nil), media.Variants...)
+		tx.db.media[media.ID] = row
+		return nil
+	})
+}
+
+// DeleteMedia removes the record of a file along with its references
+func (s *MemStore) DeleteMedia(mediaID int64) error {
+	return s.locked(func(tx *MemStore) error {
+		delete(tx.db.media, mediaID)
+		for key := range tx.db.mediaReferences {
+			if key.mediaID == mediaID {
+				delete(tx.db.mediaReferences, key)
+			}
+		}
+		for key := range tx.db.mediaUploads {
+			if key.mediaID == mediaID {
+				delete(tx.db.mediaUploads, key)
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateMediaReferences counts the references of an adventure again
+func (s *MemStore) UpdateMediaReferences(adventureID int64) error {
+	return s.transaction(func(tx *MemStore) error {
+		row, exists := tx.db.adventures[adventureID]
+		if !exists {
+			return sql.ErrNoRows
+		}
+		adventure, err := tx.GetAdventure(row.slug, models.ReadWrite)
+		if err != nil {
+			return err
+		}
+		return tx.updateMediaReferences(adventure)
+	})
+}
+
+// updateMediaReferences replaces the references of adventure with the ones
+// of its content. Files without a record are not counted. The uploads of the
+// files it referred to are removed, see store.MediaRecords.
+func (s *MemStore) updateMediaReferences(adventure *models.Adventure) error {
+	references := adventure.MediaReferences()
+	return s.locked(func(tx *MemStore) error {
+		for key := range tx.db.mediaReferences {
+			if key.adventureID == adventure.ID {
+				delete(tx.db.mediaUploads, key)
+				delete(tx.db.mediaReferences, key)
+			}
+		}
+		for _, row := range tx.db.media {
+			if count, exists := references[row.hash]; exists {
+				tx.db.mediaReferences[mediaReference{mediaID: row.id, adventureID: adventure.ID}] = count
+			}
+		}
+		return nil
+	})
+}
+
+// AddMediaUpload records that a file was uploaded to an adventure
+func (s *MemStore) AddMediaUpload(mediaID int64, adventureID int64) error {
+	return s.locked(func(tx *MemStore) error {
+		if _, exists := tx.db.media[mediaID]; !exists {
+			return errConstraint
+		}
+		if _, exists := tx.db.adventures[adventureID]; !exists {
+			return errConstraint
+		}
+		key := mediaReference{mediaID: mediaID, adventureID: adventureID}
+		if _, exists := tx.db.mediaUploads[key]; !exists {
+			tx.db.mediaUploads[key] = now()
+		}
+		return nil
+	})
+}
+
+// RemoveMediaUpload removes the upload of a file to an adventure
+func (s *MemStore) RemoveMediaUpload(mediaID int64, adventureID int64) error {
+	return s.locked(func(tx *MemStore) error {
+		delete(tx.db.mediaUploads, mediaReference{mediaID: mediaID, adventureID: adventureID})
+		return nil
+	})
+}
+
+// GetAdventureMedia returns the files that were uploaded to an adventure or
+// that it refers to, each once
+func (s *MemStore) GetAdventureMedia(adventureID int64) ([]models.Media, error) {
+	media := []models.Media{}
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.db.media {
+			key := mediaReference{mediaID: row.id, adventureID: adventureID}
+			_, uploaded := tx.db.mediaUploads[key]
+			_, referred := tx.db.mediaReferences[key]
+			if uploaded || referred {
+				media = append(media, *tx.mediaModel(row))
+			}
+		}
+		return nil
+	})
+	sort.Slice(media, func(i, j int) bool { return media[i].ID < media[j].ID })
+	return media, err
+}
+
+func (s *MemStore) mediaModel(row mediaRow) *models.Media {
+	media := &models.Media{
+		ID:          row.id,
+		Hash:        row.hash,
+		URL:         row.url,
+		Size:        row.size,
+		ContentType: row.contentType,
+		CreatedAt:   row.createdAt,
+		Width:       row.width,
+		Height:      row.height,
+		Thumbnail:   row.thumbnail,
+		Variants:    append([]models.MediaVariant(nil), row.variants...),
+	}
+	for key, count := range s.db.mediaReferences {
+		if key.mediaID == row.id {
+			media.RefCount += count
+		}
+	}
+	return media
+}
@@ -0,0 +1,14 @@
+package memstore
+
+import (
+	"testing"
+
+	"projektps/store"
+	"projektps/store/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return NewStore()
+	})
+}
@@ -0,0 +1,116 @@
+package memstore
+
+import (
+	"database/sql"
+	"sort"
+
+	"projektps/models"
+)
+
+// nodeRow is a node as stored in adventure_node
+type nodeRow = models.Node
+
+// CreateNewNode creates a new node
+func (s *MemStore) CreateNewNode(node *models.Node) (*models.Node, error) {
+	err := s.locked(func(tx *MemStore) error {
+		if _, exists := tx.db.adventures[node.AdventureID]; !exists {
+			return errConstraint
+		}
+
+		node.ID = tx.db.nextID("adventure_node")
+
+		row := *node
+		row.Changed = false
+		tx.db.nodes[node.ID] = row
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+// UpdateNode updates an existing node
+func (s *MemStore) UpdateNode(node *models.Node) error {
+	return s.locked(func(tx *MemStore) error {
+		row, exists := tx.db.nodes[node.ID]
+		if !exists || row.AdventureID != node.AdventureID {
+			return nil
+		}
+
+		row.Title = node.Title
+		row.Icon = node.Icon
+		row.Content = node.Content
+		row.ImageURL = node.ImageURL
+		row.ImageID = node.ImageID
+		row.ImageLayoutType = node.ImageLayoutType
+		row.X = node.X
+		row.Y = node.Y
+		row.Props = node.Props
+		tx.db.nodes[node.ID] = row
+		return nil
+	})
+}
+
+// DeleteNode removes a node
+func (s *MemStore) DeleteNode(node *models.Node) error {
+	return s.locked(func(tx *MemStore) error {
+		row, exists := tx.db.nodes[node.ID]
+		if exists && row.AdventureID == node.AdventureID && row.NodeID == node.NodeID {
+			delete(tx.db.nodes, node.ID)
+		}
+		return nil
+	})
+}
+
+// GetNode retrieves a single node by its node_id within an adventure
+func (s *MemStore) GetNode(adventureID int64, nodeID int64) (*models.Node, error) {
+	var node *models.Node
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.nodesOf(adventureID) {
+			if row.NodeID == nodeID {
+				n := row
+				n.AdventureID = adventureID
+				node = &n
+				return nil
+			}
+		}
+		return sql.ErrNoRows
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+// GetNodesByAdventureID retrieves all nodes in a specific adventure
+func (s *MemStore) GetNodesByAdventureID(adventureID int64) ([]models.Node, error) {
+	nodes := []models.Node{}
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.nodesOf(adventureID) {
+			// The SQL store does not read adventure_id for lists of nodes
+			row.AdventureID = 0
+			nodes = append(nodes, row)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
+// nodesOf returns the nodes of an adventure in insertion order
+func (s *MemStore) nodesOf(adventureID int64) []nodeRow {
+	nodes := []nodeRow{}
+	for _, row := range s.db.nodes {
+		if row.AdventureID == adventureID {
+			nodes = append(nodes, row)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
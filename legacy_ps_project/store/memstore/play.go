@@ -0,0 +1,294 @@
+package memstore
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"projektps/models"
+)
+
+// CreatePlaySession records a new session, a session with the same id is
+// left as it is
+func (s *MemStore) CreatePlaySession(session *models.PlaySession) error {
+	return s.locked(func(tx *MemStore) error {
+		session.StartedAt = now()
+		session.UpdatedAt = session.StartedAt
+		if _, exists := tx.db.playSessions[session.ID]; exists {
+			return nil
+		}
+		if _, exists := tx.db.adventures[session.AdventureID]; !exists {
+			return errConstraint
+		}
+		tx.db.playSessions[session.ID] = playSessionRow{
+			id:          session.ID,
+			adventureID: session.AdventureID,
+			startedAt:   session.StartedAt,
+			updatedAt:   session.UpdatedAt,
+		}
+		return nil
+	})
+}
+
+// GetPlaySession returns a session with its events
+func (s *MemStore) GetPlaySession(id string) (*models.PlaySession, error) {
+	var session *models.PlaySession
+	err := s.locked(func(tx *MemStore) error {
+		row, exists := tx.db.playSessions[id]
+		if !exists {
+			return sql.ErrNoRows
+		}
+		session = row.toModel()
+		return nil
+	})
+	return session, err
+}
+
+// AddPlayEvents adds events to the end of a session
+func (s *MemStore) AddPlayEvents(id string, events []models.PlayEvent) error {
+	return s.locked(func(tx *MemStore) error {
+		row, exists := tx.db.playSessions[id]
+		if !exists {
+			return sql.ErrNoRows
+		}
+		for _, event := range events {
+			for _, existing := range row.events {
+				if existing.Seq == event.Seq {
+					return errConstraint
+				}
+			}
+		}
+		row.events = append(copyPlayEvents(row.events), copyPlayEvents(events)...)
+		sort.SliceStable(row.events, func(i, j int) bool { return row.events[i].Seq < row.events[j].Seq })
+		row.updatedAt = now()
+		tx.db.playSessions[id] = row
+		return nil
+	})
+}
+
+// CountPlaySessions counts the sessions of an adventure by how they ended
+func (s *MemStore) CountPlaySessions(adventureID int64, from time.Time, to time.Time, idle time.Duration) (*models.PlayCounts, error) {
+	counts := &models.PlayCounts{}
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.playSessionsOf(adventureID, from, to) {
+			counts.Sessions++
+			if row.ended() {
+				counts.Completed++
+			} else if row.abandoned(idle) {
+				counts.Abandoned++
+			}
+		}
+		return nil
+	})
+	return counts, err
+}
+
+// GetPlayNodeCounts returns the counts of the nodes shown in the sessions of
+// an adventure, by node id
+func (s *MemStore) GetPlayNodeCounts(adventureID int64, from time.Time, to time.Time, idle time.Duration) ([]models.PlayNodeCounts, error) {
+	nodes := make(map[int64]*models.PlayNodeCounts)
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.playSessionsOf(adventureID, from, to) {
+			concluded := row.ended() || row.abandoned(idle)
+			seen := make(map[int64]bool)
+			var last *int64
+			for i, event := range row.events {
+				if event.Type != models.PlayNode || event.NodeID == nil {
+					continue
+				}
+				nodeID := *event.NodeID
+				last = event.NodeID
+				if nodes[nodeID] == nil {
+					nodes[nodeID] = &models.PlayNodeCounts{NodeID: nodeID, Durations: []int64{}}
+				}
+				node := nodes[nodeID]
+				node.Visits++
+				if !seen[nodeID] {
+					seen[nodeID] = true
+					node.Sessions++
+					if concluded {
+						node.Concluded++
+					}
+				}
+				if i+1 < len(row.events) {
+					next := row.events[i+1]
+					if next.Type == models.PlayChoice || next.Type == models.PlayNode {
+						node.Durations = append(node.Durations, next.Offset-event.Offset)
+					}
+				}
+			}
+			if row.abandoned(idle) && last != nil {
+				nodes[*last].DropOffs++
+			}
+		}
+		return nil
+	})
+
+	counts := make([]models.PlayNodeCounts, 0, len(nodes))
+	for _, node := range nodes {
+		sort.Slice(node.Durations, func(i, j int) bool { return node.Durations[i] < node.Durations[j] })
+		counts = append(counts, *node)
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].NodeID < counts[j].NodeID })
+	return counts, err
+}
+
+// GetPlayPaths returns the paths the sessions of an adventure took
+func (s *MemStore) GetPlayPaths(adventureID int64, from time.Time, to time.Time) ([]models.PlayPathCounts, error) {
+	counts := []models.PlayPathCounts{}
+	err := s.locked(func(tx *MemStore) error {
+		index := make(map[string]int)
+		for _, row := range tx.playSessionsOf(adventureID, from, to) {
+			nodes := []int64{}
+			for _, event := range row.events {
+				if event.Type != models.PlayNode || event.NodeID == nil {
+					continue
+				}
+				if n := len(nodes); n > 0 && nodes[n-1] == *event.NodeID {
+					continue
+				}
+				nodes = append(nodes, *event.NodeID)
+			}
+
+			key := fmt.Sprint(nodes, row.ended())
+			if i, exists := index[key]; exists {
+				counts[i].Count++
+				continue
+			}
+			index[key] = len(counts)
+			counts = append(counts, models.PlayPathCounts{Nodes: nodes, Completed: row.ended(), Count: 1})
+		}
+		return nil
+	})
+	return counts, err
+}
+
+// GetPlayChoices returns the choices made in the sessions of an adventure,
+// by source, target and link
+func (s *MemStore) GetPlayChoices(adventureID int64, from time.Time, to time.Time) ([]models.PlayChoiceCounts, error) {
+	type choiceKey struct {
+		source, target, linkID int64
+	}
+	choices := make(map[choiceKey]*models.PlayChoiceCounts)
+	err := s.locked(func(tx *MemStore) error {
+		links := make(map[int64]linkRow)
+		for _, link := range tx.linksOf(adventureID) {
+			links[link.LinkID] = link
+		}
+
+		for _, row := range tx.playSessionsOf(adventureID, from, to) {
+			seen := make(map[choiceKey]bool)
+			var source *int64
+			for i, event := range row.events {
+				if event.Type == models.PlayNode {
+					source = event.NodeID
+				}
+				if event.Type != models.PlayChoice || event.LinkID == nil || source == nil {
+					continue
+				}
+
+				target, ok := choiceTarget(links, *source, *event.LinkID, row.events[i+1:])
+				if !ok {
+					continue
+				}
+				key := choiceKey{*source, target, *event.LinkID}
+				if choices[key] == nil {
+					choices[key] = &models.PlayChoiceCounts{Source: key.source, Target: key.target, LinkID: key.linkID}
+				}
+				choices[key].Value++
+				if !seen[key] {
+					seen[key] = true
+					choices[key].Sessions++
+				}
+			}
+		}
+		return nil
+	})
+
+	counts := make([]models.PlayChoiceCounts, 0, len(choices))
+	for _, choice := range choices {
+		counts = append(counts, *choice)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		a, b := counts[i], counts[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.LinkID < b.LinkID
+	})
+	return counts, err
+}
+
+// choiceTarget returns the node a link leads to from source, the node shown
+// after the choice when the link has been removed
+func choiceTarget(links map[int64]linkRow, source int64, linkID int64, after []models.PlayEvent) (int64, bool) {
+	if link, ok := links[linkID]; ok {
+		if link.SourceNodeID == source {
+			return link.TargetNodeID, true
+		}
+		if link.TargetNodeID == source && link.LinkType == "bidirectional" {
+			return link.SourceNodeID, true
+		}
+	}
+	for _, event := range after {
+		if event.Type == models.PlayNode && event.NodeID != nil {
+			return *event.NodeID, true
+		}
+	}
+	return 0, false
+}
+
+// playSessionsOf returns the sessions of an adventure that started from
+// from up to to
+func (s *MemStore) playSessionsOf(adventureID int64, from time.Time, to time.Time) []playSessionRow {
+	sessions := []playSessionRow{}
+	for _, row := range s.db.playSessions {
+		if row.adventureID == adventureID && !row.startedAt.Before(from) && !row.startedAt.After(to) {
+			sessions = append(sessions, row)
+		}
+	}
+	return sessions
+}
+
+// ended is true for a session that reached an end
+func (row playSessionRow) ended() bool {
+	return len(row.events) > 0 && row.events[len(row.events)-1].Type == models.PlayEnd
+}
+
+// abandoned is true for a session that has not ended and has had no events
+// for idle
+func (row playSessionRow) abandoned(idle time.Duration) bool {
+	return !row.ended() && !row.updatedAt.After(now().Add(-idle))
+}
+
+func (row playSessionRow) toModel() *models.PlaySession {
+	return &models.PlaySession{
+		ID:          row.id,
+		AdventureID: row.adventureID,
+		StartedAt:   row.startedAt,
+		UpdatedAt:   row.updatedAt,
+		Events:      copyPlayEvents(row.events),
+	}
+}
+
+// copyPlayEvents copies events with their node and link ids, which are
+// pointers
+func copyPlayEvents(events []models.PlayEvent) []models.PlayEvent {
+	copied := make([]models.PlayEvent, len(events))
+	for i, event := range events {
+		if event.NodeID != nil {
+			nodeID := *event.NodeID
+			event.NodeID = &nodeID
+		}
+		if event.LinkID != nil {
+			linkID := *event.LinkID
+			event.LinkID = &linkID
+		}
+		copied[i] = event
+	}
+	return copied
+}
@@ -0,0 +1,83 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	"projektps/models"
+)
+
+type reportRow struct {
+	id           int64
+	adventureID  int64
+	reportReason string
+	comment      string
+	isHandled    int64
+	createdAt    time.Time
+}
+
+// ReportAdventure reports an adventure
+func (s *MemStore) ReportAdventure(report *models.Report) (*models.Report, error) {
+	err := s.locked(func(tx *MemStore) error {
+		if _, exists := tx.db.adventures[report.AdventureID]; !exists && report.AdventureID != 0 {
+			return errConstraint
+		}
+
+		report.ID = tx.db.nextID("adventure_report")
+		tx.db.reports[report.ID] = reportRow{
+			id:           report.ID,
+			adventureID:  report.AdventureID,
+			reportReason: report.ReportReason,
+			comment:      report.Comment,
+			createdAt:    now(),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// GetReports returns all handled/unhandled reports, newest first
+func (s *MemStore) GetReports(isHandled bool) ([]models.Report, error) {
+	reports := []models.Report{}
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.db.reports {
+			if (row.isHandled != 0) != isHandled {
+				continue
+			}
+			reports = append(reports, models.Report{
+				ID:           row.id,
+				ReportReason: row.reportReason,
+				Comment:      row.comment,
+				IsHandled:    row.isHandled,
+				CreatedAt:    row.createdAt,
+			})
+		}
+		sort.Slice(reports, func(i, j int) bool {
+			if !reports[i].CreatedAt.Equal(reports[j].CreatedAt) {
+				return reports[i].CreatedAt.After(reports[j].CreatedAt)
+			}
+			return reports[i].ID > reports[j].ID
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// UpdateReport updates the handled state of a report
+func (s *MemStore) UpdateReport(report *models.Report) error {
+	return s.locked(func(tx *MemStore) error {
+		if row, exists := tx.db.reports[report.ID]; exists {
+			row.isHandled = report.IsHandled
+			tx.db.reports[report.ID] = row
+		}
+		return nil
+	})
+}
@@ -0,0 +1,151 @@
+package memstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+
+	"projektps/models"
+)
+
+// CreateRevision stores a snapshot of an adventure as its next revision
+func (s *MemStore) CreateRevision(revision *models.Revision) (*models.Revision, error) {
+	snapshot, err := json.Marshal(revision.Adventure)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.locked(func(tx *MemStore) error {
+		if _, exists := tx.db.adventures[revision.AdventureID]; !exists {
+			return errConstraint
+		}
+
+		revision.Revision = 1
+		for _, row := range tx.db.revisions {
+			if row.adventureID == revision.AdventureID && row.revision >= revision.Revision {
+				revision.Revision = row.revision + 1
+			}
+		}
+
+		revision.ID = tx.db.nextID("adventure_revision")
+		revision.CreatedAt = now()
+		tx.db.revisions[revision.ID] = revisionRow{
+			id:          revision.ID,
+			adventureID: revision.AdventureID,
+			revision:    revision.Revision,
+			userID:      revision.UserID,
+			snapshot:    snapshot,
+			createdAt:   revision.CreatedAt,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return revision, nil
+}
+
+// GetRevisions lists all revisions of an adventure, newest first, without snapshots
+func (s *MemStore) GetRevisions(adventureID int64) ([]models.Revision, error) {
+	revisions := []models.Revision{}
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.db.revisions {
+			if row.adventureID == adventureID {
+				revisions = append(revisions, row.toModel())
+			}
+		}
+		sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision > revisions[j].Revision })
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// GetRevision retrieves a single revision including its snapshot
+func (s *MemStore) GetRevision(adventureID int64, revision int64) (*models.Revision, error) {
+	var r models.Revision
+	var snapshot []byte
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.db.revisions {
+			if row.adventureID == adventureID && row.revision == revision {
+				r = row.toModel()
+				snapshot = row.snapshot
+				return nil
+			}
+		}
+		return sql.ErrNoRows
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.Adventure = &models.Adventure{}
+	err = json.Unmarshal(snapshot, r.Adventure)
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// createRevisionSnapshot stores the current state of an adventure as a new
+// revision and applies the retention limits. The references to uploaded
+// files are counted from the same state.
+func (s *MemStore) createRevisionSnapshot(slug string, userID int64) error {
+	adventure, err := s.GetAdventure(slug, models.ReadWrite)
+	if err != nil {
+		return err
+	}
+
+	err = s.updateMediaReferences(adventure)
+	if err != nil {
+		return err
+	}
+
+	// Memberships are not part of the content history
+	adventure.Users = nil
+
+	revision, err := s.CreateRevision(&models.Revision{
+		AdventureID: adventure.ID,
+		UserID:      userID,
+		Adventure:   adventure,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.pruneRevisions(adventure.ID, revision.Revision)
+	return nil
+}
+
+// pruneRevisions removes revisions outside the retention limits, always
+// keeping the latest revision
+func (s *MemStore) pruneRevisions(adventureID int64, latest int64) {
+	cutoff := now().Add(-s.retention.MaxAge)
+
+	for id, row := range s.db.revisions {
+		if row.adventureID != adventureID {
+			continue
+		}
+
+		if s.retention.MaxCount > 0 && row.revision <= latest-s.retention.MaxCount {
+			delete(s.db.revisions, id)
+		} else if s.retention.MaxAge > 0 && row.revision < latest && row.createdAt.Before(cutoff) {
+			delete(s.db.revisions, id)
+		}
+	}
+}
+
+func (row revisionRow) toModel() models.Revision {
+	return models.Revision{
+		ID:          row.id,
+		AdventureID: row.adventureID,
+		Revision:    row.revision,
+		UserID:      row.userID,
+		CreatedAt:   row.createdAt,
+	}
+}
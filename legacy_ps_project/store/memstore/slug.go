@@ -0,0 +1,75 @@
+package memstore
+
+import (
+	"database/sql"
+
+	"projektps/models"
+	"projektps/store"
+)
+
+// UpdateViewSlug gives an adventure a new play slug and keeps a redirect from
+// the old one, see sqlstore.SQLStore.UpdateViewSlug
+func (s *MemStore) UpdateViewSlug(adventureID int64, viewSlug string) error {
+	return s.locked(func(tx *MemStore) error {
+		row, exists := tx.db.adventures[adventureID]
+		if !exists {
+			return sql.ErrNoRows
+		}
+
+		if row.viewSlug == viewSlug {
+			return nil
+		}
+
+		if err := models.ValidateViewSlug(viewSlug); err != nil {
+			return err
+		}
+
+		if id, exists := tx.db.slugRedirects[viewSlug]; exists && id != adventureID {
+			return store.ErrSlugTaken
+		}
+		for _, other := range tx.db.adventures {
+			if other.slug == viewSlug || other.viewSlug == viewSlug {
+				return store.ErrSlugTaken
+			}
+		}
+
+		delete(tx.db.slugRedirects, viewSlug)
+		tx.db.slugRedirects[row.viewSlug] = adventureID
+
+		row.viewSlug = viewSlug
+		tx.updateAdventureRow(row)
+		return nil
+	})
+}
+
+// GetSlugRedirect returns the current play slug of the adventure that used
+// to have slug as its play slug
+func (s *MemStore) GetSlugRedirect(slug string) (string, error) {
+	var viewSlug string
+	err := s.locked(func(tx *MemStore) error {
+		id, exists := tx.db.slugRedirects[slug]
+		if !exists {
+			return sql.ErrNoRows
+		}
+		row, exists := tx.db.adventures[id]
+		if !exists {
+			return sql.ErrNoRows
+		}
+		viewSlug = row.viewSlug
+		return nil
+	})
+	return viewSlug, err
+}
+
+// slugInUse tells whether slug is taken by an adventure or a redirect
+func (s *MemStore) slugInUse(slug string) bool {
+	if _, exists := s.db.slugRedirects[slug]; exists {
+		return true
+	}
+	for _, row := range s.db.adventures {
+		if row.slug == slug || row.viewSlug == slug {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,304 @@
+// Package memstore keeps all data in memory. It implements store.Store with
+// the same behaviour as the SQL store and is meant for tests and local
+// experiments where a database is not available.
+package memstore
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"projektps/models"
+	"projektps/store"
+)
+
+// errConstraint is returned when a write would break a unique or foreign
+// key constraint that the SQL schema enforces
+var errConstraint = errors.New("memstore: constraint violation")
+
+type adventureRow struct {
+	id          int64
+	categoryID  sql.NullInt64
+	slug        string
+	viewSlug    string
+	locked      bool
+	coverURL    string
+	title       string
+	description string
+	createdAt   time.Time
+	updatedAt   time.Time
+	editVersion int64
+	viewCount   int64
+	props       string
+}
+
+type userRow struct {
+	id        int64
+	username  string
+	password  string
+	name      string
+	role      int64
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+type listRow struct {
+	id          int64
+	parentID    int64
+	title       string
+	description string
+	createdAt   time.Time
+}
+
+type listItem struct {
+	listID      int64
+	adventureID int64
+	ordinal     int64
+}
+
+type membership struct {
+	userID      int64
+	adventureID int64
+}
+
+type logRow struct {
+	id          int64
+	createdAt   time.Time
+	logType     int64
+	data        string
+	adventureID int64
+}
+
+type mediaRow struct {
+	id          int64
+	hash        string
+	url         string
+	size        int64
+	contentType string
+	createdAt   time.Time
+	width       int
+	height      int
+	thumbnail   string
+	variants    []models.MediaVariant
+}
+
+type mediaReference struct {
+	mediaID     int64
+	adventureID int64
+}
+
+type playSessionRow struct {
+	id          string
+	adventureID int64
+	startedAt   time.Time
+	updatedAt   time.Time
+	// events are replaced, not appended to, as the rows are shared with
+	// snapshots
+	events []models.PlayEvent
+}
+
+type revisionRow struct {
+	id          int64
+	adventureID int64
+	revision    int64
+	userID      int64
+	snapshot    []byte
+	createdAt   time.Time
+}
+
+// tables holds every row of the store. Rows are stored by value, so copying
+// the maps is enough to take a snapshot for a transaction.
+type tables struct {
+	lastID map[string]int64
+
+	adventures      map[int64]adventureRow
+	nodes           map[int64]nodeRow
+	links           map[int64]linkRow
+	categories      map[int64]categoryRow
+	lists           map[int64]listRow
+	listItems       []listItem
+	users           map[int64]userRow
+	memberships     []membership
+	reports         map[int64]reportRow
+	imageCategories map[int64]imageCategoryRow
+	images          map[int64]imageRow
+	logs            []logRow
+	revisions       map[int64]revisionRow
+	slugRedirects   map[string]int64
+	media           map[int64]mediaRow
+	mediaReferences map[mediaReference]int64
+	mediaUploads    map[mediaReference]time.Time
+	playSessions    map[string]playSessionRow
+}
+
+func newTables() *tables {
+	return &tables{
+		lastID:          make(map[string]int64),
+		adventures:      make(map[int64]adventureRow),
+		nodes:           make(map[int64]nodeRow),
+		links:           make(map[int64]linkRow),
+		categories:      make(map[int64]categoryRow),
+		lists:           make(map[int64]listRow),
+		users:           make(map[int64]userRow),
+		reports:         make(map[int64]reportRow),
+		imageCategories: make(map[int64]imageCategoryRow),
+		images:          make(map[int64]imageRow),
+		revisions:       make(map[int64]revisionRow),
+		slugRedirects:   make(map[string]int64),
+		media:           make(map[int64]mediaRow),
+		mediaReferences: make(map[mediaReference]int64),
+		mediaUploads:    make(map[mediaReference]time.Time),
+		playSessions:    make(map[string]playSessionRow),
+	}
+}
+
+func (t *tables) clone() *tables {
+	c := newTables()
+	for k, v := range t.lastID {
+		c.lastID[k] = v
+	}
+	for k, v := range t.adventures {
+		c.adventures[k] = v
+	}
+	for k, v := range t.nodes {
+		c.nodes[k] = v
+	}
+	for k, v := range t.links {
+		c.links[k] = v
+	}
+	for k, v := range t.categories {
+		c.categories[k] = v
+	}
+	for k, v := range t.lists {
+		c.lists[k] = v
+	}
+	for k, v := range t.users {
+		c.users[k] = v
+	}
+	for k, v := range t.reports {
+		c.reports[k] = v
+	}
+	for k, v := range t.imageCategories {
+		c.imageCategories[k] = v
+	}
+	for k, v := range t.images {
+		c.images[k] = v
+	}
+	for k, v := range t.revisions {
+		c.revisions[k] = v
+	}
+	for k, v := range t.slugRedirects {
+		c.slugRedirects[k] = v
+	}
+	for k, v := range t.media {
+		c.media[k] = v
+	}
+	for k, v := range t.mediaReferences {
+		c.mediaReferences[k] = v
+	}
+	for k, v := range t.mediaUploads {
+		c.mediaUploads[k] = v
+	}
+	for k, v := range t.playSessions {
+		c.playSessions[k] = v
+	}
+	c.listItems = append([]listItem{}, t.listItems...)
+	c.memberships = append([]membership{}, t.memberships...)
+	c.logs = append([]logRow{}, t.logs...)
+	return c
+}
+
+// nextID works like an AUTO_INCREMENT column, ids are never reused
+func (t *tables) nextID(table string) int64 {
+	t.lastID[table]++
+	return t.lastID[table]
+}
+
+var _ store.Store = (*MemStore)(nil)
+
+// MemStore is an in-memory implementation of store.Store
+type MemStore struct {
+	// mu is shared with the transaction stores created from this store
+	mu *sync.Mutex
+	db *tables
+
+	// inTx is true when the lock is already held by a caller further up,
+	// i.e. within WithTransaction or locked
+	inTx bool
+
+	retention store.RevisionRetention
+}
+
+// NewStore creates a new, empty in-memory store
+func NewStore() *MemStore {
+	return &MemStore{
+		mu:        &sync.Mutex{},
+		db:        newTables(),
+		retention: store.DefaultRevisionRetention,
+	}
+}
+
+// SetRevisionRetention configures how many revisions are kept per adventure
+func (s *MemStore) SetRevisionRetention(retention store.RevisionRetention) {
+	s.retention = retention
+}
+
+// locked runs fn with the lock held. fn gets a store that works directly on
+// the data of s and can call other store methods without locking again.
+func (s *MemStore) locked(fn func(tx *MemStore) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return fn(&MemStore{
+		mu:        s.mu,
+		db:        s.db,
+		inTx:      true,
+		retention: s.retention,
+	})
+}
+
+// WithTransaction runs fn against a copy of the data, which replaces the
+// data of the store if fn returns nil. Other callers wait until the
+// transaction is done. Calling WithTransaction on a store that already is
+// bound to a transaction runs fn within that same transaction.
+func (s *MemStore) WithTransaction(fn func(tx store.Store) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &MemStore{
+		mu:        s.mu,
+		db:        s.db.clone(),
+		inTx:      true,
+		retention: s.retention,
+	}
+
+	err := fn(tx)
+	if err != nil {
+		return err
+	}
+
+	s.db = tx.db
+	return nil
+}
+
+// transaction is a typed shorthand for WithTransaction used by store methods
+// that need several changes to succeed or fail together
+func (s *MemStore) transaction(fn func(tx *MemStore) error) error {
+	return s.WithTransaction(func(tx store.Store) error {
+		return fn(tx.(*MemStore))
+	})
+}
+
+// now returns the current time with the precision of a SQL timestamp
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
@@ -0,0 +1,227 @@
+package memstore
+
+import (
+	"database/sql"
+	"sort"
+
+	"projektps/models"
+	"projektps/store"
+)
+
+func (row userRow) toModel() models.User {
+	return models.User{
+		ID:        row.id,
+		Username:  row.username,
+		Name:      row.name,
+		Role:      row.role,
+		CreatedAt: row.createdAt,
+		UpdatedAt: row.updatedAt,
+	}
+}
+
+// Authenticate checks the password of a user
+func (s *MemStore) Authenticate(username string, password string) (*models.User, error) {
+	var user *models.User
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.db.users {
+			if row.username == username {
+				user = &models.User{
+					ID:        row.id,
+					Password:  row.password,
+					CreatedAt: row.createdAt,
+				}
+				return nil
+			}
+		}
+		return store.ErrInvalidUser
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.CheckPasswordHash(password) {
+		return nil, store.ErrInvalidPassword
+	}
+
+	return user, nil
+}
+
+// CreateUser stores a user, the password is expected to be hashed already
+func (s *MemStore) CreateUser(user *models.User) (*models.User, error) {
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.db.users {
+			if row.username == user.Username {
+				return errConstraint
+			}
+		}
+
+		user.ID = tx.db.nextID("users")
+		tx.db.users[user.ID] = userRow{
+			id:        user.ID,
+			username:  user.Username,
+			password:  user.Password,
+			name:      user.Name,
+			role:      user.Role,
+			createdAt: now(),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// UpdateUser updates a user, the password is only changed if set
+func (s *MemStore) UpdateUser(user *models.User) error {
+	return s.locked(func(tx *MemStore) error {
+		row, exists := tx.db.users[user.ID]
+		if !exists {
+			return nil
+		}
+
+		for _, other := range tx.db.users {
+			if other.id != user.ID && other.username == user.Username {
+				return errConstraint
+			}
+		}
+
+		row.username = user.Username
+		row.name = user.Name
+		row.role = user.Role
+		if user.Password != "" {
+			row.password = user.Password
+		}
+		row.updatedAt = now()
+		tx.db.users[user.ID] = row
+		return nil
+	})
+}
+
+// DeleteUserFromAdventure removes a user from the members of an adventure
+func (s *MemStore) DeleteUserFromAdventure(user *models.User, adventure *models.Adventure) error {
+	return s.locked(func(tx *MemStore) error {
+		memberships := []membership{}
+		for _, m := range tx.db.memberships {
+			if m.userID != user.ID || m.adventureID != adventure.ID {
+				memberships = append(memberships, m)
+			}
+		}
+		tx.db.memberships = memberships
+		return nil
+	})
+}
+
+// AddUserToAdventure adds a user to the members of an adventure
+func (s *MemStore) AddUserToAdventure(user *models.User, adventure *models.Adventure) error {
+	return s.locked(func(tx *MemStore) error {
+		_, userExists := tx.db.users[user.ID]
+		_, adventureExists := tx.db.adventures[adventure.ID]
+		if !userExists || !adventureExists {
+			return errConstraint
+		}
+
+		for _, m := range tx.db.memberships {
+			if m.userID == user.ID && m.adventureID == adventure.ID {
+				return errConstraint
+			}
+		}
+
+		tx.db.memberships = append(tx.db.memberships, membership{userID: user.ID, adventureID: adventure.ID})
+		return nil
+	})
+}
+
+// GetUser retrieves a user along with the adventures the user is member of
+func (s *MemStore) GetUser(userId int64) (*models.User, error) {
+	var user models.User
+	err := s.locked(func(tx *MemStore) error {
+		row, exists := tx.db.users[userId]
+		if !exists {
+			return sql.ErrNoRows
+		}
+		user = row.toModel()
+
+		user.Adventures = []models.Adventure{}
+		for _, adventure := range tx.sortedAdventures() {
+			if tx.isMember(userId, adventure.id) {
+				user.Adventures = append(user.Adventures, adventure.toModel())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetUsers retrieves all users
+func (s *MemStore) GetUsers() ([]models.User, error) {
+	users := []models.User{}
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.sortedUsers() {
+			users = append(users, row.toModel())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// GetUsersByAdventureID retrieves the members of an adventure
+func (s *MemStore) GetUsersByAdventureID(adventureID int64) ([]models.User, error) {
+	users := []models.User{}
+	err := s.locked(func(tx *MemStore) error {
+		for _, row := range tx.sortedUsers() {
+			if tx.isMember(row.id, adventureID) {
+				users = append(users, row.toModel())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// DeleteUser removes a user and its memberships
+func (s *MemStore) DeleteUser(userId int64) error {
+	return s.locked(func(tx *MemStore) error {
+		memberships := []membership{}
+		for _, m := range tx.db.memberships {
+			if m.userID != userId {
+				memberships = append(memberships, m)
+			}
+		}
+		tx.db.memberships = memberships
+
+		delete(tx.db.users, userId)
+		return nil
+	})
+}
+
+func (s *MemStore) isMember(userID, adventureID int64) bool {
+	for _, m := range s.db.memberships {
+		if m.userID == userID && m.adventureID == adventureID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemStore) sortedUsers() []userRow {
+	rows := make([]userRow, 0, len(s.db.users))
+	for _, row := range s.db.users {
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].id < rows[j].id })
+	return rows
+}
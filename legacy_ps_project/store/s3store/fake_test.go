@@ -0,0 +1,211 @@
+package s3store
+
+import (
+	"crypto/subtle"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeS3 is a stand-in for MinIO: a bucket in memory that checks the
+// signatures of the requests like S3 does. It knows the requests S3Store
+// sends, nothing more.
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	creds   Credentials
+	objects map[string]fakeObject
+	// pageSize is how many objects a page of a listing has
+	pageSize int
+	// requests counts the requests by method
+	requests map[string]int
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+func newFakeS3(bucket string, creds Credentials) *fakeS3 {
+	return &fakeS3{bucket: bucket, creds: creds, objects: make(map[string]fakeObject), pageSize: 2, requests: make(map[string]int)}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[r.Method]++
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		f.fail(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	if !f.authorized(r, body) {
+		f.fail(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if parts[0] != f.bucket {
+		f.fail(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if len(parts) == 1 || parts[1] == "" {
+		if r.Method == "GET" && r.URL.Query().Get("list-type") == "2" {
+			f.list(w, r.URL.Query())
+			return
+		}
+		f.fail(w, http.StatusNotImplemented, "NotImplemented")
+		return
+	}
+	key := parts[1]
+
+	switch r.Method {
+	case "PUT":
+		object := fakeObject{data: body, contentType: r.Header.Get("Content-Type"), modTime: time.Now().UTC()}
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			source, _ = url.PathUnescape(source)
+			copied, exists := f.objects[strings.TrimPrefix(source, "/"+f.bucket+"/")]
+			if !exists {
+				f.fail(w, http.StatusNotFound, "NoSuchKey")
+				return
+			}
+			object.data = copied.data
+			object.contentType = copied.contentType
+		}
+		if object.contentType == "" {
+			object.contentType = "binary/octet-stream"
+		}
+		f.objects[key] = object
+		w.WriteHeader(http.StatusOK)
+	case "GET", "HEAD":
+		object, exists := f.objects[key]
+		if !exists {
+			f.fail(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		w.Header().Set("Last-Modified", object.modTime.Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == "GET" {
+			w.Write(object.data)
+		}
+	case "DELETE":
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.fail(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, query url.Values) {
+	prefix := query.Get("prefix")
+	keys := []string{}
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	start := 0
+	if token := query.Get("continuation-token"); token != "" {
+		start = sort.SearchStrings(keys, token)
+	}
+	keys = keys[start:]
+
+	type content struct {
+		Key          string
+		Size         int
+		LastModified string
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []content
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}{}
+	if len(keys) > f.pageSize {
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[f.pageSize]
+		keys = keys[:f.pageSize]
+	}
+	for _, key := range keys {
+		object := f.objects[key]
+		result.Contents = append(result.Contents, content{Key: key, Size: len(object.data), LastModified: object.modTime.Format(time.RFC3339)})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeS3) fail(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: code})
+}
+
+// authorized checks the Authorization header or the presigned query
+func (f *fakeS3) authorized(r *http.Request, body []byte) bool {
+	if r.URL.Query().Get("X-Amz-Signature") != "" {
+		return f.presigned(r)
+	}
+
+	fields := map[string]string{}
+	authorization := strings.TrimPrefix(r.Header.Get("Authorization"), algorithm+" ")
+	for _, field := range strings.Split(authorization, ", ") {
+		if parts := strings.SplitN(field, "=", 2); len(parts) == 2 {
+			fields[parts[0]] = parts[1]
+		}
+	}
+
+	t, err := time.Parse(timeFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil || fields["Credential"] != f.creds.AccessKeyID+"/"+f.creds.scope(t) {
+		return false
+	}
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != unsignedPayload && payloadHash != hashHex(body) {
+		return false
+	}
+
+	names := strings.Split(fields["SignedHeaders"], ";")
+	signature := f.creds.signature(t, canonicalRequest(r, names, payloadHash))
+	return subtle.ConstantTimeCompare([]byte(signature), []byte(fields["Signature"])) == 1
+}
+
+func (f *fakeS3) presigned(r *http.Request) bool {
+	query := r.URL.Query()
+	signature := query.Get("X-Amz-Signature")
+	query.Del("X-Amz-Signature")
+
+	t, err := time.Parse(timeFormat, query.Get("X-Amz-Date"))
+	if err != nil || query.Get("X-Amz-Credential") != f.creds.AccessKeyID+"/"+f.creds.scope(t) {
+		return false
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || time.Now().After(t.Add(time.Duration(expires)*time.Second)) {
+		return false
+	}
+
+	canonical := strings.Join([]string{
+		r.Method,
+		canonicalPath(r.URL),
+		canonicalQuery(query),
+		"host:" + r.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	return subtle.ConstantTimeCompare([]byte(f.creds.signature(t, canonical)), []byte(signature)) == 1
+}
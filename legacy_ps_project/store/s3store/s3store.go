@@ -0,0 +1,258 @@
+// Package s3store keeps the uploaded files in a bucket of an S3 compatible
+// object storage, like Amazon S3 or MinIO, so that they are not tied to one
+// server. Requests are signed with Signature Version 4 and the bucket is
+// addressed by path, http://endpoint/bucket/name.
+package s3store
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"projektps/store"
+)
+
+// Config tells where the bucket is
+type Config struct {
+	// Endpoint is the url of the storage, like https://s3.eu-north-1.amazonaws.com
+	Endpoint string
+	Bucket   string
+	Credentials
+}
+
+// S3Store is a store.MediaStore in a bucket
+type S3Store struct {
+	endpoint *url.URL
+	bucket   string
+	creds    Credentials
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3Store creates a media store in the bucket of config
+func NewS3Store(config Config) (*S3Store, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("no S3 bucket")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	return &S3Store{
+		endpoint: endpoint,
+		bucket:   config.Bucket,
+		creds:    config.Credentials,
+		client:   &http.Client{Timeout: 5 * time.Minute},
+		now:      time.Now,
+	}, nil
+}
+
+// objectURL is the url of name in the bucket, or of the bucket itself
+func (s *S3Store) objectURL(name string) *url.URL {
+	u := *s.endpoint
+	u.Path = u.Path + "/" + s.bucket
+	if name != "" {
+		u.Path += "/" + name
+	}
+	// The path is sent escaped like it is signed
+	u.RawPath = canonicalPath(&u)
+	return &u
+}
+
+// do sends a signed request and returns an error for anything but a 2xx
+// response. The body of the response has to be closed.
+func (s *S3Store) do(method string, u *url.URL, body []byte, header http.Header) (*http.Response, error) {
+	r, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	s.creds.Sign(r, hashHex(body), s.now())
+
+	response, err := s.client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return response, nil
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, store.ErrMediaNotFound
+	}
+	var failure struct {
+		Code    string
+		Message string
+	}
+	data, _ := ioutil.ReadAll(io.LimitReader(response.Body, 64<<10))
+	if xml.Unmarshal(data, &failure) == nil && failure.Code != "" {
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", method, u.Path, failure.Code, failure.Message)
+	}
+	return nil, fmt.Errorf("s3 %s %s: %s", method, u.Path, response.Status)
+}
+
+// Put sends the content in one request, S3 replaces objects at once
+func (s *S3Store) Put(name string, content io.Reader, contentType string) error {
+	if !store.ValidMediaName(name) {
+		return store.ErrInvalidMediaName
+	}
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	response, err := s.do("PUT", s.objectURL(name), data, header)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+func (s *S3Store) Get(name string) (io.ReadCloser, error) {
+	if !store.ValidMediaName(name) {
+		return nil, store.ErrInvalidMediaName
+	}
+	response, err := s.do("GET", s.objectURL(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+func (s *S3Store) Stat(name string) (*store.MediaObject, error) {
+	if !store.ValidMediaName(name) {
+		return nil, store.ErrInvalidMediaName
+	}
+	response, err := s.do("HEAD", s.objectURL(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+
+	modTime, _ := http.ParseTime(response.Header.Get("Last-Modified"))
+	size, _ := strconv.ParseInt(response.Header.Get("Content-Length"), 10, 64)
+	return &store.MediaObject{
+		Name:        name,
+		Size:        size,
+		ModTime:     modTime,
+		ContentType: response.Header.Get("Content-Type"),
+	}, nil
+}
+
+func (s *S3Store) Delete(name string) error {
+	if !store.ValidMediaName(name) {
+		return store.ErrInvalidMediaName
+	}
+	response, err := s.do("DELETE", s.objectURL(name), nil, nil)
+	if err == store.ErrMediaNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// listResult is the response of ListObjectsV2
+type listResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// List pages through ListObjectsV2, which lists the objects ordered by name
+func (s *S3Store) List(prefix string) ([]store.MediaObject, error) {
+	objects := []store.MediaObject{}
+	token := ""
+	for {
+		u := s.objectURL("")
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u.RawQuery = canonicalQuery(query)
+
+		response, err := s.do("GET", u, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listResult
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, content := range result.Contents {
+			objects = append(objects, store.MediaObject{
+				Name:    content.Key,
+				Size:    content.Size,
+				ModTime: content.LastModified,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// CopyPrefix copies the objects in the bucket, they are not downloaded
+func (s *S3Store) CopyPrefix(from, to string) error {
+	objects, err := s.List(from)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		name := to + strings.TrimPrefix(object.Name, from)
+		if !store.ValidMediaName(name) {
+			return store.ErrInvalidMediaName
+		}
+
+		header := http.Header{}
+		header.Set("X-Amz-Copy-Source", s.objectURL(object.Name).EscapedPath())
+		response, err := s.do("PUT", s.objectURL(name), nil, header)
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+	}
+	return nil
+}
+
+// SignedURL returns a presigned GET url of the object
+func (s *S3Store) SignedURL(name string, expires time.Duration) (string, error) {
+	if !store.ValidMediaName(name) {
+		return "", store.ErrInvalidMediaName
+	}
+	r, err := http.NewRequest("GET", s.objectURL(name).String(), nil)
+	if err != nil {
+		return "", err
+	}
+	return s.creds.Presign(r, s.now(), expires), nil
+}
@@ -0,0 +1,182 @@
+package s3store
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature Version 4, as described in
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+
+const (
+	algorithm       = "AWS4-HMAC-SHA256"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	timeFormat      = "20060102T150405Z"
+	dateFormat      = "20060102"
+)
+
+// Credentials sign the requests to the store
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	Region          string
+}
+
+func (c Credentials) scope(t time.Time) string {
+	return t.Format(dateFormat) + "/" + c.Region + "/s3/aws4_request"
+}
+
+func (c Credentials) signature(t time.Time, canonical string) string {
+	stringToSign := strings.Join([]string{algorithm, t.Format(timeFormat), c.scope(t), hashHex([]byte(canonical))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), t.Format(dateFormat))
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// Sign adds the Authorization header to r. payloadHash is the hex SHA-256 of
+// the body, or UNSIGNED-PAYLOAD.
+func (c Credentials) Sign(r *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	r.Header.Set("X-Amz-Date", t.Format(timeFormat))
+	r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	names := signedHeaders(r)
+	r.Header.Set("Authorization", algorithm+
+		" Credential="+c.AccessKeyID+"/"+c.scope(t)+
+		", SignedHeaders="+strings.Join(names, ";")+
+		", Signature="+c.signature(t, canonicalRequest(r, names, payloadHash)))
+}
+
+// canonicalRequest is the request as it is signed, with the headers names
+func canonicalRequest(r *http.Request, names []string, payloadHash string) string {
+	return strings.Join([]string{
+		r.Method,
+		canonicalPath(r.URL),
+		canonicalQuery(r.URL.Query()),
+		canonicalHeaders(r, names),
+		strings.Join(names, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// Presign returns the url of r signed in its query, valid for expires
+func (c Credentials) Presign(r *http.Request, t time.Time, expires time.Duration) string {
+	t = t.UTC()
+	query := r.URL.Query()
+	query.Set("X-Amz-Algorithm", algorithm)
+	query.Set("X-Amz-Credential", c.AccessKeyID+"/"+c.scope(t))
+	query.Set("X-Amz-Date", t.Format(timeFormat))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonical := strings.Join([]string{
+		r.Method,
+		canonicalPath(r.URL),
+		canonicalQuery(query),
+		"host:" + r.URL.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+
+	signed := *r.URL
+	signed.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + c.signature(t, canonical)
+	return signed.String()
+}
+
+// signedHeaders returns the names of the headers that are signed, the host,
+// the content headers and the x-amz- headers
+func signedHeaders(r *http.Request) []string {
+	names := []string{"host"}
+	for name := range r.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "content-type" || name == "content-md5" || name == "range" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// canonicalHeaders returns the headers names of r, one "name:value" a line
+func canonicalHeaders(r *http.Request, names []string) string {
+	var headers strings.Builder
+	for _, name := range names {
+		value := strings.Join(r.Header.Values(name), ",")
+		if name == "host" {
+			value = r.Host
+			if value == "" {
+				value = r.URL.Host
+			}
+		}
+		headers.WriteString(name + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+	return headers.String()
+}
+
+// canonicalPath is the path with every segment escaped, "/" if it is empty
+func canonicalPath(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		segments[i] = escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery is the query sorted by name and value
+func canonicalQuery(query url.Values) string {
+	pairs := [][2]string{}
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, [2]string{escape(name), escape(value)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+
+	joined := make([]string, len(pairs))
+	for i, pair := range pairs {
+		joined[i] = pair[0] + "=" + pair[1]
+	}
+	return strings.Join(joined, "&")
+}
+
+// escape escapes everything but the unreserved characters of RFC 3986
+func escape(s string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(s) {
+		if 'A' <= b && b <= 'Z' || 'a' <= b && b <= 'z' || '0' <= b && b <= '9' || b == '-' || b == '_' || b == '.' || b == '~' {
+			escaped.WriteByte(b)
+		} else {
+			escaped.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{b})))
+		}
+	}
+	return escaped.String()
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -7,38 +7,75 @@ import (
 	"github.com/go-sql-driver/mysql"
 	"projektps/helpers/uniuri"
 	"projektps/models"
+	"projektps/store"
 )
 
-// CreateNewAdventure creates a new adventure
+// CreateNewAdventure creates a new adventure. Slug and ViewSlug are random
+// and unique, a slug that is already taken is replaced by a new one.
 func (s *SQLStore) CreateNewAdventure() (*models.Adventure, error) {
 
-	newAdventure := &models.Adventure{
-		ViewSlug: uniuri.New(),
-		Slug:     uniuri.NewLen(8),
-	}
+	for attempt := 0; attempt < store.MaxSlugAttempts; attempt++ {
+		newAdventure := &models.Adventure{
+			ViewSlug: uniuri.New(),
+			Slug:     uniuri.NewLen(8),
+		}
 
-	// TODO: Make sure Slug & ViewSlug are unique by checking db for pre-existant entries
+		taken, err := s.slugsInUse(newAdventure)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			continue
+		}
 
-	res, err := s.db.Exec("INSERT INTO adventure (title, slug, view_slug, category_id, created_at) VALUES(?, ?, ?, ?, sysdate())",
-		"Nytt äventyr",
-		newAdventure.Slug,
-		newAdventure.ViewSlug,
-		1)
+		res, err := s.db.Exec("INSERT INTO adventure (title, slug, view_slug, category_id, created_at) VALUES(?, ?, ?, ?, CURRENT_TIMESTAMP)",
+			"Nytt äventyr",
+			newAdventure.Slug,
+			newAdventure.ViewSlug,
+			1)
 
-	if err != nil {
-		return nil, err
+		if err != nil {
+			// The unique indexes catch an adventure created with the same
+			// slug in between the check and the insert
+			if taken, _ := s.slugsInUse(newAdventure); taken {
+				continue
+			}
+			return nil, err
+		}
+
+		newAdventure.ID, err = res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+
+		return newAdventure, nil
 	}
 
-	newAdventure.ID, err = res.LastInsertId()
-	if err != nil {
-		return nil, err
+	return nil, fmt.Errorf("no unique slug found in %d attempts", store.MaxSlugAttempts)
+}
+
+// slugsInUse tells whether the slug or the play slug of a new adventure is taken
+func (s *SQLStore) slugsInUse(adventure *models.Adventure) (bool, error) {
+	if adventure.Slug == adventure.ViewSlug {
+		return true, nil
 	}
 
-	return newAdventure, nil
+	taken, err := s.slugInUse(adventure.Slug)
+	if err != nil || taken {
+		return taken, err
+	}
+
+	return s.slugInUse(adventure.ViewSlug)
 }
 
 // Updates only specific fields on an adventure 
 func (s *SQLStore) UpdateAdventure(adventure *models.Adventure) error {
+	return s.transaction(func(tx *SQLStore) error {
+		return tx.updateAdventure(adventure)
+	})
+}
+
+func (s *SQLStore) updateAdventure(adventure *models.Adventure) error {
 
 	existingAdventure, err := s.GetAdventure(adventure.Slug, models.ReadWrite)
 	if err != nil {
@@ -53,8 +90,7 @@ func (s *SQLStore) UpdateAdventure(adventure *models.Adventure) error {
 			description = ?, 
 			category_id = ?, 
 			locked = ?,
-			updated_at = sysdate(),
-			view_slug = ?
+			updated_at = CURRENT_TIMESTAMP
 		WHERE 
 			id = ?
 		`
@@ -64,13 +100,17 @@ func (s *SQLStore) UpdateAdventure(adventure *models.Adventure) error {
 		adventure.Description,
 		adventure.Category.ID,
 		adventure.Locked,
-		adventure.ViewSlug,
 		adventure.ID,
 	)
 	if err != nil {
 		return err
 	}
 
+	err = s.updateViewSlug(adventure.ID, adventure.ViewSlug)
+	if err != nil {
+		return err
+	}
+
 	for _, user := range existingAdventure.Users {
 		removeUser := true
 		for _, existingUser := range adventure.Users {
@@ -110,8 +150,48 @@ func (s *SQLStore) UpdateAdventure(adventure *models.Adventure) error {
 	return nil
 }
 
-// UpdateAdventureContent updates an existing adventure using the read/write slug
-func (s *SQLStore) UpdateAdventureContent(newAdventure *models.Adventure) error {
+// UpdateAdventureContent updates an existing adventure using the read/write slug.
+// The adventure row, nodes and links are saved in a single transaction, so a
+// failing statement leaves the adventure exactly as it was before the save.
+// Every successful save is recorded as a new revision authored by userID.
+// The save only succeeds if newAdventure.EditVersion still matches the stored
+// edit_version, otherwise store.ErrVersionConflict is returned. On success the
+// version has been incremented by one.
+func (s *SQLStore) UpdateAdventureContent(newAdventure *models.Adventure, userID int64) error {
+	return s.transaction(func(tx *SQLStore) error {
+		err := tx.bumpEditVersion(newAdventure.Slug, newAdventure.EditVersion)
+		if err != nil {
+			return err
+		}
+
+		err = tx.updateAdventureContent(newAdventure)
+		if err != nil {
+			return err
+		}
+		return tx.createRevisionSnapshot(newAdventure.Slug, userID)
+	})
+}
+
+// EditAdventureContent runs fn as a single save of the adventure content,
+// for changes made node by node or link by link instead of through a full
+// UpdateAdventureContent. It applies the same edit_version check and records
+// a revision when fn succeeds, all in one transaction.
+func (s *SQLStore) EditAdventureContent(slug string, editVersion int64, userID int64, fn func(tx store.Store) error) error {
+	return s.transaction(func(tx *SQLStore) error {
+		err := tx.bumpEditVersion(slug, editVersion)
+		if err != nil {
+			return err
+		}
+
+		err = fn(tx)
+		if err != nil {
+			return err
+		}
+		return tx.createRevisionSnapshot(slug, userID)
+	})
+}
+
+func (s *SQLStore) updateAdventureContent(newAdventure *models.Adventure) error {
 
 	a, err := s.GetAdventure(newAdventure.Slug, models.ReadWrite)
 	if err != nil {
@@ -230,11 +310,22 @@ func (s *SQLStore) CountViewAdventure(adventureID int64) error {
 	return nil
 }
 
-func (s *SQLStore) UpdateAdventureEditVersion(slug string) error {
-	_, err := s.db.Exec("UPDATE adventure SET edit_version = edit_version + 1 WHERE slug = ?", slug)
+// bumpEditVersion increments edit_version if it still equals expectedVersion.
+// The comparison is part of the UPDATE, so concurrent saves can not both succeed.
+func (s *SQLStore) bumpEditVersion(slug string, expectedVersion int64) error {
+	res, err := s.db.Exec("UPDATE adventure SET edit_version = edit_version + 1 WHERE slug = ? AND edit_version = ?", slug, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+
+	if count == 0 {
+		return store.ErrVersionConflict
+	}
 	return nil
 }
 
@@ -403,81 +494,40 @@ func (s *SQLStore) getAdventureContent(adventureID int64) ([]models.Node, []mode
 	return nodes, links, users, nil
 }
 
+// CreateDefaultAdventure creates a new adventure with a start node and two choices
 func (s *SQLStore) CreateDefaultAdventure() (*models.Adventure, error) {
-	adventure, err := s.CreateNewAdventure()
-	if err != nil {
-		return nil, err
-	}
-	
-	newRootNode := &models.Node{
-		AdventureID: adventure.ID,
-		NodeID:      0,
-		NodeType:    "root",
-		Title:       "Start",
-		Icon:        "🏠",
-		Content:     "<p>Detta är starten på ditt nya PS.</p>",
-		X:           345,
-		Y:           100,
-	}
-	_, err = s.CreateNewNode(newRootNode)
-	if err != nil {
-		return nil, err
-	}
-
-	newLeftNode := &models.Node{
-		AdventureID: adventure.ID,
-		NodeID:      1,
-		NodeType:    "default",
-		Title:       "Vänster",
-		Content:     "<p>Du har gått till vänster.</p>",
-		X:           144,
-		Y:           383,
-	}
-
-	_, err = s.CreateNewNode(newLeftNode)
-	if err != nil {
-		return nil, err
-	}
-
-	newRightNode := &models.Node{
-		AdventureID: adventure.ID,
-		NodeID:      2,
-		NodeType:    "default",
-		Title:       "Höger",
-		Content:     "<p>Du har gått till höger.</p>",
-		X:           546,
-		Y:           383,
-	}
-
-	_, err = s.CreateNewNode(newRightNode)
+	var adventure *models.Adventure
+	err := s.transaction(func(tx *SQLStore) error {
+		var err error
+		adventure, err = tx.createDefaultAdventure()
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
+	return adventure, nil
+}
 
-	newLinkRootToLeft := &models.Link{
-		AdventureID:  adventure.ID,
-		LinkID:       0,
-		SourceNodeID: 0,
-		TargetNodeID: 1,
-		LinkType:     "bidirectional",
-	}
-
-	_, err = s.CreateNewLink(newLinkRootToLeft)
+func (s *SQLStore) createDefaultAdventure() (*models.Adventure, error) {
+	adventure, err := s.CreateNewAdventure()
 	if err != nil {
 		return nil, err
 	}
+	
+	nodes, links := store.DefaultAdventureContent(adventure.ID)
 
-	newLinkRootToRight := &models.Link{
-		AdventureID:  adventure.ID,
-		LinkID:       1,
-		SourceNodeID: 0,
-		TargetNodeID: 2,
-		LinkType:     "bidirectional",
+	for i := range nodes {
+		_, err = s.CreateNewNode(&nodes[i])
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	_, err = s.CreateNewLink(newLinkRootToRight)
-	if err != nil {
-		return nil, err
+	for i := range links {
+		_, err = s.CreateNewLink(&links[i])
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	adventure.Nodes, adventure.Links, adventure.Users, err = s.getAdventureContent(adventure.ID)
@@ -608,6 +658,25 @@ func (s *SQLStore) countAdventuresWithSearchString(searchString string) int64 {
 	return adventureCount
 }
 
+// GetAdventureIDs returns the id of every adventure
+func (s *SQLStore) GetAdventureIDs() ([]int64, error) {
+	rows, err := s.db.Query("SELECT id FROM adventure ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
 // GetAdventureByID retrieves an adventure along with its content from the database
 func (s *SQLStore) GetAdventureByID(adventureID int64) (*models.Adventure, error) {
 
@@ -617,11 +686,11 @@ func (s *SQLStore) GetAdventureByID(adventureID int64) (*models.Adventure, error
 	query = "SELECT id, title, description, slug, view_slug, locked, category_id, view_count, cover_url FROM adventure WHERE id = ?"
 	row = s.db.QueryRow(query, adventureID)
 
-	var title, description sql.NullString
+	var title, description, coverUrl sql.NullString
 	var categoryID sql.NullInt64
 
 	a := &models.Adventure{}
-	err := row.Scan(&a.ID, &title, &description, &a.Slug, &a.ViewSlug, &a.Locked, &categoryID, &a.ViewCount, &a.CoverUrl)
+	err := row.Scan(&a.ID, &title, &description, &a.Slug, &a.ViewSlug, &a.Locked, &categoryID, &a.ViewCount, &coverUrl)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, err
@@ -637,6 +706,10 @@ func (s *SQLStore) GetAdventureByID(adventureID int64) (*models.Adventure, error
 		a.Description = description.String
 	}
 
+	if coverUrl.Valid {
+		a.CoverUrl = coverUrl.String
+	}
+
 	// Fetch category
 	if categoryID.Valid {
 		cat, err := s.GetCategory(categoryID.Int64)
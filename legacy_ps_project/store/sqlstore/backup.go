@@ -0,0 +1,348 @@
+package sqlstore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BackupTable is a table of the store that backups contain
+type BackupTable struct {
+	Name string
+	// Key are the columns that identify a row
+	Key []string
+	// Changed are the timestamp columns an incremental backup compares,
+	// tables without them are always backed up whole
+	Changed []string
+}
+
+// BackupTables are every table the store manages, in the order they are
+// restored so that rows are inserted after the rows they refer to
+var BackupTables = []BackupTable{
+	{Name: "users", Key: []string{"id"}, Changed: []string{"created_at", "updated_at"}},
+	{Name: "adventure_category", Key: []string{"id"}, Changed: []string{"created_at", "updated_at"}},
+	{Name: "adventure", Key: []string{"id"}, Changed: []string{"created_at", "updated_at"}},
+	{Name: "adventure_node", Key: []string{"id"}, Changed: []string{"created_at", "updated_at"}},
+	{Name: "adventure_link", Key: []string{"id"}, Changed: []string{"created_at", "updated_at"}},
+	{Name: "adventure_list", Key: []string{"id"}, Changed: []string{"created_at", "updated_at"}},
+	{Name: "adventure_list_item", Key: []string{"list_id", "adventure_id"}},
+	{Name: "user_adventure", Key: []string{"user_id", "adventure_id"}},
+	{Name: "adventure_slug_redirect", Key: []string{"slug"}, Changed: []string{"created_at"}},
+	{Name: "adventure_revision", Key: []string{"id"}, Changed: []string{"created_at"}},
+	{Name: "adventure_report", Key: []string{"id"}},
+	{Name: "adventure_log", Key: []string{"id"}, Changed: []string{"created_at"}},
+	// UpdateMedia changes files that were processed again and media has no
+	// updated_at
+	{Name: "media", Key: []string{"id"}},
+	{Name: "media_reference", Key: []string{"media_id", "adventure_id"}},
+	{Name: "media_upload", Key: []string{"media_id", "adventure_id"}, Changed: []string{"created_at"}},
+	{Name: "play_session", Key: []string{"id"}, Changed: []string{"started_at", "updated_at"}},
+	{Name: "play_event", Key: []string{"session_id", "seq"}, Changed: []string{"created_at"}},
+	{Name: "image_category", Key: []string{"id"}},
+	{Name: "image_item", Key: []string{"id"}},
+	{Name: "key_value", Key: []string{"id"}},
+}
+
+// Row is a row of a table by column name. Times are written as
+// "2006-01-02 15:04:05" and zero times are left out, so that a restored row
+// gets the zero date default of the column in both MySQL and SQLite.
+type Row map[string]interface{}
+
+const backupTimeLayout = "2006-01-02 15:04:05"
+
+// Dumper receives the rows of a backup, table by table
+type Dumper interface {
+	// Begin starts the rows of table, or only their keys
+	Begin(table BackupTable, keys bool) error
+	// Row is called with each row, or key, of the table begun last
+	Row(row Row) error
+}
+
+// RowSource gives the rows of a backup to RestoreTables
+type RowSource interface {
+	// Rows calls fn with each row of table in the backup, or with the key of
+	// each row the table had when an incremental backup was taken
+	Rows(table BackupTable, keys bool, fn func(row Row) error) error
+}
+
+// ErrNotEmpty is returned when a full backup is restored into a database
+// that already has rows
+var ErrNotEmpty = errors.New("the database is not empty, a full backup is only restored into a new database")
+
+// DumpTables passes the rows of BackupTables to dumper from a single
+// transaction, so they are consistent with each other. An incremental backup
+// passes since, the time returned for the backup it builds on, and only gets
+// the rows that changed from then on along with the keys of every row. The
+// database time the backup was taken at is returned.
+func (s *SQLStore) DumpTables(since string, dumper Dumper) (string, error) {
+	var now string
+	err := s.transaction(func(tx *SQLStore) error {
+		var current interface{}
+		err := tx.db.QueryRow("SELECT CURRENT_TIMESTAMP").Scan(&current)
+		if err != nil {
+			return err
+		}
+		now = fmt.Sprint(backupValue(current))
+
+		for _, table := range BackupTables {
+			query := "SELECT * FROM " + table.Name
+			args := []interface{}{}
+			if since != "" && len(table.Changed) > 0 {
+				conditions := []string{}
+				for _, column := range table.Changed {
+					conditions = append(conditions, column+" >= ?")
+					args = append(args, since)
+				}
+				query += " WHERE " + strings.Join(conditions, " OR ")
+			}
+			query += " ORDER BY " + strings.Join(table.Key, ", ")
+
+			if err := dumper.Begin(table, false); err != nil {
+				return err
+			}
+			if err := tx.queryBackupRows(query, args, dumper.Row); err != nil {
+				return fmt.Errorf("%s: %v", table.Name, err)
+			}
+
+			if since == "" {
+				continue
+			}
+			keys := strings.Join(table.Key, ", ")
+			if err := dumper.Begin(table, true); err != nil {
+				return err
+			}
+			if err := tx.queryBackupRows("SELECT "+keys+" FROM "+table.Name+" ORDER BY "+keys, nil, dumper.Row); err != nil {
+				return fmt.Errorf("%s: %v", table.Name, err)
+			}
+		}
+		return nil
+	})
+	return now, err
+}
+
+// RestoreTables writes the rows of source in a single transaction. A full
+// backup is only restored into empty tables. An incremental backup removes
+// the rows that were deleted since the backup it builds on and then inserts
+// or updates its rows. fn, if given, runs last within the transaction and an
+// error from it rolls the restore back.
+//
+// Triggers set updated_at of the rows that are updated to the time of the
+// restore.
+func (s *SQLStore) RestoreTables(source RowSource, incremental bool, fn func() error) error {
+	return s.transaction(func(tx *SQLStore) error {
+		columns := make(map[string]map[string]bool)
+		for _, table := range BackupTables {
+			names, err := tx.tableColumns(table.Name)
+			if err != nil {
+				return err
+			}
+			columns[table.Name] = names
+
+			if !incremental {
+				var count int64
+				err := tx.db.QueryRow("SELECT COUNT(*) FROM " + table.Name).Scan(&count)
+				if err != nil {
+					return err
+				}
+				if count > 0 {
+					return fmt.Errorf("%v: %s has %d rows", ErrNotEmpty, table.Name, count)
+				}
+			}
+		}
+
+		if incremental {
+			for i := len(BackupTables) - 1; i >= 0; i-- {
+				if err := tx.deleteRemovedRows(BackupTables[i], source); err != nil {
+					return fmt.Errorf("%s: %v", BackupTables[i].Name, err)
+				}
+			}
+		}
+
+		for _, table := range BackupTables {
+			err := source.Rows(table, false, func(row Row) error {
+				return tx.restoreRow(table, columns[table.Name], row, incremental)
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %v", table.Name, err)
+			}
+		}
+
+		if fn != nil {
+			return fn()
+		}
+		return nil
+	})
+}
+
+// queryBackupRows calls fn with each row of query
+func (s *SQLStore) queryBackupRows(query string, args []interface{}, fn func(row Row) error) error {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		row := make(Row, len(columns))
+		for i, column := range columns {
+			if t, ok := values[i].(time.Time); ok && t.IsZero() {
+				continue
+			}
+			row[column] = backupValue(values[i])
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// backupValue converts what the drivers scan into values that survive JSON
+func backupValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.UTC().Format(backupTimeLayout)
+	}
+	return value
+}
+
+// tableColumns returns the columns of table, the columns of a restored row
+// are checked against them since they are put into the queries
+func (s *SQLStore) tableColumns(table string) (map[string]bool, error) {
+	rows, err := s.db.Query("SELECT * FROM " + table + " LIMIT 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]bool)
+	for _, name := range names {
+		columns[name] = true
+	}
+	return columns, nil
+}
+
+func (s *SQLStore) restoreRow(table BackupTable, columns map[string]bool, row Row, incremental bool) error {
+	names := make([]string, 0, len(row))
+	for name := range row {
+		if !columns[name] {
+			return fmt.Errorf("unknown column %s", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make([]interface{}, len(names))
+	for i, name := range names {
+		values[i] = row[name]
+	}
+
+	if incremental {
+		condition, keys, err := keyCondition(table, row)
+		if err != nil {
+			return err
+		}
+
+		var count int64
+		err = s.db.QueryRow("SELECT COUNT(*) FROM "+table.Name+" WHERE "+condition, keys...).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			assignments := make([]string, len(names))
+			for i, name := range names {
+				assignments[i] = name + " = ?"
+			}
+			_, err = s.db.Exec("UPDATE "+table.Name+" SET "+strings.Join(assignments, ", ")+" WHERE "+condition, append(values, keys...)...)
+			return err
+		}
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	_, err := s.db.Exec("INSERT INTO "+table.Name+" ("+strings.Join(names, ", ")+") VALUES ("+placeholders+")", values...)
+	return err
+}
+
+// deleteRemovedRows deletes the rows of table that are not among the keys of
+// an incremental backup
+func (s *SQLStore) deleteRemovedRows(table BackupTable, source RowSource) error {
+	kept := make(map[string]bool)
+	err := source.Rows(table, true, func(key Row) error {
+		_, values, err := keyCondition(table, key)
+		if err != nil {
+			return err
+		}
+		kept[fmt.Sprintf("%q", values)] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	keys := strings.Join(table.Key, ", ")
+	removed := [][]interface{}{}
+	err = s.queryBackupRows("SELECT "+keys+" FROM "+table.Name, nil, func(key Row) error {
+		_, values, err := keyCondition(table, key)
+		if err != nil {
+			return err
+		}
+		if !kept[fmt.Sprintf("%q", values)] {
+			removed = append(removed, values)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, values := range removed {
+		condition, _, _ := keyCondition(table, nil)
+		if _, err := s.db.Exec("DELETE FROM "+table.Name+" WHERE "+condition, values...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyCondition returns the WHERE condition on the key of table, and the
+// values of the key in row if it is given
+func keyCondition(table BackupTable, row Row) (string, []interface{}, error) {
+	conditions := make([]string, len(table.Key))
+	values := make([]interface{}, len(table.Key))
+	for i, column := range table.Key {
+		conditions[i] = column + " = ?"
+		if row == nil {
+			continue
+		}
+		value, exists := row[column]
+		if !exists || value == nil {
+			return "", nil, fmt.Errorf("a row has no %s", column)
+		}
+		values[i] = fmt.Sprint(value)
+	}
+	return strings.Join(conditions, " AND "), values, nil
+}
@@ -115,7 +115,7 @@ func (s *SQLStore) CreateNewCategory(category *models.Category) (*models.Categor
 
 // UpdateCategory updates an existing category
 func (s *SQLStore) UpdateCategory(category *models.Category) error {
-	_, err := s.db.Exec("UPDATE adventure_category SET title = ?, icon = ?, sort_order = ? WHERE id = ?",
+	_, err := s.db.Exec("UPDATE adventure_category SET title = ?, icon = ?, sort_order = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
 		category.Title,
 		category.Icon,
 		category.SortOrder,
@@ -83,7 +83,7 @@ func (s *SQLStore) deleteImagesByCategoryID(categoryID int64) error {
 
 	// Remove all references to the images in the category
 	// TODO: Make db-constraint instead of manual enforcement
-	_, err := s.db.Exec("UPDATE adventure_node SET image_id = null, image_layout_type = null WHERE id IN (SELECT id FROM image_item where image_category_id = ?)", categoryID)
+	_, err := s.db.Exec("UPDATE adventure_node SET image_id = null, image_layout_type = null WHERE image_id IN (SELECT id FROM image_item where image_category_id = ?)", categoryID)
 	if err != nil {
 		return err
 	}
@@ -2,7 +2,6 @@ package sqlstore
 
 import (
 	"database/sql"
-	"fmt"
 
 	"projektps/models"
 )
@@ -32,7 +31,7 @@ func (s *SQLStore) CreateNewLink(link *models.Link) (*models.Link, error) {
 }
 
 func (s *SQLStore) UpdateLink(link *models.Link) error {
-	_, err := s.db.Exec("UPDATE adventure_link SET source_node_id = ?, source_link_title = ?, target_node_id = ?, target_link_title = ?, link_type = ?, props = ?, updated_at = now() WHERE id = ? AND adventure_id = ?",
+	_, err := s.db.Exec("UPDATE adventure_link SET source_node_id = ?, source_link_title = ?, target_node_id = ?, target_link_title = ?, link_type = ?, props = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND adventure_id = ?",
 		link.SourceNodeID,
 		link.SourceLinkTitle,
 		link.TargetNodeID,
@@ -47,7 +46,6 @@ func (s *SQLStore) UpdateLink(link *models.Link) error {
 		return err
 	}
 
-	fmt.Println(link)
 	return nil
 }
 
@@ -62,12 +60,21 @@ func (s *SQLStore) DeleteLink(link *models.Link) error {
 	return nil
 }
 
-func (s *SQLStore) GetLink(linkID int64) (*models.Link, error) {
-	return nil, nil
+// GetLink retrieves a single link by its link_id within an adventure
+func (s *SQLStore) GetLink(adventureID int64, linkID int64) (*models.Link, error) {
+	row := s.db.QueryRow(linkQuery+" WHERE adventure_id = ? AND link_id = ?", adventureID, linkID)
+
+	l, err := scanLink(row)
+	if err != nil {
+		return nil, err
+	}
+
+	l.AdventureID = adventureID
+	return l, nil
 }
 
 func (s *SQLStore) GetLinksByAdventureID(adventureID int64) ([]models.Link, error) {
-	rows, err := s.db.Query("SELECT id, link_id, source_node_id, source_link_title, target_node_id, target_link_title, link_type, props FROM adventure_link WHERE adventure_id = ?", adventureID)
+	rows, err := s.db.Query(linkQuery+" WHERE adventure_id = ?", adventureID)
 	if err != nil {
 		return nil, err
 	}
@@ -77,34 +84,45 @@ func (s *SQLStore) GetLinksByAdventureID(adventureID int64) ([]models.Link, erro
 	links := []models.Link{}
 
 	for rows.Next() {
-		l := models.Link{}
-		var sourceLinkTitle sql.NullString
-		var targetLinkTitle sql.NullString
-		var linkType sql.NullString
-		var props sql.NullString
-
-		if err := rows.Scan(&l.ID, &l.LinkID, &l.SourceNodeID, &sourceLinkTitle, &l.TargetNodeID, &targetLinkTitle, &linkType, &props); err != nil {
+		l, err := scanLink(rows)
+		if err != nil {
 			return nil, err
 		}
 
-		if sourceLinkTitle.Valid {
-			l.SourceLinkTitle = sourceLinkTitle.String
-		}
+		links = append(links, *l)
+	}
 
-		if targetLinkTitle.Valid {
-			l.TargetLinkTitle = targetLinkTitle.String
-		}
+	return links, nil
+}
 
-		if linkType.Valid {
-			l.LinkType = linkType.String
-		}
+const linkQuery = "SELECT id, link_id, source_node_id, source_link_title, target_node_id, target_link_title, link_type, props FROM adventure_link"
 
-		if props.Valid {
-			l.Props = props.String
-		}
+func scanLink(row rowScanner) (*models.Link, error) {
+	l := &models.Link{}
+	var sourceLinkTitle sql.NullString
+	var targetLinkTitle sql.NullString
+	var linkType sql.NullString
+	var props sql.NullString
 
-		links = append(links, l)
+	if err := row.Scan(&l.ID, &l.LinkID, &l.SourceNodeID, &sourceLinkTitle, &l.TargetNodeID, &targetLinkTitle, &linkType, &props); err != nil {
+		return nil, err
 	}
 
-	return links, nil
+	if sourceLinkTitle.Valid {
+		l.SourceLinkTitle = sourceLinkTitle.String
+	}
+
+	if targetLinkTitle.Valid {
+		l.TargetLinkTitle = targetLinkTitle.String
+	}
+
+	if linkType.Valid {
+		l.LinkType = linkType.String
+	}
+
+	if props.Valid {
+		l.Props = props.String
+	}
+
+	return l, nil
 }
@@ -112,6 +112,9 @@ func (s *SQLStore) GetListsByParent(listSlug string) ([]models.List, error) {
 		if description.Valid {
 			l.Description = description.String
 		}
+		if createdAt.Valid {
+			l.CreatedAt = createdAt.Time
+		}
 		if parentID.Valid {
 			l.ParentID = parentID.Int64
 		}
@@ -189,7 +192,7 @@ func (s *SQLStore) CreateNewList(list *models.List) (*models.List, error) {
 // UpdateList updates a list and its items
 func (s *SQLStore) UpdateList(list *models.List) error {
 
-	_, err := s.db.Exec("UPDATE adventure_list SET title = ?, description = ?, parent_id = ? WHERE id = ?",
+	_, err := s.db.Exec("UPDATE adventure_list SET title = ?, description = ?, parent_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
 		list.Title,
 		list.Description,
 		list.ParentID,
@@ -0,0 +1,234 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"projektps/models"
+)
+
+const mediaQuery = `
+	SELECT
+		m.id, m.hash, m.url, m.size, m.content_type, m.created_at,
+		m.width, m.height, m.thumbnail, m.variants,
+		COALESCE((SELECT SUM(r.ref_count) FROM media_reference r WHERE r.media_id = m.id), 0)
+	FROM
+		media m`
+
+// CreateMedia records an uploaded file, or returns the record of the file
+// with the same hash if there is one
+func (s *SQLStore) CreateMedia(media *models.Media) (*models.Media, error) {
+	var created *models.Media
+	err := s.transaction(func(tx *SQLStore) error {
+		existing, err := tx.GetMediaByHash(media.Hash)
+		if err != sql.ErrNoRows {
+			created = existing
+			return err
+		}
+
+		variants, err := marshalVariants(media.Variants)
+		if err != nil {
+			return err
+		}
+		res, err := tx.db.Exec("INSERT INTO media (hash, url, size, content_type, width, height, thumbnail, variants, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)",
+			media.Hash,
+			media.URL,
+			media.Size,
+			media.ContentType,
+			media.Width,
+			media.Height,
+			media.Thumbnail,
+			variants)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		created, err = tx.getMedia(mediaQuery+" WHERE m.id = ?", id)
+		return err
+	})
+	return created, err
+}
+
+// GetMediaByHash returns the record of the file with the SHA-256 hash
+func (s *SQLStore) GetMediaByHash(hash string) (*models.Media, error) {
+	return s.getMedia(mediaQuery+" WHERE m.hash = ?", hash)
+}
+
+// GetMedia returns the records of every uploaded file, oldest first
+func (s *SQLStore) GetMedia() ([]models.Media, error) {
+	rows, err := s.db.Query(mediaQuery + " ORDER BY m.id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	media := []models.Media{}
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		media = append(media, *m)
+	}
+	return media, rows.Err()
+}
+
+// UpdateMedia saves the size, type and variants of a file that was
+// processed again
+func (s *SQLStore) UpdateMedia(media *models.Media) error {
+	variants, err := marshalVariants(media.Variants)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("UPDATE media SET size = ?, content_type = ?, width = ?, height = ?, thumbnail = ?, variants = ? WHERE id = ?",
+		media.Size,
+		media.ContentType,
+		media.Width,
+		media.Height,
+		media.Thumbnail,
+		variants,
+		media.ID)
+	return err
+}
+
+// DeleteMedia removes the record of a file along with its references
+func (s *SQLStore) DeleteMedia(mediaID int64) error {
+	_, err := s.db.Exec("DELETE FROM media WHERE id = ?", mediaID)
+	return err
+}
+
+// UpdateMediaReferences counts the references of an adventure again
+func (s *SQLStore) UpdateMediaReferences(adventureID int64) error {
+	return s.transaction(func(tx *SQLStore) error {
+		var slug string
+		err := tx.db.QueryRow("SELECT slug FROM adventure WHERE id = ?", adventureID).Scan(&slug)
+		if err != nil {
+			return err
+		}
+		adventure, err := tx.GetAdventure(slug, models.ReadWrite)
+		if err != nil {
+			return err
+		}
+		return tx.updateMediaReferences(adventure)
+	})
+}
+
+// updateMediaReferences replaces the references of adventure with the ones
+// of its content. Files without a record are not counted. The uploads of the
+// files it referred to are removed, see store.MediaRecords.
+func (s *SQLStore) updateMediaReferences(adventure *models.Adventure) error {
+	_, err := s.db.Exec(`
+		DELETE FROM media_upload WHERE adventure_id = ? AND media_id IN
+			(SELECT r.media_id FROM media_reference r WHERE r.adventure_id = ?)`, adventure.ID, adventure.ID)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("DELETE FROM media_reference WHERE adventure_id = ?", adventure.ID)
+	if err != nil {
+		return err
+	}
+
+	for hash, count := range adventure.MediaReferences() {
+		var mediaID int64
+		err := s.db.QueryRow("SELECT id FROM media WHERE hash = ?", hash).Scan(&mediaID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = s.db.Exec("INSERT INTO media_reference (media_id, adventure_id, ref_count) VALUES (?, ?, ?)", mediaID, adventure.ID, count)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddMediaUpload records that a file was uploaded to an adventure
+func (s *SQLStore) AddMediaUpload(mediaID int64, adventureID int64) error {
+	var exists int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM media_upload WHERE media_id = ? AND adventure_id = ?", mediaID, adventureID).Scan(&exists)
+	if err != nil || exists > 0 {
+		return err
+	}
+	_, err = s.db.Exec("INSERT INTO media_upload (media_id, adventure_id, created_at) VALUES (?, ?, CURRENT_TIMESTAMP)", mediaID, adventureID)
+	return err
+}
+
+// RemoveMediaUpload removes the upload of a file to an adventure
+func (s *SQLStore) RemoveMediaUpload(mediaID int64, adventureID int64) error {
+	_, err := s.db.Exec("DELETE FROM media_upload WHERE media_id = ? AND adventure_id = ?", mediaID, adventureID)
+	return err
+}
+
+// GetAdventureMedia returns the files that were uploaded to an adventure or
+// that it refers to, each once
+func (s *SQLStore) GetAdventureMedia(adventureID int64) ([]models.Media, error) {
+	rows, err := s.db.Query(mediaQuery+`
+		WHERE
+			m.id IN (SELECT u.media_id FROM media_upload u WHERE u.adventure_id = ?) OR
+			m.id IN (SELECT r.media_id FROM media_reference r WHERE r.adventure_id = ?)
+		ORDER BY m.id`, adventureID, adventureID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	media := []models.Media{}
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		media = append(media, *m)
+	}
+	return media, rows.Err()
+}
+
+func (s *SQLStore) getMedia(query string, args ...interface{}) (*models.Media, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, sql.ErrNoRows
+	}
+	return scanMedia(rows)
+}
+
+func scanMedia(rows *sql.Rows) (*models.Media, error) {
+	m := &models.Media{}
+	var variants string
+	err := rows.Scan(&m.ID, &m.Hash, &m.URL, &m.Size, &m.ContentType, &m.CreatedAt, &m.Width, &m.Height, &m.Thumbnail, &variants, &m.RefCount)
+	if err != nil {
+		return nil, err
+	}
+	if variants != "" {
+		err = json.Unmarshal([]byte(variants), &m.Variants)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// marshalVariants returns the variants as they are saved, "" if there are
+// none
+func marshalVariants(variants []models.MediaVariant) (string, error) {
+	if len(variants) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(variants)
+	return string(data), err
+}
@@ -0,0 +1,390 @@
+package sqlstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration is a numbered change to the database schema. Up is read from
+// NN_name.sql and Down, if there is one, from NN_name.down.sql.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationStatus tells whether a migration has been applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+
+	// Modified is set if the migration file has changed since it was applied
+	Modified bool
+
+	// Missing is set if the migration has been applied but its file is gone
+	Missing bool
+}
+
+// ErrMigrationModified is returned when an applied migration file has been
+// edited afterwards. Migrations are never changed, add a new one instead.
+var ErrMigrationModified = errors.New("applied migrations have been modified")
+
+// ErrNotBaselined is returned when migrating a database that was set up
+// before migrations were tracked
+var ErrNotBaselined = errors.New("the database has tables but no recorded migrations, run \"toolps migrate baseline\" first")
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(.+?)(\.down)?\.sql$`)
+
+const createMigrationTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version bigint NOT NULL PRIMARY KEY,
+  name varchar(255) NOT NULL,
+  checksum char(64) NOT NULL,
+  applied_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// LoadMigrations reads the migrations in dir of fsys, ordered by version
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	downs := make(map[int64]string)
+
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration %s: %v", entry.Name(), err)
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if match[3] != "" {
+			downs[version] = string(content)
+			continue
+		}
+
+		if existing, exists := byVersion[version]; exists {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", existing.Name, match[2])
+		}
+
+		checksum := sha256.Sum256(content)
+		byVersion[version] = &Migration{
+			Version:  version,
+			Name:     match[2],
+			Up:       string(content),
+			Checksum: hex.EncodeToString(checksum[:]),
+		}
+	}
+
+	for version, down := range downs {
+		migration, exists := byVersion[version]
+		if !exists {
+			return nil, fmt.Errorf("down migration %d has no up migration", version)
+		}
+		migration.Down = down
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// String returns the migration as it is named on disk, e.g. 25_adventure_revision
+func (m Migration) String() string {
+	return fmt.Sprintf("%02d_%s", m.Version, m.Name)
+}
+
+// MigrationStatus lists every migration along with whether it is applied,
+// including applied migrations whose files no longer exist
+func (s *SQLStore) MigrationStatus(migrations []Migration) ([]MigrationStatus, error) {
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []MigrationStatus{}
+	for _, migration := range migrations {
+		status := MigrationStatus{Migration: migration}
+		if record, exists := applied[migration.Version]; exists {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+			status.Modified = record.Checksum != migration.Checksum
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	for _, record := range applied {
+		statuses = append(statuses, MigrationStatus{
+			Migration: record.Migration,
+			Applied:   true,
+			AppliedAt: record.AppliedAt,
+			Missing:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+
+	return statuses, nil
+}
+
+// MigrateUp applies pending migrations in order, at most steps of them
+// unless steps is 0. MySQL can not roll back schema changes, so a migration
+// that fails halfway has to be cleaned up by hand before running it again.
+// SQLite rolls the migration back, see execSQLite for how it runs them.
+func (s *SQLStore) MigrateUp(migrations []Migration, steps int) ([]Migration, error) {
+	statuses, err := s.MigrationStatus(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	modified := []string{}
+	pending := []Migration{}
+	recorded := 0
+	for _, status := range statuses {
+		if status.Applied {
+			recorded++
+		}
+		if status.Modified {
+			modified = append(modified, status.String())
+		}
+		if !status.Applied {
+			pending = append(pending, status.Migration)
+		}
+	}
+	if len(modified) > 0 {
+		return nil, fmt.Errorf("%v: %s", ErrMigrationModified, strings.Join(modified, ", "))
+	}
+
+	// Running the first migrations on a database created by setup.sh would
+	// drop its tables
+	if recorded == 0 && len(pending) > 0 && s.hasTable("adventure") {
+		return nil, ErrNotBaselined
+	}
+
+	if steps > 0 && steps < len(pending) {
+		pending = pending[:steps]
+	}
+
+	foreignKeysOn, err := s.foreignKeysOff()
+	if err != nil {
+		return nil, err
+	}
+	defer foreignKeysOn()
+
+	for i, migration := range pending {
+		err := s.transaction(func(tx *SQLStore) error {
+			if err := tx.execMigration(migration.Up); err != nil {
+				return err
+			}
+			return tx.recordMigration(migration)
+		})
+		if err != nil {
+			return pending[:i], fmt.Errorf("migration %s failed: %v", migration, err)
+		}
+	}
+
+	return pending, nil
+}
+
+// MigrateDown reverts the latest applied migrations, steps of them. Every
+// reverted migration must have a down migration.
+func (s *SQLStore) MigrateDown(migrations []Migration, steps int) ([]Migration, error) {
+	statuses, err := s.MigrationStatus(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	reverting := []Migration{}
+	for i := len(statuses) - 1; i >= 0 && len(reverting) < steps; i-- {
+		status := statuses[i]
+		if !status.Applied {
+			continue
+		}
+		if status.Missing || status.Down == "" {
+			return nil, fmt.Errorf("migration %s has no down migration", status.Migration)
+		}
+		reverting = append(reverting, status.Migration)
+	}
+
+	foreignKeysOn, err := s.foreignKeysOff()
+	if err != nil {
+		return nil, err
+	}
+	defer foreignKeysOn()
+
+	for i, migration := range reverting {
+		err := s.transaction(func(tx *SQLStore) error {
+			if err := tx.execMigration(migration.Down); err != nil {
+				return err
+			}
+			_, err := tx.db.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+			return err
+		})
+		if err != nil {
+			return reverting[:i], fmt.Errorf("down migration %s failed: %v", migration, err)
+		}
+	}
+
+	return reverting, nil
+}
+
+// BaselineMigrations records the migrations up to and including version as
+// applied without running them. It is used once on databases that were set
+// up before migrations were tracked.
+func (s *SQLStore) BaselineMigrations(migrations []Migration, version int64) ([]Migration, error) {
+	statuses, err := s.MigrationStatus(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := []Migration{}
+	err = s.transaction(func(tx *SQLStore) error {
+		for _, status := range statuses {
+			if status.Applied || status.Version > version {
+				continue
+			}
+			if err := tx.recordMigration(status.Migration); err != nil {
+				return err
+			}
+			recorded = append(recorded, status.Migration)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recorded, nil
+}
+
+type migrationRecord struct {
+	Migration
+	AppliedAt time.Time
+}
+
+func (s *SQLStore) appliedMigrations() (map[int64]migrationRecord, error) {
+	_, err := s.db.Exec(createMigrationTable)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query("SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]migrationRecord)
+	for rows.Next() {
+		record := migrationRecord{}
+		if err := rows.Scan(&record.Version, &record.Name, &record.Checksum, &record.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[record.Version] = record
+	}
+
+	return applied, rows.Err()
+}
+
+func (s *SQLStore) recordMigration(migration Migration) error {
+	_, err := s.db.Exec("INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)",
+		migration.Version,
+		migration.Name,
+		migration.Checksum)
+	return err
+}
+
+func (s *SQLStore) hasTable(table string) bool {
+	var count int64
+	err := s.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count)
+	return err == nil
+}
+
+// splitStatements splits a migration into its statements, since the MySQL
+// driver runs a single statement at a time. Semicolons within quotes and
+// comments do not end a statement.
+func splitStatements(script string) []string {
+	statements := []string{}
+	var current strings.Builder
+	var quote rune
+	comment := ""
+
+	flush := func() {
+		statement := strings.TrimSpace(current.String())
+		if statement != "" {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+
+		switch {
+		case comment == "--":
+			if r == '\n' {
+				comment = ""
+				current.WriteRune(r)
+			}
+		case comment == "/*":
+			if r == '*' && next == '/' {
+				comment = ""
+				i++
+			}
+		case quote != 0:
+			current.WriteRune(r)
+			if r == '\\' && quote != '`' && next != 0 {
+				current.WriteRune(next)
+				i++
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+			current.WriteRune(r)
+		case r == '-' && next == '-':
+			comment = "--"
+		case r == '/' && next == '*':
+			comment = "/*"
+			i++
+		case r == ';':
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return statements
+}
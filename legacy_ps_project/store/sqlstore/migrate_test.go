@@ -0,0 +1,345 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"projektps/database"
+)
+
+var testMigrations = fstest.MapFS{
+	"migrations/01_fruit.sql":      {Data: []byte("-- Adds fruit\nCREATE TABLE fruit (id integer PRIMARY KEY, name varchar(30) DEFAULT 'a;b');\nINSERT INTO fruit (name) VALUES ('äpple');\n")},
+	"migrations/01_fruit.down.sql": {Data: []byte("DROP TABLE fruit;")},
+	"migrations/02_basket.sql":     {Data: []byte("CREATE TABLE basket (id integer PRIMARY KEY);")},
+	"migrations/README.md":         {Data: []byte("not a migration")},
+}
+
+// newEmptySQLiteStore returns a store without the application schema
+func newEmptySQLiteStore(t *testing.T) *SQLStore {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+
+	return &SQLStore{db: db, conn: db, retention: DefaultRevisionRetention, sqlite: true}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(testMigrations, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("expected 2 migrations, got %d", len(migrations))
+	}
+	if migrations[0].String() != "01_fruit" || migrations[0].Down == "" || migrations[1].Down != "" {
+		t.Errorf("unexpected migrations %+v", migrations)
+	}
+
+	// The migrations that ship with the server
+	migrations, err = LoadMigrations(database.Migrations, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 || migrations[len(migrations)-1].Name != "play_session" {
+		t.Errorf("unexpected embedded migrations %+v", migrations)
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	s := newEmptySQLiteStore(t)
+	defer s.Close()
+
+	migrations, err := LoadMigrations(testMigrations, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := s.MigrateUp(migrations, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0].Version != 1 {
+		t.Fatalf("expected the first migration, got %+v", applied)
+	}
+
+	var name string
+	if err := s.db.QueryRow("SELECT name FROM fruit").Scan(&name); err != nil || name != "äpple" {
+		t.Errorf("expected the migration to be applied, got %q and %v", name, err)
+	}
+
+	applied, err = s.MigrateUp(migrations, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0].Version != 2 {
+		t.Fatalf("expected the second migration, got %+v", applied)
+	}
+
+	statuses, err := s.MigrationStatus(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if !status.Applied || status.Modified || status.AppliedAt.IsZero() {
+			t.Errorf("unexpected status %+v", status)
+		}
+	}
+
+	// 02 has no down migration
+	if _, err := s.MigrateDown(migrations, 1); err == nil {
+		t.Error("expected an error for a missing down migration")
+	}
+
+	_, err = s.MigrateDown(migrations[:1], 1)
+	if err == nil {
+		t.Error("expected an error for an applied migration without file")
+	}
+
+	s.db.Exec("DELETE FROM schema_migrations WHERE version = 2")
+	reverted, err := s.MigrateDown(migrations, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != 1 {
+		t.Fatalf("expected the first migration to be reverted, got %+v", reverted)
+	}
+	if s.hasTable("fruit") {
+		t.Error("expected the down migration to drop the table")
+	}
+}
+
+func TestMigrateModified(t *testing.T) {
+	s := newEmptySQLiteStore(t)
+	defer s.Close()
+
+	migrations, err := LoadMigrations(testMigrations, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MigrateUp(migrations, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	migrations[0].Checksum = "edited"
+
+	statuses, err := s.MigrationStatus(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[0].Modified {
+		t.Error("expected the migration to be modified")
+	}
+
+	_, err = s.MigrateUp(migrations, 0)
+	if err == nil || !strings.Contains(err.Error(), "01_fruit") {
+		t.Errorf("expected a modified migration error, got %v", err)
+	}
+}
+
+func TestMigrateBaseline(t *testing.T) {
+	// A database that has the tables of the migrations but no records
+	s := newEmptySQLiteStore(t)
+	defer s.Close()
+	if _, err := s.db.Exec("CREATE TABLE adventure (id integer PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err := LoadMigrations(database.Migrations, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.MigrateUp(migrations, 0); err != ErrNotBaselined {
+		t.Fatalf("expected ErrNotBaselined, got %v", err)
+	}
+
+	recorded, err := s.BaselineMigrations(migrations, migrations[len(migrations)-1].Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != len(migrations) {
+		t.Errorf("expected %d migrations to be recorded, got %d", len(migrations), len(recorded))
+	}
+
+	applied, err := s.MigrateUp(migrations, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("expected nothing to apply, got %+v", applied)
+	}
+}
+
+func TestSQLiteNotBaselined(t *testing.T) {
+	// A file with tables but no recorded migrations is not opened until it
+	// has been baselined
+	path := filepath.Join(t.TempDir(), "projektps.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("CREATE TABLE adventure (id integer PRIMARY KEY)")
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSQLiteStore(path)
+	if err == nil {
+		s.Close()
+	}
+	if err == nil || !strings.Contains(err.Error(), ErrNotBaselined.Error()) {
+		t.Errorf("expected ErrNotBaselined, got %v", err)
+	}
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	// The store applies the migrations when it is opened
+	s := newTestSQLiteStore(t)
+	defer s.Close()
+
+	migrations, err := LoadMigrations(database.Migrations, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := s.MigrationStatus(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if !status.Applied {
+			t.Errorf("expected %s to be applied", status.Migration)
+		}
+	}
+
+	// 18 renames version to cover_url, which may be NULL, and drops image_id.
+	// Added columns come last.
+	columns, _, err := s.sqliteColumns("adventure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"id", "category_id", "slug", "view_slug", "cover_url", "title", "description", "created_at", "updated_at", "locked", "edit_version", "view_count", "props"}
+	if !reflect.DeepEqual(columns, expected) {
+		t.Errorf("expected the columns %v, got %v", expected, columns)
+	}
+	var notNull bool
+	if err := s.db.QueryRow("SELECT \"notnull\" FROM pragma_table_info('adventure') WHERE name = 'cover_url'").Scan(&notNull); err != nil || notNull {
+		t.Errorf("expected cover_url to allow NULL, got %v and %v", notNull, err)
+	}
+
+	// 17 deletes the nodes along with their adventure
+	var onDelete string
+	if err := s.db.QueryRow("SELECT on_delete FROM pragma_foreign_key_list('adventure_node')").Scan(&onDelete); err != nil || onDelete != "CASCADE" {
+		t.Errorf("expected the nodes to be deleted with the adventure, got %q and %v", onDelete, err)
+	}
+
+	// The down migrations are translated as well
+	reverted, err := s.MigrateDown(migrations, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 5 || s.hasTable("media") || !s.hasTable("adventure_revision") {
+		t.Errorf("unexpected reverted migrations %+v", reverted)
+	}
+	if _, err := s.MigrateUp(migrations, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateDefaultAdventure(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateDuplicateSlugs(t *testing.T) {
+	s := newEmptySQLiteStore(t)
+	defer s.Close()
+
+	migrations, err := LoadMigrations(database.Migrations, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := 0
+	for migrations[steps].Name != "adventure_slug" {
+		steps++
+	}
+	if _, err := s.MigrateUp(migrations, steps); err != nil {
+		t.Fatal(err)
+	}
+
+	// Slugs were not unique before 26
+	seed := [][]string{
+		{"skog", "spela"},
+		{"skog", "spela"},
+		{"sjo", "spela"},
+		{"skog", strings.Repeat("s", 30)},
+		{strings.Repeat("f", 30), strings.Repeat("s", 30)},
+	}
+	for _, slugs := range seed {
+		if _, err := s.db.Exec("INSERT INTO adventure (slug, view_slug) VALUES (?, ?)", slugs[0], slugs[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := s.MigrateUp(migrations, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := s.db.Query("SELECT slug, view_slug FROM adventure ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	slugs := [][]string{}
+	for rows.Next() {
+		var slug, viewSlug string
+		if err := rows.Scan(&slug, &viewSlug); err != nil {
+			t.Fatal(err)
+		}
+		slugs = append(slugs, []string{slug, viewSlug})
+	}
+	expected := [][]string{
+		{"skog", "spela"},
+		{"skog2", "spela-2"},
+		{"sjo", "spela-3"},
+		{"skog4", strings.Repeat("s", 30)},
+		{strings.Repeat("f", 30), strings.Repeat("s", 28) + "-5"},
+	}
+	if !reflect.DeepEqual(slugs, expected) {
+		t.Errorf("expected the slugs %v, got %v", expected, slugs)
+	}
+}
+
+func TestSQLiteCreateTable(t *testing.T) {
+	statements := sqliteCreateTableStatements("", "media_reference", "id int(11) NOT NULL AUTO_INCREMENT,\n  media_id int(11) NOT NULL DEFAULT 0,\n  note varchar(10) DEFAULT 'a, b',\n  PRIMARY KEY (id),\n  UNIQUE KEY media_reference_media (media_id, note),\n  KEY (note),\n  CONSTRAINT media_reference_ibfk_1 FOREIGN KEY (media_id) REFERENCES media (id) ON DELETE CASCADE")
+
+	expected := []string{
+		"CREATE TABLE media_reference (\n  id INTEGER PRIMARY KEY AUTOINCREMENT,\n  media_id int(11) NOT NULL DEFAULT 0,\n  note varchar(10) DEFAULT 'a, b',\n  CONSTRAINT media_reference_ibfk_1 FOREIGN KEY (media_id) REFERENCES media (id) ON DELETE CASCADE\n)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS media_reference_media ON media_reference (media_id, note)",
+		"CREATE INDEX IF NOT EXISTS media_reference_note ON media_reference (note)",
+	}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(statements, "\n"))
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := "-- comment; with semicolon\nCREATE TABLE a (b varchar(3) DEFAULT ';');\n/* block; */INSERT INTO a VALUES ('it\\'s;');\n\nCREATE TRIGGER t BEFORE UPDATE ON a\nFOR EACH ROW SET NEW.b = `x;y`;"
+
+	expected := []string{
+		"CREATE TABLE a (b varchar(3) DEFAULT ';')",
+		"INSERT INTO a VALUES ('it\\'s;')",
+		"CREATE TRIGGER t BEFORE UPDATE ON a\nFOR EACH ROW SET NEW.b = `x;y`",
+	}
+
+	statements := splitStatements(script)
+	if !reflect.DeepEqual(statements, expected) {
+		t.Errorf("expected %q, got %q", expected, statements)
+	}
+}
@@ -70,31 +70,23 @@ func (s *SQLStore) DeleteNode(node *models.Node) error {
 	return nil
 }
 
-// GetNode retrieves a single node
-func (s *SQLStore) GetNode(nodeID int64) error {
-	return nil
+// GetNode retrieves a single node by its node_id within an adventure
+func (s *SQLStore) GetNode(adventureID int64, nodeID int64) (*models.Node, error) {
+	row := s.db.QueryRow(nodeQuery+" WHERE an.adventure_id = ? AND an.node_id = ?", adventureID, nodeID)
+
+	n, err := scanNode(row)
+	if err != nil {
+		return nil, err
+	}
+
+	n.AdventureID = adventureID
+	return n, nil
 }
 
 // GetNodesByAdventureID retrieves all nodes in a specific adventure
 func (s *SQLStore) GetNodesByAdventureID(adventureID int64) ([]models.Node, error) {
-	query := `SELECT
-									an.id,
-									an.node_id,
-									an.title,
-									an.icon,
-									an.content,
-									an.image_url,
-									an.image_id,
-									an.image_layout_type,
-									an.node_type,
-									an.position_x,
-									an.position_y,
-									an.props
-						FROM adventure_node an
-						WHERE an.adventure_id = ?`
-
 	// Old query: "SELECT id, node_id, title, icon, content, image_url, image_id, image_layout_type, node_type, position_x, position_y FROM adventure_node WHERE adventure_id = ?
-	rows, err := s.db.Query(query, adventureID)
+	rows, err := s.db.Query(nodeQuery+" WHERE an.adventure_id = ?", adventureID)
 	if err != nil {
 		return nil, err
 	}
@@ -104,59 +96,88 @@ func (s *SQLStore) GetNodesByAdventureID(adventureID int64) ([]models.Node, erro
 	nodes := []models.Node{}
 
 	for rows.Next() {
-		n := models.Node{}
-		var nodeIcon sql.NullString
-		var nodeType sql.NullString
-		var imageURL sql.NullString
-		var imageID sql.NullInt64
-		var imageLayoutType sql.NullString
-		var nodeContent sql.NullString
-		var xPosition sql.NullInt64
-		var yPosition sql.NullInt64
-		var props sql.NullString
-
-		if err := rows.Scan(&n.ID, &n.NodeID, &n.Title, &nodeIcon, &nodeContent, &imageURL, &imageID, &imageLayoutType, &nodeType, &xPosition, &yPosition, &props); err != nil {
+		n, err := scanNode(rows)
+		if err != nil {
 			return nil, err
 		}
 
-		if imageURL.Valid {
-			n.ImageURL = imageURL.String
-		}
+		nodes = append(nodes, *n)
+	}
 
-		if imageID.Valid {
-			n.ImageID = imageID.Int64
-		}
+	return nodes, nil
+}
 
-		if imageLayoutType.Valid {
-			n.ImageLayoutType = imageLayoutType.String
-		}
+const nodeQuery = `SELECT
+								an.id,
+								an.node_id,
+								an.title,
+								an.icon,
+								an.content,
+								an.image_url,
+								an.image_id,
+								an.image_layout_type,
+								an.node_type,
+								an.position_x,
+								an.position_y,
+								an.props
+					FROM adventure_node an`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
-		if nodeType.Valid {
-			n.NodeType = nodeType.String
-		}
+func scanNode(row rowScanner) (*models.Node, error) {
+	n := &models.Node{}
+	var nodeIcon sql.NullString
+	var nodeType sql.NullString
+	var imageURL sql.NullString
+	var imageID sql.NullInt64
+	var imageLayoutType sql.NullString
+	var nodeContent sql.NullString
+	var xPosition sql.NullInt64
+	var yPosition sql.NullInt64
+	var props sql.NullString
+
+	if err := row.Scan(&n.ID, &n.NodeID, &n.Title, &nodeIcon, &nodeContent, &imageURL, &imageID, &imageLayoutType, &nodeType, &xPosition, &yPosition, &props); err != nil {
+		return nil, err
+	}
 
-		if nodeIcon.Valid {
-			n.Icon = nodeIcon.String
-		}
+	if imageURL.Valid {
+		n.ImageURL = imageURL.String
+	}
 
-		if nodeContent.Valid {
-			n.Content = nodeContent.String
-		}
+	if imageID.Valid {
+		n.ImageID = imageID.Int64
+	}
 
-		if xPosition.Valid {
-			n.X = xPosition.Int64
-		}
+	if imageLayoutType.Valid {
+		n.ImageLayoutType = imageLayoutType.String
+	}
 
-		if yPosition.Valid {
-			n.Y = yPosition.Int64
-		}
+	if nodeType.Valid {
+		n.NodeType = nodeType.String
+	}
 
-		if props.Valid {
-			n.Props = props.String
-		}
+	if nodeIcon.Valid {
+		n.Icon = nodeIcon.String
+	}
 
-		nodes = append(nodes, n)
+	if nodeContent.Valid {
+		n.Content = nodeContent.String
 	}
 
-	return nodes, nil
+	if xPosition.Valid {
+		n.X = xPosition.Int64
+	}
+
+	if yPosition.Valid {
+		n.Y = yPosition.Int64
+	}
+
+	if props.Valid {
+		n.Props = props.String
+	}
+
+	return n, nil
 }
@@ -0,0 +1,301 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"projektps/models"
+)
+
+// CreatePlaySession records a new session, a session with the same id is
+// left as it is. The times are those of the session that was stored.
+func (s *SQLStore) CreatePlaySession(session *models.PlaySession) error {
+	// Only a duplicate id is ignored, an IGNORE would also let a missing
+	// adventure through on MySQL
+	query := "INSERT INTO play_session (id, adventure_id, started_at, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP) ON DUPLICATE KEY UPDATE id = id"
+	if s.sqlite {
+		query = "INSERT INTO play_session (id, adventure_id, started_at, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP) ON CONFLICT (id) DO NOTHING"
+	}
+	_, err := s.db.Exec(query, session.ID, session.AdventureID)
+	if err != nil {
+		return err
+	}
+	return s.db.QueryRow("SELECT started_at, updated_at FROM play_session WHERE id = ?", session.ID).
+		Scan(&session.StartedAt, &session.UpdatedAt)
+}
+
+// GetPlaySession returns a session with its events
+func (s *SQLStore) GetPlaySession(id string) (*models.PlaySession, error) {
+	session := &models.PlaySession{ID: id}
+	err := s.db.QueryRow("SELECT adventure_id, started_at, updated_at FROM play_session WHERE id = ?", id).
+		Scan(&session.AdventureID, &session.StartedAt, &session.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query("SELECT session_id, seq, type, node_id, link_id, offset_ms FROM play_event WHERE session_id = ? ORDER BY seq", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events, err := scanPlayEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	session.Events = events[id]
+	if session.Events == nil {
+		session.Events = []models.PlayEvent{}
+	}
+	return session, nil
+}
+
+// AddPlayEvents adds events to the end of a session
+func (s *SQLStore) AddPlayEvents(id string, events []models.PlayEvent) error {
+	return s.transaction(func(tx *SQLStore) error {
+		var exists int
+		err := tx.db.QueryRow("SELECT COUNT(*) FROM play_session WHERE id = ?", id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return sql.ErrNoRows
+		}
+
+		_, err = tx.db.Exec("UPDATE play_session SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			_, err := tx.db.Exec("INSERT INTO play_event (session_id, seq, type, node_id, link_id, offset_ms, created_at) VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)",
+				id,
+				event.Seq,
+				string(event.Type),
+				event.NodeID,
+				event.LinkID,
+				event.Offset)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// playPeriod limits a query to the sessions p of an adventure that started
+// in a period, its arguments are the adventure id, from and to
+const playPeriod = "p.adventure_id = ? AND p.started_at >= ? AND p.started_at <= ?"
+
+// playTime writes t like the CURRENT_TIMESTAMP the sessions are written with,
+// so that SQLite compares the same text
+func playTime(t time.Time) string {
+	return t.UTC().Format(backupTimeLayout)
+}
+
+// CountPlaySessions counts the sessions of an adventure by how they ended.
+// Nothing follows the end of a session, so the sessions with an end event
+// are the completed ones.
+func (s *SQLStore) CountPlaySessions(adventureID int64, from time.Time, to time.Time, idle time.Duration) (*models.PlayCounts, error) {
+	idleSince, idleArg := s.timeAgo(idle)
+	counts := &models.PlayCounts{}
+	err := s.db.QueryRow(`
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN x.session_id IS NOT NULL THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN x.session_id IS NULL AND p.updated_at <= `+idleSince+` THEN 1 ELSE 0 END), 0)
+		FROM play_session p
+		LEFT JOIN play_event x ON x.session_id = p.id AND x.type = 'end'
+		WHERE `+playPeriod, idleArg, adventureID, playTime(from), playTime(to)).
+		Scan(&counts.Sessions, &counts.Completed, &counts.Abandoned)
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// GetPlayNodeCounts returns the counts of the nodes shown in the sessions of
+// an adventure, by node id. The events of a session are numbered without
+// gaps, so the event after a node has the next seq.
+func (s *SQLStore) GetPlayNodeCounts(adventureID int64, from time.Time, to time.Time, idle time.Duration) ([]models.PlayNodeCounts, error) {
+	idleSince, idleArg := s.timeAgo(idle)
+	rows, err := s.db.Query(`
+		SELECT
+			e.node_id,
+			COUNT(*),
+			COUNT(DISTINCT e.session_id),
+			COUNT(DISTINCT CASE WHEN x.session_id IS NOT NULL OR p.updated_at <= `+idleSince+` THEN e.session_id END),
+			SUM(CASE WHEN x.session_id IS NULL AND p.updated_at <= `+idleSince+` AND NOT EXISTS (
+				SELECT 1 FROM play_event l WHERE l.session_id = e.session_id AND l.type = 'node' AND l.seq > e.seq
+			) THEN 1 ELSE 0 END)
+		FROM play_session p
+		JOIN play_event e ON e.session_id = p.id AND e.type = 'node'
+		LEFT JOIN play_event x ON x.session_id = p.id AND x.type = 'end'
+		WHERE `+playPeriod+` AND e.node_id IS NOT NULL
+		GROUP BY e.node_id
+		ORDER BY e.node_id`, idleArg, idleArg, adventureID, playTime(from), playTime(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []models.PlayNodeCounts{}
+	index := make(map[int64]int)
+	for rows.Next() {
+		var c models.PlayNodeCounts
+		if err := rows.Scan(&c.NodeID, &c.Visits, &c.Sessions, &c.Concluded, &c.DropOffs); err != nil {
+			return nil, err
+		}
+		c.Durations = []int64{}
+		index[c.NodeID] = len(counts)
+		counts = append(counts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// The end comes as soon as a node without links is shown, so only a
+	// choice or another node tells how long the node was read
+	rows, err = s.db.Query(`
+		SELECT e.node_id, n.offset_ms - e.offset_ms AS duration
+		FROM play_session p
+		JOIN play_event e ON e.session_id = p.id AND e.type = 'node'
+		JOIN play_event n ON n.session_id = e.session_id AND n.seq = e.seq + 1
+		WHERE `+playPeriod+` AND e.node_id IS NOT NULL AND n.type IN ('choice', 'node')
+		ORDER BY e.node_id, duration`, adventureID, playTime(from), playTime(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var nodeID, duration int64
+		if err := rows.Scan(&nodeID, &duration); err != nil {
+			return nil, err
+		}
+		c := &counts[index[nodeID]]
+		c.Durations = append(c.Durations, duration)
+	}
+	return counts, rows.Err()
+}
+
+// GetPlayPaths returns the paths the sessions of an adventure took. The
+// nodes are read one session at a time and only the paths are kept.
+func (s *SQLStore) GetPlayPaths(adventureID int64, from time.Time, to time.Time) ([]models.PlayPathCounts, error) {
+	rows, err := s.db.Query(`
+		SELECT p.id, e.node_id, CASE WHEN x.session_id IS NOT NULL THEN 1 ELSE 0 END
+		FROM play_session p
+		LEFT JOIN play_event e ON e.session_id = p.id AND e.type = 'node' AND e.node_id IS NOT NULL
+		LEFT JOIN play_event x ON x.session_id = p.id AND x.type = 'end'
+		WHERE `+playPeriod+`
+		ORDER BY p.id, e.seq`, adventureID, playTime(from), playTime(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []models.PlayPathCounts{}
+	index := make(map[string]int)
+	var session string
+	var path *models.PlayPathCounts
+	count := func() {
+		if path == nil {
+			return
+		}
+		key := fmt.Sprint(path.Nodes, path.Completed)
+		if i, exists := index[key]; exists {
+			counts[i].Count++
+			return
+		}
+		index[key] = len(counts)
+		path.Count = 1
+		counts = append(counts, *path)
+	}
+	for rows.Next() {
+		var id string
+		var nodeID *int64
+		var completed bool
+		if err := rows.Scan(&id, &nodeID, &completed); err != nil {
+			return nil, err
+		}
+		if path == nil || id != session {
+			count()
+			session = id
+			path = &models.PlayPathCounts{Nodes: []int64{}, Completed: completed}
+		}
+		if nodeID == nil {
+			continue
+		}
+		if n := len(path.Nodes); n == 0 || path.Nodes[n-1] != *nodeID {
+			path.Nodes = append(path.Nodes, *nodeID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	count()
+	return counts, nil
+}
+
+// GetPlayChoices returns the choices made in the sessions of an adventure,
+// by source, target and link
+func (s *SQLStore) GetPlayChoices(adventureID int64, from time.Time, to time.Time) ([]models.PlayChoiceCounts, error) {
+	rows, err := s.db.Query(`
+		SELECT source, target, link_id, COUNT(*), COUNT(DISTINCT session_id)
+		FROM (
+			SELECT c.session_id, c.link_id, c.source, COALESCE((
+				SELECT CASE
+					WHEN l.source_node_id = c.source THEN l.target_node_id
+					WHEN l.target_node_id = c.source AND l.link_type = 'bidirectional' THEN l.source_node_id
+				END
+				FROM adventure_link l WHERE l.adventure_id = ? AND l.link_id = c.link_id
+				ORDER BY l.id DESC LIMIT 1
+			), c.next_node_id) AS target
+			FROM (
+				SELECT e.session_id, e.link_id, (
+					SELECT n.node_id FROM play_event n
+					WHERE n.session_id = e.session_id AND n.type = 'node' AND n.seq < e.seq
+					ORDER BY n.seq DESC LIMIT 1
+				) AS source, (
+					SELECT n.node_id FROM play_event n
+					WHERE n.session_id = e.session_id AND n.type = 'node' AND n.seq > e.seq
+					ORDER BY n.seq LIMIT 1
+				) AS next_node_id
+				FROM play_session p
+				JOIN play_event e ON e.session_id = p.id AND e.type = 'choice'
+				WHERE `+playPeriod+` AND e.link_id IS NOT NULL
+			) c
+		) f
+		WHERE source IS NOT NULL AND target IS NOT NULL
+		GROUP BY source, target, link_id
+		ORDER BY source, target, link_id`, adventureID, adventureID, playTime(from), playTime(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	choices := []models.PlayChoiceCounts{}
+	for rows.Next() {
+		var c models.PlayChoiceCounts
+		if err := rows.Scan(&c.Source, &c.Target, &c.LinkID, &c.Value, &c.Sessions); err != nil {
+			return nil, err
+		}
+		choices = append(choices, c)
+	}
+	return choices, rows.Err()
+}
+
+// scanPlayEvents reads events in order by the session they belong to
+func scanPlayEvents(rows *sql.Rows) (map[string][]models.PlayEvent, error) {
+	events := make(map[string][]models.PlayEvent)
+	for rows.Next() {
+		var id, eventType string
+		var event models.PlayEvent
+		if err := rows.Scan(&id, &event.Seq, &eventType, &event.NodeID, &event.LinkID, &event.Offset); err != nil {
+			return nil, err
+		}
+		event.Type = models.PlayEventType(eventType)
+		events[id] = append(events[id], event)
+	}
+	return events, rows.Err()
+}
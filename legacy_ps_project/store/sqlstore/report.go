@@ -64,8 +64,8 @@ func (s *SQLStore) GetReports(isHandled bool) ([]models.Report, error) {
 // UpdateReport updates a reportinstance
 func (s *SQLStore) UpdateReport(report *models.Report) error {
 	_, err := s.db.Exec("UPDATE adventure_report SET is_handled = ? WHERE id = ?",
-		report.ID,
-		report.IsHandled)
+		report.IsHandled,
+		report.ID)
 
 	if err != nil {
 		return err
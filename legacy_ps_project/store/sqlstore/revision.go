@@ -0,0 +1,161 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"projektps/models"
+	"projektps/store"
+)
+
+// DefaultRevisionRetention is used unless the store is configured otherwise
+var DefaultRevisionRetention = store.DefaultRevisionRetention
+
+// SetRevisionRetention configures how many revisions are kept per adventure
+func (s *SQLStore) SetRevisionRetention(retention store.RevisionRetention) {
+	s.retention = retention
+}
+
+// CreateRevision stores a snapshot of an adventure as its next revision
+func (s *SQLStore) CreateRevision(revision *models.Revision) (*models.Revision, error) {
+	snapshot, err := json.Marshal(revision.Adventure)
+	if err != nil {
+		return nil, err
+	}
+
+	row := s.db.QueryRow("SELECT COALESCE(MAX(revision), 0) + 1 FROM adventure_revision WHERE adventure_id = ?", revision.AdventureID)
+	err = row.Scan(&revision.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	userID := sql.NullInt64{Int64: revision.UserID, Valid: revision.UserID != 0}
+
+	res, err := s.db.Exec("INSERT INTO adventure_revision (adventure_id, revision, user_id, snapshot) VALUES (?, ?, ?, ?)",
+		revision.AdventureID,
+		revision.Revision,
+		userID,
+		string(snapshot))
+	if err != nil {
+		return nil, err
+	}
+
+	revision.ID, err = res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	revision.CreatedAt = time.Now()
+
+	return revision, nil
+}
+
+// GetRevisions lists all revisions of an adventure, newest first, without snapshots
+func (s *SQLStore) GetRevisions(adventureID int64) ([]models.Revision, error) {
+	rows, err := s.db.Query("SELECT id, adventure_id, revision, user_id, created_at FROM adventure_revision WHERE adventure_id = ? ORDER BY revision DESC", adventureID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []models.Revision{}
+
+	for rows.Next() {
+		r := models.Revision{}
+		var userID sql.NullInt64
+
+		if err := rows.Scan(&r.ID, &r.AdventureID, &r.Revision, &userID, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		if userID.Valid {
+			r.UserID = userID.Int64
+		}
+
+		revisions = append(revisions, r)
+	}
+
+	return revisions, nil
+}
+
+// GetRevision retrieves a single revision including its snapshot
+func (s *SQLStore) GetRevision(adventureID int64, revision int64) (*models.Revision, error) {
+	row := s.db.QueryRow("SELECT id, adventure_id, revision, user_id, snapshot, created_at FROM adventure_revision WHERE adventure_id = ? AND revision = ?", adventureID, revision)
+
+	r := &models.Revision{}
+	var userID sql.NullInt64
+	var snapshot string
+
+	err := row.Scan(&r.ID, &r.AdventureID, &r.Revision, &userID, &snapshot, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if userID.Valid {
+		r.UserID = userID.Int64
+	}
+
+	r.Adventure = &models.Adventure{}
+	err = json.Unmarshal([]byte(snapshot), r.Adventure)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// createRevisionSnapshot stores the current state of an adventure as a new
+// revision and applies the retention limits. The references to uploaded
+// files are counted from the same state.
+func (s *SQLStore) createRevisionSnapshot(slug string, userID int64) error {
+	adventure, err := s.GetAdventure(slug, models.ReadWrite)
+	if err != nil {
+		return err
+	}
+
+	err = s.updateMediaReferences(adventure)
+	if err != nil {
+		return err
+	}
+
+	// Memberships are not part of the content history
+	adventure.Users = nil
+
+	revision, err := s.CreateRevision(&models.Revision{
+		AdventureID: adventure.ID,
+		UserID:      userID,
+		Adventure:   adventure,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.pruneRevisions(adventure.ID, revision.Revision)
+}
+
+// pruneRevisions removes revisions outside the retention limits, always
+// keeping the latest revision
+func (s *SQLStore) pruneRevisions(adventureID int64, latest int64) error {
+	if s.retention.MaxCount > 0 {
+		_, err := s.db.Exec("DELETE FROM adventure_revision WHERE adventure_id = ? AND revision <= ?",
+			adventureID,
+			latest-s.retention.MaxCount)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.retention.MaxAge > 0 {
+		// created_at is written by the database, so its clock tells the age
+		since, arg := s.timeAgo(s.retention.MaxAge)
+		_, err := s.db.Exec("DELETE FROM adventure_revision WHERE adventure_id = ? AND revision < ? AND created_at < "+since,
+			adventureID,
+			latest,
+			arg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
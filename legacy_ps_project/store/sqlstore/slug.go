@@ -0,0 +1,105 @@
+package sqlstore
+
+import (
+	"database/sql"
+
+	"projektps/models"
+	"projektps/store"
+)
+
+// UpdateViewSlug gives an adventure a new play slug. The old play slug keeps
+// working as a redirect, see GetSlugRedirect.
+func (s *SQLStore) UpdateViewSlug(adventureID int64, viewSlug string) error {
+	return s.transaction(func(tx *SQLStore) error {
+		return tx.updateViewSlug(adventureID, viewSlug)
+	})
+}
+
+func (s *SQLStore) updateViewSlug(adventureID int64, viewSlug string) error {
+	var oldSlug string
+	err := s.db.QueryRow("SELECT view_slug FROM adventure WHERE id = ?", adventureID).Scan(&oldSlug)
+	if err != nil {
+		return err
+	}
+
+	if oldSlug == viewSlug {
+		return nil
+	}
+
+	err = models.ValidateViewSlug(viewSlug)
+	if err != nil {
+		return err
+	}
+
+	// Taking back one of its own old play slugs is fine, anything else is not
+	redirectID, err := s.slugRedirectAdventureID(viewSlug)
+	if err != nil {
+		return err
+	}
+	if redirectID != 0 && redirectID != adventureID {
+		return store.ErrSlugTaken
+	}
+
+	var count int64
+	err = s.db.QueryRow("SELECT COUNT(*) FROM adventure WHERE slug = ? OR view_slug = ?", viewSlug, viewSlug).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return store.ErrSlugTaken
+	}
+
+	_, err = s.db.Exec("DELETE FROM adventure_slug_redirect WHERE slug = ?", viewSlug)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("UPDATE adventure SET view_slug = ? WHERE id = ?", viewSlug, adventureID)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("INSERT INTO adventure_slug_redirect (slug, adventure_id, created_at) VALUES(?, ?, CURRENT_TIMESTAMP)", oldSlug, adventureID)
+	return err
+}
+
+// GetSlugRedirect returns the current play slug of the adventure that used
+// to have slug as its play slug
+func (s *SQLStore) GetSlugRedirect(slug string) (string, error) {
+	var viewSlug string
+	err := s.db.QueryRow(`
+		SELECT
+			a.view_slug
+		FROM
+			adventure_slug_redirect r
+			JOIN adventure a ON a.id = r.adventure_id
+		WHERE
+			r.slug = ?`, slug).Scan(&viewSlug)
+	if err != nil {
+		return "", err
+	}
+
+	return viewSlug, nil
+}
+
+// slugInUse tells whether slug is taken by an adventure or a redirect
+func (s *SQLStore) slugInUse(slug string) (bool, error) {
+	var count int64
+	err := s.db.QueryRow("SELECT COUNT(*) FROM adventure WHERE slug = ? OR view_slug = ?", slug, slug).Scan(&count)
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	redirectID, err := s.slugRedirectAdventureID(slug)
+	return redirectID != 0, err
+}
+
+// slugRedirectAdventureID returns the adventure that slug redirects to, or 0
+func (s *SQLStore) slugRedirectAdventureID(slug string) (int64, error) {
+	var adventureID int64
+	err := s.db.QueryRow("SELECT adventure_id FROM adventure_slug_redirect WHERE slug = ?", slug).Scan(&adventureID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return adventureID, err
+}
@@ -0,0 +1,47 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"fmt"
+
+	// Registers the sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// NewSQLiteStore creates a SQL store backed by a SQLite database file.
+// The pending migrations are applied, so a new file gets the whole schema.
+// Use ":memory:" for a database that only lives as long as the store.
+func NewSQLiteStore(path string) (*SQLStore, error) {
+	connectionString := fmt.Sprintf("file:%s?_foreign_keys=1&_busy_timeout=5000", path)
+
+	db, err := sql.Open("sqlite3", connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer, and an in-memory database only exists
+	// within its connection, so all queries share one connection
+	db.SetMaxOpenConns(1)
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &SQLStore{
+		db:        db,
+		conn:      db,
+		retention: DefaultRevisionRetention,
+		sqlite:    true,
+	}
+	err = s.migrateSQLite()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not migrate sqlite database: %v", err)
+	}
+
+	fmt.Println("[sqlstore] Connected to ", connectionString)
+
+	return s, nil
+}
@@ -0,0 +1,442 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"projektps/database"
+)
+
+// The migrations in database/migrations are written for MySQL. SQLite runs
+// them through execSQLite, which translates what they use of MySQL:
+// AUTO_INCREMENT, keys within CREATE TABLE, triggers that set a column,
+// BOOLEAN, zero dates, table options and the ALTER TABLE clauses SQLite does not
+// have, for which the table is rebuilt.
+
+// sqliteZeroDate replaces the zero date of MySQL, both are read as the zero
+// time.Time
+const sqliteZeroDate = "'0001-01-01 00:00:00'"
+
+var (
+	sqliteCreateTable      = regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+(IF\s+NOT\s+EXISTS\s+)?(\w+)\s*\((.*)\)[^)]*$`)
+	sqliteTrigger          = regexp.MustCompile(`(?is)^CREATE\s+TRIGGER\s+(\w+)\s+BEFORE\s+UPDATE\s+ON\s+(\w+)\s+FOR\s+EACH\s+ROW\s+SET\s+NEW\.(\w+)\s*=\s*CURRENT_TIMESTAMP$`)
+	sqliteAlterTable       = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(\w+)\s+(.*)$`)
+	sqliteKey              = regexp.MustCompile(`(?is)^(UNIQUE\s+)?(?:KEY|INDEX)\b\s*(\w+)?\s*\((.*)\)$`)
+	sqliteAutoIncrement    = regexp.MustCompile(`(?is)^(\w+)\s.*\bAUTO_INCREMENT\b`)
+	sqlitePrimaryKey       = regexp.MustCompile(`(?is)^PRIMARY\s+KEY\s*\(\s*(\w+)\s*\)$`)
+	sqliteCurrentTimestamp = regexp.MustCompile(`(?i)\bcurrent_timestamp\(\)`)
+	sqliteZeroDates        = regexp.MustCompile(`'0000-00-00( 00:00:00)?'`)
+	sqliteBoolean          = regexp.MustCompile(`(?i)\bBOOLEAN\b`)
+	sqliteColumnPosition   = regexp.MustCompile(`(?is)\s+(AFTER\s+\w+|FIRST)$`)
+
+	sqliteAddKey        = regexp.MustCompile(`(?is)^ADD\s+((?:UNIQUE\s+)?(?:KEY|INDEX)\b.*)$`)
+	sqliteAddConstraint = regexp.MustCompile(`(?is)^ADD\s+(CONSTRAINT\s+\w+\s+FOREIGN\s+KEY\b.*)$`)
+	sqliteAddColumn     = regexp.MustCompile(`(?is)^ADD\s+(?:COLUMN\s+)?(.*)$`)
+	sqliteDropKey       = regexp.MustCompile(`(?is)^DROP\s+(?:INDEX|KEY)\s+(\w+)$`)
+	sqliteDropForeign   = regexp.MustCompile(`(?is)^DROP\s+FOREIGN\s+KEY\s+(\w+)$`)
+	sqliteDropColumn    = regexp.MustCompile(`(?is)^DROP\s+(?:COLUMN\s+)?(\w+)$`)
+	sqliteChangeColumn  = regexp.MustCompile(`(?is)^CHANGE\s+(?:COLUMN\s+)?(\w+)\s+(\w+)\s+(.*)$`)
+	sqliteModifyColumn  = regexp.MustCompile(`(?is)^MODIFY\s+(?:COLUMN\s+)?(\w+)\s+(.*)$`)
+	sqliteConvert       = regexp.MustCompile(`(?is)^CONVERT\s+TO\s+CHARACTER\s+SET\b`)
+)
+
+// migrateSQLite applies the pending migrations when the store is opened. A
+// database with tables but no recorded migrations has to be baselined first,
+// as on MySQL.
+func (s *SQLStore) migrateSQLite() error {
+	migrations, err := LoadMigrations(database.Migrations, "migrations")
+	if err != nil {
+		return err
+	}
+
+	done, err := s.MigrateUp(migrations, 0)
+	if err != nil {
+		return err
+	}
+	if len(done) > 0 {
+		fmt.Printf("[sqlstore] Applied %d migrations, the latest %s\n", len(done), done[len(done)-1])
+	}
+	return nil
+}
+
+// execMigration runs the statements of a migration, translated for SQLite
+// if the database is one
+func (s *SQLStore) execMigration(script string) error {
+	for _, statement := range splitStatements(script) {
+		var err error
+		if s.sqlite {
+			err = s.execSQLite(statement)
+		} else {
+			_, err = s.db.Exec(statement)
+		}
+		if err != nil {
+			return fmt.Errorf("%v\n%s", err, statement)
+		}
+	}
+
+	if s.sqlite {
+		return s.checkSQLiteForeignKeys()
+	}
+	return nil
+}
+
+// foreignKeysOff turns off the foreign keys of SQLite until the returned
+// function is called. Rebuilding a table drops it, which would delete the
+// rows that refer to it. Nothing is changed for MySQL.
+func (s *SQLStore) foreignKeysOff() (func(), error) {
+	if !s.sqlite || s.conn == nil {
+		return func() {}, nil
+	}
+
+	// The pragma has no effect within a transaction
+	_, err := s.conn.Exec("PRAGMA foreign_keys = OFF")
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		s.conn.Exec("PRAGMA foreign_keys = ON")
+	}, nil
+}
+
+// checkSQLiteForeignKeys fails if a row refers to a row that does not
+// exist, which the foreign keys being off let a migration do
+func (s *SQLStore) checkSQLiteForeignKeys() error {
+	rows, err := s.db.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var table, parent string
+		var rowID sql.NullInt64
+		var foreignKey int64
+		if err := rows.Scan(&table, &rowID, &parent, &foreignKey); err != nil {
+			return err
+		}
+		return fmt.Errorf("row %d of %s refers to a missing row of %s", rowID.Int64, table, parent)
+	}
+	return rows.Err()
+}
+
+// execSQLite runs a statement of a MySQL migration on SQLite
+func (s *SQLStore) execSQLite(statement string) error {
+	statement = strings.ReplaceAll(statement, "`", "")
+	statement = sqliteCurrentTimestamp.ReplaceAllString(statement, "CURRENT_TIMESTAMP")
+	statement = sqliteZeroDates.ReplaceAllString(statement, sqliteZeroDate)
+	// BOOLEAN is tinyint(1) in MySQL, the driver of SQLite would read it as bool
+	statement = sqliteBoolean.ReplaceAllString(statement, "tinyint(1)")
+
+	if match := sqliteCreateTable.FindStringSubmatch(statement); match != nil {
+		return s.execAll(sqliteCreateTableStatements(match[1], match[2], match[3]))
+	}
+
+	// MySQL sets the column before the row is written, SQLite updates the
+	// row afterwards. Triggers are not recursive in SQLite.
+	if match := sqliteTrigger.FindStringSubmatch(statement); match != nil {
+		_, err := s.db.Exec(fmt.Sprintf("CREATE TRIGGER %s AFTER UPDATE ON %s\nFOR EACH ROW BEGIN\n  UPDATE %s SET %s = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;\nEND",
+			match[1], match[2], match[2], match[3]))
+		return err
+	}
+
+	if match := sqliteAlterTable.FindStringSubmatch(statement); match != nil {
+		for _, clause := range splitDefinitions(match[2]) {
+			if err := s.alterSQLiteTable(match[1], clause); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	_, err := s.db.Exec(statement)
+	return err
+}
+
+// alterSQLiteTable runs a clause of ALTER TABLE on table
+func (s *SQLStore) alterSQLiteTable(table string, clause string) error {
+	if match := sqliteAddKey.FindStringSubmatch(clause); match != nil {
+		key := sqliteKey.FindStringSubmatch(match[1])
+		if key == nil {
+			return fmt.Errorf("unsupported key: %s", clause)
+		}
+		_, err := s.db.Exec(sqliteIndexStatement(table, key, false))
+		return err
+	}
+	if match := sqliteAddConstraint.FindStringSubmatch(clause); match != nil {
+		return s.rebuildSQLiteTable(table, func(definitions []string) ([]string, error) {
+			return append(definitions, match[1]), nil
+		})
+	}
+	if match := sqliteAddColumn.FindStringSubmatch(clause); match != nil {
+		_, err := s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, sqliteColumnPosition.ReplaceAllString(match[1], "")))
+		return err
+	}
+
+	if match := sqliteDropKey.FindStringSubmatch(clause); match != nil {
+		_, err := s.db.Exec("DROP INDEX " + sqliteIndexName(table, match[1]))
+		return err
+	}
+	if match := sqliteDropForeign.FindStringSubmatch(clause); match != nil {
+		return s.rebuildSQLiteTable(table, func(definitions []string) ([]string, error) {
+			return replaceDefinition(definitions, "constraint "+strings.ToLower(match[1]), "")
+		})
+	}
+	if match := sqliteDropColumn.FindStringSubmatch(clause); match != nil {
+		_, err := s.db.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, match[1]))
+		return err
+	}
+
+	// A changed column keeps its data, SQLite renames it and the table is
+	// rebuilt with its new definition
+	column, definition := "", ""
+	if match := sqliteChangeColumn.FindStringSubmatch(clause); match != nil {
+		if !strings.EqualFold(match[1], match[2]) {
+			_, err := s.db.Exec(fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", table, match[1], match[2]))
+			if err != nil {
+				return err
+			}
+		}
+		column, definition = match[2], match[3]
+	} else if match := sqliteModifyColumn.FindStringSubmatch(clause); match != nil {
+		column, definition = match[1], match[2]
+	}
+	if column != "" {
+		return s.rebuildSQLiteTable(table, func(definitions []string) ([]string, error) {
+			return replaceDefinition(definitions, strings.ToLower(column), column+" "+sqliteColumnPosition.ReplaceAllString(definition, ""))
+		})
+	}
+
+	if sqliteConvert.MatchString(clause) {
+		// SQLite stores all text as UTF-8
+		return nil
+	}
+	return fmt.Errorf("unsupported clause of ALTER TABLE %s: %s", table, clause)
+}
+
+// sqliteCreateTableStatements translates CREATE TABLE. The AUTO_INCREMENT
+// column becomes the primary key and the keys become indexes of their own.
+func sqliteCreateTableStatements(ifNotExists string, table string, body string) []string {
+	definitions := splitDefinitions(body)
+
+	autoIncrement := ""
+	for _, definition := range definitions {
+		if match := sqliteAutoIncrement.FindStringSubmatch(definition); match != nil {
+			autoIncrement = match[1]
+		}
+	}
+
+	columns := []string{}
+	indexes := []string{}
+	for _, definition := range definitions {
+		if autoIncrement != "" {
+			if strings.EqualFold(definitionName(definition), autoIncrement) {
+				columns = append(columns, autoIncrement+" INTEGER PRIMARY KEY AUTOINCREMENT")
+				continue
+			}
+			if match := sqlitePrimaryKey.FindStringSubmatch(definition); match != nil && strings.EqualFold(match[1], autoIncrement) {
+				continue
+			}
+		}
+		if match := sqliteKey.FindStringSubmatch(definition); match != nil {
+			indexes = append(indexes, sqliteIndexStatement(table, match, true))
+			continue
+		}
+		columns = append(columns, definition)
+	}
+
+	return append([]string{"CREATE TABLE " + ifNotExists + table + " (\n  " + strings.Join(columns, ",\n  ") + "\n)"}, indexes...)
+}
+
+// sqliteIndexStatement creates the index of a key matched by sqliteKey
+func sqliteIndexStatement(table string, key []string, ifNotExists bool) string {
+	name := key[2]
+	if name == "" {
+		name = definitionName(key[3])
+	}
+	statement := "CREATE "
+	if key[1] != "" {
+		statement += "UNIQUE "
+	}
+	statement += "INDEX "
+	if ifNotExists {
+		statement += "IF NOT EXISTS "
+	}
+	return statement + sqliteIndexName(table, name) + " ON " + table + " (" + key[3] + ")"
+}
+
+// sqliteIndexName is the name of an index of table. The names of MySQL are
+// per table and the ones of SQLite per database, so they start with the
+// table.
+func sqliteIndexName(table string, name string) string {
+	if strings.HasPrefix(name, table+"_") {
+		return name
+	}
+	return table + "_" + name
+}
+
+// rebuildSQLiteTable creates table again with the definitions edit returns
+// and copies the rows of the columns that are left. Its indexes and
+// triggers are created again. The foreign keys have to be off, see
+// foreignKeysOff.
+func (s *SQLStore) rebuildSQLiteTable(table string, edit func(definitions []string) ([]string, error)) error {
+	var create string
+	err := s.db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&create)
+	if err != nil {
+		return fmt.Errorf("table %s: %v", table, err)
+	}
+	definitions, err := edit(splitDefinitions(create[strings.Index(create, "(")+1 : strings.LastIndex(create, ")")]))
+	if err != nil {
+		return fmt.Errorf("table %s: %v", table, err)
+	}
+
+	rows, err := s.db.Query("SELECT sql FROM sqlite_master WHERE tbl_name = ? AND type IN ('index', 'trigger') AND sql IS NOT NULL", table)
+	if err != nil {
+		return err
+	}
+	others := []string{}
+	for rows.Next() {
+		var statement string
+		if err := rows.Scan(&statement); err != nil {
+			rows.Close()
+			return err
+		}
+		others = append(others, statement)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rebuilt := table + "_rebuilt"
+	_, err = s.db.Exec("CREATE TABLE " + rebuilt + " (\n  " + strings.Join(definitions, ",\n  ") + "\n)")
+	if err != nil {
+		return err
+	}
+
+	_, old, err := s.sqliteColumns(table)
+	if err != nil {
+		return err
+	}
+	columns, _, err := s.sqliteColumns(rebuilt)
+	if err != nil {
+		return err
+	}
+	kept := []string{}
+	for _, column := range columns {
+		if old[column] {
+			kept = append(kept, column)
+		}
+	}
+
+	statements := []string{
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", rebuilt, strings.Join(kept, ", "), strings.Join(kept, ", "), table),
+		"DROP TABLE " + table,
+		"ALTER TABLE " + rebuilt + " RENAME TO " + table,
+	}
+	return s.execAll(append(statements, others...))
+}
+
+// sqliteColumns returns the columns of table in order, and by name
+func (s *SQLStore) sqliteColumns(table string) ([]string, map[string]bool, error) {
+	rows, err := s.db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	columns := []string{}
+	names := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, nil, err
+		}
+		columns = append(columns, name)
+		names[name] = true
+	}
+	return columns, names, rows.Err()
+}
+
+func (s *SQLStore) execAll(statements []string) error {
+	for _, statement := range statements {
+		if _, err := s.db.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceDefinition replaces the definition of a table that starts with
+// prefix, a lowercase name, or removes it if replacement is empty
+func replaceDefinition(definitions []string, prefix string, replacement string) ([]string, error) {
+	result := []string{}
+	found := false
+	for _, definition := range definitions {
+		normalized := strings.ToLower(strings.Join(strings.Fields(strings.NewReplacer(`"`, "", "`", "").Replace(definition)), " "))
+		if normalized == prefix || strings.HasPrefix(normalized, prefix+" ") {
+			found = true
+			if replacement != "" {
+				result = append(result, replacement)
+			}
+			continue
+		}
+		result = append(result, definition)
+	}
+	if !found {
+		return nil, fmt.Errorf("no definition %s", prefix)
+	}
+	return result, nil
+}
+
+// definitionName returns the first word of a definition, the name of a
+// column, without quotes
+func definitionName(definition string) string {
+	fields := strings.FieldsFunc(definition, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '(' || r == ')' || r == ','
+	})
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.Trim(fields[0], "\"`")
+}
+
+// splitDefinitions splits the body of CREATE TABLE, or the clauses of
+// ALTER TABLE, at the commas that are not within parentheses or quotes
+func splitDefinitions(body string) []string {
+	definitions := []string{}
+	var current strings.Builder
+	depth := 0
+	var quote rune
+
+	flush := func() {
+		definition := strings.TrimSpace(current.String())
+		if definition != "" {
+			definitions = append(definitions, definition)
+		}
+		current.Reset()
+	}
+
+	for _, r := range body {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			flush()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	flush()
+
+	return definitions
+}
@@ -0,0 +1,182 @@
+package sqlstore
+
+import (
+	"testing"
+	"time"
+
+	"projektps/models"
+	"projektps/store"
+	"projektps/store/storetest"
+)
+
+func newTestSQLiteStore(t *testing.T) *SQLStore {
+	t.Helper()
+
+	s, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSQLiteAdventureContent(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	defer s.Close()
+
+	adventure, err := s.CreateDefaultAdventure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(adventure.Nodes) != 3 || len(adventure.Links) != 2 {
+		t.Fatalf("expected 3 nodes and 2 links, got %d and %d", len(adventure.Nodes), len(adventure.Links))
+	}
+
+	adventure, err = s.GetAdventure(adventure.Slug, models.ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adventure.CreatedAt.IsZero() {
+		t.Error("expected created_at to be set")
+	}
+
+	adventure.Title = "Skogen"
+	adventure.Nodes[1].Title = "Stigen"
+	adventure.Nodes[1].Changed = true
+	adventure.Nodes = append(adventure.Nodes, models.Node{NodeID: 3, NodeType: "default", Title: "Sjön"})
+	adventure.Links = adventure.Links[:1]
+
+	err = s.UpdateAdventureContent(adventure, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := s.GetAdventure(adventure.ViewSlug, models.ReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Title != "Skogen" || saved.EditVersion != adventure.EditVersion+1 {
+		t.Errorf("unexpected title %q and edit_version %d", saved.Title, saved.EditVersion)
+	}
+	if len(saved.Nodes) != 4 || len(saved.Links) != 1 {
+		t.Errorf("expected 4 nodes and 1 link, got %d and %d", len(saved.Nodes), len(saved.Links))
+	}
+	if saved.UpdatedAt.IsZero() {
+		t.Error("expected updated_at to be set by the trigger")
+	}
+
+	// The same edit_version can not be saved twice
+	err = s.UpdateAdventureContent(adventure, 0)
+	if err != store.ErrVersionConflict {
+		t.Errorf("expected version conflict, got %v", err)
+	}
+
+	revisions, err := s.GetRevisions(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 || revisions[0].Revision != 1 {
+		t.Errorf("expected a single revision, got %+v", revisions)
+	}
+
+	err = s.DeleteAdventureByID(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := s.GetNodesByAdventureID(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 0 {
+		t.Errorf("expected nodes to be deleted with the adventure, got %d", len(nodes))
+	}
+}
+
+func TestSQLitePruneRevisionsByAge(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	defer s.Close()
+	s.SetRevisionRetention(store.RevisionRetention{MaxAge: time.Hour})
+
+	adventure, err := s.CreateDefaultAdventure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	save := func() {
+		t.Helper()
+		adventure, err = s.GetAdventure(adventure.Slug, models.ReadWrite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.UpdateAdventureContent(adventure, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save()
+	save()
+	// The first revision is older than the retention
+	_, err = s.db.Exec("UPDATE adventure_revision SET created_at = datetime('now', '-2 hours') WHERE revision = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	save()
+
+	revisions, err := s.GetRevisions(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[0].Revision != 3 || revisions[1].Revision != 2 {
+		t.Errorf("expected revisions 3 and 2, got %+v", revisions)
+	}
+}
+
+func TestSQLiteTransactionRollback(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	defer s.Close()
+
+	var slug string
+	err := s.WithTransaction(func(tx store.Store) error {
+		adventure, err := tx.CreateNewAdventure()
+		if err != nil {
+			return err
+		}
+		slug = adventure.Slug
+		return store.ErrVersionConflict
+	})
+	if err != store.ErrVersionConflict {
+		t.Fatalf("expected the error from fn, got %v", err)
+	}
+
+	if _, err := s.GetAdventure(slug, models.ReadWrite); err == nil {
+		t.Error("expected the adventure to be rolled back")
+	}
+}
+
+func TestSQLiteUsers(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	defer s.Close()
+
+	user := &models.User{Username: "anna", Name: "Anna", Role: 2}
+	user.HashPassword("hemligt")
+
+	user, err := s.CreateUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticated, err := s.Authenticate("anna", "hemligt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authenticated.ID != user.ID {
+		t.Errorf("expected user %d, got %d", user.ID, authenticated.ID)
+	}
+
+	if _, err := s.Authenticate("anna", "fel"); err != ErrInvalidPassword {
+		t.Errorf("expected invalid password, got %v", err)
+	}
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return newTestSQLiteStore(t)
+	})
+}
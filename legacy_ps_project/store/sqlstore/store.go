@@ -3,11 +3,31 @@ package sqlstore
 import (
 	"database/sql"
 	"fmt"
+	"time"
+
+	"projektps/store"
 )
 
+// executor is implemented by both *sql.DB and *sql.Tx, which lets every
+// query in the store run either directly or inside a transaction
+type executor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 // SQLStore contains the database connection aswell as fulfill the Store interface
 type SQLStore struct {
-	db *sql.DB
+	db executor
+
+	// conn is nil when the store is bound to a transaction
+	conn *sql.DB
+
+	// sqlite is set for a SQLite database, the migrations are translated for
+	// it, see execSQLite
+	sqlite bool
+
+	retention store.RevisionRetention
 }
 
 // NewStore creates a new SQL store
@@ -29,6 +49,70 @@ func NewStore(username, password, dbhost, dbport, dbname string) (*SQLStore, err
 	fmt.Println("[sqlstore] Connected to ", connectionString)
 
 	return &SQLStore{
-		db: db,
+		db:        db,
+		conn:      db,
+		retention: DefaultRevisionRetention,
 	}, nil
 }
+
+// timeAgo returns SQL for the time d before now by the clock of the
+// database, with the argument it takes
+func (s *SQLStore) timeAgo(d time.Duration) (string, interface{}) {
+	seconds := int64(d / time.Second)
+	if s.sqlite {
+		return "datetime('now', ?)", fmt.Sprintf("%+d seconds", -seconds)
+	}
+	return "CURRENT_TIMESTAMP - INTERVAL ? SECOND", seconds
+}
+
+// Close closes the database connection of the store
+func (s *SQLStore) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// WithTransaction runs fn with a store bound to a single database transaction.
+// The transaction is committed if fn returns nil and rolled back otherwise.
+// Calling WithTransaction on a store that already is bound to a transaction
+// runs fn within that same transaction.
+func (s *SQLStore) WithTransaction(fn func(tx store.Store) error) (err error) {
+	if s.conn == nil {
+		return fn(s)
+	}
+
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	// A copy keeps every setting of the store, only bound to the transaction
+	txStore := *s
+	txStore.db = tx
+	txStore.conn = nil
+	err = fn(&txStore)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			fmt.Println("[sqlstore] Error while rolling back transaction", rollbackErr.Error())
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// transaction is a typed shorthand for WithTransaction used by store methods
+// that need several statements to succeed or fail together
+func (s *SQLStore) transaction(fn func(tx *SQLStore) error) error {
+	return s.WithTransaction(func(tx store.Store) error {
+		return fn(tx.(*SQLStore))
+	})
+}
@@ -2,18 +2,18 @@ package sqlstore
 
 import (
 	"database/sql"
-	"errors"
 	"strconv"
 //	"fmt"
 
 	"projektps/models"
+	"projektps/store"
 )
 
 // ErrInvalidUser is returned when user is not found in storage
-var ErrInvalidUser = errors.New("errors.auth.invaliduser")
+var ErrInvalidUser = store.ErrInvalidUser
 
 // ErrInvalidPassword is returned when password is incorrect
-var ErrInvalidPassword = errors.New("errors.auth.invalidpassword")
+var ErrInvalidPassword = store.ErrInvalidPassword
 
 // Authenticate performs an authentication request to the database
 func (s *SQLStore) Authenticate(username string, password string) (*models.User, error) {
@@ -64,7 +64,7 @@ func (s *SQLStore) CreateUser(user *models.User) (*models.User, error) {
 		return nil, err
 	}
 
-	_, err = res.LastInsertId()
+	user.ID, err = res.LastInsertId()
 	if err != nil {
 		return nil, err
 	}
@@ -76,10 +76,10 @@ func (s *SQLStore) CreateUser(user *models.User) (*models.User, error) {
 func (s *SQLStore) UpdateUser(user *models.User) error {
 	var err error
 	if user.Password == "" {
-		_, err = s.db.Exec("UPDATE users SET username = ?, name = ?, role = ?, updated_at = current_timestamp() WHERE id = ?", 
+		_, err = s.db.Exec("UPDATE users SET username = ?, name = ?, role = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", 
 			user.Username, user.Name, user.Role, user.ID)
 	} else {
-		_, err = s.db.Exec("UPDATE users SET username = ?, password = ?, name = ?, role = ?, updated_at = current_timestamp() WHERE id = ?", 
+		_, err = s.db.Exec("UPDATE users SET username = ?, password = ?, name = ?, role = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", 
 		user.Username, user.Password, user.Name, user.Role, user.ID)
 	}
 	return err
@@ -103,6 +103,9 @@ func (s *SQLStore) GetUser(userId int64) (*models.User, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(users) == 0 {
+		return nil, sql.ErrNoRows
+	}
 	user := users[0]
 
 	user.Adventures, err = s.GetAdventuresByUserID(userId)
@@ -1,30 +1,139 @@
 package store
 
 import (
+	"errors"
+	"time"
+
 	"projektps/models"
 )
 
+// ErrInvalidUser is returned when user is not found in storage
+var ErrInvalidUser = errors.New("errors.auth.invaliduser")
+
+// ErrInvalidPassword is returned when password is incorrect
+var ErrInvalidPassword = errors.New("errors.auth.invalidpassword")
+
+// ErrVersionConflict is returned when an adventure is saved from an edit_version
+// that no longer matches the stored one, i.e. someone else saved in between
+var ErrVersionConflict = errors.New("adventure edit version conflict")
+
+// ErrSlugTaken is returned when a play slug is already used by an adventure,
+// either as its slug, its play slug or as a redirect from a renamed one
+var ErrSlugTaken = errors.New("error.adventure.slugtaken")
+
+// MaxSlugAttempts is how many random slugs are tried before creating an
+// adventure gives up
+const MaxSlugAttempts = 10
+
 // AdventureStore describes a storage facility for adventures
 type AdventureStore interface {
 	CreateNewAdventure() (*models.Adventure, error)
 	CreateDefaultAdventure() (*models.Adventure, error)
 	UpdateAdventure(adventure *models.Adventure) error
-	UpdateAdventureContent(adventure *models.Adventure) error
+	UpdateViewSlug(adventureID int64, viewSlug string) error
+	UpdateAdventureContent(adventure *models.Adventure, userID int64) error
+	EditAdventureContent(slug string, editVersion int64, userID int64, fn func(tx Store) error) error
 	DeleteAdventureByID(adventureID int64) error
 	CountViewAdventure(adventureID int64) error
-	UpdateAdventureEditVersion(slug string) error
 	GetAdventure(slug string, permission models.Permission) (*models.Adventure, error)
 	GetAdventures(list string) ([]models.Adventure, error)
 	GetAdventuresByCategory(categoryID, pageSize, pageIndex int64) ([]models.Adventure, int64, error)
 	GetAdventuresBySearchString(searchString string, pageSize, pageIndex int64) ([]models.Adventure, int64, error)
 	GetAdventureByID(adventureID int64) (*models.Adventure, error)
+	GetAdventureIDs() ([]int64, error)
+	GetSlugRedirect(slug string) (string, error)
 	GetAdventuresByReportReason(reportReason string, pageSize, pageIndex int64) ([]models.Adventure, int64, error)
 }
 
+// RevisionStore describes a storage facility for adventure revisions
+type RevisionStore interface {
+	CreateRevision(revision *models.Revision) (*models.Revision, error)
+	GetRevisions(adventureID int64) ([]models.Revision, error)
+	GetRevision(adventureID int64, revision int64) (*models.Revision, error)
+}
+
+// MediaRecords describes a storage facility for the records of uploaded
+// files, see models.Media. The references of an adventure are counted from
+// its content every time it is saved.
+type MediaRecords interface {
+	// CreateMedia records an uploaded file, or returns the record of the file
+	// with the same hash if there is one
+	CreateMedia(media *models.Media) (*models.Media, error)
+	GetMediaByHash(hash string) (*models.Media, error)
+	GetMedia() ([]models.Media, error)
+	// UpdateMedia saves the size, type and variants of a file that was
+	// processed again
+	UpdateMedia(media *models.Media) error
+	DeleteMedia(mediaID int64) error
+	// UpdateMediaReferences counts the references of an adventure again.
+	// The uploads of the files it referred to before are removed, the ones
+	// it still refers to are counted by their references.
+	UpdateMediaReferences(adventureID int64) error
+	// AddMediaUpload records that a file was uploaded to an adventure, it
+	// counts until the adventure has referred to the file and stopped
+	AddMediaUpload(mediaID int64, adventureID int64) error
+	// RemoveMediaUpload removes the upload of a file to an adventure
+	RemoveMediaUpload(mediaID int64, adventureID int64) error
+	// GetAdventureMedia returns the files that were uploaded to an
+	// adventure or that it refers to, each once. Their sizes are the
+	// storage the adventure uses.
+	GetAdventureMedia(adventureID int64) ([]models.Media, error)
+}
+
+// PlayStore describes a storage facility for the anonymous play sessions of
+// adventures, see models.PlaySession. The events of a session are kept in
+// the order of their seq, and sessions are found by adventure and the time
+// they started. The counts for the analytics are summed up by the store over
+// the sessions of an adventure that started from from up to to, see
+// models.PlayCounts for idle.
+type PlayStore interface {
+	// CreatePlaySession records a new session. A session with the same id
+	// is left as it is, so two requests that start the same session can
+	// both create it.
+	CreatePlaySession(session *models.PlaySession) error
+	// GetPlaySession returns a session with its events, sql.ErrNoRows if
+	// there is none
+	GetPlaySession(id string) (*models.PlaySession, error)
+	// AddPlayEvents adds events to the end of a session
+	AddPlayEvents(id string, events []models.PlayEvent) error
+	// CountPlaySessions counts the sessions by how they ended
+	CountPlaySessions(adventureID int64, from time.Time, to time.Time, idle time.Duration) (*models.PlayCounts, error)
+	// GetPlayNodeCounts returns the counts of the nodes that were shown,
+	// by node id
+	GetPlayNodeCounts(adventureID int64, from time.Time, to time.Time, idle time.Duration) ([]models.PlayNodeCounts, error)
+	// GetPlayPaths returns the paths the sessions took, in no particular
+	// order
+	GetPlayPaths(adventureID int64, from time.Time, to time.Time) ([]models.PlayPathCounts, error)
+	// GetPlayChoices returns the choices that were made, by source, target
+	// and link. The source of a choice is the node shown before it and the
+	// target the other end of the link, or the node shown after it when the
+	// link has been removed from the adventure.
+	GetPlayChoices(adventureID int64, from time.Time, to time.Time) ([]models.PlayChoiceCounts, error)
+}
+
+// RevisionRetention limits how many revisions are kept for each adventure.
+// The latest revision is always kept, regardless of the limits.
+type RevisionRetention struct {
+	// MaxCount is the number of revisions to keep, 0 keeps all
+	MaxCount int64
+	// MaxAge is how long revisions are kept, 0 keeps them forever
+	MaxAge time.Duration
+}
+
+// DefaultRevisionRetention is used unless the store is configured otherwise
+var DefaultRevisionRetention = RevisionRetention{MaxCount: 100}
+
 // Store defines what capabilities a store is expected to have
 type Store interface {
 	AdventureStore
-	
+	RevisionStore
+	MediaRecords
+	PlayStore
+
+	// WithTransaction runs fn against a store where every operation is part
+	// of the same transaction. Any error returned by fn rolls back all of it.
+	WithTransaction(fn func(tx Store) error) error
+
 	Authenticate(username string, password string) (*models.User, error)
 	CreateUser(user *models.User) (*models.User, error)
 	GetUsers() ([]models.User, error)
@@ -56,13 +165,13 @@ type Store interface {
 	CreateNewNode(node *models.Node) (*models.Node, error)
 	UpdateNode(node *models.Node) error
 	DeleteNode(node *models.Node) error
-	GetNode(nodeID int64) error
+	GetNode(adventureID int64, nodeID int64) (*models.Node, error)
 	GetNodesByAdventureID(adventureID int64) ([]models.Node, error)
 
 	CreateNewLink(link *models.Link) (*models.Link, error)
 	UpdateLink(link *models.Link) error
 	DeleteLink(link *models.Link) error
-	GetLink(linkID int64) (*models.Link, error)
+	GetLink(adventureID int64, linkID int64) (*models.Link, error)
 	GetLinksByAdventureID(adventureID int64) ([]models.Link, error)
 
 	CreateNewImageCategory(category *models.ImageCategory) (*models.ImageCategory, error)
@@ -0,0 +1,168 @@
+package storetest
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"projektps/store"
+)
+
+// RunMediaStore runs the conformance suite of store.MediaStore. newStore is
+// called once for every subtest and must return an empty store.
+func RunMediaStore(t *testing.T, newStore func(t *testing.T) store.MediaStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.MediaStore)
+	}{
+		{"Files", testMediaFiles},
+		{"List", testMediaList},
+		{"CopyPrefix", testMediaCopyPrefix},
+		{"Names", testMediaNames},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, newStore(t))
+		})
+	}
+}
+
+func putMedia(t *testing.T, s store.MediaStore, name string, content string) {
+	t.Helper()
+
+	if err := s.Put(name, strings.NewReader(content), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectMedia(t *testing.T, s store.MediaStore, name string, content string) {
+	t.Helper()
+
+	file, err := s.Get(name)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("%s: expected %q, got %q", name, content, data)
+	}
+}
+
+func testMediaFiles(t *testing.T, s store.MediaStore) {
+	if _, err := s.Get("abc/skog.png"); err != store.ErrMediaNotFound {
+		t.Errorf("expected store.ErrMediaNotFound, got %v", err)
+	}
+	if _, err := s.Stat("abc/skog.png"); err != store.ErrMediaNotFound {
+		t.Errorf("expected store.ErrMediaNotFound, got %v", err)
+	}
+
+	putMedia(t, s, "abc/skog.png", "skogen")
+	expectMedia(t, s, "abc/skog.png", "skogen")
+
+	// A file is replaced as a whole
+	putMedia(t, s, "abc/skog.png", "skog")
+	expectMedia(t, s, "abc/skog.png", "skog")
+
+	object, err := s.Stat("abc/skog.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.Name != "abc/skog.png" || object.Size != 4 || object.ModTime.IsZero() || object.ContentType != "image/png" {
+		t.Errorf("unexpected file %+v", object)
+	}
+
+	url, err := s.SignedURL("abc/skog.png", time.Hour)
+	if err != nil || !strings.Contains(url, "abc/skog.png") {
+		t.Errorf("expected a url of the file, got %q: %v", url, err)
+	}
+
+	if err := s.Delete("abc/skog.png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("abc/skog.png"); err != store.ErrMediaNotFound {
+		t.Errorf("expected store.ErrMediaNotFound, got %v", err)
+	}
+	// Deleting a file that is gone is not an error
+	if err := s.Delete("abc/skog.png"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func testMediaList(t *testing.T, s store.MediaStore) {
+	for _, name := range []string{"b/4.png", "a/2.png", "ab/3.png", "a/1.png", "media/ab/5.png"} {
+		putMedia(t, s, name, name)
+	}
+
+	names := func(prefix string) string {
+		t.Helper()
+		objects, err := s.List(prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, object := range objects {
+			names = append(names, object.Name)
+			if object.Size != int64(len(object.Name)) || object.ModTime.IsZero() {
+				t.Errorf("unexpected file %+v", object)
+			}
+		}
+		return strings.Join(names, ",")
+	}
+
+	for prefix, expected := range map[string]string{
+		"":       "a/1.png,a/2.png,ab/3.png,b/4.png,media/ab/5.png",
+		"a/":     "a/1.png,a/2.png",
+		"a":      "a/1.png,a/2.png,ab/3.png",
+		"media/": "media/ab/5.png",
+		"c/":     "",
+	} {
+		if got := names(prefix); got != expected {
+			t.Errorf("%q: expected %s, got %s", prefix, expected, got)
+		}
+	}
+
+	if err := store.DeleteMediaPrefix(s, "a/"); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(""); got != "ab/3.png,b/4.png,media/ab/5.png" {
+		t.Errorf("expected a/ to be deleted, got %s", got)
+	}
+}
+
+func testMediaCopyPrefix(t *testing.T, s store.MediaStore) {
+	putMedia(t, s, "abc/skog.png", "skog")
+	putMedia(t, s, "abc/ljud/fagel.mp3", "fågel")
+	putMedia(t, s, "abcd/hav.png", "hav")
+
+	if err := s.CopyPrefix("abc/", "def/"); err != nil {
+		t.Fatal(err)
+	}
+	expectMedia(t, s, "def/skog.png", "skog")
+	expectMedia(t, s, "def/ljud/fagel.mp3", "fågel")
+	expectMedia(t, s, "abc/skog.png", "skog")
+	if _, err := s.Stat("def/hav.png"); err != store.ErrMediaNotFound {
+		t.Errorf("expected only abc/ to be copied, got %v", err)
+	}
+}
+
+func testMediaNames(t *testing.T, s store.MediaStore) {
+	for _, name := range []string{"", "/abc/skog.png", "abc/../../skog.png", "abc/./skog.png", "abc//skog.png", "abc\\skog.png", "c:/skog.png", "abc/"} {
+		if err := s.Put(name, strings.NewReader("skog"), ""); err != store.ErrInvalidMediaName {
+			t.Errorf("%q: expected store.ErrInvalidMediaName, got %v", name, err)
+		}
+		if _, err := s.Get(name); err != store.ErrInvalidMediaName {
+			t.Errorf("%q: expected store.ErrInvalidMediaName, got %v", name, err)
+		}
+	}
+
+	// Names are not limited to the characters of a url
+	putMedia(t, s, "abc/en skog & ett hav+.png", "skog")
+	expectMedia(t, s, "abc/en skog & ett hav+.png", "skog")
+}
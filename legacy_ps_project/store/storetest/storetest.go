@@ -0,0 +1,1430 @@
+// Package storetest contains a conformance suite that every implementation
+// of store.Store is expected to pass. Run it from a test in the package of
+// the implementation:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) store.Store { return NewStore() })
+//	}
+package storetest
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"projektps/models"
+	"projektps/store"
+)
+
+// Run runs the conformance suite. newStore is called once for every subtest
+// and must return an empty store.
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.Store)
+	}{
+		{"DefaultAdventure", testDefaultAdventure},
+		{"AdventureContent", testAdventureContent},
+		{"EditAdventureContent", testEditAdventureContent},
+		{"Transaction", testTransaction},
+		{"AdventureQueries", testAdventureQueries},
+		{"DeleteAdventure", testDeleteAdventure},
+		{"Slugs", testSlugs},
+		{"Nodes", testNodes},
+		{"Links", testLinks},
+		{"Categories", testCategories},
+		{"Lists", testLists},
+		{"Users", testUsers},
+		{"Reports", testReports},
+		{"Images", testImages},
+		{"Statistics", testStatistics},
+		{"Media", testMedia},
+		{"PlaySessions", testPlaySessions},
+		{"PlayCounts", testPlayCounts},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, newStore(t))
+		})
+	}
+}
+
+func createCategory(t *testing.T, s store.Store, title string) *models.Category {
+	t.Helper()
+
+	category, err := s.CreateNewCategory(&models.Category{Title: title, Icon: "🌲", SortOrder: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return category
+}
+
+func createAdventure(t *testing.T, s store.Store) *models.Adventure {
+	t.Helper()
+
+	adventure, err := s.CreateDefaultAdventure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return adventure
+}
+
+func testDefaultAdventure(t *testing.T, s store.Store) {
+	adventure := createAdventure(t, s)
+	if adventure.ID == 0 || adventure.Slug == "" || adventure.ViewSlug == "" {
+		t.Fatalf("expected id and slugs to be set, got %+v", adventure)
+	}
+	if len(adventure.Nodes) != 3 || len(adventure.Links) != 2 {
+		t.Fatalf("expected 3 nodes and 2 links, got %d and %d", len(adventure.Nodes), len(adventure.Links))
+	}
+
+	edit, err := s.GetAdventure(adventure.Slug, models.ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edit.Permission != models.ReadWrite || edit.Title != "Nytt äventyr" || edit.CreatedAt.IsZero() {
+		t.Errorf("unexpected adventure %+v", edit)
+	}
+	if edit.Nodes[0].NodeType != "root" || edit.Nodes[0].Title != "Start" {
+		t.Errorf("expected the root node first, got %+v", edit.Nodes[0])
+	}
+
+	view, err := s.GetAdventure(adventure.ViewSlug, models.ReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if view.Permission != models.ReadOnly || view.ID != adventure.ID {
+		t.Errorf("unexpected adventure %+v", view)
+	}
+
+	if _, err := s.GetAdventure(adventure.ViewSlug, models.ReadWrite); err != sql.ErrNoRows {
+		t.Errorf("expected the view slug not to give write access, got %v", err)
+	}
+	if _, err := s.GetAdventure("missing", models.Ignore); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	byID, err := s.GetAdventureByID(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byID.Slug != adventure.Slug || len(byID.Nodes) != 3 {
+		t.Errorf("unexpected adventure %+v", byID)
+	}
+	if _, err := s.GetAdventureByID(adventure.ID + 100); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func testAdventureContent(t *testing.T, s store.Store) {
+	category := createCategory(t, s, "Skog")
+	adventure := createAdventure(t, s)
+
+	adventure, err := s.GetAdventure(adventure.Slug, models.ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adventure.Title = "Skogen"
+	adventure.Description = "Ett äventyr i skogen"
+	adventure.Category = *category
+	adventure.CoverUrl = "https://example.com/cover.jpg"
+	adventure.Props = `{"background":"#fff"}`
+	adventure.Nodes[1].Title = "Stigen"
+	adventure.Nodes[1].Changed = true
+	adventure.Nodes = append(adventure.Nodes[:2], models.Node{NodeID: 3, NodeType: "default", Title: "Sjön"})
+	adventure.Links = adventure.Links[:1]
+	adventure.Links = append(adventure.Links, models.Link{LinkID: 2, SourceNodeID: 1, TargetNodeID: 3, LinkType: "default"})
+
+	err = s.UpdateAdventureContent(adventure, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := s.GetAdventure(adventure.ViewSlug, models.ReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Title != "Skogen" || saved.Description != "Ett äventyr i skogen" || saved.CoverUrl != "https://example.com/cover.jpg" {
+		t.Errorf("unexpected adventure %+v", saved)
+	}
+	if saved.Category.ID != category.ID || saved.Category.Title != "Skog" {
+		t.Errorf("expected category %d, got %+v", category.ID, saved.Category)
+	}
+	if saved.Props != adventure.Props {
+		t.Errorf("expected props %s, got %s", adventure.Props, saved.Props)
+	}
+	if saved.EditVersion != adventure.EditVersion+1 {
+		t.Errorf("expected edit_version %d, got %d", adventure.EditVersion+1, saved.EditVersion)
+	}
+	if len(saved.Nodes) != 3 || len(saved.Links) != 2 {
+		t.Fatalf("expected 3 nodes and 2 links, got %d and %d", len(saved.Nodes), len(saved.Links))
+	}
+
+	titles := map[int64]string{}
+	for _, node := range saved.Nodes {
+		titles[node.NodeID] = node.Title
+	}
+	if titles[1] != "Stigen" || titles[3] != "Sjön" {
+		t.Errorf("unexpected node titles %v", titles)
+	}
+	if _, exists := titles[2]; exists {
+		t.Error("expected node 2 to be removed")
+	}
+
+	// Saving from the old edit_version again is a conflict
+	err = s.UpdateAdventureContent(adventure, 0)
+	if err != store.ErrVersionConflict {
+		t.Errorf("expected store.ErrVersionConflict, got %v", err)
+	}
+
+	revisions, err := s.GetRevisions(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 || revisions[0].Revision != 1 || revisions[0].Adventure != nil {
+		t.Fatalf("expected a single revision without snapshot, got %+v", revisions)
+	}
+
+	revision, err := s.GetRevision(adventure.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision.Adventure == nil || revision.Adventure.Title != "Skogen" || len(revision.Adventure.Nodes) != 3 {
+		t.Errorf("unexpected snapshot %+v", revision.Adventure)
+	}
+	if _, err := s.GetRevision(adventure.ID, 2); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	err = s.CountViewAdventure(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID, err := s.GetAdventureByID(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byID.ViewCount != 1 {
+		t.Errorf("expected view count 1, got %d", byID.ViewCount)
+	}
+}
+
+func testEditAdventureContent(t *testing.T, s store.Store) {
+	adventure := createAdventure(t, s)
+
+	err := s.EditAdventureContent(adventure.Slug, adventure.EditVersion, 0, func(tx store.Store) error {
+		node, err := tx.GetNode(adventure.ID, 1)
+		if err != nil {
+			return err
+		}
+		node.Title = "Ändrad"
+		return tx.UpdateNode(node)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := s.GetNode(adventure.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.Title != "Ändrad" {
+		t.Errorf("expected the node to be updated, got %q", node.Title)
+	}
+
+	// A failing fn rolls back every change, including the edit_version
+	err = s.EditAdventureContent(adventure.Slug, adventure.EditVersion+1, 0, func(tx store.Store) error {
+		node.Title = "Kastad"
+		if err := tx.UpdateNode(node); err != nil {
+			return err
+		}
+		return store.ErrVersionConflict
+	})
+	if err != store.ErrVersionConflict {
+		t.Fatalf("expected the error from fn, got %v", err)
+	}
+
+	saved, err := s.GetAdventure(adventure.Slug, models.ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.EditVersion != adventure.EditVersion+1 {
+		t.Errorf("expected edit_version %d, got %d", adventure.EditVersion+1, saved.EditVersion)
+	}
+	if saved.Nodes[1].Title != "Ändrad" {
+		t.Errorf("expected the node change to be rolled back, got %q", saved.Nodes[1].Title)
+	}
+
+	err = s.EditAdventureContent(adventure.Slug, adventure.EditVersion, 0, func(tx store.Store) error {
+		return nil
+	})
+	if err != store.ErrVersionConflict {
+		t.Errorf("expected store.ErrVersionConflict, got %v", err)
+	}
+
+	revisions, err := s.GetRevisions(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 {
+		t.Errorf("expected 1 revision, got %d", len(revisions))
+	}
+}
+
+func testTransaction(t *testing.T, s store.Store) {
+	var slug string
+	err := s.WithTransaction(func(tx store.Store) error {
+		adventure, err := tx.CreateDefaultAdventure()
+		if err != nil {
+			return err
+		}
+		slug = adventure.Slug
+
+		// Nested transactions are part of the outer one
+		return tx.WithTransaction(func(tx store.Store) error {
+			return store.ErrVersionConflict
+		})
+	})
+	if err != store.ErrVersionConflict {
+		t.Fatalf("expected the error from fn, got %v", err)
+	}
+	if _, err := s.GetAdventure(slug, models.ReadWrite); err != sql.ErrNoRows {
+		t.Errorf("expected the adventure to be rolled back, got %v", err)
+	}
+
+	err = s.WithTransaction(func(tx store.Store) error {
+		adventure, err := tx.CreateNewAdventure()
+		if err != nil {
+			return err
+		}
+		slug = adventure.Slug
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetAdventure(slug, models.ReadWrite); err != nil {
+		t.Errorf("expected the adventure to be committed, got %v", err)
+	}
+}
+
+func testAdventureQueries(t *testing.T, s store.Store) {
+	forest := createCategory(t, s, "Skog")
+	sea := createCategory(t, s, "Hav")
+
+	adventures := []*models.Adventure{}
+	for i, title := range []string{"Skogen", "Havet", "Skogsbrynet"} {
+		adventure := createAdventure(t, s)
+		adventure.Title = title
+		adventure.Category = *forest
+		if i == 1 {
+			adventure.Category = *sea
+			adventure.Nodes[2].Content = "<p>En val simmar förbi.</p>"
+			adventure.Nodes[2].Changed = true
+		}
+		if err := s.UpdateAdventureContent(adventure, 0); err != nil {
+			t.Fatal(err)
+		}
+		adventures = append(adventures, adventure)
+	}
+
+	result, count, err := s.GetAdventuresByCategory(forest.ID, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || len(result) != 1 || result[0].ID != adventures[0].ID {
+		t.Errorf("expected the first of 2 adventures, got %d and %+v", count, result)
+	}
+
+	result, count, err = s.GetAdventuresByCategory(forest.ID, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || len(result) != 1 || result[0].ID != adventures[2].ID {
+		t.Errorf("expected the second of 2 adventures, got %d and %+v", count, result)
+	}
+
+	result, count, err = s.GetAdventuresBySearchString("skog", 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || len(result) != 2 {
+		t.Errorf("expected 2 adventures matching the title, got %d and %+v", count, result)
+	}
+
+	result, count, err = s.GetAdventuresBySearchString("val simmar", 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || len(result) != 1 || result[0].ID != adventures[1].ID {
+		t.Errorf("expected the adventure matching a node, got %d and %+v", count, result)
+	}
+
+	result, count, err = s.GetAdventuresBySearchString("öken", 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 || len(result) != 0 {
+		t.Errorf("expected no adventures, got %d and %+v", count, result)
+	}
+}
+
+func testDeleteAdventure(t *testing.T, s store.Store) {
+	adventure := createAdventure(t, s)
+	other := createAdventure(t, s)
+
+	user := &models.User{Username: "anna", Name: "Anna", Role: 1}
+	user.HashPassword("hemligt")
+	user, err := s.CreateUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddUserToAdventure(user, adventure); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateAdventureContent(adventure, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.DeleteAdventureByID(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetAdventureByID(adventure.ID); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	nodes, err := s.GetNodesByAdventureID(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, err := s.GetLinksByAdventureID(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revisions, err := s.GetRevisions(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 0 || len(links) != 0 || len(revisions) != 0 {
+		t.Errorf("expected content to be deleted, got %d nodes, %d links and %d revisions", len(nodes), len(links), len(revisions))
+	}
+
+	saved, err := s.GetUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Adventures) != 0 {
+		t.Errorf("expected the membership to be deleted, got %+v", saved.Adventures)
+	}
+
+	nodes, err = s.GetNodesByAdventureID(other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 3 {
+		t.Errorf("expected other adventures to be kept, got %d nodes", len(nodes))
+	}
+}
+
+func testSlugs(t *testing.T, s store.Store) {
+	adventure := createAdventure(t, s)
+	other := createAdventure(t, s)
+
+	if adventure.Slug == other.Slug || adventure.ViewSlug == other.ViewSlug || adventure.Slug == adventure.ViewSlug {
+		t.Errorf("expected unique slugs, got %+v and %+v", adventure, other)
+	}
+
+	oldSlug := adventure.ViewSlug
+	err := s.UpdateViewSlug(adventure.ID, "skolans-vardegrund")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := s.GetAdventure("skolans-vardegrund", models.ReadOnly)
+	if err != nil || saved.ID != adventure.ID {
+		t.Fatalf("expected the adventure by its new play slug, got %+v and %v", saved, err)
+	}
+	if _, err := s.GetAdventure(oldSlug, models.ReadOnly); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for the old play slug, got %v", err)
+	}
+
+	viewSlug, err := s.GetSlugRedirect(oldSlug)
+	if err != nil || viewSlug != "skolans-vardegrund" {
+		t.Errorf("expected a redirect to the new play slug, got %q and %v", viewSlug, err)
+	}
+
+	// Renaming again keeps the first redirect pointing at the latest slug
+	if err := s.UpdateViewSlug(adventure.ID, "vardegrunden"); err != nil {
+		t.Fatal(err)
+	}
+	if viewSlug, _ := s.GetSlugRedirect(oldSlug); viewSlug != "vardegrunden" {
+		t.Errorf("expected the old redirect to follow the rename, got %q", viewSlug)
+	}
+
+	for slug, expected := range map[string]error{
+		"vardegrunden":       store.ErrSlugTaken,
+		"skolans-vardegrund": store.ErrSlugTaken,
+		oldSlug:              store.ErrSlugTaken,
+		adventure.Slug:       store.ErrSlugTaken,
+		"upload":             models.ErrSlugReserved,
+		"admin":              models.ErrSlugReserved,
+		"Versaler":           models.ErrSlugInvalid,
+		"kort":               models.ErrSlugInvalid,
+		"-bindestreck":       models.ErrSlugInvalid,
+	} {
+		if err := s.UpdateViewSlug(other.ID, slug); err != expected {
+			t.Errorf("%q: expected %v, got %v", slug, expected, err)
+		}
+	}
+
+	// The old play slugs of an adventure can be taken back
+	if err := s.UpdateViewSlug(adventure.ID, "skolans-vardegrund"); err != nil {
+		t.Errorf("expected to take back an old play slug, got %v", err)
+	}
+	if _, err := s.GetSlugRedirect("skolans-vardegrund"); err != sql.ErrNoRows {
+		t.Errorf("expected the redirect to be removed, got %v", err)
+	}
+
+	// UpdateAdventure changes the play slug the same way
+	adventure, err = s.GetAdventureByID(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adventure.ViewSlug = other.ViewSlug
+	if err := s.UpdateAdventure(adventure); err != store.ErrSlugTaken {
+		t.Errorf("expected store.ErrSlugTaken, got %v", err)
+	}
+
+	if err := s.DeleteAdventureByID(adventure.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetSlugRedirect(oldSlug); err != sql.ErrNoRows {
+		t.Errorf("expected the redirects to be deleted with the adventure, got %v", err)
+	}
+}
+
+func testNodes(t *testing.T, s store.Store) {
+	adventure := createAdventure(t, s)
+
+	node, err := s.CreateNewNode(&models.Node{
+		AdventureID: adventure.ID,
+		NodeID:      3,
+		NodeType:    "default",
+		Title:       "Grottan",
+		Content:     "<p>Mörkt.</p>",
+		ImageID:     7,
+		X:           10,
+		Y:           20,
+		Props:       `{"color":"red"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.ID == 0 {
+		t.Fatal("expected the node id to be set")
+	}
+
+	saved, err := s.GetNode(adventure.ID, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.ID != node.ID || saved.AdventureID != adventure.ID || saved.Title != "Grottan" || saved.Content != "<p>Mörkt.</p>" ||
+		saved.ImageID != 7 || saved.X != 10 || saved.Y != 20 || saved.Props != `{"color":"red"}` {
+		t.Errorf("unexpected node %+v", saved)
+	}
+
+	saved.Title = "Grottan i berget"
+	saved.X = 30
+	if err := s.UpdateNode(saved); err != nil {
+		t.Fatal(err)
+	}
+	saved, err = s.GetNode(adventure.ID, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Title != "Grottan i berget" || saved.X != 30 {
+		t.Errorf("unexpected node %+v", saved)
+	}
+
+	if err := s.DeleteNode(saved); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetNode(adventure.ID, 3); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	nodes, err := s.GetNodesByAdventureID(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 3 {
+		t.Errorf("expected 3 nodes, got %d", len(nodes))
+	}
+}
+
+func testLinks(t *testing.T, s store.Store) {
+	adventure := createAdventure(t, s)
+
+	link, err := s.CreateNewLink(&models.Link{
+		AdventureID:     adventure.ID,
+		LinkID:          2,
+		SourceNodeID:    1,
+		TargetNodeID:    2,
+		SourceLinkTitle: "Gå över",
+		LinkType:        "default",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.ID == 0 {
+		t.Fatal("expected the link id to be set")
+	}
+
+	saved, err := s.GetLink(adventure.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.ID != link.ID || saved.SourceNodeID != 1 || saved.TargetNodeID != 2 || saved.SourceLinkTitle != "Gå över" {
+		t.Errorf("unexpected link %+v", saved)
+	}
+
+	saved.AdventureID = adventure.ID
+	saved.TargetLinkTitle = "Gå tillbaka"
+	saved.LinkType = "bidirectional"
+	if err := s.UpdateLink(saved); err != nil {
+		t.Fatal(err)
+	}
+	saved, err = s.GetLink(adventure.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.TargetLinkTitle != "Gå tillbaka" || saved.LinkType != "bidirectional" {
+		t.Errorf("unexpected link %+v", saved)
+	}
+
+	saved.AdventureID = adventure.ID
+	if err := s.DeleteLink(saved); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetLink(adventure.ID, 2); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	links, err := s.GetLinksByAdventureID(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 {
+		t.Errorf("expected 2 links, got %d", len(links))
+	}
+}
+
+func testCategories(t *testing.T, s store.Store) {
+	second, err := s.CreateNewCategory(&models.Category{Title: "Hav", Icon: "🌊", SortOrder: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := s.CreateNewCategory(&models.Category{Title: "Skog", Icon: "🌲", SortOrder: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	categories, err := s.GetCategories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(categories) != 2 || categories[0].ID != first.ID || categories[1].ID != second.ID {
+		t.Fatalf("expected categories in sort order, got %+v", categories)
+	}
+
+	first.Title = "Skogen"
+	if err := s.UpdateCategory(first); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := s.GetCategory(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Title != "Skogen" || saved.Icon != "🌲" {
+		t.Errorf("unexpected category %+v", saved)
+	}
+
+	adventure := createAdventure(t, s)
+	adventure.Category = *first
+	if err := s.UpdateAdventureContent(adventure, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteCategory(first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetCategory(first.ID); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	byID, err := s.GetAdventureByID(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byID.Category.ID != 0 {
+		t.Errorf("expected the adventure to lose its category, got %+v", byID.Category)
+	}
+}
+
+func testLists(t *testing.T, s store.Store) {
+	category := createCategory(t, s, "Skog")
+
+	adventures := []models.Adventure{}
+	for i := 0; i < 3; i++ {
+		adventure := createAdventure(t, s)
+		adventure.Category = *category
+		if err := s.UpdateAdventureContent(adventure, 0); err != nil {
+			t.Fatal(err)
+		}
+		adventures = append(adventures, *adventure)
+	}
+
+	parent, err := s.CreateNewList(&models.List{Title: "start", Description: "Startsidan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := s.CreateNewList(&models.List{Title: "utvalda", ParentID: parent.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	child.Adventures = []models.Adventure{adventures[2], adventures[0]}
+	if err := s.UpdateList(child); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := s.GetListByID(child.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Adventures) != 2 || list.Adventures[0].ID != adventures[2].ID || list.Adventures[1].ID != adventures[0].ID {
+		t.Errorf("expected the adventures in list order, got %+v", list.Adventures)
+	}
+
+	result, err := s.GetAdventures("utvalda")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 || result[0].ID != adventures[2].ID || result[0].Category.Title != "Skog" {
+		t.Errorf("expected the adventures in list order, got %+v", result)
+	}
+
+	bySlug, err := s.GetList("utvalda")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bySlug.ID != child.ID || bySlug.ParentID != parent.ID {
+		t.Errorf("unexpected list %+v", bySlug)
+	}
+	if _, err := s.GetList("saknas"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	children, err := s.GetListsByParent("start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 1 || children[0].ID != child.ID {
+		t.Errorf("expected the child list, got %+v", children)
+	}
+
+	lists, err := s.GetLists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 2 {
+		t.Errorf("expected 2 lists, got %d", len(lists))
+	}
+
+	child.Adventures = []models.Adventure{adventures[1]}
+	if err := s.UpdateList(child); err != nil {
+		t.Fatal(err)
+	}
+	result, err = s.GetAdventures("utvalda")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].ID != adventures[1].ID {
+		t.Errorf("expected the list items to be replaced, got %+v", result)
+	}
+
+	if err := s.DeleteListByID(child.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetListByID(child.ID); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func testUsers(t *testing.T, s store.Store) {
+	user := &models.User{Username: "anna", Name: "Anna", Role: 2}
+	user.HashPassword("hemligt")
+
+	user, err := s.CreateUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == 0 {
+		t.Fatal("expected the user id to be set")
+	}
+
+	authenticated, err := s.Authenticate("anna", "hemligt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authenticated.ID != user.ID {
+		t.Errorf("expected user %d, got %d", user.ID, authenticated.ID)
+	}
+	if _, err := s.Authenticate("anna", "fel"); err != store.ErrInvalidPassword {
+		t.Errorf("expected store.ErrInvalidPassword, got %v", err)
+	}
+	if _, err := s.Authenticate("okänd", "hemligt"); err != store.ErrInvalidUser {
+		t.Errorf("expected store.ErrInvalidUser, got %v", err)
+	}
+
+	duplicate := &models.User{Username: "anna", Name: "Anna 2"}
+	duplicate.HashPassword("hemligt")
+	if _, err := s.CreateUser(duplicate); err == nil {
+		t.Error("expected usernames to be unique")
+	}
+
+	// An empty password keeps the current one
+	user.Name = "Anna Andersson"
+	user.Password = ""
+	if err := s.UpdateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate("anna", "hemligt"); err != nil {
+		t.Errorf("expected the password to be kept, got %v", err)
+	}
+
+	adventure := createAdventure(t, s)
+	if err := s.AddUserToAdventure(user, adventure); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := s.GetUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Name != "Anna Andersson" || saved.Role != 2 || saved.Password != "" {
+		t.Errorf("unexpected user %+v", saved)
+	}
+	if len(saved.Adventures) != 1 || saved.Adventures[0].ID != adventure.ID {
+		t.Errorf("expected the adventure of the user, got %+v", saved.Adventures)
+	}
+
+	members, err := s.GetUsersByAdventureID(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].ID != user.ID {
+		t.Errorf("expected the user as member, got %+v", members)
+	}
+
+	byAdventure, err := s.GetAdventure(adventure.Slug, models.ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byAdventure.Users) != 1 {
+		t.Errorf("expected the adventure to have 1 member, got %d", len(byAdventure.Users))
+	}
+
+	if err := s.DeleteUserFromAdventure(user, adventure); err != nil {
+		t.Fatal(err)
+	}
+	members, err = s.GetUsersByAdventureID(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 0 {
+		t.Errorf("expected no members, got %+v", members)
+	}
+
+	users, err := s.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Password != "" {
+		t.Errorf("expected 1 user without password, got %+v", users)
+	}
+
+	if err := s.DeleteUser(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUser(user.ID); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func testReports(t *testing.T, s store.Store) {
+	adventure := createAdventure(t, s)
+	other := createAdventure(t, s)
+
+	first, err := s.ReportAdventure(&models.Report{AdventureID: adventure.ID, ReportReason: "spam", Comment: "Reklam"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == 0 {
+		t.Fatal("expected the report id to be set")
+	}
+	if _, err := s.ReportAdventure(&models.Report{AdventureID: adventure.ID, ReportReason: "spam"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReportAdventure(&models.Report{AdventureID: other.ID, ReportReason: "olämpligt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := s.GetReports(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("expected 3 unhandled reports, got %d", len(reports))
+	}
+
+	adventures, count, err := s.GetAdventuresByReportReason("spam", 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || len(adventures) != 1 || adventures[0].ID != adventure.ID {
+		t.Errorf("expected the reported adventure, got %d and %+v", count, adventures)
+	}
+
+	first.IsHandled = 1
+	if err := s.UpdateReport(first); err != nil {
+		t.Fatal(err)
+	}
+
+	handled, err := s.GetReports(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(handled) != 1 || handled[0].ID != first.ID || handled[0].Comment != "Reklam" {
+		t.Errorf("expected the handled report, got %+v", handled)
+	}
+
+	reports, err = s.GetReports(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Errorf("expected 2 unhandled reports, got %d", len(reports))
+	}
+}
+
+func testImages(t *testing.T, s store.Store) {
+	active, err := s.CreateNewImageCategory(&models.ImageCategory{Active: true, Title: "Natur", UnsplashID: 123})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inactive, err := s.CreateNewImageCategory(&models.ImageCategory{Title: "Arkiv", UnsplashID: 456})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	categories, err := s.GetImageCategories(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(categories) != 1 || categories[0].ID != active.ID {
+		t.Errorf("expected the active category, got %+v", categories)
+	}
+	categories, err = s.GetImageCategories(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(categories) != 2 || categories[0].ID != inactive.ID {
+		t.Errorf("expected all categories ordered by title, got %+v", categories)
+	}
+
+	byUnsplash, err := s.GetImageCategoryByUnsplashID("456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byUnsplash.ID != inactive.ID {
+		t.Errorf("expected category %d, got %d", inactive.ID, byUnsplash.ID)
+	}
+
+	inactive.Active = true
+	inactive.Title = "Arkivet"
+	if err := s.UpdateImageCategory(inactive); err != nil {
+		t.Fatal(err)
+	}
+	category, err := s.GetImageCategory(strconv.FormatInt(inactive.ID, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if category.Title != "Arkivet" || !category.Active {
+		t.Errorf("unexpected category %+v", category)
+	}
+
+	image, err := s.CreateNewImage(&models.Image{
+		Active:     true,
+		CategoryID: active.ID,
+		Title:      "Fjäll",
+		UnsplashID: "abc",
+		AuthorName: "Fotograf",
+		FullURL:    "https://example.com/full.jpg",
+		ThumbURL:   "https://example.com/thumb.jpg",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateNewImage(&models.Image{CategoryID: active.ID, Title: "Dold", UnsplashID: "def"}); err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := s.GetImagesByCategory(active.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 || images[0].ID != image.ID || images[0].AuthorName != "Fotograf" {
+		t.Errorf("expected the active image, got %+v", images)
+	}
+
+	saved, err := s.GetImageByUnsplashID("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.ID != image.ID || saved.FullURL != "https://example.com/full.jpg" {
+		t.Errorf("unexpected image %+v", saved)
+	}
+
+	image.Title = "Fjällen"
+	if err := s.UpdateImage(image); err != nil {
+		t.Fatal(err)
+	}
+	saved, err = s.GetImage(image.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Title != "Fjällen" {
+		t.Errorf("expected the title to be updated, got %q", saved.Title)
+	}
+
+	adventure := createAdventure(t, s)
+	node, err := s.GetNode(adventure.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.ImageID = image.ID
+	node.ImageLayoutType = "cover"
+	if err := s.UpdateNode(node); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleting the category deletes its images and the references to them
+	if err := s.DeleteImageCategory(*active); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetImage(image.ID); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+	if _, err := s.GetImageCategory(strconv.FormatInt(active.ID, 10)); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	node, err = s.GetNode(adventure.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.ImageID != 0 || node.ImageLayoutType != "" {
+		t.Errorf("expected the image reference to be removed, got %+v", node)
+	}
+
+	other, err := s.CreateNewImage(&models.Image{Active: true, CategoryID: inactive.ID, UnsplashID: "ghi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.ImageID = other.ID
+	if err := s.UpdateNode(node); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteImage(*other); err != nil {
+		t.Fatal(err)
+	}
+	node, err = s.GetNode(adventure.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.ImageID != 0 {
+		t.Errorf("expected the image reference to be removed, got %d", node.ImageID)
+	}
+}
+
+func testStatistics(t *testing.T, s store.Store) {
+	adventure := createAdventure(t, s)
+
+	for _, nodeID := range []string{"0", "1", "1", "7"} {
+		if err := s.LogVisitedNode(nodeID, adventure.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	format := "2006-01-02 15:04:05"
+	start := time.Now().UTC().Add(-time.Hour).Format(format)
+	stop := time.Now().UTC().Add(time.Hour).Format(format)
+
+	stats, err := s.GetStatisticsByAdventureID(adventure.ID, start, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	visits := map[int64]int64{}
+	for _, stat := range stats {
+		visits[stat.NodeId] = stat.VisitCount
+	}
+	// Visits to nodes that do not exist are not counted
+	if len(stats) != 2 || visits[0] != 1 || visits[1] != 2 {
+		t.Errorf("unexpected statistics %+v", stats)
+	}
+
+	stats, err = s.GetStatisticsByAdventureID(adventure.ID, "2000-01-01 00:00:00", "2000-01-02 00:00:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 0 {
+		t.Errorf("expected no statistics outside the interval, got %+v", stats)
+	}
+}
+
+func testMedia(t *testing.T, s store.Store) {
+	hash := strings.Repeat("ab", 32)
+	media, err := s.CreateMedia(&models.Media{Hash: hash, URL: models.MediaURL(hash, ".jpg"), Size: 10, ContentType: "image/jpeg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if media.ID == 0 || media.CreatedAt.IsZero() || media.RefCount != 0 {
+		t.Errorf("unexpected media %+v", media)
+	}
+
+	// The same content is stored once
+	again, err := s.CreateMedia(&models.Media{Hash: hash, URL: models.MediaURL(hash, ".jpeg"), Size: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != media.ID || again.URL != media.URL {
+		t.Errorf("expected media %+v, got %+v", media, again)
+	}
+
+	adventure := createAdventure(t, s)
+	other := createAdventure(t, s)
+	for _, a := range []*models.Adventure{adventure, other} {
+		edit, err := s.GetAdventure(a.Slug, models.ReadWrite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edit.CoverUrl = media.URL
+		if a == adventure {
+			edit.Nodes[0].ImageURL = media.URL
+			edit.Nodes[0].Changed = true
+		}
+		if err := s.UpdateAdventureContent(edit, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved, err := s.GetMediaByHash(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.RefCount != 3 {
+		t.Errorf("expected 3 references, got %d", saved.RefCount)
+	}
+
+	ids, err := s.GetAdventureIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != adventure.ID || ids[1] != other.ID {
+		t.Errorf("expected adventures %d and %d, got %v", adventure.ID, other.ID, ids)
+	}
+
+	// The references of a deleted adventure are removed with it
+	if err := s.DeleteAdventureByID(other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateMediaReferences(adventure.ID); err != nil {
+		t.Fatal(err)
+	}
+	all, err := s.GetMedia()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].RefCount != 2 {
+		t.Errorf("expected 2 references, got %+v", all)
+	}
+
+	// An image that is processed again gets its variants
+	media.Size = 8
+	media.Width, media.Height = 2000, 1000
+	media.Thumbnail = models.MediaVariantURL(hash, "thumb", ".jpg")
+	media.Variants = []models.MediaVariant{{URL: models.MediaVariantURL(hash, "w960", ".jpg"), Width: 960, Height: 480}}
+	if err := s.UpdateMedia(media); err != nil {
+		t.Fatal(err)
+	}
+	saved, err = s.GetMediaByHash(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Size != 8 || saved.Width != 2000 || saved.Height != 1000 || saved.Thumbnail != media.Thumbnail || len(saved.Variants) != 1 || saved.Variants[0] != media.Variants[0] {
+		t.Errorf("expected media %+v, got %+v", media, saved)
+	}
+
+	// An adventure uses the files uploaded to it and the ones it refers to
+	uploadedHash := strings.Repeat("cd", 32)
+	uploaded, err := s.CreateMedia(&models.Media{Hash: uploadedHash, URL: models.MediaURL(uploadedHash, ".png"), Size: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mediaID := range []int64{uploaded.ID, uploaded.ID, media.ID} {
+		if err := s.AddMediaUpload(mediaID, adventure.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	used, err := s.GetAdventureMedia(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(used) != 2 || used[0].ID != media.ID || used[1].ID != uploaded.ID || used[1].Size != 5 {
+		t.Errorf("expected media %d and %d, got %+v", media.ID, uploaded.ID, used)
+	}
+
+	// An upload stops counting when the adventure has used the file and
+	// stopped, or when it is removed
+	for _, url := range []string{uploaded.URL, ""} {
+		edit, err := s.GetAdventure(adventure.Slug, models.ReadWrite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edit.Nodes[1].ImageURL = url
+		edit.Nodes[1].Changed = true
+		if err := s.UpdateAdventureContent(edit, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.RemoveMediaUpload(media.ID, adventure.ID); err != nil {
+		t.Fatal(err)
+	}
+	used, err = s.GetAdventureMedia(adventure.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(used) != 1 || used[0].ID != media.ID {
+		t.Errorf("expected media %d that is still referred to, got %+v", media.ID, used)
+	}
+
+	if err := s.DeleteMedia(uploaded.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteMedia(media.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetMediaByHash(hash); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+	used, err = s.GetAdventureMedia(adventure.ID)
+	if err != nil || len(used) != 0 {
+		t.Errorf("expected the uploads to be removed with the files, got %+v: %v", used, err)
+	}
+}
+
+func testPlaySessions(t *testing.T, s store.Store) {
+	adventure := createAdventure(t, s)
+	id := func(n int64) *int64 { return &n }
+
+	session := &models.PlaySession{ID: "0123456789abcdef", AdventureID: adventure.ID}
+	if err := s.CreatePlaySession(session); err != nil {
+		t.Fatal(err)
+	}
+	if session.StartedAt.IsZero() || !session.UpdatedAt.Equal(session.StartedAt) {
+		t.Errorf("unexpected session %+v", session)
+	}
+	// A session that exists is left as it is
+	if err := s.CreatePlaySession(&models.PlaySession{ID: session.ID, AdventureID: adventure.ID}); err != nil {
+		t.Errorf("expected no error for a session that exists, got %v", err)
+	}
+	if _, err := s.GetPlaySession("saknas"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+	if err := s.AddPlayEvents("saknas", []models.PlayEvent{{Seq: 1, Type: models.PlayStart}}); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	events := []models.PlayEvent{
+		{Seq: 1, Type: models.PlayStart},
+		{Seq: 2, Type: models.PlayNode, NodeID: id(0), Offset: 10},
+	}
+	if err := s.AddPlayEvents(session.ID, events); err != nil {
+		t.Fatal(err)
+	}
+	events = []models.PlayEvent{
+		{Seq: 3, Type: models.PlayChoice, LinkID: id(0), Offset: 4000},
+		{Seq: 4, Type: models.PlayNode, NodeID: id(1), Offset: 4010},
+	}
+	if err := s.AddPlayEvents(session.ID, events); err != nil {
+		t.Fatal(err)
+	}
+	// An event is only recorded once
+	if err := s.AddPlayEvents(session.ID, events[1:]); err == nil {
+		t.Error("expected an error for an event that exists")
+	}
+
+	saved, err := s.GetPlaySession(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.AdventureID != adventure.ID || len(saved.Events) != 4 || saved.LastSeq() != 4 || saved.Ended() {
+		t.Fatalf("unexpected session %+v", saved)
+	}
+	if saved.Events[0].NodeID != nil || saved.Events[1].NodeID == nil || *saved.Events[1].NodeID != 0 ||
+		saved.Events[2].LinkID == nil || *saved.Events[2].LinkID != 0 || saved.Events[3].Offset != 4010 {
+		t.Errorf("unexpected events %+v", saved.Events)
+	}
+
+	other := &models.PlaySession{ID: "fedcba9876543210", AdventureID: adventure.ID}
+	if err := s.CreatePlaySession(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreatePlaySession(&models.PlaySession{ID: "aaaaaaaaaaaaaaaa", AdventureID: adventure.ID + 100}); err == nil {
+		t.Error("expected an error for an adventure that does not exist")
+	}
+
+	saved, err = s.GetPlaySession(session.ID)
+	if err != nil || len(saved.Events) != 4 {
+		t.Errorf("expected the session to keep its events, got %+v: %v", saved, err)
+	}
+
+	// The sessions of a deleted adventure are removed with it
+	if err := s.DeleteAdventureByID(adventure.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetPlaySession(session.ID); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func testPlayCounts(t *testing.T, s store.Store) {
+	adventure := createAdventure(t, s)
+	other := createAdventure(t, s)
+
+	// play records a session from the nodes it showed and the links it
+	// followed in between, each id with the time it happened at
+	play := func(adventureID int64, id string, ended bool, steps ...int64) {
+		t.Helper()
+		if err := s.CreatePlaySession(&models.PlaySession{ID: id, AdventureID: adventureID}); err != nil {
+			t.Fatal(err)
+		}
+		events := []models.PlayEvent{{Seq: 1, Type: models.PlayStart}}
+		for i := 0; i < len(steps); i += 2 {
+			event := models.PlayEvent{Seq: int64(len(events) + 1), Type: models.PlayNode, NodeID: &steps[i], Offset: steps[i+1]}
+			if i%4 == 2 {
+				event.Type, event.NodeID, event.LinkID = models.PlayChoice, nil, &steps[i]
+			}
+			events = append(events, event)
+		}
+		if ended {
+			events = append(events, models.PlayEvent{Seq: int64(len(events) + 1), Type: models.PlayEnd, Offset: steps[len(steps)-1]})
+		}
+		if err := s.AddPlayEvents(id, events); err != nil {
+			t.Fatal(err)
+		}
+	}
+	play(adventure.ID, "aaaaaaaaaaaaaaaa", true, 0, 0, 0, 3990, 1, 4000)
+	play(adventure.ID, "bbbbbbbbbbbbbbbb", false, 0, 0, 1, 1990, 2, 2000)
+	// Back over the bidirectional link 0, then over link 9 that has been
+	// removed and link 2 that never was, both lead to the node after them
+	play(adventure.ID, "cccccccccccccccc", true, 0, 0, 0, 990, 1, 1000, 0, 2000, 0, 2010, 9, 3000, 2, 3010, 2, 3020, 2, 5000)
+	play(adventure.ID, "dddddddddddddddd", false)
+	play(other.ID, "eeeeeeeeeeeeeeee", false, 0, 0, 0, 100, 1, 200)
+
+	from, to := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	// The sessions that have not ended are abandoned without idle time and
+	// in progress with an hour
+	abandoned, inProgress := time.Duration(0), time.Hour
+
+	counts, err := s.CountPlaySessions(adventure.ID, from, to, abandoned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *counts != (models.PlayCounts{Sessions: 4, Completed: 2, Abandoned: 2}) {
+		t.Errorf("unexpected counts %+v", counts)
+	}
+	counts, err = s.CountPlaySessions(adventure.ID, from, to, inProgress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *counts != (models.PlayCounts{Sessions: 4, Completed: 2}) {
+		t.Errorf("unexpected counts %+v", counts)
+	}
+	counts, err = s.CountPlaySessions(adventure.ID, to, to.Add(time.Hour), abandoned)
+	if err != nil || *counts != (models.PlayCounts{}) {
+		t.Errorf("expected no sessions outside the period, got %+v: %v", counts, err)
+	}
+
+	nodes, err := s.GetPlayNodeCounts(adventure.ID, from, to, abandoned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []models.PlayNodeCounts{
+		{NodeID: 0, Visits: 4, Sessions: 3, Concluded: 3, Durations: []int64{990, 990, 1990, 3990}},
+		{NodeID: 1, Visits: 2, Sessions: 2, Concluded: 2, Durations: []int64{1000}},
+		{NodeID: 2, Visits: 3, Sessions: 2, Concluded: 2, DropOffs: 1, Durations: []int64{10}},
+	}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("expected\n%+v\ngot\n%+v", expected, nodes)
+	}
+	nodes, err = s.GetPlayNodeCounts(adventure.ID, from, to, inProgress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 3 || nodes[2].Concluded != 1 || nodes[2].DropOffs != 0 {
+		t.Errorf("expected the sessions in progress to be left out, got %+v", nodes)
+	}
+
+	paths, err := s.GetPlayPaths(adventure.ID, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(paths, func(i, j int) bool { return fmt.Sprint(paths[i]) < fmt.Sprint(paths[j]) })
+	expectedPaths := []models.PlayPathCounts{
+		{Nodes: []int64{0, 1, 0, 2}, Completed: true, Count: 1},
+		{Nodes: []int64{0, 1}, Completed: true, Count: 1},
+		{Nodes: []int64{0, 2}, Count: 1},
+		{Nodes: []int64{}, Count: 1},
+	}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("expected %+v, got %+v", expectedPaths, paths)
+	}
+
+	choices, err := s.GetPlayChoices(adventure.ID, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedChoices := []models.PlayChoiceCounts{
+		{Source: 0, Target: 1, LinkID: 0, Value: 2, Sessions: 2},
+		{Source: 0, Target: 2, LinkID: 1, Value: 1, Sessions: 1},
+		{Source: 0, Target: 2, LinkID: 9, Value: 1, Sessions: 1},
+		{Source: 1, Target: 0, LinkID: 0, Value: 1, Sessions: 1},
+		{Source: 2, Target: 2, LinkID: 2, Value: 1, Sessions: 1},
+	}
+	if !reflect.DeepEqual(choices, expectedChoices) {
+		t.Errorf("expected %+v, got %+v", expectedChoices, choices)
+	}
+}
@@ -944,6 +944,11 @@ body { font-size: 14pt; font-family: EB Garamond; }
 
     app.model.uploadMedia(data, (response) => {
       var url = response.url;
+      if (response.error == "error.media.invalidsubtitles") {
+        target.value = "";
+        window.alert("Undertexten kunde inte läsas, rad " + response.line + ": " + response.reason);
+        return;
+      }
       if (!url) {
         window.alert("Något gick fel i uppladningen, försök igen.");
         return;
@@ -965,8 +970,9 @@ body { font-size: 14pt; font-family: EB Garamond; }
 
     this.handleFileUpload(
       e.target,
-      ["text/vtt"],
-      "Felaktig filtyp. Du kan endast välja .vtt (WebVTT).",
+      // .srt files often have no type, the server checks the content
+      [],
+      "Felaktig filtyp. Du kan endast välja .vtt (WebVTT) eller .srt (SubRip).",
       1024 * 1024,
       "Filens storlek får inte överstiga 1 Kb.",
       handler
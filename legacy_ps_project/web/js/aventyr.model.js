@@ -34,6 +34,12 @@ Model.prototype.load = function (guid, onError) {
 };
 
 Model.prototype.loadStandalone = async function (guid) {
+  // The offline export has the adventure inlined in the page
+  if (window.offlineAdventure) {
+    this.data = window.offlineAdventure;
+    return this.data;
+  }
+
   const response = await fetch("PSadventure_" + guid + ".json");
   this.data = await response.json();
   return this.data;
@@ -64,7 +70,10 @@ Model.prototype.save = function () {
  * @param  {json} data Payload containing the response from the server
  */
 Model.prototype.didSave = function (result) {
-  if (result.status == 423) {
+  if (result.status == 409) {
+    // Someone else saved first, keep the server version so a merge can use it
+    this.serverEditVersion = result.response ? result.response.edit_version : null;
+
     // Call callback to inform of locked adventure
     if (this.onSave) {
       this.onSave();
@@ -472,6 +481,14 @@ Model.prototype.setPlayerStatistics = function (nodeId, callback) {
   this.storage.setPlayerStatistics(this.model.guid, nodeId, callback);
 };
 
+Model.prototype.sendPlayEvents = function (payload, callback) {
+  this.storage.sendPlayEvents(this.model.guid, payload, callback);
+};
+
+Model.prototype.beaconPlayEvents = function (payload) {
+  return this.storage.beaconPlayEvents(this.model.guid, payload);
+};
+
 Model.prototype.newAdventure = function (callback) {
   this.storage.newAdventure(callback);
 };
@@ -47,6 +47,8 @@ function startPlayer(adventure) {
 
   app.viewer.setAdventureContent(adventure.props);
 
+  startPlaySession();
+
   var links = app.model.getLinksByNodeID(rootNode.node_id);
   app.viewer.setNodeContent(rootNode, links);
 
@@ -96,6 +98,7 @@ function didPressLink(nodeId, navigate) {
   var links = app.model.getLinksByNodeID(nodeId);
 
   if (!navigate) {
+    didChoosePlayLink(node.node_id);
     app.historyIndex++;
     app.visitedHistory = app.visitedHistory.slice(0, app.historyIndex);
     app.visitedHistory.push(node.node_id);
@@ -109,9 +112,79 @@ function getProgressionNodes() {
 }
 
 function didStatisticsNode(nodeId) {
+  // There is no server to report to in the offline player
+  if (standAlonePlayer) return;
   app.model.setPlayerStatistics(nodeId, () => true);
 }
 
+// A play session is anonymous, its id only tells the events of one play
+// apart from the others. The times of the events are counted from the start.
+function startPlaySession() {
+  if (!app.viewer.isRecordingStatistics) return;
+
+  var id;
+  if (window.crypto && crypto.randomUUID) {
+    id = crypto.randomUUID();
+  } else {
+    id = Date.now().toString(36) + Math.random().toString(36).slice(2) + Math.random().toString(36).slice(2);
+  }
+  app.playSession = { session_id: id, seq: 0, start: performance.now(), pending: [], sending: false };
+  recordPlayEvent({ type: "start" });
+
+  window.addEventListener("pagehide", () => flushPlayEvents(true));
+}
+
+function didPlayNode(node, links) {
+  recordPlayEvent({ type: "node", node_id: node.node_id });
+  // The end of the adventure is a node without links of its own
+  if (!links.some((x) => x.source == node.node_id)) {
+    recordPlayEvent({ type: "end" });
+  }
+}
+
+function didChoosePlayLink(nodeId) {
+  var linkId = app.viewer.linkIdsByTarget ? app.viewer.linkIdsByTarget[nodeId] : undefined;
+  if (linkId === undefined) return;
+  recordPlayEvent({ type: "choice", link_id: linkId });
+}
+
+function recordPlayEvent(event) {
+  var session = app.playSession;
+  if (!session || session.ended) return;
+
+  event.seq = ++session.seq;
+  event.t = Math.round(performance.now() - session.start);
+  session.pending.push(event);
+  if (event.type == "end") session.ended = true;
+  flushPlayEvents(false);
+}
+
+// Events are sent until the server has them, the server skips the ones it
+// already has
+function flushPlayEvents(leaving) {
+  var session = app.playSession;
+  if (!session || session.pending.length == 0) return;
+
+  var payload = { session_id: session.session_id, events: session.pending.slice() };
+  if (leaving) {
+    app.model.beaconPlayEvents(payload);
+    return;
+  }
+  if (session.sending) return;
+
+  session.sending = true;
+  app.model.sendPlayEvents(payload, (result) => {
+    session.sending = false;
+    if (result.status == 200 && result.response) {
+      session.pending = session.pending.filter((x) => x.seq > result.response.last_seq);
+      flushPlayEvents(false);
+    } else if (result.status >= 400 && result.status < 500) {
+      // The server will not take the events, stop recording
+      app.playSession = null;
+    }
+  });
+}
+
 function getNodeByID(nodeId) {
   return app.model.getNodeByID(nodeId);
 }
@@ -0,0 +1,135 @@
+// SCORM adapter of the offline player in a SCORM package. It reports the
+// adventure as completed to the LMS when an end node is reached, or when
+// scormSettings.completion_percent of the nodes have been visited.
+
+document.addEventListener("DOMContentLoaded", () => {
+  app.scorm = new ScormAdapter(scormSettings);
+  app.scorm.initialize();
+
+  // The viewer keeps track of the visited nodes, for conditions and statistics
+  app.viewer.didVisitNode = (node, links) => app.scorm.didVisitNode(node, links);
+
+  window.addEventListener("pagehide", () => app.scorm.terminate());
+  window.addEventListener("beforeunload", () => app.scorm.terminate());
+});
+
+const scormRuntimes = {
+  scorm12: {
+    api: "API",
+    initialize: "LMSInitialize",
+    terminate: "LMSFinish",
+    getValue: "LMSGetValue",
+    setValue: "LMSSetValue",
+    commit: "LMSCommit",
+    status: "cmi.core.lesson_status",
+    sessionTime: "cmi.core.session_time",
+  },
+  scorm2004: {
+    api: "API_1484_11",
+    initialize: "Initialize",
+    terminate: "Terminate",
+    getValue: "GetValue",
+    setValue: "SetValue",
+    commit: "Commit",
+    status: "cmi.completion_status",
+    sessionTime: "cmi.session_time",
+    progress: "cmi.progress_measure",
+  },
+};
+
+class ScormAdapter {
+  constructor(settings) {
+    this.settings = settings;
+    this.runtime = scormRuntimes[settings.version];
+    this.api = this.findAPI(this.runtime.api);
+    this.completed = false;
+    this.terminated = false;
+    this.startTime = new Date();
+  }
+
+  // The LMS API is an object of a parent frame, or of the window that opened us
+  findAPI(name) {
+    for (let win of [window, window.opener]) {
+      for (let i = 0; win && i < 10; i++) {
+        try {
+          if (win[name]) return win[name];
+        } catch (e) {
+          // A frame of another origin
+          break;
+        }
+        if (win.parent == win) break;
+        win = win.parent;
+      }
+    }
+    console.log("SCORM: no LMS API found, completion is not reported");
+    return null;
+  }
+
+  call(method, ...args) {
+    if (!this.api) return "";
+    return this.api[this.runtime[method]](...args);
+  }
+
+  initialize() {
+    if (!this.api) return;
+    if (String(this.call("initialize", "")) != "true") {
+      console.log("SCORM: the LMS could not be initialized");
+      this.api = null;
+      return;
+    }
+
+    this.completed = this.call("getValue", this.runtime.status) == "completed";
+    if (!this.completed) {
+      this.call("setValue", this.runtime.status, "incomplete");
+      this.call("commit", "");
+    }
+  }
+
+  didVisitNode(node, links) {
+    if (!this.api || this.completed) return;
+
+    const visited = Object.keys(app.viewer.visitedNodes).length;
+    const total = getProgressionNodes().length;
+    const percent = total > 0 ? (100.0 * visited) / total : 100.0;
+
+    if (this.runtime.progress) {
+      this.call("setValue", this.runtime.progress, Math.min(percent / 100.0, 1.0).toFixed(2));
+    }
+
+    const completionPercent = this.settings.completion_percent;
+    if (this.isEndNode(node, links) || (completionPercent > 0 && percent >= completionPercent)) {
+      this.completed = true;
+      this.call("setValue", this.runtime.status, "completed");
+    }
+    this.call("commit", "");
+  }
+
+  // An end node has no buttons to go on with, the same links the viewer shows
+  isEndNode(node, links) {
+    const chapterType = node.props.settings_chapterType[0];
+    if (chapterType == "random-node" || chapterType.startsWith("ref-node")) return false;
+
+    return !links.some(
+      (link) => link.source == node.node_id || (link.target == node.node_id && link.type == "bidirectional")
+    );
+  }
+
+  terminate() {
+    if (!this.api || this.terminated) return;
+    this.terminated = true;
+
+    this.call("setValue", this.runtime.sessionTime, this.sessionTime());
+    this.call("commit", "");
+    this.call("terminate", "");
+  }
+
+  // SCORM 1.2 wants HHHH:MM:SS, SCORM 2004 an ISO 8601 duration
+  sessionTime() {
+    const seconds = Math.round((new Date() - this.startTime) / 1000);
+    const h = Math.floor(seconds / 3600);
+    const m = Math.floor((seconds % 3600) / 60);
+    const s = seconds % 60;
+    if (this.settings.version == "scorm2004") return `PT${h}H${m}M${s}S`;
+    return [String(h).padStart(2, "0"), String(m).padStart(2, "0"), String(s).padStart(2, "0")].join(":");
+  }
+}
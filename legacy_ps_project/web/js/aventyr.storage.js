@@ -217,6 +217,25 @@ Storage.prototype.setPlayerStatistics = function (guid, nodeId, callback) {
   );
 };
 
+Storage.prototype.sendPlayEvents = function (guid, payload, callback) {
+  var url = "/play/" + guid + "/events";
+  this.restclient.post(
+    url,
+    payload,
+    function (result) {
+      callback(result);
+    },
+    false
+  );
+};
+
+// Sends the events when the page is closed, which a request can not do
+Storage.prototype.beaconPlayEvents = function (guid, payload) {
+  if (!navigator.sendBeacon) return false;
+  var url = this.restclient.baseURL + "/play/" + guid + "/events";
+  return navigator.sendBeacon(url, JSON.stringify(payload));
+};
+
 Storage.prototype.newAdventure = function (callback) {
   var url = "/newAdventure";
   this.restclient.get(
@@ -12,6 +12,7 @@ class Viewer {
     this.container = document.getElementById("player_container");
     this.contentBackground = document.getElementById("background");
     this.backgroundImage = document.getElementById("background_image");
+    this.backgroundSource = document.getElementById("background_source");
     this.video = document.getElementById("background_video");
     this.media_container = document.getElementById("media_container");
     this.player_navigation = document.getElementById("playerNavigation");
@@ -189,7 +190,7 @@ class Viewer {
   }
 
   formatUrl(url) {
-    if (!url || !standAlonePlayer) return url;
+    if (!url || !standAlonePlayer || !url.startsWith("/")) return url;
     return url.substring(1);
   }
 
@@ -305,6 +306,27 @@ class Viewer {
     this.props.manage({ ...node.props }, !this.menu_settings.high_contrast, new_image, this.isMobile);
   }
 
+  // Images with narrower variants are loaded by an img with their srcset, so
+  // that the browser picks the one that fits the screen, and then shown
+  setBackgroundImage(imageUrl, originalUrl) {
+    const srcset = typeof mediaSrcSets !== "undefined" && mediaSrcSets ? mediaSrcSets[originalUrl] : undefined;
+    if (!srcset || !this.backgroundSource) {
+      this.backgroundImage.style.backgroundImage = "url('" + imageUrl + "')";
+      return;
+    }
+
+    const source = this.backgroundSource;
+    source.dataset.url = imageUrl;
+    source.onload = () => {
+      if (source.dataset.url == imageUrl) this.backgroundImage.style.backgroundImage = "url('" + (source.currentSrc || imageUrl) + "')";
+    };
+    source.onerror = () => {
+      if (source.dataset.url == imageUrl) this.backgroundImage.style.backgroundImage = "url('" + imageUrl + "')";
+    };
+    source.srcset = srcset;
+    source.src = imageUrl;
+  }
+
   setVideo(imageUrl, node, chapterType)
   {
     const fileExtension = imageUrl.split(".").pop();
@@ -315,7 +337,7 @@ class Viewer {
       this.video.src = "";
       this.subtitles.src = "";
       track.mode = "hidden";
-      if (imageUrl != "") this.backgroundImage.style.backgroundImage = "url('" + imageUrl + "')";
+      if (imageUrl != "") this.setBackgroundImage(imageUrl, node.image_url);
       else this.backgroundImage.style.backgroundImage = "none";
 
       return;
@@ -334,7 +356,7 @@ class Viewer {
     this.videoAudioMuted = muted;
     if (node.props.subtitles_url) {
       // addendum to prevent cache issue in iOS
-      this.subtitles.src = node.props.subtitles_url + '?t=' + new Date().getTime();
+      this.subtitles.src = this.formatUrl(node.props.subtitles_url) + '?t=' + new Date().getTime();
       track.mode = "showing";
       track.oncuechange = () => {
         // again some workaround. vtt must have line defined. I am using the first to set the rest.
@@ -443,11 +465,17 @@ class Viewer {
     }
 
     this.visitedNodes[node.node_id] = true;
+    if (this.didVisitNode) {
+      this.didVisitNode(node, links);
+    }
 
     var statistics = node.props && this.props.getProp(node.props, "node_statistics") == "on";
     if (statistics && this.isRecordingStatistics) {
       didStatisticsNode(node.node_id);
     }
+    if (this.isRecordingStatistics) {
+      didPlayNode(node, links);
+    }
 
     if (nodeType.startsWith("ref-node")) {
       let target = "_self";
@@ -544,16 +572,19 @@ class Viewer {
     }
 
     this.targetNodeIds = [];
+    this.linkIdsByTarget = {};
 
     for (var link of ordered_links) {
       if (link.source == node.node_id) {
         this.targetNodeIds.push(link.target);
+        this.linkIdsByTarget[link.target] = link.link_id;
         if (skipCount-- > 0) continue;
         var showButton = !this.navigationShowLogic(link.props);
         this.addNavigation(link.target, link.target_title, showButton);
         navButtonCount++;
       } else if (link.type == "bidirectional") {
         this.targetNodeIds.push(link.source);
+        this.linkIdsByTarget[link.source] = link.link_id;
         if (skipCount-- > 0) continue;
         this.addNavigation(link.source, link.source_title);
         navButtonCount++;
@@ -3,7 +3,9 @@ function loadFileFonts(doc, fonts)
 {
     if (!fonts)
         fonts = [];
-    fonts = ["/static/img/ConduitMedium.woff2", "/static/img/ConduitLight.woff2", ...fonts];
+    // The offline player is opened from a folder, without the server root
+    var path = typeof standAlonePlayer != "undefined" && standAlonePlayer ? "static/img/" : "/static/img/";
+    fonts = [path + "ConduitMedium.woff2", path + "ConduitLight.woff2", ...fonts];
     
     const style = doc.createElement("style");
     var fontFamilies = "";
@@ -29,6 +29,9 @@
 
     var isFileUpload = payload instanceof FormData;
 
+    if (isFileUpload && secure) {
+      xhr.setRequestHeader("Authorization", this.token);
+    }
     if (!isFileUpload) {
       xhr.setRequestHeader("Content-Type", "application/json;charset=UTF-8");
       xhr.responseType = "json";